@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
+	"web-traffic-sim/dashboard"
+)
+
+// runAnalyze is the analyze subcommand: it loads what earlier runs left
+// behind - the events from -parquet-dir or -export-format parquet, the
+// time series from -series-csv - into an in-memory DuckDB and prints a few
+// canned analyses of them. DuckDB is embedded through its cgo bindings, so
+// it's only built in with -tags duckdb (analyze_duckdb.go); the simulator
+// itself builds without cgo. The files are only read.
+func runAnalyze(args []string) int {
+	fs := flag.NewFlagSet("analyze", flag.ExitOnError)
+	every := fs.Duration("every", time.Minute, "the period throughput and processing lag are summed up over")
+	top := fs.Int("top", 10, "how many of the busiest subreddits to list")
+	sqlOnly := fs.Bool("sql", false, "print the queries, as a script for the duckdb CLI, instead of running them")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s analyze [flags] FILE|DIR...\n\n", filepath.Base(os.Args[0]))
+		fmt.Fprintln(fs.Output(), "Parquet files are read as events and CSV files as -series-csv time series;")
+		fmt.Fprintln(fs.Output(), "directories are searched for both.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *every < time.Second || *top < 1 {
+		fmt.Println("Error: -every must be at least 1s and -top at least 1")
+		return 2
+	}
+	events, series, err := analyzeInputs(fs.Args())
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	if len(events) == 0 && len(series) == 0 {
+		fmt.Println("Error: no Parquet or series CSV files to analyze")
+		return 1
+	}
+
+	views, analyses := analyzeQueries(events, series, *every, *top)
+	if *sqlOnly {
+		for _, v := range views {
+			fmt.Println(v)
+		}
+		for _, a := range analyses {
+			fmt.Printf("\n-- %s\n%s\n", a.title, a.query)
+		}
+		return 0
+	}
+	if !slices.Contains(sql.Drivers(), "duckdb") {
+		fmt.Println("Error: this build has no DuckDB: rebuild with -tags duckdb (it needs cgo), or use -sql for the queries")
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	// An empty DSN is a database in memory
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	// The views only live as long as the connection they were made on
+	db.SetMaxOpenConns(1)
+	for _, v := range views {
+		if _, err := db.ExecContext(ctx, v); err != nil {
+			fmt.Printf("Error: load: %v\n", err)
+			return 1
+		}
+	}
+	for i, a := range analyses {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s%s%s\n", dashboard.Bold, a.title, dashboard.ColorReset)
+		if err := printQuery(ctx, db, a.query); err != nil {
+			fmt.Printf("Error: %s: %v\n", a.title, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// printQuery runs query and prints its rows as a table, the header first.
+func printQuery(ctx context.Context, db *sql.DB, query string) error {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, strings.Join(cols, "\t")+"\t")
+	values, ptrs := make([]any, len(cols)), make([]any, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+		cells := make([]string, len(values))
+		for i, v := range values {
+			cells[i] = formatCell(v)
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t")+"\t")
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+func formatCell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case time.Time:
+		return v.UTC().Format("2006-01-02 15:04:05")
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// analyzeInputs sorts the files named, and those in the directories named,
+// into event Parquet files and series CSVs. A CSV whose header isn't a
+// time series', like -report-csv's, is skipped, as are unfinished
+// .parquet.tmp files.
+func analyzeInputs(paths []string) (events, series []string, err error) {
+	add := func(path string, named bool) error {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".parquet":
+			events = append(events, path)
+		case ".csv":
+			ok, err := isSeriesCSV(path)
+			if err != nil {
+				return err
+			}
+			if ok {
+				series = append(series, path)
+			} else if named {
+				return fmt.Errorf("%s is not a -series-csv time series", path)
+			}
+		default:
+			if named {
+				return fmt.Errorf("%s is neither Parquet nor CSV", path)
+			}
+		}
+		return nil
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !info.IsDir() {
+			if err := add(path, true); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return err
+			}
+			return add(p, false)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	slices.Sort(events)
+	slices.Sort(series)
+	return slices.Compact(events), slices.Compact(series), nil
+}
+
+// isSeriesCSV reports whether path's header is the time series'.
+func isSeriesCSV(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	header, err := csv.NewReader(f).Read()
+	if err != nil {
+		return false, nil
+	}
+	return len(header) > 0 && header[0] == "elapsed_seconds", nil
+}
+
+// analysis is one of the canned queries, under the title it's printed with.
+type analysis struct {
+	title string
+	query string
+}
+
+// analyzeQueries returns the statements making the views - one over the
+// events and one over the series - and the analyses there are files for.
+func analyzeQueries(events, series []string, every time.Duration, top int) (views []string, analyses []analysis) {
+	secs := int(every / time.Second)
+	period := every.Truncate(time.Second).String()
+	if every%time.Minute == 0 {
+		period = fmt.Sprintf("%dm", every/time.Minute)
+	}
+
+	if len(events) > 0 {
+		// The mirror's and the export's files share a schema, but files
+		// from before -enrich lack the client columns
+		views = append(views, fmt.Sprintf("CREATE VIEW events AS SELECT * FROM read_parquet(%s, union_by_name = true);", sqlList(events)))
+		analyses = append(analyses,
+			analysis{fmt.Sprintf("📦 Events: %d Parquet file(s)", len(events)),
+				`SELECT count(*) AS events, count(DISTINCT "user") AS users, count(DISTINCT subreddit) AS subreddits, min(timestamp) AS first, max(timestamp) AS last FROM events;`},
+			// The first and last periods are usually partial
+			analysis{fmt.Sprintf("🚀 Throughput per %s, by event timestamp", period), fmt.Sprintf(`SELECT time_bucket(to_seconds(%d), timestamp) AS period,
+	count(*) AS events,
+	round(count(*) / %d, 1) AS per_second,
+	count(*) FILTER (WHERE type = 'post') AS posts,
+	count(*) FILTER (WHERE type = 'comment') AS comments,
+	count(*) FILTER (WHERE type IN ('upvote', 'downvote')) AS votes
+FROM events GROUP BY period ORDER BY period;`, secs, secs)},
+			analysis{"🔥 Busiest subreddits", fmt.Sprintf(`SELECT subreddit,
+	count(*) AS events,
+	count(DISTINCT "user") AS users,
+	round(100 * count(*) / sum(count(*)) OVER (), 1) AS share_pct
+FROM events GROUP BY subreddit ORDER BY events DESC, subreddit LIMIT %d;`, top)},
+		)
+	}
+
+	if len(series) > 0 {
+		// Several runs' series are told apart by their file
+		views = append(views, fmt.Sprintf("CREATE VIEW series AS SELECT *, parse_filename(filename) AS run FROM read_csv(%s, header = true, union_by_name = true, filename = true);", sqlList(series)))
+		run := ""
+		if len(series) > 1 {
+			run = "run, "
+		}
+		analyses = append(analyses,
+			analysis{fmt.Sprintf("⏱️  Latency distribution (ms) of the per-sample percentiles, %d series file(s)", len(series)), fmt.Sprintf(`SELECT %[1]sop,
+	count(*) AS samples,
+	round(min(ms), 2) AS min,
+	round(quantile_cont(ms, 0.5), 2) AS p50,
+	round(quantile_cont(ms, 0.9), 2) AS p90,
+	round(quantile_cont(ms, 0.99), 2) AS p99,
+	round(max(ms), 2) AS max
+FROM (UNPIVOT series ON write_p50_ms, write_p99_ms, read_p99_ms, update_p99_ms INTO NAME op VALUE ms)
+WHERE ms > 0
+GROUP BY %[1]sop ORDER BY %[1]slist_position(['write_p50_ms', 'write_p99_ms', 'read_p99_ms', 'update_p99_ms'], op);`, run)},
+			// Lag is how long the backlog would take to drain at the rate
+			// the processors were going - roughly how long an event stored
+			// then waited, with the oldest claimed first
+			analysis{fmt.Sprintf("🐢 Processing lag per %s of the run", period), fmt.Sprintf(`SELECT %[1]sCAST(floor(elapsed_seconds / %[2]d) * %[2]d AS INTEGER) AS from_second,
+	round(avg(events_per_sec)) AS events_per_sec,
+	round(avg(processed_per_sec)) AS processed_per_sec,
+	round(avg(backlog)) AS avg_backlog,
+	max(backlog) AS max_backlog,
+	round(max(backlog / nullif(processed_per_sec, 0)), 1) AS max_lag_seconds
+FROM series GROUP BY %[1]sfrom_second ORDER BY %[1]sfrom_second;`, run, secs)},
+		)
+	}
+	return views, analyses
+}
+
+// sqlList is paths as a DuckDB list of string literals.
+func sqlList(paths []string) string {
+	quoted := make([]string, len(paths))
+	for i, p := range paths {
+		quoted[i] = "'" + strings.ReplaceAll(p, "'", "''") + "'"
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
@@ -0,0 +1,7 @@
+//go:build duckdb
+
+package main
+
+// DuckDB for analyze, embedded. Its bindings link DuckDB's library in with
+// cgo, so they're left out of the default build.
+import _ "github.com/duckdb/duckdb-go/v2"
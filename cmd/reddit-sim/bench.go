@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"web-traffic-sim/dashboard"
+)
+
+// benchResult is one configuration's steady-state throughput.
+type benchResult struct {
+	workers         int
+	eventsPerSec    float64
+	writesPerSec    float64
+	processedPerSec float64
+	writeP99        float64 // ms, mean of the per-second p99s
+}
+
+// runBench is the bench subcommand: it runs the simulator once per pool
+// size, with that many writers and processors, and prints how throughput
+// scales. Every run is a fresh process, so one configuration's backlog,
+// connections and heap can't leak into the next one's numbers. Arguments
+// after -- are passed to every run.
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	counts := fs.String("counts", "1,2,4,8", "comma-separated writer/processor pool sizes to measure, in order")
+	run := fs.Duration("run", 20*time.Second, "how long each configuration runs")
+	warmup := fs.Duration("warmup", 5*time.Second, "how much of each run to discard before measuring")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s bench [flags] [-- simulator flags]\n", filepath.Base(os.Args[0]))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	var sizes []int
+	for _, s := range strings.Split(*counts, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || n < 1 {
+			fmt.Printf("Error: -counts: %q is not a positive pool size\n", s)
+			return 2
+		}
+		sizes = append(sizes, n)
+	}
+	if *warmup >= *run {
+		fmt.Println("Error: -warmup must be shorter than -run")
+		return 2
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	dir, err := os.MkdirTemp("", "redditsim-bench")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("📏 Scaling benchmark: %d configuration(s), %v each, first %v discarded\n", len(sizes), *run, *warmup)
+	var results []benchResult
+	for _, n := range sizes {
+		fmt.Printf("   %d writer(s) and %d processor(s)...\n", n, n)
+		args := append(append([]string(nil), fs.Args()...), "-writers", strconv.Itoa(n), "-processors", strconv.Itoa(n))
+		r, err := measureRun(ctx, exe, args, *run, *warmup, filepath.Join(dir, fmt.Sprintf("series-%d.csv", n)))
+		r.workers = n
+		if ctx.Err() != nil {
+			break
+		}
+		if err != nil {
+			fmt.Printf("Error: %d workers: %v\n", n, err)
+			return 1
+		}
+		results = append(results, r)
+	}
+	if len(results) > 0 {
+		printBench(results)
+	}
+	return 0
+}
+
+// measureRun runs the simulator with args for run, on emptied tables,
+// recording its time series to series, and averages the samples after
+// warmup. The flags it adds come after args, so they win.
+func measureRun(ctx context.Context, exe string, args []string, run, warmup time.Duration, series string) (benchResult, error) {
+	args = append(append([]string(nil), args...),
+		"-reset",
+		"-duration", run.String(),
+		"-series-csv", series,
+		"-series-interval", "1s",
+		"-tui=false",
+	)
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, exe, args...)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	// Interrupted runs shut down cleanly, like the simulator on Ctrl+C
+	cmd.Cancel = func() error { return cmd.Process.Signal(os.Interrupt) }
+	if err := cmd.Run(); err != nil {
+		// The simulator reports what went wrong on an "Error:" line
+		for _, line := range strings.Split(out.String(), "\n") {
+			if strings.HasPrefix(line, "Error:") {
+				return benchResult{}, errors.New(strings.TrimSpace(strings.TrimPrefix(line, "Error:")))
+			}
+		}
+		return benchResult{}, err
+	}
+
+	f, err := os.Open(series)
+	if err != nil {
+		return benchResult{}, err
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return benchResult{}, err
+	}
+	if len(rows) < 2 {
+		return benchResult{}, errors.New("the run recorded no samples")
+	}
+	col := map[string]int{}
+	for i, name := range rows[0] {
+		col[name] = i
+	}
+	value := func(row []string, name string) float64 {
+		f, _ := strconv.ParseFloat(row[col[name]], 64)
+		return f
+	}
+
+	// Elapsed counts from the simulator's startup, so the warmup also
+	// covers the pools starting up
+	var r benchResult
+	steady := 0
+	for _, row := range rows[1:] {
+		if value(row, "elapsed_seconds") < warmup.Seconds() {
+			continue
+		}
+		r.eventsPerSec += value(row, "events_per_sec")
+		r.writesPerSec += value(row, "writes_per_sec")
+		r.processedPerSec += value(row, "processed_per_sec")
+		r.writeP99 += value(row, "write_p99_ms")
+		steady++
+	}
+	if steady == 0 {
+		return benchResult{}, errors.New("no samples after the warmup")
+	}
+	r.eventsPerSec /= float64(steady)
+	r.writesPerSec /= float64(steady)
+	r.processedPerSec /= float64(steady)
+	r.writeP99 /= float64(steady)
+	return r, nil
+}
+
+// printBench prints the scaling table. Speedup is writes/second against the
+// first configuration, and efficiency is that speedup per extra worker: 100%
+// is perfectly linear scaling, and it falls off once the workers contend
+// for whatever they share - the database, its locks, or the event rate.
+func printBench(results []benchResult) {
+	base := results[0]
+	fmt.Printf("\n%s%-9s %10s %10s %12s %10s %8s %10s%s\n", dashboard.Bold,
+		"Workers", "Events/s", "Writes/s", "Processed/s", "Write p99", "Speedup", "Efficiency", dashboard.ColorReset)
+	for _, r := range results {
+		speedup := 0.0
+		if base.writesPerSec > 0 {
+			speedup = r.writesPerSec / base.writesPerSec
+		}
+		efficiency := speedup * float64(base.workers) / float64(r.workers) * 100
+		fmt.Printf("%-9d %10.0f %10.0f %12.0f %8.1fms %7.2fx %9.0f%%\n",
+			r.workers, r.eventsPerSec, r.writesPerSec, r.processedPerSec, r.writeP99, speedup, efficiency)
+	}
+	fmt.Println("\nWrites/s stops growing once the writers keep up with -rate; raise it to find the ceiling.")
+}
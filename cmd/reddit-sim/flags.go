@@ -0,0 +1,436 @@
+package main
+
+import (
+	"flag"
+	"maps"
+
+	"web-traffic-sim/config"
+)
+
+// parseFlags loads the simulation profile and then applies any flags that
+// were set explicitly on the command line, so flags always win.
+func parseFlags() (*config.Config, error) {
+	def := config.Default()
+	f := *def
+
+	path := flag.String("config", config.DefaultPath, "YAML simulation profile")
+	flag.StringVar(&f.Backend, "backend", def.Backend, "storage backend: postgres, sqlite, memory, nats (JetStream), redis (Streams) or rabbitmq")
+	flag.StringVar(&f.Sink, "sink", def.Sink, "where writers send events: store (the backend), kafka, or both")
+	flag.StringVar(&f.Kafka.Brokers, "kafka-brokers", def.Kafka.Brokers, "comma-separated Kafka bootstrap brokers for -sink kafka/both")
+	flag.StringVar(&f.Kafka.Topic, "kafka-topic", def.Kafka.Topic, "Kafka topic events are published to")
+	flag.StringVar(&f.NATS.URL, "nats-url", def.NATS.URL, "NATS server URL for the nats backend")
+	flag.StringVar(&f.NATS.Stream, "nats-stream", def.NATS.Stream, "JetStream stream the nats backend recreates at startup")
+	flag.StringVar(&f.NATS.Subject, "nats-subject", def.NATS.Subject, "subject prefix events are published under, one subject per event type")
+	flag.StringVar(&f.NATS.Consumer, "nats-consumer", def.NATS.Consumer, "durable pull consumer shared by the processors")
+	flag.StringVar(&f.Redis.Addr, "redis-addr", def.Redis.Addr, "Redis address for the redis backend")
+	flag.StringVar(&f.Redis.Stream, "redis-stream", def.Redis.Stream, "Redis stream key the redis backend recreates at startup")
+	flag.StringVar(&f.Redis.Group, "redis-group", def.Redis.Group, "consumer group shared by the processors")
+	flag.StringVar(&f.RabbitMQ.URL, "amqp-url", def.RabbitMQ.URL, "AMQP URL for the rabbitmq backend")
+	flag.StringVar(&f.RabbitMQ.Exchange, "amqp-exchange", def.RabbitMQ.Exchange, "topic exchange the rabbitmq backend publishes to")
+	flag.StringVar(&f.RabbitMQ.Queue, "amqp-queue", def.RabbitMQ.Queue, "queue the processors consume, recreated at startup")
+	flag.IntVar(&f.RabbitMQ.Prefetch, "amqp-prefetch", def.RabbitMQ.Prefetch, "max unacknowledged deliveries the broker pushes to the processors")
+	flag.StringVar(&f.DSN, "dsn", def.DSN, "PostgreSQL connection string; $DATABASE_URL, or the PG* variables, set the default")
+	flag.DurationVar(&f.ConnectTimeout, "connect-timeout", def.ConnectTimeout, "how long to keep retrying a backend that isn't reachable yet at startup (0 = fail at once)")
+	flag.StringVar(&f.Driver, "driver", def.Driver, "PostgreSQL driver: pq (lib/pq through database/sql) or pgx (native interface and batch API for inserts)")
+	flag.BoolVar(&f.Reset, "reset", def.Reset, "drop the postgres or sqlite tables and start from empty, instead of adding to what earlier runs left")
+	flag.BoolVar(&f.Resume, "resume", def.Resume, "carry on from the posts, comments and backlog already in the postgres or sqlite tables (false = generate as if they were empty)")
+	flag.BoolVar(&f.Prepare, "prepare", def.Prepare, "prepare the postgres insert, claim and update statements once per connection instead of parsing them on every query")
+	flag.IntVar(&f.Pool.MaxOpen, "db-max-open", def.Pool.MaxOpen, "max open PostgreSQL connections shared by every writer, processor and job (0 = unlimited)")
+	flag.IntVar(&f.Pool.MaxIdle, "db-max-idle", def.Pool.MaxIdle, "max idle PostgreSQL connections kept for reuse (0 = none)")
+	flag.DurationVar(&f.Pool.MaxLifetime, "db-max-lifetime", def.Pool.MaxLifetime, "recycle PostgreSQL connections after this long (0 = never)")
+	flag.StringVar(&f.Partition.By, "partition", def.Partition.By, "partition the postgres events table by created_at: hour or day (empty = one plain table)")
+	flag.IntVar(&f.Partition.Ahead, "partition-ahead", def.Partition.Ahead, "partitions kept created ahead of the current one")
+	flag.DurationVar(&f.Partition.Retain, "partition-retain", def.Partition.Retain, "drop partitions, and their events, this long after they end (0 = keep them all)")
+	flag.DurationVar(&f.Partition.Interval, "partition-interval", def.Partition.Interval, "how often the leader creates and drops partitions")
+	flag.DurationVar(&f.Retention.Age, "retention", def.Retention.Age, "remove processed events once they are this old (0 = keep them all; postgres and sqlite only)")
+	flag.DurationVar(&f.Retention.Interval, "retention-interval", def.Retention.Interval, "how often expired events are removed")
+	flag.IntVar(&f.Retention.Batch, "retention-batch", def.Retention.Batch, "expired events deleted per statement")
+	flag.StringVar(&f.Retention.Method, "retention-method", def.Retention.Method, "how expired events are removed: delete (in batches) or drop (whole partitions, needs -partition)")
+	flag.StringVar(&f.Retention.Archive, "archive", def.Retention.Archive, "directory or s3://bucket/prefix expired events are archived to as gzipped NDJSON before they are removed (empty = no archive)")
+	flag.StringVar(&f.Export.Dest, "export", def.Export.Dest, "directory or s3://bucket/prefix every processed event is exported to (empty = no export; postgres and sqlite only)")
+	flag.DurationVar(&f.Export.Interval, "export-interval", def.Export.Interval, "how often newly processed events are exported")
+	flag.IntVar(&f.Export.Batch, "export-batch", def.Export.Batch, "most events per export file")
+	flag.StringVar(&f.Export.Format, "export-format", def.Export.Format, "export file format: ndjson (gzipped) or parquet")
+	flag.StringVar(&f.Parquet.Dir, "parquet-dir", def.Parquet.Dir, "mirror every event the writers send into rolling Parquet files in this directory (empty = off)")
+	flag.TextVar(&f.Parquet.RotateSize, "parquet-rotate-size", def.Parquet.RotateSize, "start a new Parquet file once this much is written, e.g. 64MB (0 = no limit)")
+	flag.DurationVar(&f.Parquet.RotateEvery, "parquet-rotate-every", def.Parquet.RotateEvery, "start a new Parquet file after this long (0 = no limit)")
+	flag.StringVar(&f.ClickHouse.URL, "clickhouse-url", def.ClickHouse.URL, "also insert every stored event into ClickHouse over HTTP, e.g. http://localhost:8123 (empty = off)")
+	flag.StringVar(&f.ClickHouse.Database, "clickhouse-database", def.ClickHouse.Database, "ClickHouse database of the events table")
+	flag.StringVar(&f.ClickHouse.Table, "clickhouse-table", def.ClickHouse.Table, "ClickHouse table events are inserted into, created if missing")
+	flag.StringVar(&f.ClickHouse.User, "clickhouse-user", def.ClickHouse.User, "ClickHouse user")
+	flag.StringVar(&f.ClickHouse.Password, "clickhouse-password", def.ClickHouse.Password, "ClickHouse password")
+	flag.IntVar(&f.ClickHouse.BatchSize, "clickhouse-batch", def.ClickHouse.BatchSize, "events per ClickHouse insert")
+	flag.DurationVar(&f.ClickHouse.FlushInterval, "clickhouse-flush", def.ClickHouse.FlushInterval, "max time an event waits for a ClickHouse insert")
+	flag.IntVar(&f.ClickHouse.Buffer, "clickhouse-buffer", def.ClickHouse.Buffer, "events that may wait for ClickHouse before new ones are dropped")
+	flag.IntVar(&f.ClickHouse.Attempts, "clickhouse-attempts", def.ClickHouse.Attempts, "attempts per ClickHouse insert before its events are dropped")
+	flag.DurationVar(&f.ClickHouse.Timeout, "clickhouse-timeout", def.ClickHouse.Timeout, "how long each ClickHouse insert attempt may take")
+	flag.StringVar(&f.S3.Endpoint, "s3-endpoint", def.S3.Endpoint, "host[:port] of the S3-compatible API s3:// locations are on")
+	flag.StringVar(&f.S3.Region, "s3-region", def.S3.Region, "S3 region (empty = the bucket's own)")
+	flag.StringVar(&f.S3.AccessKey, "s3-access-key", def.S3.AccessKey, "S3 access key (empty = AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	flag.StringVar(&f.S3.SecretKey, "s3-secret-key", def.S3.SecretKey, "S3 secret key")
+	flag.BoolVar(&f.S3.Insecure, "s3-insecure", def.S3.Insecure, "talk plain HTTP to the S3 endpoint, e.g. a local MinIO")
+	flag.StringVar(&f.SQLitePath, "sqlite-path", def.SQLitePath, "database file for the sqlite backend")
+	flag.IntVar(&f.MemoryCapacity, "memory-capacity", def.MemoryCapacity, "ring buffer size for the memory backend")
+	flag.DurationVar(&f.Duration, "duration", def.Duration, "how long to run the simulation (0 = until interrupted)")
+	flag.StringVar(&f.Scenario, "scenario", def.Scenario, "YAML timeline of phases to run (rates, ramps, pool sizes, faults); sets the duration")
+	flag.StringVar(&f.Record, "record", def.Record, "write every generated event to this file (gzipped if it ends in .gz) for -replay")
+	flag.StringVar(&f.Replay.File, "replay", def.Replay.File, "send the events of a -record file instead of generating them; the run ends with the last one")
+	flag.Float64Var(&f.Replay.Speed, "replay-speed", def.Replay.Speed, "replay at this multiple of the recorded pace (0 = as fast as the pipeline takes them)")
+	flag.StringVar(&f.Dump.Files, "dump", def.Dump.Files, "comma-separated Reddit archive dumps (NDJSON, zstd/gzip/plain) to send at -rate instead of generating events")
+	flag.Float64Var(&f.Dump.Votes, "dump-votes", def.Dump.Votes, "votes to send after each dumped post or comment per point of its score")
+	flag.StringVar(&f.Mode, "mode", def.Mode, "pipeline: concurrent (goroutines), sequential (one loop), or compare (run both and report side by side)")
+	flag.IntVar(&f.Generator.Count, "generators", def.Generator.Count, "number of event generator goroutines")
+	flag.Float64Var(&f.Generator.Rate, "rate", def.Generator.Rate, "target events/second across all generators")
+	flag.StringVar(&f.Generator.Arrivals, "arrivals", def.Generator.Arrivals, "arrival process: poisson (random gaps) or fixed (evenly spaced)")
+	flag.IntVar(&f.Generator.Buffer, "buffer", def.Generator.Buffer, "event channel buffer size")
+	flag.StringVar(&f.Generator.Overflow, "overflow", def.Generator.Overflow, "when the event channel is full: block, drop-oldest or drop-newest")
+	flag.Float64Var(&f.RateLimit.PerUser, "user-rate", def.RateLimit.PerUser, "events/second each user may send, a token bucket (0 = unlimited)")
+	flag.IntVar(&f.RateLimit.UserBurst, "user-burst", def.RateLimit.UserBurst, "events a user may send at once before -user-rate applies")
+	flag.Float64Var(&f.RateLimit.PerIP, "ip-rate", def.RateLimit.PerIP, "events/second each IP address may send, a token bucket (0 = unlimited)")
+	flag.IntVar(&f.RateLimit.IPBurst, "ip-burst", def.RateLimit.IPBurst, "events an IP address may send at once before -ip-rate applies")
+	flag.IntVar(&f.RateLimit.IPs, "ips", def.RateLimit.IPs, "IP addresses the users are spread over, several to each")
+	flag.StringVar(&f.RateLimit.Action, "rate-limit-action", def.RateLimit.Action, "what happens to an event over a rate limit: reject (dropped) or delay (sent once there's a token)")
+	flag.IntVar(&f.Generator.Users, "users", def.Generator.Users, "number of simulated users")
+	flag.IntVar(&f.Generator.Subreddits, "subreddits", def.Generator.Subreddits, "number of simulated subreddits")
+	flag.StringVar(&f.Generator.SubredditFile, "subreddit-file", def.Generator.SubredditFile, "catalog of subreddit names with optional weights, one per line (replaces -subreddits)")
+	flag.Float64Var(&f.Generator.Skew, "skew", def.Generator.Skew, "Zipf exponent for user/subreddit activity, > 1 (0 = uniform)")
+	flag.Int64Var(&f.Generator.Seed, "seed", def.Generator.Seed, "random seed for a reproducible event stream (0 = random)")
+	flag.IntVar(&f.Writer.Count, "writers", def.Writer.Count, "number of database writer goroutines")
+	flag.IntVar(&f.Writer.BatchSize, "write-batch", def.Writer.BatchSize, "events per writer flush (1 = insert each event immediately)")
+	flag.DurationVar(&f.Writer.FlushInterval, "flush-interval", def.Writer.FlushInterval, "max time an event waits in a partial write batch")
+	flag.StringVar(&f.Writer.Stages, "stages", def.Writer.Stages, "comma-separated middleware every write batch passes through before it's stored, e.g. audit")
+	flag.StringVar(&f.Filter.Subreddits, "filter-subreddits", def.Filter.Subreddits, "comma-separated subreddits whose events are stored; the rest are left out (empty = all)")
+	flag.TextVar(&f.Filter.Sample, "sample", def.Filter.Sample, "fraction of events stored, overall and by type, e.g. 0.5 or upvote=0.1,downvote=0.1 (empty = all)")
+	flag.BoolVar(&f.Enrich.Enabled, "enrich", def.Enrich.Enabled, "fill in the country, device and app version every event was sent from before it's stored")
+	flag.TextVar(&f.Enrich.Countries, "enrich-countries", def.Enrich.Countries, "countries events are sent from and their weights, e.g. US=48,GB=8,DE=5")
+	flag.TextVar(&f.Enrich.Devices, "enrich-devices", def.Enrich.Devices, "devices events are sent from and their weights, e.g. android=38,ios=34,desktop=22")
+	flag.TextVar(&f.Enrich.AppVersions, "enrich-app-versions", def.Enrich.AppVersions, "app versions events are sent from and their weights, e.g. 2026.41.0=45,2026.40.1=30")
+	flag.IntVar(&f.Processor.Count, "processors", def.Processor.Count, "number of competing processor goroutines")
+	flag.StringVar(&f.Processor.Mode, "process-mode", def.Processor.Mode, "processor wake-up: poll, or notify (postgres LISTEN/NOTIFY)")
+	flag.DurationVar(&f.Processor.Interval, "process-interval", def.Processor.Interval, "time between processor batches (fallback poll in notify mode)")
+	flag.IntVar(&f.Processor.BatchSize, "batch-size", def.Processor.BatchSize, "max events claimed per processor batch")
+	flag.StringVar(&f.Processor.Claim, "claim", def.Processor.Claim, "which pending events a processor claims first: fifo (oldest), lifo (newest) or random")
+	flag.StringVar(&f.Processor.Stages, "process-stages", def.Processor.Stages, "comma-separated middleware every claimed batch is processed through, e.g. audit")
+	flag.DurationVar(&f.Processor.LagAlert, "lag-alert", def.Processor.LagAlert, "alert when the backlog has grown for this long without shrinking (0 = never)")
+	flag.Float64Var(&f.Reads.Ratio, "read-ratio", def.Reads.Ratio, "page loads (front page, comments, profile) per event written, from the materialized tables (postgres only; 0 = no reads)")
+	flag.IntVar(&f.Reads.Readers, "readers", def.Reads.Readers, "reader goroutines sharing the read load")
+	flag.StringVar(&f.Cache.Backend, "cache", def.Cache.Backend, "cache in front of the readers and /graphql: none, lru (in-process) or redis (postgres only)")
+	flag.IntVar(&f.Cache.Size, "cache-size", def.Cache.Size, "entries the lru cache holds before evicting the least recently used")
+	flag.DurationVar(&f.Cache.TTL, "cache-ttl", def.Cache.TTL, "how long a cached read is served before it's read again")
+	flag.StringVar(&f.Cache.Addr, "cache-addr", def.Cache.Addr, "Redis address for the redis cache")
+	flag.BoolVar(&f.Processor.Priority, "priority", def.Processor.Priority, "claim moderation, then posts and comments, then votes (-priority=false for -claim order alone)")
+	flag.DurationVar(&f.Visualizer.Refresh, "refresh", def.Visualizer.Refresh, "dashboard refresh interval")
+	flag.DurationVar(&f.Visualizer.RateWindow, "rate-window", def.Visualizer.RateWindow, "how far back the dashboard's current rates look")
+	flag.BoolVar(&f.Visualizer.TUI, "tui", def.Visualizer.TUI, "interactive dashboard with keyboard controls when stdout is a terminal (-tui=false for plain output)")
+	flag.StringVar(&f.Visualizer.Output, "output", def.Visualizer.Output, "what to write to stdout every refresh: dashboard, log (a line of figures, appended) or json (a metrics snapshot a line)")
+	flag.BoolVar(&f.Visualizer.NoColor, "no-color", def.Visualizer.NoColor, "leave out the ANSI colors (on if NO_COLOR is set)")
+	flag.BoolVar(&f.Visualizer.Headless, "headless", def.Visualizer.Headless, "run the pipeline without any dashboard, e.g. under systemd or in a container")
+	flag.BoolVar(&f.Visualizer.Summary, "summary", def.Visualizer.Summary, "print a summary of the run's figures when it ends")
+	flag.StringVar(&f.HTTP.Addr, "http", def.HTTP.Addr, "address for the HTTP server (web dashboard and /metrics), e.g. :9090 (empty = disabled)")
+	flag.IntVar(&f.HTTP.FirehoseBuffer, "firehose-buffer", def.HTTP.FirehoseBuffer, "events a firehose client may lag before it is disconnected")
+	flag.DurationVar(&f.HTTP.StallAfter, "stall-after", def.HTTP.StallAfter, "how long a worker with work to do may go without a heartbeat before /healthz fails")
+	flag.StringVar(&f.GRPC.Addr, "grpc-addr", def.GRPC.Addr, "address for the gRPC server (event stream and metrics), e.g. :9095 (empty = disabled)")
+	flag.StringVar(&f.HTTP.DebugAddr, "debug-addr", def.HTTP.DebugAddr, "address for net/http/pprof, e.g. localhost:6060 (empty = disabled)")
+	flag.IntVar(&f.DLQ.MaxRetries, "dlq-retries", def.DLQ.MaxRetries, "times an event that failed to store is retried before it is parked in the dead-letter queue")
+	flag.DurationVar(&f.DLQ.Backoff, "dlq-backoff", def.DLQ.Backoff, "delay before the first dead-letter retry, doubling after each failure")
+	flag.IntVar(&f.Retry.MaxAttempts, "retry-attempts", def.Retry.MaxAttempts, "attempts per store write or claim on transient errors (1 = no retries)")
+	flag.DurationVar(&f.Retry.BaseDelay, "retry-delay", def.Retry.BaseDelay, "delay before the first retry, doubling after each one")
+	flag.Float64Var(&f.Retry.Jitter, "retry-jitter", def.Retry.Jitter, "fraction (0-1) of each retry delay to randomize away")
+	flag.IntVar(&f.Breaker.Threshold, "breaker-threshold", def.Breaker.Threshold, "consecutive store failures that open the circuit breaker (0 = disabled)")
+	flag.DurationVar(&f.Breaker.Cooldown, "breaker-cooldown", def.Breaker.Cooldown, "how long the breaker stays open before probing the store again")
+	flag.BoolVar(&f.Chaos.Enabled, "chaos", def.Chaos.Enabled, "inject random failures: dropped connections, slow queries, slow consumers, generator stalls, lost acks")
+	flag.Float64Var(&f.Chaos.ConnDrop, "chaos-conn-drop", def.Chaos.ConnDrop, "probability a store call fails with a dropped connection")
+	flag.Float64Var(&f.Chaos.Latency, "chaos-latency", def.Chaos.Latency, "probability a store call is delayed by -chaos-latency-delay")
+	flag.DurationVar(&f.Chaos.LatencyDelay, "chaos-latency-delay", def.Chaos.LatencyDelay, "artificial query latency")
+	flag.Float64Var(&f.Chaos.SlowConsumer, "chaos-slow-consumer", def.Chaos.SlowConsumer, "probability a processor sits on its claimed batch for -chaos-slow-delay")
+	flag.DurationVar(&f.Chaos.SlowConsumerDelay, "chaos-slow-delay", def.Chaos.SlowConsumerDelay, "how long a slow consumer holds its batch")
+	flag.Float64Var(&f.Chaos.GeneratorStall, "chaos-stall", def.Chaos.GeneratorStall, "probability per second that the generators stall")
+	flag.DurationVar(&f.Chaos.StallDuration, "chaos-stall-duration", def.Chaos.StallDuration, "how long a generator stall lasts")
+	flag.Float64Var(&f.Chaos.LostAck, "chaos-lost-ack", def.Chaos.LostAck, "probability a successful write reports failure and is retried, delivering its events twice")
+	flag.DurationVar(&f.Karma.Interval, "karma-interval", def.Karma.Interval, "how often votes are aggregated into user karma (postgres only)")
+	flag.DurationVar(&f.Leaderboard.Interval, "leaderboard-interval", def.Leaderboard.Interval, "how often the leaderboards are recomputed (postgres only)")
+	flag.IntVar(&f.Leaderboard.Size, "leaderboard-size", def.Leaderboard.Size, "entries kept on each leaderboard")
+	flag.DurationVar(&f.Views.Interval, "views-interval", def.Views.Interval, "how often the analytics views are refreshed (postgres only)")
+	flag.IntVar(&f.Views.Size, "views-size", def.Views.Size, "rows read back from each analytics view")
+	flag.Func("schedule", "run a periodic job on a cron expression or interval instead of its own setting, as job=schedule, e.g. 'retention=0 3 * * *'; jobs are karma, leaderboards, ranking, scores, partitions, retention and views (repeatable)", func(v string) error {
+		schedules, err := config.ParseSchedules(v)
+		if err != nil {
+			return err
+		}
+		if f.Schedule == nil {
+			f.Schedule = make(map[string]config.Schedule)
+		}
+		maps.Copy(f.Schedule, schedules)
+		return nil
+	})
+	flag.DurationVar(&f.Ranking.Interval, "rank-interval", def.Ranking.Interval, "how often posts are rescored for the front page (postgres only)")
+	flag.StringVar(&f.Ranking.Sort, "front-page", def.Ranking.Sort, "front page order: hot, top or new")
+	flag.DurationVar(&f.Scores.Interval, "score-interval", def.Scores.Interval, "how often vote events are folded into post scores (postgres only)")
+	flag.IntVar(&f.Scores.Batch, "score-batch", def.Scores.Batch, "vote events folded per upsert statement")
+	flag.Float64Var(&f.Scores.Fuzz, "vote-fuzz", def.Scores.Fuzz, "vote fuzzing: up to this fraction of a post's votes is added to both its displayed ups and downs (0 = off)")
+	flag.StringVar(&f.Instance.Name, "instance", def.Instance.Name, "name this simulator registers under in the instances table (empty = host-pid)")
+	flag.BoolVar(&f.Instance.Join, "join", def.Instance.Join, "join the simulator already running on -dsn instead of migrating its tables (postgres only)")
+	flag.DurationVar(&f.Instance.Heartbeat, "heartbeat", def.Instance.Heartbeat, "how often this instance reports its throughput to its peers")
+	flag.BoolVar(&f.Outbox.Enabled, "outbox", def.Outbox.Enabled, "transactional outbox demo: processors write an activity row and an outbox entry per event, and a relay publishes the entries (postgres and sqlite only)")
+	flag.DurationVar(&f.Outbox.Interval, "outbox-interval", def.Outbox.Interval, "how often the relay publishes pending outbox entries")
+	flag.IntVar(&f.Outbox.Batch, "outbox-batch", def.Outbox.Batch, "outbox entries the relay publishes at a time")
+	flag.StringVar(&f.Outbox.Sink, "outbox-sink", def.Outbox.Sink, "where the relay publishes outbox entries: log or kafka (-kafka-brokers)")
+	flag.StringVar(&f.Outbox.Topic, "outbox-topic", def.Outbox.Topic, "Kafka topic for -outbox-sink kafka")
+	flag.StringVar(&f.Webhook.URL, "webhook-url", def.Webhook.URL, "POST every processed batch to this URL (empty = off)")
+	flag.StringVar(&f.Webhook.Secret, "webhook-secret", def.Webhook.Secret, "sign webhook bodies with HMAC-SHA256 of this secret, in X-Signature")
+	flag.StringVar(&f.Webhook.Body, "webhook-body", def.Webhook.Body, "what each webhook carries: summary (counts by type) or batch (the events)")
+	flag.IntVar(&f.Webhook.Attempts, "webhook-attempts", def.Webhook.Attempts, "attempts per webhook delivery before it is dropped")
+	flag.DurationVar(&f.Webhook.Timeout, "webhook-timeout", def.Webhook.Timeout, "how long each webhook attempt may take")
+	flag.StringVar(&f.Log.Level, "log-level", def.Log.Level, "log level: debug, info, warn or error")
+	flag.StringVar(&f.Log.Format, "log-format", def.Log.Format, "log format: text or json")
+	flag.StringVar(&f.Log.File, "log-file", def.Log.File, `log file ("-" = stderr, which interferes with the dashboard)`)
+	flag.StringVar(&f.Report.JSON, "report-json", def.Report.JSON, "write a JSON run report to this file at shutdown")
+	flag.StringVar(&f.Report.CSV, "report-csv", def.Report.CSV, "append a CSV row summarizing the run to this file at shutdown")
+	flag.DurationVar(&f.Series.Interval, "series-interval", def.Series.Interval, "how often metrics are sampled for -series-csv/-series-svg")
+	flag.StringVar(&f.Series.CSV, "series-csv", def.Series.CSV, "write the sampled metrics time series to this CSV file at exit")
+	flag.StringVar(&f.Series.SVG, "series-svg", def.Series.SVG, "render throughput, channel depth and latency charts to this SVG file at exit")
+	flag.StringVar(&f.Metrics.StatsD, "statsd", def.Metrics.StatsD, "push the metrics to this StatsD host:port over UDP")
+	flag.StringVar(&f.Metrics.Dump, "metrics-dump", def.Metrics.Dump, "rewrite this JSON file with every metric on each push")
+	flag.DurationVar(&f.Metrics.Interval, "metrics-interval", def.Metrics.Interval, "how often metrics are pushed to -statsd and -metrics-dump")
+	flag.StringVar(&f.Tracing.Endpoint, "otlp-endpoint", def.Tracing.Endpoint, "export event traces over OTLP/HTTP, e.g. http://localhost:4318 (empty = disabled)")
+	flag.Float64Var(&f.Tracing.SampleRatio, "trace-sample", def.Tracing.SampleRatio, "fraction of events to trace (0-1)")
+	flag.BoolVar(&f.Viral.Enabled, "viral", def.Viral.Enabled, "occasionally make a post go viral with a spike of votes and comments")
+	flag.DurationVar(&f.Viral.Interval, "viral-interval", def.Viral.Interval, "average time between viral spikes")
+	flag.DurationVar(&f.Viral.Duration, "viral-duration", def.Viral.Duration, "how long each viral spike lasts")
+	flag.IntVar(&f.Viral.Events, "viral-events", def.Viral.Events, "extra events per viral spike")
+	flag.StringVar(&f.Reddit.Subreddits, "reddit-subreddits", def.Reddit.Subreddits, "comma-separated subreddits to ingest real posts and comments from, alongside the generated ones (empty = off)")
+	flag.DurationVar(&f.Reddit.Interval, "reddit-interval", def.Reddit.Interval, "how often to poll each subreddit's listings")
+	flag.StringVar(&f.Reddit.URL, "reddit-url", def.Reddit.URL, "base URL of the Reddit JSON API")
+	flag.StringVar(&f.Reddit.UserAgent, "reddit-user-agent", def.Reddit.UserAgent, "User-Agent to send Reddit, which rejects generic ones")
+	flag.TextVar(&f.Content.TitleWords, "title-words", def.Content.TitleWords, "post title length in words: fixed:N, uniform:MIN-MAX or lognormal:MEDIAN,SIGMA[,MIN-MAX]")
+	flag.TextVar(&f.Content.CommentWords, "comment-words", def.Content.CommentWords, "comment body length in words, as for -title-words")
+	flag.TextVar(&f.Content.PayloadBytes, "payload-bytes", def.Content.PayloadBytes, "size every event payload in bytes instead, e.g. uniform:100-100KB or lognormal:2KB,1.5,100-100KB (empty = text lengths)")
+	flag.Float64Var(&f.Moderation.Reports, "mod-reports", def.Moderation.Reports, "fraction of user actions that report a post or comment (0 = no moderation)")
+	flag.DurationVar(&f.Moderation.Delay, "mod-delay", def.Moderation.Delay, "how long a report waits for a moderator")
+	flag.Float64Var(&f.Moderation.Remove, "mod-remove", def.Moderation.Remove, "probability a reported post or comment is removed rather than approved")
+	flag.Float64Var(&f.Moderation.Ban, "mod-ban", def.Moderation.Ban, "probability the author of a removed post or comment is banned")
+	flag.BoolVar(&f.Detect.Enabled, "detect", def.Detect.Enabled, "flag users with abnormal event rates or repeated content, into the flags table (postgres and sqlite)")
+	flag.DurationVar(&f.Detect.Window, "detect-window", def.Detect.Window, "sliding window the detector counts each user's events over")
+	flag.Float64Var(&f.Detect.Factor, "detect-factor", def.Detect.Factor, "flag a user sending this many times the median active user's events in the window")
+	flag.IntVar(&f.Detect.MinEvents, "detect-min", def.Detect.MinEvents, "events in the window below which no user is flagged for rate")
+	flag.IntVar(&f.Detect.Repeats, "detect-repeats", def.Detect.Repeats, "flag a user posting the same text this many times among their last 20 (0 = don't)")
+	flag.IntVar(&f.Actors.Count, "actors", def.Actors.Count, "simulate this many stateful users instead of stateless generators (0 = generators)")
+	flag.DurationVar(&f.Actors.Session, "actor-session", def.Actors.Session, "average length of a simulated user's session")
+	flag.DurationVar(&f.Actors.Idle, "actor-idle", def.Actors.Idle, "average time a simulated user stays offline between sessions")
+	flag.Parse()
+
+	set := map[string]bool{}
+	flag.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+
+	cfg, err := config.Load(*path, set["config"])
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := map[string]func(){
+		"backend":              func() { cfg.Backend = f.Backend },
+		"sink":                 func() { cfg.Sink = f.Sink },
+		"kafka-brokers":        func() { cfg.Kafka.Brokers = f.Kafka.Brokers },
+		"kafka-topic":          func() { cfg.Kafka.Topic = f.Kafka.Topic },
+		"nats-url":             func() { cfg.NATS.URL = f.NATS.URL },
+		"nats-stream":          func() { cfg.NATS.Stream = f.NATS.Stream },
+		"nats-subject":         func() { cfg.NATS.Subject = f.NATS.Subject },
+		"nats-consumer":        func() { cfg.NATS.Consumer = f.NATS.Consumer },
+		"redis-addr":           func() { cfg.Redis.Addr = f.Redis.Addr },
+		"redis-stream":         func() { cfg.Redis.Stream = f.Redis.Stream },
+		"redis-group":          func() { cfg.Redis.Group = f.Redis.Group },
+		"amqp-url":             func() { cfg.RabbitMQ.URL = f.RabbitMQ.URL },
+		"amqp-exchange":        func() { cfg.RabbitMQ.Exchange = f.RabbitMQ.Exchange },
+		"amqp-queue":           func() { cfg.RabbitMQ.Queue = f.RabbitMQ.Queue },
+		"amqp-prefetch":        func() { cfg.RabbitMQ.Prefetch = f.RabbitMQ.Prefetch },
+		"dsn":                  func() { cfg.DSN = f.DSN },
+		"connect-timeout":      func() { cfg.ConnectTimeout = f.ConnectTimeout },
+		"sqlite-path":          func() { cfg.SQLitePath = f.SQLitePath },
+		"memory-capacity":      func() { cfg.MemoryCapacity = f.MemoryCapacity },
+		"duration":             func() { cfg.Duration = f.Duration },
+		"scenario":             func() { cfg.Scenario = f.Scenario },
+		"record":               func() { cfg.Record = f.Record },
+		"replay":               func() { cfg.Replay.File = f.Replay.File },
+		"replay-speed":         func() { cfg.Replay.Speed = f.Replay.Speed },
+		"dump":                 func() { cfg.Dump.Files = f.Dump.Files },
+		"dump-votes":           func() { cfg.Dump.Votes = f.Dump.Votes },
+		"mode":                 func() { cfg.Mode = f.Mode },
+		"generators":           func() { cfg.Generator.Count = f.Generator.Count },
+		"rate":                 func() { cfg.Generator.Rate = f.Generator.Rate },
+		"arrivals":             func() { cfg.Generator.Arrivals = f.Generator.Arrivals },
+		"buffer":               func() { cfg.Generator.Buffer = f.Generator.Buffer },
+		"overflow":             func() { cfg.Generator.Overflow = f.Generator.Overflow },
+		"user-rate":            func() { cfg.RateLimit.PerUser = f.RateLimit.PerUser },
+		"user-burst":           func() { cfg.RateLimit.UserBurst = f.RateLimit.UserBurst },
+		"ip-rate":              func() { cfg.RateLimit.PerIP = f.RateLimit.PerIP },
+		"ip-burst":             func() { cfg.RateLimit.IPBurst = f.RateLimit.IPBurst },
+		"ips":                  func() { cfg.RateLimit.IPs = f.RateLimit.IPs },
+		"rate-limit-action":    func() { cfg.RateLimit.Action = f.RateLimit.Action },
+		"users":                func() { cfg.Generator.Users = f.Generator.Users },
+		"subreddits":           func() { cfg.Generator.Subreddits = f.Generator.Subreddits },
+		"subreddit-file":       func() { cfg.Generator.SubredditFile = f.Generator.SubredditFile },
+		"skew":                 func() { cfg.Generator.Skew = f.Generator.Skew },
+		"seed":                 func() { cfg.Generator.Seed = f.Generator.Seed },
+		"writers":              func() { cfg.Writer.Count = f.Writer.Count },
+		"write-batch":          func() { cfg.Writer.BatchSize = f.Writer.BatchSize },
+		"flush-interval":       func() { cfg.Writer.FlushInterval = f.Writer.FlushInterval },
+		"stages":               func() { cfg.Writer.Stages = f.Writer.Stages },
+		"filter-subreddits":    func() { cfg.Filter.Subreddits = f.Filter.Subreddits },
+		"sample":               func() { cfg.Filter.Sample = f.Filter.Sample },
+		"enrich":               func() { cfg.Enrich.Enabled = f.Enrich.Enabled },
+		"enrich-countries":     func() { cfg.Enrich.Countries = f.Enrich.Countries },
+		"enrich-devices":       func() { cfg.Enrich.Devices = f.Enrich.Devices },
+		"enrich-app-versions":  func() { cfg.Enrich.AppVersions = f.Enrich.AppVersions },
+		"processors":           func() { cfg.Processor.Count = f.Processor.Count },
+		"process-mode":         func() { cfg.Processor.Mode = f.Processor.Mode },
+		"process-interval":     func() { cfg.Processor.Interval = f.Processor.Interval },
+		"batch-size":           func() { cfg.Processor.BatchSize = f.Processor.BatchSize },
+		"priority":             func() { cfg.Processor.Priority = f.Processor.Priority },
+		"claim":                func() { cfg.Processor.Claim = f.Processor.Claim },
+		"lag-alert":            func() { cfg.Processor.LagAlert = f.Processor.LagAlert },
+		"process-stages":       func() { cfg.Processor.Stages = f.Processor.Stages },
+		"read-ratio":           func() { cfg.Reads.Ratio = f.Reads.Ratio },
+		"readers":              func() { cfg.Reads.Readers = f.Reads.Readers },
+		"cache":                func() { cfg.Cache.Backend = f.Cache.Backend },
+		"cache-size":           func() { cfg.Cache.Size = f.Cache.Size },
+		"cache-ttl":            func() { cfg.Cache.TTL = f.Cache.TTL },
+		"cache-addr":           func() { cfg.Cache.Addr = f.Cache.Addr },
+		"http":                 func() { cfg.HTTP.Addr = f.HTTP.Addr },
+		"firehose-buffer":      func() { cfg.HTTP.FirehoseBuffer = f.HTTP.FirehoseBuffer },
+		"stall-after":          func() { cfg.HTTP.StallAfter = f.HTTP.StallAfter },
+		"grpc-addr":            func() { cfg.GRPC.Addr = f.GRPC.Addr },
+		"debug-addr":           func() { cfg.HTTP.DebugAddr = f.HTTP.DebugAddr },
+		"dlq-retries":          func() { cfg.DLQ.MaxRetries = f.DLQ.MaxRetries },
+		"dlq-backoff":          func() { cfg.DLQ.Backoff = f.DLQ.Backoff },
+		"retry-attempts":       func() { cfg.Retry.MaxAttempts = f.Retry.MaxAttempts },
+		"retry-delay":          func() { cfg.Retry.BaseDelay = f.Retry.BaseDelay },
+		"retry-jitter":         func() { cfg.Retry.Jitter = f.Retry.Jitter },
+		"breaker-threshold":    func() { cfg.Breaker.Threshold = f.Breaker.Threshold },
+		"breaker-cooldown":     func() { cfg.Breaker.Cooldown = f.Breaker.Cooldown },
+		"chaos":                func() { cfg.Chaos.Enabled = f.Chaos.Enabled },
+		"chaos-conn-drop":      func() { cfg.Chaos.ConnDrop = f.Chaos.ConnDrop },
+		"chaos-latency":        func() { cfg.Chaos.Latency = f.Chaos.Latency },
+		"chaos-latency-delay":  func() { cfg.Chaos.LatencyDelay = f.Chaos.LatencyDelay },
+		"chaos-slow-consumer":  func() { cfg.Chaos.SlowConsumer = f.Chaos.SlowConsumer },
+		"chaos-slow-delay":     func() { cfg.Chaos.SlowConsumerDelay = f.Chaos.SlowConsumerDelay },
+		"chaos-stall":          func() { cfg.Chaos.GeneratorStall = f.Chaos.GeneratorStall },
+		"chaos-stall-duration": func() { cfg.Chaos.StallDuration = f.Chaos.StallDuration },
+		"chaos-lost-ack":       func() { cfg.Chaos.LostAck = f.Chaos.LostAck },
+		"karma-interval":       func() { cfg.Karma.Interval = f.Karma.Interval },
+		"leaderboard-interval": func() { cfg.Leaderboard.Interval = f.Leaderboard.Interval },
+		"leaderboard-size":     func() { cfg.Leaderboard.Size = f.Leaderboard.Size },
+		"views-interval":       func() { cfg.Views.Interval = f.Views.Interval },
+		"views-size":           func() { cfg.Views.Size = f.Views.Size },
+		"schedule": func() {
+			if cfg.Schedule == nil {
+				cfg.Schedule = make(map[string]config.Schedule)
+			}
+			maps.Copy(cfg.Schedule, f.Schedule)
+		},
+		"rank-interval":        func() { cfg.Ranking.Interval = f.Ranking.Interval },
+		"front-page":           func() { cfg.Ranking.Sort = f.Ranking.Sort },
+		"score-interval":       func() { cfg.Scores.Interval = f.Scores.Interval },
+		"score-batch":          func() { cfg.Scores.Batch = f.Scores.Batch },
+		"vote-fuzz":            func() { cfg.Scores.Fuzz = f.Scores.Fuzz },
+		"instance":             func() { cfg.Instance.Name = f.Instance.Name },
+		"join":                 func() { cfg.Instance.Join = f.Instance.Join },
+		"heartbeat":            func() { cfg.Instance.Heartbeat = f.Instance.Heartbeat },
+		"prepare":              func() { cfg.Prepare = f.Prepare },
+		"reset":                func() { cfg.Reset = f.Reset },
+		"resume":               func() { cfg.Resume = f.Resume },
+		"driver":               func() { cfg.Driver = f.Driver },
+		"partition":            func() { cfg.Partition.By = f.Partition.By },
+		"partition-ahead":      func() { cfg.Partition.Ahead = f.Partition.Ahead },
+		"partition-retain":     func() { cfg.Partition.Retain = f.Partition.Retain },
+		"partition-interval":   func() { cfg.Partition.Interval = f.Partition.Interval },
+		"retention":            func() { cfg.Retention.Age = f.Retention.Age },
+		"retention-interval":   func() { cfg.Retention.Interval = f.Retention.Interval },
+		"retention-batch":      func() { cfg.Retention.Batch = f.Retention.Batch },
+		"retention-method":     func() { cfg.Retention.Method = f.Retention.Method },
+		"archive":              func() { cfg.Retention.Archive = f.Retention.Archive },
+		"export":               func() { cfg.Export.Dest = f.Export.Dest },
+		"export-interval":      func() { cfg.Export.Interval = f.Export.Interval },
+		"export-batch":         func() { cfg.Export.Batch = f.Export.Batch },
+		"export-format":        func() { cfg.Export.Format = f.Export.Format },
+		"parquet-dir":          func() { cfg.Parquet.Dir = f.Parquet.Dir },
+		"parquet-rotate-size":  func() { cfg.Parquet.RotateSize = f.Parquet.RotateSize },
+		"parquet-rotate-every": func() { cfg.Parquet.RotateEvery = f.Parquet.RotateEvery },
+		"clickhouse-url":       func() { cfg.ClickHouse.URL = f.ClickHouse.URL },
+		"clickhouse-database":  func() { cfg.ClickHouse.Database = f.ClickHouse.Database },
+		"clickhouse-table":     func() { cfg.ClickHouse.Table = f.ClickHouse.Table },
+		"clickhouse-user":      func() { cfg.ClickHouse.User = f.ClickHouse.User },
+		"clickhouse-password":  func() { cfg.ClickHouse.Password = f.ClickHouse.Password },
+		"clickhouse-batch":     func() { cfg.ClickHouse.BatchSize = f.ClickHouse.BatchSize },
+		"clickhouse-flush":     func() { cfg.ClickHouse.FlushInterval = f.ClickHouse.FlushInterval },
+		"clickhouse-buffer":    func() { cfg.ClickHouse.Buffer = f.ClickHouse.Buffer },
+		"clickhouse-attempts":  func() { cfg.ClickHouse.Attempts = f.ClickHouse.Attempts },
+		"clickhouse-timeout":   func() { cfg.ClickHouse.Timeout = f.ClickHouse.Timeout },
+		"s3-endpoint":          func() { cfg.S3.Endpoint = f.S3.Endpoint },
+		"s3-region":            func() { cfg.S3.Region = f.S3.Region },
+		"s3-access-key":        func() { cfg.S3.AccessKey = f.S3.AccessKey },
+		"s3-secret-key":        func() { cfg.S3.SecretKey = f.S3.SecretKey },
+		"s3-insecure":          func() { cfg.S3.Insecure = f.S3.Insecure },
+		"db-max-open":          func() { cfg.Pool.MaxOpen = f.Pool.MaxOpen },
+		"db-max-idle":          func() { cfg.Pool.MaxIdle = f.Pool.MaxIdle },
+		"db-max-lifetime":      func() { cfg.Pool.MaxLifetime = f.Pool.MaxLifetime },
+		"outbox":               func() { cfg.Outbox.Enabled = f.Outbox.Enabled },
+		"outbox-interval":      func() { cfg.Outbox.Interval = f.Outbox.Interval },
+		"outbox-batch":         func() { cfg.Outbox.Batch = f.Outbox.Batch },
+		"outbox-sink":          func() { cfg.Outbox.Sink = f.Outbox.Sink },
+		"outbox-topic":         func() { cfg.Outbox.Topic = f.Outbox.Topic },
+		"webhook-url":          func() { cfg.Webhook.URL = f.Webhook.URL },
+		"webhook-secret":       func() { cfg.Webhook.Secret = f.Webhook.Secret },
+		"webhook-body":         func() { cfg.Webhook.Body = f.Webhook.Body },
+		"webhook-attempts":     func() { cfg.Webhook.Attempts = f.Webhook.Attempts },
+		"webhook-timeout":      func() { cfg.Webhook.Timeout = f.Webhook.Timeout },
+		"log-level":            func() { cfg.Log.Level = f.Log.Level },
+		"log-format":           func() { cfg.Log.Format = f.Log.Format },
+		"log-file":             func() { cfg.Log.File = f.Log.File },
+		"report-json":          func() { cfg.Report.JSON = f.Report.JSON },
+		"report-csv":           func() { cfg.Report.CSV = f.Report.CSV },
+		"series-interval":      func() { cfg.Series.Interval = f.Series.Interval },
+		"series-csv":           func() { cfg.Series.CSV = f.Series.CSV },
+		"series-svg":           func() { cfg.Series.SVG = f.Series.SVG },
+		"statsd":               func() { cfg.Metrics.StatsD = f.Metrics.StatsD },
+		"metrics-dump":         func() { cfg.Metrics.Dump = f.Metrics.Dump },
+		"metrics-interval":     func() { cfg.Metrics.Interval = f.Metrics.Interval },
+		"otlp-endpoint":        func() { cfg.Tracing.Endpoint = f.Tracing.Endpoint },
+		"trace-sample":         func() { cfg.Tracing.SampleRatio = f.Tracing.SampleRatio },
+		"viral":                func() { cfg.Viral.Enabled = f.Viral.Enabled },
+		"viral-interval":       func() { cfg.Viral.Interval = f.Viral.Interval },
+		"viral-duration":       func() { cfg.Viral.Duration = f.Viral.Duration },
+		"viral-events":         func() { cfg.Viral.Events = f.Viral.Events },
+		"reddit-subreddits":    func() { cfg.Reddit.Subreddits = f.Reddit.Subreddits },
+		"reddit-interval":      func() { cfg.Reddit.Interval = f.Reddit.Interval },
+		"reddit-url":           func() { cfg.Reddit.URL = f.Reddit.URL },
+		"reddit-user-agent":    func() { cfg.Reddit.UserAgent = f.Reddit.UserAgent },
+		"title-words":          func() { cfg.Content.TitleWords = f.Content.TitleWords },
+		"comment-words":        func() { cfg.Content.CommentWords = f.Content.CommentWords },
+		"payload-bytes":        func() { cfg.Content.PayloadBytes = f.Content.PayloadBytes },
+		"mod-reports":          func() { cfg.Moderation.Reports = f.Moderation.Reports },
+		"mod-delay":            func() { cfg.Moderation.Delay = f.Moderation.Delay },
+		"mod-remove":           func() { cfg.Moderation.Remove = f.Moderation.Remove },
+		"mod-ban":              func() { cfg.Moderation.Ban = f.Moderation.Ban },
+		"detect":               func() { cfg.Detect.Enabled = f.Detect.Enabled },
+		"detect-window":        func() { cfg.Detect.Window = f.Detect.Window },
+		"detect-factor":        func() { cfg.Detect.Factor = f.Detect.Factor },
+		"detect-min":           func() { cfg.Detect.MinEvents = f.Detect.MinEvents },
+		"detect-repeats":       func() { cfg.Detect.Repeats = f.Detect.Repeats },
+		"actors":               func() { cfg.Actors.Count = f.Actors.Count },
+		"actor-session":        func() { cfg.Actors.Session = f.Actors.Session },
+		"actor-idle":           func() { cfg.Actors.Idle = f.Actors.Idle },
+		"refresh":              func() { cfg.Visualizer.Refresh = f.Visualizer.Refresh },
+		"rate-window":          func() { cfg.Visualizer.RateWindow = f.Visualizer.RateWindow },
+		"tui":                  func() { cfg.Visualizer.TUI = f.Visualizer.TUI },
+		"output":               func() { cfg.Visualizer.Output = f.Visualizer.Output },
+		"no-color":             func() { cfg.Visualizer.NoColor = f.Visualizer.NoColor },
+		"headless":             func() { cfg.Visualizer.Headless = f.Visualizer.Headless },
+		"summary":              func() { cfg.Visualizer.Summary = f.Visualizer.Summary },
+	}
+	for name := range set {
+		if apply, ok := overrides[name]; ok {
+			apply()
+		}
+	}
+	return cfg, cfg.Validate()
+}
@@ -0,0 +1,62 @@
+// Command reddit-sim simulates Reddit's traffic against a store and shows
+// how the pipeline keeps up. Run it with -h for its flags.
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/dashboard"
+	"web-traffic-sim/simulator"
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "analyze" {
+		os.Exit(runAnalyze(os.Args[2:]))
+	}
+	// "record FILE" and "replay FILE" are -record FILE and -replay FILE;
+	// a replay runs until the recording ends unless told otherwise
+	if len(os.Args) > 1 && (os.Args[1] == "record" || os.Args[1] == "replay") {
+		args := []string{os.Args[0], "-" + os.Args[1]}
+		if os.Args[1] == "replay" && len(os.Args) > 2 {
+			args = append(args, os.Args[2], "-duration", "0")
+			os.Args = append(args, os.Args[3:]...)
+		} else {
+			os.Args = append(args, os.Args[2:]...)
+		}
+	}
+	cfg, err := parseFlags()
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(2)
+	}
+	if cfg.Mode == config.ModeCompare {
+		os.Exit(runCompare(cfg))
+	}
+
+	// Stop on Ctrl+C / SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Visualizer.NoColor || cfg.Visualizer.Output != config.OutputDashboard {
+		dashboard.DisableColors()
+	}
+	dash := dashboard.New(os.Stdout)
+	// With -output json stdout carries nothing but the snapshots, for
+	// whatever it's piped into; the rest of what's printed goes to stderr
+	if cfg.Visualizer.Output == config.OutputJSON {
+		os.Stdout = os.Stderr
+	}
+	sim := simulator.New(simulator.WithConfig(cfg), simulator.WithDashboard(dash))
+	if err := sim.Run(ctx); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
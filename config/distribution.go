@@ -0,0 +1,175 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Distribution kinds.
+const (
+	DistFixed     = "fixed"
+	DistUniform   = "uniform"
+	DistLogNormal = "lognormal"
+)
+
+// Distribution is a random size, written the same way in the config file,
+// environment and flags:
+//
+//	fixed:N                        always N
+//	uniform:MIN-MAX                anything from MIN to MAX, equally likely
+//	lognormal:MEDIAN,SIGMA[,MIN-MAX]
+//
+// Log-normal sizes cluster around MEDIAN with a long tail whose length
+// SIGMA sets, as the lengths of real text do; the optional range clamps
+// them. Sizes may carry a KB or MB suffix (powers of 1024), so byte sizes
+// read naturally: uniform:100-100KB.
+type Distribution struct {
+	Kind     string
+	Value    float64 // fixed size, or log-normal median
+	Sigma    float64
+	Min, Max float64 // 0 Max means unclamped
+}
+
+// ParseDistribution parses the text form of a Distribution. An empty
+// string is the zero Distribution, which means "unset" where that is
+// allowed.
+func ParseDistribution(s string) (Distribution, error) {
+	if s == "" {
+		return Distribution{}, nil
+	}
+	kind, args, _ := strings.Cut(s, ":")
+	d := Distribution{Kind: kind}
+	var err error
+	switch kind {
+	case DistFixed:
+		d.Value, err = parsePositive(args)
+	case DistUniform:
+		d.Min, d.Max, err = parseRange(args)
+	case DistLogNormal:
+		parts := strings.SplitN(args, ",", 3)
+		if len(parts) < 2 {
+			return d, fmt.Errorf("%q: want lognormal:MEDIAN,SIGMA[,MIN-MAX]", s)
+		}
+		if d.Value, err = parsePositive(parts[0]); err != nil {
+			break
+		}
+		if d.Sigma, err = strconv.ParseFloat(parts[1], 64); err != nil || d.Sigma < 0 {
+			return d, fmt.Errorf("%q: sigma must be a number of at least 0", s)
+		}
+		if len(parts) == 3 {
+			d.Min, d.Max, err = parseRange(parts[2])
+		}
+	default:
+		return d, fmt.Errorf("%q: distribution must be %s:N, %s:MIN-MAX or %s:MEDIAN,SIGMA[,MIN-MAX]", s, DistFixed, DistUniform, DistLogNormal)
+	}
+	if err != nil {
+		return d, fmt.Errorf("%q: %w", s, err)
+	}
+	return d, nil
+}
+
+// sizeSuffixes are the units a size may carry, longest first.
+var sizeSuffixes = []struct {
+	suffix string
+	scale  float64
+}{
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"B", 1},
+}
+
+func parsePositive(s string) (float64, error) {
+	scale := 1.0
+	num := strings.TrimSpace(s)
+	for _, u := range sizeSuffixes {
+		if rest, ok := strings.CutSuffix(strings.ToUpper(num), u.suffix); ok {
+			num, scale = num[:len(rest)], u.scale
+			break
+		}
+	}
+	v, err := strconv.ParseFloat(num, 64)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("%q is not a positive number", s)
+	}
+	return v * scale, nil
+}
+
+func parseRange(s string) (lo, hi float64, err error) {
+	a, b, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, errors.New("want a range MIN-MAX")
+	}
+	if lo, err = parsePositive(a); err != nil {
+		return 0, 0, err
+	}
+	if hi, err = parsePositive(b); err != nil {
+		return 0, 0, err
+	}
+	if lo > hi {
+		return 0, 0, fmt.Errorf("range %s is backwards", s)
+	}
+	return lo, hi, nil
+}
+
+func (d Distribution) String() string {
+	num := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	switch d.Kind {
+	case DistFixed:
+		return d.Kind + ":" + num(d.Value)
+	case DistUniform:
+		return d.Kind + ":" + num(d.Min) + "-" + num(d.Max)
+	case DistLogNormal:
+		s := d.Kind + ":" + num(d.Value) + "," + num(d.Sigma)
+		if d.Max > 0 {
+			s += "," + num(d.Min) + "-" + num(d.Max)
+		}
+		return s
+	}
+	return d.Kind
+}
+
+func (d Distribution) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Distribution) UnmarshalText(text []byte) error {
+	parsed, err := ParseDistribution(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// ByteSize is a size in bytes, written with the same suffixes as a
+// distribution's sizes: 64MB. Zero is allowed, for no limit.
+type ByteSize int64
+
+func (b ByteSize) String() string {
+	for _, u := range []struct {
+		suffix string
+		scale  ByteSize
+	}{{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}} {
+		if b >= u.scale && b%u.scale == 0 {
+			return strconv.FormatInt(int64(b/u.scale), 10) + u.suffix
+		}
+	}
+	return strconv.FormatInt(int64(b), 10)
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	if s := strings.TrimSpace(string(text)); s == "" || s == "0" {
+		*b = 0
+		return nil
+	}
+	v, err := parsePositive(string(text))
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(v)
+	return nil
+}
@@ -0,0 +1,123 @@
+package config
+
+import "testing"
+
+func TestParseDistribution(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Distribution
+		wantErr bool
+	}{
+		{in: "", want: Distribution{}},
+		{in: "fixed:12", want: Distribution{Kind: DistFixed, Value: 12}},
+		{in: "uniform:5-20", want: Distribution{Kind: DistUniform, Min: 5, Max: 20}},
+		{in: "uniform:7-7", want: Distribution{Kind: DistUniform, Min: 7, Max: 7}},
+		{in: "lognormal:8,0.5", want: Distribution{Kind: DistLogNormal, Value: 8, Sigma: 0.5}},
+		{in: "lognormal:40,0.8,5-300", want: Distribution{Kind: DistLogNormal, Value: 40, Sigma: 0.8, Min: 5, Max: 300}},
+		{in: "lognormal:8,0", want: Distribution{Kind: DistLogNormal, Value: 8}},
+		{in: "fixed", wantErr: true},
+		{in: "fixed:0", wantErr: true},
+		{in: "fixed:-3", wantErr: true},
+		{in: "uniform:20-5", wantErr: true},
+		{in: "uniform:5", wantErr: true},
+		{in: "lognormal:8", wantErr: true},
+		{in: "lognormal:8,-1", wantErr: true},
+		{in: "lognormal:8,x", wantErr: true},
+		{in: "lognormal:8,0.5,300-5", wantErr: true},
+		{in: "normal:8,1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDistribution(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseDistribution(%q) = %+v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDistribution(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDistribution(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+			// The text form parses back to the same distribution
+			if again, err := ParseDistribution(got.String()); err != nil || again != got {
+				t.Errorf("round trip of %q via %q = %+v, %v", tt.in, got.String(), again, err)
+			}
+		})
+	}
+}
+
+func TestParseSizes(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Distribution
+		wantErr bool
+	}{
+		{in: "fixed:512B", want: Distribution{Kind: DistFixed, Value: 512}},
+		{in: "fixed:4KB", want: Distribution{Kind: DistFixed, Value: 4 << 10}},
+		{in: "fixed:4kb", want: Distribution{Kind: DistFixed, Value: 4 << 10}},
+		{in: "fixed:1.5K", want: Distribution{Kind: DistFixed, Value: 1536}},
+		{in: "uniform:100-100KB", want: Distribution{Kind: DistUniform, Min: 100, Max: 100 << 10}},
+		{in: "lognormal:2KB,1,1KB-1MB", want: Distribution{Kind: DistLogNormal, Value: 2 << 10, Sigma: 1, Min: 1 << 10, Max: 1 << 20}},
+		{in: "uniform:1MB-1GB", want: Distribution{Kind: DistUniform, Min: 1 << 20, Max: 1 << 30}},
+		{in: "fixed:KB", wantErr: true},
+		{in: "fixed:4TB", wantErr: true},
+		{in: "uniform:2KB-1KB", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseDistribution(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseDistribution(%q) = %+v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseDistribution(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseDistribution(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    ByteSize
+		text    string
+		wantErr bool
+	}{
+		{in: "", want: 0, text: "0"},
+		{in: "0", want: 0, text: "0"},
+		{in: "1000", want: 1000, text: "1000"},
+		{in: "64MB", want: 64 << 20, text: "64MB"},
+		{in: " 2gb ", want: 2 << 30, text: "2GB"},
+		{in: "1536K", want: 1536 << 10, text: "1536KB"},
+		{in: "1.5MB", want: 1536 << 10, text: "1536KB"},
+		{in: "-1MB", wantErr: true},
+		{in: "lots", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			var b ByteSize
+			err := b.UnmarshalText([]byte(tt.in))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("UnmarshalText(%q) = %v, want an error", tt.in, b)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("UnmarshalText(%q): %v", tt.in, err)
+			}
+			if b != tt.want || b.String() != tt.text {
+				t.Errorf("UnmarshalText(%q) = %d (%s), want %d (%s)", tt.in, b, b, tt.want, tt.text)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"web-traffic-sim/event"
+)
+
+// Sampling is the fraction of events kept, by type, written the same way
+// in the config file, environment and flags: comma-separated TYPE=FRACTION
+// pairs, and optionally a bare FRACTION for the types not named.
+//
+//	0.5                      half of everything
+//	upvote=0.1,downvote=0.1  one vote in ten, and everything else
+//	0.2,report=1             a fifth of everything but reports
+//
+// The zero Sampling keeps everything.
+type Sampling map[string]float64
+
+// rest is the key of the fraction for the types not named.
+const rest = ""
+
+// ParseSampling parses the text form of a Sampling.
+func ParseSampling(s string) (Sampling, error) {
+	sampling := Sampling{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		typ, frac, named := strings.Cut(part, "=")
+		if !named {
+			typ, frac = rest, part
+		} else if _, err := event.ParseType(typ); err != nil {
+			return nil, fmt.Errorf("%q: %w", s, err)
+		}
+		if _, dup := sampling[typ]; dup {
+			return nil, fmt.Errorf("%q: %s given twice", s, part)
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(frac), 64)
+		if err != nil || f < 0 || f > 1 {
+			return nil, fmt.Errorf("%q: %s is not a fraction from 0 to 1", s, frac)
+		}
+		sampling[typ] = f
+	}
+	if len(sampling) == 0 {
+		return nil, nil
+	}
+	return sampling, nil
+}
+
+// Fraction returns the fraction of events of type typ kept.
+func (s Sampling) Fraction(typ string) float64 {
+	if f, ok := s[typ]; ok {
+		return f
+	}
+	if f, ok := s[rest]; ok {
+		return f
+	}
+	return 1
+}
+
+func (s Sampling) String() string {
+	var parts []string
+	if f, ok := s[rest]; ok {
+		parts = append(parts, strconv.FormatFloat(f, 'f', -1, 64))
+	}
+	for _, typ := range slices.Sorted(maps.Keys(s)) {
+		if typ != rest {
+			parts = append(parts, typ+"="+strconv.FormatFloat(s[typ], 'f', -1, 64))
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s Sampling) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Sampling) UnmarshalText(text []byte) error {
+	parsed, err := ParseSampling(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
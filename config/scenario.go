@@ -0,0 +1,127 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Faults a scenario phase can inject.
+const (
+	// FaultDBDown fails every store call as if the connection had dropped.
+	FaultDBDown = "db-down"
+)
+
+// Scenario is a timeline of phases, run one after another:
+//
+//	phases:
+//	  - name: warm-up
+//	    duration: 30s
+//	    rate: 100
+//	  - name: ramp
+//	    duration: 30s
+//	    ramp_to: 2000
+//	  - name: outage
+//	    duration: 30s
+//	    fault: db-down
+//
+// Settings carry over into the following phases until one changes them;
+// a fault lasts only for its own phase.
+type Scenario struct {
+	Phases []Phase `yaml:"phases" json:"phases"`
+}
+
+// Phase is one step of a Scenario. Unset fields leave the current setting
+// alone.
+type Phase struct {
+	Name     string        `yaml:"name" json:"name"`
+	Duration time.Duration `yaml:"duration" json:"duration"`
+	// Rate is set at the start of the phase; with RampTo the rate then
+	// moves linearly to RampTo over the phase.
+	Rate         *float64 `yaml:"rate" json:"rate,omitempty"`
+	RampTo       *float64 `yaml:"ramp_to" json:"ramp_to,omitempty"`
+	Paused       *bool    `yaml:"paused" json:"paused,omitempty"`
+	Writers      *int     `yaml:"writers" json:"writers,omitempty"`
+	WriteBatch   *int     `yaml:"write_batch" json:"write_batch,omitempty"`
+	Processors   *int     `yaml:"processors" json:"processors,omitempty"`
+	ProcessBatch *int     `yaml:"process_batch" json:"process_batch,omitempty"`
+	Fault        string   `yaml:"fault" json:"fault,omitempty"`
+}
+
+// LoadScenario reads and validates a scenario file.
+func LoadScenario(path string) (*Scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Scenario
+	if err := yaml.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if err := s.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Validate rejects timelines that can't be run.
+func (s *Scenario) Validate() error {
+	if len(s.Phases) == 0 {
+		return errors.New("scenario has no phases")
+	}
+	for i := range s.Phases {
+		p := &s.Phases[i]
+		if p.Name == "" {
+			p.Name = fmt.Sprintf("phase %d", i+1)
+		}
+		positive := func(field string, n *int) error {
+			if n != nil && *n < 1 {
+				return fmt.Errorf("%s: %s must be at least 1", p.Name, field)
+			}
+			return nil
+		}
+		switch {
+		case p.Duration <= 0:
+			return fmt.Errorf("%s: duration must be positive", p.Name)
+		case p.Rate != nil && *p.Rate < 1:
+			return fmt.Errorf("%s: rate must be at least 1", p.Name)
+		case p.RampTo != nil && *p.RampTo < 1:
+			return fmt.Errorf("%s: ramp_to must be at least 1", p.Name)
+		case p.Fault != "" && p.Fault != FaultDBDown:
+			return fmt.Errorf("%s: fault must be %q, got %q", p.Name, FaultDBDown, p.Fault)
+		}
+		for _, err := range []error{
+			positive("writers", p.Writers),
+			positive("write_batch", p.WriteBatch),
+			positive("processors", p.Processors),
+			positive("process_batch", p.ProcessBatch),
+		} {
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Duration is how long the whole timeline takes.
+func (s *Scenario) Duration() time.Duration {
+	var d time.Duration
+	for _, p := range s.Phases {
+		d += p.Duration
+	}
+	return d
+}
+
+// HasFault reports whether any phase injects fault.
+func (s *Scenario) HasFault(fault string) bool {
+	for _, p := range s.Phases {
+		if p.Fault == fault {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package config
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The periodic jobs, by the names Config.Schedule knows them by.
+const (
+	JobKarma        = "karma"
+	JobLeaderboards = "leaderboards"
+	JobRanking      = "ranking"
+	JobScores       = "scores"
+	JobPartitions   = "partitions"
+	JobRetention    = "retention"
+	JobViews        = "views"
+)
+
+var jobNames = []string{JobKarma, JobLeaderboards, JobRanking, JobScores, JobPartitions, JobRetention, JobViews}
+
+// Schedule is when a periodic job runs, written the same way in the config
+// file, environment and flags:
+//
+//	30s, @every 30s   every 30 seconds, counted from the end of the last run
+//	@hourly, @daily   at the top of every hour, every midnight (also @weekly)
+//	*/15 9-17 * * 1-5 a cron expression: minute, hour, day of month, month
+//	                  and day of week (0 or 7 is Sunday), in local time
+//
+// Cron fields take *, a number, a range a-b, and a step */n or a-b/n, or
+// a comma-separated list of them. As in cron, a day matches if either the
+// day of month or the day of week does, when both are restricted.
+type Schedule struct {
+	Every time.Duration
+	Cron  string
+	// Bitsets of the minutes, hours, days, months and weekdays that match
+	fields [5]uint64
+	// Whether the day of month and day of week were restricted
+	dom, dow bool
+}
+
+// cronFields are the cron fields' names and ranges.
+var cronFields = [5]struct {
+	name     string
+	min, max int
+}{{"minute", 0, 59}, {"hour", 0, 23}, {"day of month", 1, 31}, {"month", 1, 12}, {"day of week", 0, 7}}
+
+var cronMacros = map[string]string{
+	"@hourly":   "0 * * * *",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@weekly":   "0 0 * * 0",
+}
+
+// Every returns the schedule that runs every d.
+func Every(d time.Duration) Schedule { return Schedule{Every: d} }
+
+// ParseSchedule parses the text form of a Schedule.
+func ParseSchedule(s string) (Schedule, error) {
+	s = strings.TrimSpace(s)
+	if d, ok := strings.CutPrefix(s, "@every "); ok {
+		s = strings.TrimSpace(d)
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		if d <= 0 {
+			return Schedule{}, fmt.Errorf("%q: interval must be positive", s)
+		}
+		return Every(d), nil
+	}
+
+	sched := Schedule{Cron: s}
+	expr := s
+	if m, ok := cronMacros[s]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return Schedule{}, fmt.Errorf("%q: want an interval like 30s, @every 30s, @hourly, @daily, @weekly or five cron fields", s)
+	}
+	for i, part := range parts {
+		bits, err := parseCronField(part, cronFields[i].min, cronFields[i].max)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("%q: %s: %w", s, cronFields[i].name, err)
+		}
+		sched.fields[i] = bits
+	}
+	// Sunday is 0 or 7
+	if sched.fields[4]&(1<<7) != 0 {
+		sched.fields[4] |= 1
+	}
+	sched.dom, sched.dow = parts[2] != "*", parts[4] != "*"
+	return sched, nil
+}
+
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(field, ",") {
+		span, stepText, stepped := strings.Cut(item, "/")
+		step := 1
+		if stepped {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return 0, fmt.Errorf("bad step %q", stepText)
+			}
+		}
+		from, to := lo, hi
+		if span != "*" {
+			a, b, isRange := strings.Cut(span, "-")
+			var err error
+			if from, err = strconv.Atoi(a); err != nil {
+				return 0, fmt.Errorf("bad value %q", a)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(b); err != nil {
+					return 0, fmt.Errorf("bad value %q", b)
+				}
+			} else if stepped {
+				to = hi
+			}
+			if from < lo || to > hi || from > to {
+				return 0, fmt.Errorf("%q is outside %d-%d", span, lo, hi)
+			}
+		}
+		for v := from; v <= to; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// IsZero reports whether s is unset.
+func (s Schedule) IsZero() bool { return s.Every == 0 && s.Cron == "" }
+
+// Next returns when the schedule runs next after t, or the zero time if a
+// cron expression never matches (the 31st of February).
+func (s Schedule) Next(t time.Time) time.Time {
+	if s.Every > 0 {
+		return t.Add(s.Every)
+	}
+	if s.Cron == "" {
+		return time.Time{}
+	}
+	has := func(field, v int) bool { return s.fields[field]&(1<<v) != 0 }
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	// Skipping a month, day or hour at a time, any schedule that matches
+	// at all does within a few thousand steps.
+	for limit := t.AddDate(5, 0, 0); t.Before(limit); {
+		switch {
+		case !has(3, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !has(1, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !has(0, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (s Schedule) dayMatches(t time.Time) bool {
+	dom := s.fields[2]&(1<<t.Day()) != 0
+	dow := s.fields[4]&(1<<int(t.Weekday())) != 0
+	if s.dom && s.dow {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func (s Schedule) String() string {
+	if s.Cron != "" {
+		return s.Cron
+	}
+	return "@every " + s.Every.String()
+}
+
+func (s Schedule) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Schedule) UnmarshalText(text []byte) error {
+	parsed, err := ParseSchedule(string(text))
+	if err != nil {
+		return err
+	}
+	*s = parsed
+	return nil
+}
+
+// ParseSchedules parses job=schedule pairs separated by semicolons, as the
+// SIM_SCHEDULE variable takes them: "karma=10s;retention=0 3 * * *".
+func ParseSchedules(s string) (map[string]Schedule, error) {
+	out := make(map[string]Schedule)
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		name, spec, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q: want job=schedule", pair)
+		}
+		sched, err := ParseSchedule(spec)
+		if err != nil {
+			return nil, err
+		}
+		out[strings.TrimSpace(name)] = sched
+	}
+	return out, nil
+}
+
+// ScheduleFor returns when job runs: its entry in c.Schedule if it has
+// one, and otherwise every interval, the job's own setting.
+func (c *Config) ScheduleFor(job string, interval time.Duration) Schedule {
+	if s, ok := c.Schedule[job]; ok {
+		return s
+	}
+	return Every(interval)
+}
+
+func validateSchedules(schedules map[string]Schedule) error {
+	for name, s := range schedules {
+		if !slices.Contains(jobNames, name) {
+			return fmt.Errorf("schedule: unknown job %q (want one of %s)", name, strings.Join(jobNames, ", "))
+		}
+		if s.IsZero() {
+			return fmt.Errorf("schedule.%s: empty schedule", name)
+		}
+		if s.Cron != "" && s.Next(time.Now()).IsZero() {
+			return fmt.Errorf("schedule.%s: %q never runs", name, s.Cron)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tests := []struct {
+		in      string
+		every   time.Duration
+		cron    string
+		wantErr bool
+	}{
+		{in: "30s", every: 30 * time.Second},
+		{in: "@every 5m", every: 5 * time.Minute},
+		{in: "  @every  1h ", every: time.Hour},
+		{in: "@hourly", cron: "@hourly"},
+		{in: "*/15 9-17 * * 1-5", cron: "*/15 9-17 * * 1-5"},
+		{in: "0 3 1,15 * 7", cron: "0 3 1,15 * 7"},
+		{in: "0s", wantErr: true},
+		{in: "-1m", wantErr: true},
+		{in: "@yearly", wantErr: true},
+		{in: "* * * *", wantErr: true},
+		{in: "60 * * * *", wantErr: true},
+		{in: "* 5-3 * * *", wantErr: true},
+		{in: "*/0 * * * *", wantErr: true},
+		{in: "0 0 0 * *", wantErr: true},
+		{in: "a * * * *", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			s, err := ParseSchedule(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSchedule(%q) = %v, want an error", tt.in, s)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q): %v", tt.in, err)
+			}
+			if s.Every != tt.every || s.Cron != tt.cron {
+				t.Errorf("ParseSchedule(%q) = {%v %q}, want {%v %q}", tt.in, s.Every, s.Cron, tt.every, tt.cron)
+			}
+			// The text form parses back to the same schedule
+			again, err := ParseSchedule(s.String())
+			if err != nil || again.String() != s.String() {
+				t.Errorf("round trip of %q: %v, %v", s, again, err)
+			}
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// 2024-01-01 was a Monday
+	at := func(s string) time.Time {
+		t, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.UTC)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+	tests := []struct {
+		sched string
+		from  string
+		want  string // "" for never
+	}{
+		{"30s", "2024-01-01 10:00:10", "2024-01-01 10:00:40"},
+		{"@hourly", "2024-01-01 10:00:00", "2024-01-01 11:00:00"},
+		{"@hourly", "2024-01-01 10:59:59", "2024-01-01 11:00:00"},
+		{"@daily", "2024-01-01 10:00:00", "2024-01-02 00:00:00"},
+		{"@weekly", "2024-01-01 10:00:00", "2024-01-07 00:00:00"},
+		{"*/15 * * * *", "2024-01-01 10:07:30", "2024-01-01 10:15:00"},
+		{"*/15 9-17 * * 1-5", "2024-01-01 17:50:00", "2024-01-02 09:00:00"},
+		{"*/15 9-17 * * 1-5", "2024-01-05 17:46:00", "2024-01-08 09:00:00"},
+		{"0 3 * * *", "2024-01-31 04:00:00", "2024-02-01 03:00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"0 0 * * 7", "2024-01-01 00:00:00", "2024-01-07 00:00:00"},
+		// Either day field matches when both are restricted
+		{"0 0 15 * 1", "2024-01-02 00:00:00", "2024-01-08 00:00:00"},
+		{"0 0 15 * 1", "2024-01-09 00:00:00", "2024-01-15 00:00:00"},
+		{"0 0 31 2 *", "2024-01-01 00:00:00", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sched+" after "+tt.from, func(t *testing.T) {
+			s, err := ParseSchedule(tt.sched)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := s.Next(at(tt.from))
+			var want time.Time
+			if tt.want != "" {
+				want = at(tt.want)
+			}
+			if !got.Equal(want) {
+				t.Errorf("Next(%s) = %v, want %v", tt.from, got, want)
+			}
+		})
+	}
+}
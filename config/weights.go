@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Weights is a set of names, each picked in proportion to its weight,
+// written the same way in the config file, environment and flags:
+// comma-separated NAME=WEIGHT pairs, such as ios=35,android=45,desktop=20.
+// A name without a weight weighs 1.
+type Weights []Weight
+
+// Weight is one of a Weights' names and its weight.
+type Weight struct {
+	Name   string
+	Weight float64
+}
+
+// ParseWeights parses the text form of a Weights.
+func ParseWeights(s string) (Weights, error) {
+	var ws Weights
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, weight, weighted := strings.Cut(part, "=")
+		w := Weight{Name: strings.TrimSpace(name), Weight: 1}
+		if w.Name == "" {
+			return nil, fmt.Errorf("%q: %s has no name", s, part)
+		}
+		if seen[w.Name] {
+			return nil, fmt.Errorf("%q: %s given twice", s, w.Name)
+		}
+		seen[w.Name] = true
+		if weighted {
+			f, err := strconv.ParseFloat(strings.TrimSpace(weight), 64)
+			if err != nil || f <= 0 {
+				return nil, fmt.Errorf("%q: %s's weight must be a number above 0", s, w.Name)
+			}
+			w.Weight = f
+		}
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
+
+func (ws Weights) String() string {
+	parts := make([]string, len(ws))
+	for i, w := range ws {
+		parts[i] = w.Name + "=" + strconv.FormatFloat(w.Weight, 'f', -1, 64)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (ws Weights) MarshalText() ([]byte, error) {
+	return []byte(ws.String()), nil
+}
+
+func (ws *Weights) UnmarshalText(text []byte) error {
+	parsed, err := ParseWeights(string(text))
+	if err != nil {
+		return err
+	}
+	*ws = parsed
+	return nil
+}
@@ -0,0 +1,1008 @@
+// Package dashboard shows a simulator run as it goes: redrawn in the
+// terminal or as a TUI, as lines of figures for logs and pipes, or in the
+// browser from the HTTP server.
+package dashboard
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/term"
+	"github.com/muesli/termenv"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/simulator"
+	"web-traffic-sim/store"
+)
+
+// Dashboard panels. The TUI shows one at a time, switched with tab or the
+// number keys; panelAll stacks every section and is all the plain
+// dashboard ever shows.
+const (
+	panelAll = iota
+	panelPipeline
+	panelReddit
+	panelSystem
+	numPanels
+)
+
+var panelNames = [numPanels]string{"All", "Pipeline", "Reddit", "System"}
+
+// plainWidth is the terminal width the dashboards assume when they can't
+// tell.
+const plainWidth = 80
+
+// terminalWidth is stdout's width in columns, else $COLUMNS, else
+// plainWidth. The plain dashboard asks every frame, so it follows a resize.
+func terminalWidth() int {
+	if w, _, err := term.GetSize(os.Stdout.Fd()); err == nil && w > 0 {
+		return w
+	}
+	if w, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && w > 0 {
+		return w
+	}
+	return plainWidth
+}
+
+// View is the dashboard a run shows: in the terminal, the TUI or
+// the plain one, or else lines of figures for -output log and json, as
+// cfg.Visualizer says; and the web one on the HTTP server.
+type View struct {
+	stdout io.Writer // for the log and JSON lines
+}
+
+func New(stdout io.Writer) *View {
+	return &View{stdout: stdout}
+}
+
+func (v *View) Show(ctx context.Context, cfg *config.Config, metrics *simulator.RedditMetrics, ctl *simulator.Controls, stop func()) {
+	switch {
+	case cfg.Visualizer.Output == config.OutputLog:
+		logMetrics(ctx, cfg, metrics, v.stdout)
+	case cfg.Visualizer.Output == config.OutputJSON:
+		jsonMetrics(ctx, cfg, metrics, v.stdout)
+	case cfg.Visualizer.TUI && isTerminal():
+		if err := runTUI(ctx, cfg, metrics, ctl, stop); err != nil {
+			slog.Error("run dashboard", "err", err)
+		}
+	default:
+		visualizeMetrics(ctx, cfg, metrics)
+	}
+}
+
+func (v *View) Register(ctx context.Context, mux *http.ServeMux, cfg *config.Config, metrics *simulator.RedditMetrics) {
+	registerWebDashboard(ctx, mux, cfg, metrics)
+}
+
+// visualizeMetrics redraws the dashboard every refresh by clearing the
+// screen, for when stdout isn't a terminal the TUI can take over (or -tui
+// is off).
+func visualizeMetrics(ctx context.Context, cfg *config.Config, metrics *simulator.RedditMetrics) {
+	ticker := time.NewTicker(cfg.Visualizer.Refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// Build the frame first and write it in one go, so the screen
+			// is never left half-drawn
+			w := bufio.NewWriter(os.Stdout)
+			fmt.Fprint(w, "\033[H\033[2J")
+			fmt.Fprintf(w, "%s%s🚀 Go Concurrency Demo - Real-time Event Processing%s\n", Bold, ColorCyan, ColorReset)
+			width := terminalWidth()
+			fmt.Fprintln(w, strings.Repeat("=", min(width, 70)))
+			renderDashboard(w, cfg, metrics.Snapshot(), panelAll, width)
+			w.Flush()
+		}
+	}
+}
+
+// logMetrics appends a line of the main figures to w every refresh, for
+// -output log: CI logs and the like, where clearing the screen only
+// leaves escape codes behind.
+func logMetrics(ctx context.Context, cfg *config.Config, metrics *simulator.RedditMetrics, w io.Writer) {
+	ticker := time.NewTicker(cfg.Visualizer.Refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			snap := metrics.Snapshot()
+			r := snap.Rates
+			line := fmt.Sprintf("%s events=%d/s (%d since start) writes=%d/s reads=%d/s updates=%d/s channel=%d/%d backlog=%d dropped=%d write_p99=%v",
+				now.Format(time.RFC3339), int(r.EventsPerSec), int(snap.EventsPerSec), int(r.WritesPerSec), int(r.ReadsPerSec), int(r.UpdatesPerSec),
+				snap.ChannelDepth, cfg.Generator.Buffer, snap.Backlog, snap.Dropped, simulator.RoundLatency(snap.Latency[simulator.OpWrite].P99))
+			if snap.Lag.Alert {
+				line += " LAG"
+			}
+			if snap.Paused {
+				line += " PAUSED"
+			}
+			fmt.Fprintln(w, line)
+		}
+	}
+}
+
+// jsonMetrics writes a metrics snapshot to w as a line of JSON every
+// refresh, for -output json, to pipe into jq or anything else that reads
+// JSON lines. The line is the same snapshot the web dashboard gets.
+func jsonMetrics(ctx context.Context, cfg *config.Config, metrics *simulator.RedditMetrics, w io.Writer) {
+	ticker := time.NewTicker(cfg.Visualizer.Refresh)
+	defer ticker.Stop()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := enc.Encode(struct {
+				Time    time.Time          `json:"time"`
+				Metrics simulator.Snapshot `json:"metrics"`
+			}{now, metrics.Snapshot()}); err != nil {
+				slog.Warn("write metrics", "err", err)
+				return
+			}
+		}
+	}
+}
+
+// ANSI colors and styles, emptied by disableColors
+var (
+	ColorGreen   = "\033[92m"
+	ColorYellow  = "\033[93m"
+	ColorRed     = "\033[91m"
+	ColorBlue    = "\033[94m"
+	ColorMagenta = "\033[95m"
+	ColorCyan    = "\033[96m"
+	ColorReset   = "\033[0m"
+	Bold         = "\033[1m"
+)
+
+// DisableColors leaves the ANSI colors out of everything printed from
+// here on, the TUI's included, for -no-color, NO_COLOR and the outputs
+// meant for logs and pipes.
+func DisableColors() {
+	ColorGreen, ColorYellow, ColorRed, ColorBlue, ColorMagenta, ColorCyan, ColorReset, Bold = "", "", "", "", "", "", "", ""
+	lipgloss.SetColorProfile(termenv.Ascii)
+}
+
+// dashboard renders the sections of one dashboard frame to w.
+type dashboard struct {
+	w     io.Writer
+	cfg   *config.Config
+	snap  simulator.Snapshot
+	width int
+}
+
+// renderDashboard writes panel for snap to w, sized for a terminal width
+// columns wide.
+func renderDashboard(w io.Writer, cfg *config.Config, snap simulator.Snapshot, panel, width int) {
+	d := dashboard{w: w, cfg: cfg, snap: snap, width: width}
+	switch panel {
+	case panelAll:
+		d.status()
+		d.activity()
+		d.workers()
+		d.reddit()
+		d.system()
+		d.totals()
+		d.howItWorks()
+	case panelPipeline:
+		d.status()
+		d.activity()
+		d.workers()
+		d.totals()
+	case panelReddit:
+		if !d.reddit() {
+			fmt.Fprintf(w, "\n%sNo Reddit data yet: the domain tables, karma and front page need -backend postgres.%s\n", ColorYellow, ColorReset)
+		}
+	case panelSystem:
+		d.system()
+	}
+}
+
+func (d dashboard) status() {
+	snap, cfg := d.snap, d.cfg
+	paused := ""
+	if snap.Paused {
+		paused = fmt.Sprintf("  %s%s⏸ paused%s", Bold, ColorYellow, ColorReset)
+	}
+	if l := snap.Lag; l.Alert {
+		fmt.Fprintf(d.w, "\n%s%s⚠️  CONSUMER LAG: the backlog has grown from %d to %d events over %v without shrinking%s\n",
+			Bold, ColorRed, l.From, snap.Backlog, l.Growing.Round(time.Second), ColorReset)
+		fmt.Fprintf(d.w, "%s   Processors are falling behind: add -processors, raise the batch size, or slow the generators%s\n", ColorRed, ColorReset)
+	}
+	fmt.Fprintf(d.w, "\n%s💻 System Status:%s\n", Bold, ColorReset)
+	// Current rates, over the last -rate-window, with the run's so far
+	rates := snap.Rates
+	if cfg.Mode == config.ModeSequential {
+		fmt.Fprintf(d.w, "• Sequential Loop    : %sGenerating %d events/second (%d since start, target %g), then writing and processing them, one thing at a time%s%s\n",
+			ColorYellow, int(rates.EventsPerSec), int(snap.EventsPerSec), snap.TargetRate, ColorReset, paused)
+	} else if snap.Actors > 0 {
+		fmt.Fprintf(d.w, "• Simulated Users    : %sGenerating %d events/second (%d since start, target %g) from %d of %d user(s) online%s%s\n",
+			ColorGreen, int(rates.EventsPerSec), int(snap.EventsPerSec), snap.TargetRate, snap.ActiveUsers, snap.Actors, ColorReset, paused)
+	} else {
+		fmt.Fprintf(d.w, "• Event Generators   : %sGenerating %d events/second (%d since start, target %g) across %d generator(s)%s%s\n",
+			ColorGreen, int(rates.EventsPerSec), int(snap.EventsPerSec), snap.TargetRate, len(snap.Generators), ColorReset, paused)
+	}
+	fmt.Fprintf(d.w, "• Database Writers   : %sWriting %d records/second (%d since start) across %d writer(s)%s\n",
+		ColorBlue, int(rates.WritesPerSec), int(snap.WritesPerSec), len(snap.Writers), ColorReset)
+	fmt.Fprintf(d.w, "• Event Processors   : %sProcessing %d records/second (%d since start) across %d processor(s)%s\n",
+		ColorMagenta, int(rates.ProcessedPerSec), int(snap.ProcessedPerSec), len(snap.Processors), ColorReset)
+	// Compare the write, read and update latencies with and without
+	if cfg.Backend == config.BackendPostgres {
+		if cfg.Driver == config.DriverPGX {
+			fmt.Fprintf(d.w, "• Driver             : %spgx%s, inserting natively in pipelined batches over the binary protocol (-driver pq to compare)\n", ColorCyan, ColorReset)
+		} else {
+			fmt.Fprintf(d.w, "• Driver             : %slib/pq%s through database/sql (-driver pgx to compare)\n", ColorCyan, ColorReset)
+		}
+		if cfg.Prepare {
+			fmt.Fprintf(d.w, "• Statements         : %sprepared%s once per connection for inserts, claims and updates\n", ColorCyan, ColorReset)
+		} else {
+			fmt.Fprintf(d.w, "• Statements         : %sparsed and planned on every query%s (-prepare to prepare them)\n", ColorYellow, ColorReset)
+		}
+	}
+	if sc := snap.Scenario; sc.Total > 0 {
+		switch {
+		case sc.Current > 0:
+			p := sc.Phases[len(sc.Phases)-1]
+			fault := ""
+			if p.Fault != "" {
+				fault = fmt.Sprintf("  %s%s💀 %s%s", Bold, ColorRed, p.Fault, ColorReset)
+			}
+			fmt.Fprintf(d.w, "• Scenario           : %sphase %d/%d %q%s, %v left (started at %.0fs)%s\n",
+				ColorCyan, sc.Current, sc.Total, p.Name, ColorReset, sc.Remaining.Round(time.Second), p.Start, fault)
+		case len(sc.Phases) == sc.Total:
+			fmt.Fprintf(d.w, "• Scenario           : %sall %d phases done%s\n", ColorGreen, sc.Total, ColorReset)
+		default:
+			fmt.Fprintf(d.w, "• Scenario           : %sstarting...%s\n", ColorYellow, ColorReset)
+		}
+	}
+	if cfg.Breaker.Threshold > 0 && cfg.Sink != config.SinkKafka {
+		color := ColorGreen
+		switch snap.Breaker.State {
+		case simulator.BreakerHalfOpen.String():
+			color = ColorYellow
+		case simulator.BreakerOpen.String():
+			color = Bold + ColorRed
+		}
+		fmt.Fprintf(d.w, "• Circuit Breaker    : %s%s%s (tripped %d times; writes go to the dead-letter queue while open)\n",
+			color, strings.ToUpper(snap.Breaker.State), ColorReset, snap.Breaker.Trips)
+	}
+	if cfg.Backend == config.BackendRabbitMQ || cfg.Backend == config.BackendNATS {
+		fmt.Fprintf(d.w, "• Broker Queue       : %s%d messages waiting%s for a processor\n", ColorYellow, snap.QueueDepth, ColorReset)
+	}
+	if cfg.Sink != config.SinkStore {
+		k := snap.Kafka
+		fmt.Fprintf(d.w, "• Kafka Sink         : %s%d events acknowledged%s on %q, %s%d failed%s, %v average ack\n",
+			ColorCyan, k.Delivered, ColorReset, cfg.Kafka.Topic, ColorRed, k.Failed, ColorReset, simulator.RoundLatency(k.AvgAck))
+	}
+	if cfg.Outbox.Enabled {
+		o := snap.Outbox
+		fmt.Fprintf(d.w, "• Outbox Relay       : %s%d entries published%s to %s, %s%d pending%s, %d failed publishes, %v average lag\n",
+			ColorCyan, o.Published, ColorReset, cfg.Outbox.Sink, ColorYellow, o.Pending, ColorReset, o.Failed, simulator.RoundLatency(o.MeanLag))
+	}
+	if l := snap.Leader; l.Elected {
+		if l.Leading {
+			fmt.Fprintf(d.w, "• Leadership         : %s%s👑 LEADER%s for %v, running karma, ranking and leaderboards (took the lead %d times)\n",
+				Bold, ColorGreen, ColorReset, l.For.Round(time.Second), l.Elections)
+		} else {
+			leader := snap.Cluster.Leader
+			if leader == "" {
+				leader = "another instance"
+			}
+			fmt.Fprintf(d.w, "• Leadership         : %sfollower%s for %v, %s runs karma, ranking and leaderboards\n",
+				ColorYellow, ColorReset, l.For.Round(time.Second), leader)
+		}
+	}
+	if p := snap.Partitions; len(p.Partitions) > 0 {
+		period := map[string]string{config.PartitionHour: "hourly", config.PartitionDay: "daily"}[cfg.Partition.By]
+		retain := "all kept"
+		if cfg.Partition.Retain > 0 {
+			retain = fmt.Sprintf("each dropped %v after it ends", cfg.Partition.Retain)
+		}
+		first, last := p.Partitions[0], p.Partitions[len(p.Partitions)-1]
+		fmt.Fprintf(d.w, "• Partitions         : %s%d %s%s from %s to %s UTC, %s (%d created, %d dropped)\n",
+			ColorCyan, len(p.Partitions), period, ColorReset, first.From.Format("Jan 2 15:04"), last.To.Format("Jan 2 15:04"), retain, p.Created, p.Dropped)
+	}
+	if cfg.Retention.Age > 0 {
+		r := snap.Retention
+		removed := fmt.Sprintf("%d events deleted", r.Deleted)
+		if cfg.Retention.Method == config.RetentionDrop {
+			removed = fmt.Sprintf("%d partitions dropped", r.Partitions)
+		}
+		archived := "unarchived"
+		if cfg.Retention.Archive != "" {
+			archived = fmt.Sprintf("%d archived to %s in %d files (%s), %s%d failed%s",
+				r.Archived, cfg.Retention.Archive, r.Archives, formatBytes(uint64(r.ArchiveBytes)), ColorRed, r.ArchiveFailed, ColorReset)
+		}
+		if l := snap.Leader; l.Elected && !l.Leading {
+			fmt.Fprintf(d.w, "• Retention          : expired events removed by the leader after %v\n", cfg.Retention.Age)
+		} else {
+			fmt.Fprintf(d.w, "• Retention          : %s%s%s after %v, %s, last run %v\n",
+				ColorCyan, removed, ColorReset, cfg.Retention.Age, archived, simulator.RoundLatency(r.LastRun))
+		}
+	}
+	if cfg.Export.Dest != "" {
+		e := snap.Export
+		fmt.Fprintf(d.w, "• Event Export       : %s%d events%s in %d files (%s) to %s, %s/s upload, %s%d failed%s\n",
+			ColorCyan, e.Events, ColorReset, e.Files, formatBytes(uint64(e.Bytes)), cfg.Export.Dest, formatBytes(uint64(e.Throughput())), ColorRed, e.Failed, ColorReset)
+	}
+	if cfg.Webhook.URL != "" {
+		h := snap.Webhook
+		fmt.Fprintf(d.w, "• Webhook            : %s%d batches delivered%s to %s, %d retries, %s%d failed, %d dropped%s\n",
+			ColorCyan, h.Sent, ColorReset, cfg.Webhook.URL, h.Retries, ColorRed, h.Failed, h.Dropped, ColorReset)
+	}
+	if cfg.Parquet.Dir != "" {
+		p := snap.Parquet
+		fmt.Fprintf(d.w, "• Parquet Mirror     : %s%d rows%s in %d finished files (%s) in %s, %s%d failed%s\n",
+			ColorCyan, p.Rows, ColorReset, p.Files, formatBytes(uint64(p.Bytes)), cfg.Parquet.Dir, ColorRed, p.Failed, ColorReset)
+	}
+	if c := snap.Cluster; c.Self != "" && len(c.Instances) > 0 {
+		fmt.Fprintf(d.w, "• Instances          : %s%d active%s (this is %s), %s%d events/second%s generated and %s%d processed%s across them, %d waiting\n",
+			ColorCyan, len(c.Instances), ColorReset, c.Self, ColorGreen, int(c.EventsPerSec), ColorReset, ColorMagenta, int(c.ProcessedPerSec), ColorReset, c.Backlog)
+	}
+	if cfg.Viral.Enabled {
+		if v := snap.Viral; v.Post != "" {
+			fmt.Fprintf(d.w, "• Viral Posts        : %s%s🔥 %s is going viral! %d votes and comments so far%s\n",
+				Bold, ColorRed, v.Post, v.Events, ColorReset)
+		} else {
+			fmt.Fprintf(d.w, "• Viral Posts        : %s%d spike(s) so far, %d events%s\n",
+				ColorYellow, v.Spikes, v.Total, ColorReset)
+		}
+	}
+	if cfg.Dump.Files != "" {
+		p := snap.Dump
+		state := "loading"
+		if p.Done {
+			state = "done"
+		}
+		fmt.Fprintf(d.w, "• Dump Loader        : %s%d posts, %d comments and %d votes%s from %d lines (%s), %s%d skipped%s\n",
+			ColorCyan, p.Posts, p.Comments, p.Votes, ColorReset, p.Lines, state, ColorRed, p.Skipped, ColorReset)
+	}
+	if cfg.Reddit.Subreddits != "" {
+		r := snap.Reddit
+		fmt.Fprintf(d.w, "• Reddit Ingest      : %s%d posts and %d comments%s from r/%s in %d requests, %s%d failed, %d rate limited%s\n",
+			ColorCyan, r.Posts, r.Comments, ColorReset, cfg.Reddit.Subreddits, r.Requests, ColorRed, r.Failed, r.Limited, ColorReset)
+	}
+	if cfg.Detect.Enabled {
+		t := snap.Detect
+		fmt.Fprintf(d.w, "• Anomaly Detector   : %s%d users flagged%s, %d for their rate and %d for repeating themselves, of %d events seen (%d missed)\n",
+			ColorRed, t.Rate+t.Repeat, ColorReset, t.Rate, t.Repeat, t.Observed, t.Dropped)
+		if n := len(t.Recent); n > 0 {
+			f := t.Recent[n-1]
+			fmt.Fprintf(d.w, "  Latest flag        : %s%s%s for %s: %s\n", ColorYellow, f.User, ColorReset, f.Reason, f.Detail)
+		}
+	}
+	if cfg.Reads.Ratio > 0 {
+		var loads, errors int
+		for _, r := range snap.PageLoads {
+			loads += r.Count
+			errors += r.Errors
+		}
+		ratio := 0.0
+		if snap.EventsPerSec > 0 {
+			ratio = snap.PageLoadsPerSec / snap.EventsPerSec
+		}
+		fmt.Fprintf(d.w, "• Read Traffic       : %s%.1f page loads/second%s by %d readers, %.1f:1 to events written (-read-ratio %g), %d in all, %s%d failed%s\n",
+			ColorGreen, snap.Rates.PageLoadsPerSec, ColorReset, cfg.Reads.Readers, ratio, cfg.Reads.Ratio, loads, ColorRed, errors, ColorReset)
+	}
+	if cfg.Cache.Backend != config.CacheNone {
+		c := snap.Cache
+		fmt.Fprintf(d.w, "• Read Cache         : %s%.1f%% hits%s (%d of %d, %s), %d evicted, %d expired, %s%d errors%s, ~%v of queries saved (%v a hit vs %v a miss)\n",
+			ColorGreen, 100*c.HitRate, ColorReset, c.Hits, c.Hits+c.Misses, cfg.Cache.Backend, c.Evictions, c.Expired, ColorRed, c.Errors, ColorReset,
+			c.Saved.Round(time.Millisecond), simulator.RoundLatency(c.MeanHit), simulator.RoundLatency(c.MeanMiss))
+	}
+}
+
+func (d dashboard) activity() {
+	snap, cfg := d.snap, d.cfg
+	// The label, brackets, scale and figure take about 45 columns; what's
+	// left goes to the bar and the last minute's sparkline, which is
+	// dropped first on a narrow terminal
+	spark := 0
+	if d.width >= 70 {
+		spark = min(max(d.width-80, 10), simulator.HistoryLen)
+	}
+	bar := min(max(d.width-45-spark, 10), 40)
+	h := snap.History
+	fmt.Fprintf(d.w, "\n%s📊 Real-time Performance:%s %s(over the last %v)%s\n", Bold, ColorReset, ColorCyan, snap.Rates.Window, ColorReset)
+	activityBar(d.w, "Writes/sec", snap.Rates.WritesPerSec, barScale(snap.Rates.WritesPerSec, h.WritesPerSec), bar, ColorBlue, "records", sparkline(h.WritesPerSec, spark))
+	activityBar(d.w, "Reads/sec", snap.Rates.ReadsPerSec, barScale(snap.Rates.ReadsPerSec, h.ReadsPerSec), bar, ColorGreen, "records", sparkline(h.ReadsPerSec, spark))
+	activityBar(d.w, "Updates/sec", snap.Rates.UpdatesPerSec, barScale(snap.Rates.UpdatesPerSec, h.UpdatesPerSec), bar, ColorMagenta, "records", sparkline(h.UpdatesPerSec, spark))
+
+	// Where events wait: the channel has a fixed size, the store's backlog
+	// only the memory backend's capacity, so it is drawn against its peak
+	gaugeBar(d.w, "Channel", snap.ChannelDepth, cfg.Generator.Buffer, "buffer", bar, ColorYellow, sparkline(h.ChannelDepth, spark))
+	if cfg.Sink != config.SinkKafka {
+		backlogMax, of := snap.Lag.Peak, "peak"
+		if cfg.Backend == config.BackendMemory {
+			backlogMax, of = cfg.MemoryCapacity, "capacity"
+		}
+		color := ColorYellow
+		if snap.Lag.Alert {
+			color = Bold + ColorRed
+		}
+		gaugeBar(d.w, "Backlog", snap.Backlog, backlogMax, of, bar, color, sparkline(h.Backlog, spark))
+	}
+}
+
+func (d dashboard) workers() {
+	snap, cfg := d.snap, d.cfg
+	if len(snap.Generators) > 1 {
+		fmt.Fprintf(d.w, "\n%s⚙️  Generators:%s\n", Bold, ColorReset)
+		for i, g := range snap.Generators {
+			fmt.Fprintf(d.w, "Generator #%-2d : %s%5d events/second%s\n",
+				i+1, ColorGreen, int(g.EventsPerSec), ColorReset)
+		}
+		fmt.Fprintf(d.w, "Aggregate     : %s%5d events/second%s\n", ColorGreen, int(snap.EventsPerSec), ColorReset)
+	}
+
+	if len(snap.Personas) > 0 {
+		fmt.Fprintf(d.w, "\n%s🎭 Personas:%s\n", Bold, ColorReset)
+		for _, p := range snap.Personas {
+			flagged := ""
+			if cfg.Detect.Enabled {
+				flagged = fmt.Sprintf(", %s%d flagged%s", ColorRed, p.Flagged, ColorReset)
+			}
+			fmt.Fprintf(d.w, "%-12s : %s%5d events/second%s  %d of %d online%s\n",
+				p.Name, ColorGreen, int(p.EventsPerSec), ColorReset, p.Online, p.Users, flagged)
+		}
+	}
+
+	if len(snap.Writers) > 1 {
+		fmt.Fprintf(d.w, "\n%s✍️  Writer Pool:%s\n", Bold, ColorReset)
+		for i, w := range snap.Writers {
+			fmt.Fprintf(d.w, "Writer #%-2d : %s%5d records/second%s  busy %s%5.1f%%%s\n",
+				i+1, ColorBlue, int(w.WritesPerSec), ColorReset, ColorYellow, w.BusyPct, ColorReset)
+		}
+	}
+
+	if len(snap.Processors) > 1 {
+		fmt.Fprintf(d.w, "\n%s🔄 Competing Processors:%s\n", Bold, ColorReset)
+		for i, p := range snap.Processors {
+			fmt.Fprintf(d.w, "Processor #%-2d : %s%5d records/second%s  (%d batches)\n",
+				i+1, ColorMagenta, int(p.ProcessedPerSec), ColorReset, p.Batches)
+		}
+	}
+
+	if c := snap.Cluster; len(c.Instances) > 1 {
+		fmt.Fprintf(d.w, "\n%s🖧  Instances:%s\n", Bold, ColorReset)
+		for _, i := range c.Instances {
+			mark := ""
+			if i.Leader {
+				mark = " 👑"
+			}
+			if i.Name == c.Self {
+				mark += " (this one)"
+			}
+			fmt.Fprintf(d.w, "%-16s : %s%5d events/second%s  %s%5d records/second%s processed%s\n",
+				i.Name, ColorGreen, int(i.EventsPerSec), ColorReset, ColorMagenta, int(i.ProcessedPerSec), ColorReset, mark)
+		}
+	}
+}
+
+// reddit shows the domain tables, busiest subreddits, karma leaderboard
+// and front page, reporting whether there was anything to show.
+func (d dashboard) reddit() bool {
+	snap, cfg := d.snap, d.cfg
+	shown := false
+	if cfg.Backend == config.BackendPostgres {
+		dc := snap.Domain
+		fmt.Fprintf(d.w, "\n%s🗂️  Reddit Data:%s\n", Bold, ColorReset)
+		fmt.Fprintf(d.w, "%s%d users%s · %s%d subreddits%s · %s%d posts%s · %s%d comments%s · %s%d votes%s\n",
+			ColorCyan, dc.Users, ColorReset, ColorCyan, dc.Subreddits, ColorReset,
+			ColorGreen, dc.Posts, ColorReset, ColorBlue, dc.Comments, ColorReset, ColorMagenta, dc.Votes, ColorReset)
+		if dc.Reports > 0 {
+			fmt.Fprintf(d.w, "🛡️  Moderation: %s%d reports%s · %s%d removed%s · %s%d bans%s\n",
+				ColorYellow, dc.Reports, ColorReset, ColorRed, dc.Removed, ColorReset, ColorRed, dc.Bans, ColorReset)
+		}
+		if dc.DeepestThread > 0 {
+			fmt.Fprintf(d.w, "🧵 Threads: deepest %s%d levels%s (%s) · busiest post %s with %s%d comments%s\n",
+				ColorYellow, dc.DeepestThread, ColorReset, dc.DeepestPost, dc.BusiestPost, ColorYellow, dc.BusiestComments, ColorReset)
+		}
+		shown = true
+	}
+
+	if len(snap.Subreddits) > 0 {
+		fmt.Fprintf(d.w, "\n%s🏘️  Top Subreddits:%s\n", Bold, ColorReset)
+		for _, s := range snap.Subreddits {
+			fmt.Fprintf(d.w, "r/%-18.18s %s%8d events%s  %5.1f%% of traffic (weight %.1f%%)\n",
+				s.Name, ColorGreen, s.Events, ColorReset, s.Share*100, s.Weight*100)
+		}
+		shown = true
+	}
+
+	if len(snap.Trending) > 0 {
+		fmt.Fprintf(d.w, "\n%s🔥 Trending now:%s events in the last 1m / 5m / 15m\n", Bold, ColorReset)
+		for _, t := range snap.Trending {
+			color := ColorCyan
+			if t.Velocity >= 1.5 {
+				color = ColorRed
+			} else if t.Velocity > 1 {
+				color = ColorYellow
+			}
+			fmt.Fprintf(d.w, "r/%-18.18s %s%6d%s / %6d / %7d  %s%4.1f× the 15m pace%s\n",
+				t.Subreddit, ColorGreen, t.Events[0], ColorReset, t.Events[1], t.Events[2], color, t.Velocity, ColorReset)
+		}
+		shown = true
+	}
+
+	if c := snap.Enrich; len(c.Countries) > 0 {
+		fmt.Fprintf(d.w, "\n%s🌍 Clients:%s where the events stored were sent from\n", Bold, ColorReset)
+		for _, dim := range []struct {
+			label  string
+			shares []simulator.ClientShare
+		}{{"Countries", c.Countries}, {"Devices", c.Devices}, {"App Versions", c.AppVersions}} {
+			fmt.Fprintf(d.w, "%-18s:", dim.label)
+			for i, s := range dim.shares[:min(5, len(dim.shares))] {
+				if i > 0 {
+					fmt.Fprint(d.w, " ·")
+				}
+				fmt.Fprintf(d.w, " %s %s%.1f%%%s", s.Name, ColorGreen, s.Share*100, ColorReset)
+			}
+			fmt.Fprintln(d.w)
+		}
+		shown = true
+	}
+
+	if m := snap.Moderation; cfg.Moderation.Reports > 0 {
+		fmt.Fprintf(d.w, "\n%s🛡️  Modqueue:%s %s%d reports%s · %s%d pending%s · %d removed · %d approved · %s%d banned%s · mean review %v",
+			Bold, ColorReset, ColorYellow, m.Reports, ColorReset, ColorCyan, m.Pending, ColorReset,
+			m.Removed, m.Approved, ColorRed, m.Banned, ColorReset, m.MeanReview.Round(time.Millisecond))
+		if m.Overflow > 0 {
+			fmt.Fprintf(d.w, " · %s%d never reviewed (queue full)%s", ColorRed, m.Overflow, ColorReset)
+		}
+		fmt.Fprintln(d.w)
+		shown = true
+	}
+
+	// A follower reads what the leader's jobs produce without running them
+	if k := snap.Karma; k.Runs > 0 || len(k.TopUsers) > 0 {
+		how := fmt.Sprintf("aggregated %d times, last run %v", k.Runs, k.LastRun.Round(time.Millisecond))
+		if k.Runs == 0 {
+			how = "aggregated by the leader"
+		}
+		fmt.Fprintf(d.w, "\n%s🏆 Top Karma:%s %s(%s)%s\n", Bold, ColorReset, ColorCyan, how, ColorReset)
+		for i, u := range k.TopUsers {
+			fmt.Fprintf(d.w, "%d. %-10s %s%6d%s  (post %d · comment %d)\n",
+				i+1, u.User, ColorYellow, u.PostKarma+u.CommentKarma, ColorReset, u.PostKarma, u.CommentKarma)
+		}
+		shown = true
+	}
+
+	if l := snap.Leaderboards; len(l.Boards) > 0 {
+		how := fmt.Sprintf("computed %d times, last run %v", l.Runs, l.LastRun.Round(time.Millisecond))
+		if l.Runs == 0 {
+			how = "computed by the leader"
+		}
+		fmt.Fprintf(d.w, "\n%s🥇 Leaderboards:%s %s(%s)%s\n", Bold, ColorReset, ColorCyan, how, ColorReset)
+		labels := map[string]string{store.BoardTopPosts: "Top posts", store.BoardTopCommenters: "Top commenters", store.BoardActiveSubreddits: "Active subreddits"}
+		for _, b := range l.Boards {
+			fmt.Fprintf(d.w, "%-18s:", labels[b.Board])
+			if len(b.Entries) == 0 {
+				fmt.Fprint(d.w, " none yet")
+			}
+			for i, e := range b.Entries[:min(3, len(b.Entries))] {
+				if i > 0 {
+					fmt.Fprint(d.w, " ·")
+				}
+				switch b.Board {
+				case store.BoardTopPosts:
+					fmt.Fprintf(d.w, " %.28q %s%+d%s", e.Title, ColorYellow, e.Score, ColorReset)
+				case store.BoardActiveSubreddits:
+					fmt.Fprintf(d.w, " r/%s %s%d%s", e.Item, ColorYellow, e.Score, ColorReset)
+				default:
+					fmt.Fprintf(d.w, " %s %s%d%s", e.Item, ColorYellow, e.Score, ColorReset)
+				}
+			}
+			fmt.Fprintln(d.w)
+		}
+		shown = true
+	}
+
+	if s := snap.Scores; s.Runs > 0 {
+		fmt.Fprintf(d.w, "\n%s🎯 Post Scores:%s %s(%d votes folded in %d upserts, last pass %v)%s\n",
+			Bold, ColorReset, ColorCyan, s.Folded, s.Upserts, s.LastRun.Round(time.Millisecond), ColorReset)
+		for i, p := range s.Top {
+			fmt.Fprintf(d.w, "%d. %-10s %s%+6d%s  (%d up · %d down) %sr/%s%s\n",
+				i+1, p.ID, ColorYellow, p.Ups-p.Downs, ColorReset, p.Ups, p.Downs, ColorGreen, p.Subreddit, ColorReset)
+		}
+		shown = true
+	}
+
+	if r := snap.Ranking; r.Runs > 0 || len(r.FrontPage) > 0 {
+		how := fmt.Sprintf("%d posts rescored, last pass %v", r.Rescored, r.LastRun.Round(time.Millisecond))
+		if r.Runs == 0 {
+			how = "ranked by the leader"
+		}
+		fmt.Fprintf(d.w, "\n%s📰 Front Page (%s):%s %s(%s)%s\n", Bold, cfg.Ranking.Sort, ColorReset, ColorCyan, how, ColorReset)
+		for i, p := range r.FrontPage {
+			fmt.Fprintf(d.w, "%2d. %s%+5d%s  %-30.30s  %sr/%s%s · u/%s · %d comments\n",
+				i+1, ColorYellow, p.Ups-p.Downs, ColorReset, p.Title, ColorGreen, p.Subreddit, ColorReset, p.Author, p.Comments)
+		}
+		shown = true
+	}
+
+	if v := snap.Views; v.Runs > 0 || len(v.Analytics.EventsPerMinute) > 0 {
+		how := fmt.Sprintf("refreshed %d times, last run %v", v.Runs, v.LastRun.Round(time.Millisecond))
+		if v.Runs == 0 {
+			how = "refreshed by the leader"
+		}
+		a := v.Analytics
+		fmt.Fprintf(d.w, "\n%s📈 Analytics Views:%s %s(%s)%s\n", Bold, ColorReset, ColorCyan, how, ColorReset)
+		if v.Runs > 0 {
+			fmt.Fprintf(d.w, "%-18s:", "Refresh")
+			for i, r := range v.Refresh {
+				if i > 0 {
+					fmt.Fprint(d.w, " ·")
+				}
+				fmt.Fprintf(d.w, " %s %s%v%s", r.View, ColorYellow, simulator.RoundLatency(r.Took.Mean), ColorReset)
+			}
+			fmt.Fprintln(d.w, " on average")
+		}
+		fmt.Fprintf(d.w, "%-18s:", "Events a Minute")
+		for i, m := range a.EventsPerMinute {
+			if i == 0 || !m.Minute.Equal(a.EventsPerMinute[i-1].Minute) {
+				var n int64
+				for _, o := range a.EventsPerMinute[i:] {
+					if o.Minute.Equal(m.Minute) {
+						n += o.Events
+					}
+				}
+				fmt.Fprintf(d.w, " %s %s%d%s", m.Minute.Local().Format("15:04"), ColorGreen, n, ColorReset)
+			}
+		}
+		fmt.Fprintln(d.w)
+		top := func(label string, n int, entry func(i int) string) {
+			fmt.Fprintf(d.w, "%-18s:", label)
+			if n == 0 {
+				fmt.Fprint(d.w, " none yet")
+			}
+			for i := range min(3, n) {
+				if i > 0 {
+					fmt.Fprint(d.w, " ·")
+				}
+				fmt.Fprint(d.w, " "+entry(i))
+			}
+			fmt.Fprintln(d.w)
+		}
+		top("Top Subreddits", len(a.Subreddits), func(i int) string {
+			s := a.Subreddits[i]
+			return fmt.Sprintf("r/%s %s%d%s (%d users)", s.Subreddit, ColorYellow, s.Events, ColorReset, s.Users)
+		})
+		top("Top Users", len(a.TopUsers), func(i int) string {
+			u := a.TopUsers[i]
+			return fmt.Sprintf("%s %s%d%s", u.User, ColorYellow, u.Events, ColorReset)
+		})
+		if len(a.Clients) > 0 {
+			top("Top Clients", len(a.Clients), func(i int) string {
+				c := a.Clients[i]
+				return fmt.Sprintf("%s %s %s%d%s", c.Country, c.Device, ColorYellow, c.Events, ColorReset)
+			})
+		}
+		shown = true
+	}
+	return shown
+}
+
+func (d dashboard) system() {
+	snap, cfg := d.snap, d.cfg
+
+	// Injected failures
+	if cfg.Chaos.Enabled {
+		c := snap.Chaos
+		stalled := ""
+		if snap.Stalled {
+			stalled = fmt.Sprintf("  %s%s⏸ generators stalled%s", Bold, ColorRed, ColorReset)
+		}
+		fmt.Fprintf(d.w, "\n%s💥 Chaos:%s %s%d dropped connections%s · %d slow queries · %d slow consumers · %d generator stalls · %d lost acks%s\n",
+			Bold, ColorReset, ColorRed, c[simulator.ChaosConnDrop], ColorReset, c[simulator.ChaosLatency], c[simulator.ChaosSlowConsumer], c[simulator.ChaosStall], c[simulator.ChaosLostAck], stalled)
+	}
+
+	// Firehose consumers
+	if cfg.HTTP.Addr != "" || cfg.GRPC.Addr != "" {
+		fmt.Fprintf(d.w, "\n%s🚿 Firehose:%s %s%d live subscriber(s)%s, %d disconnected for falling behind\n",
+			Bold, ColorReset, ColorCyan, snap.Firehose.Subscribers, ColorReset, snap.Firehose.Disconnects)
+	}
+
+	rt := snap.Runtime
+	fmt.Fprintf(d.w, "\n%s🐹 Go Runtime:%s\n", Bold, ColorReset)
+	fmt.Fprintf(d.w, "Goroutines        : %s%d%s\n", ColorCyan, rt.Goroutines, ColorReset)
+	fmt.Fprintf(d.w, "Heap              : %s%s in use%s of %s (%d objects)\n",
+		ColorCyan, formatBytes(rt.HeapAlloc), ColorReset, formatBytes(rt.HeapSys), rt.HeapObjs)
+	fmt.Fprintf(d.w, "GC                : %s%d cycles%s, last pause %v, total %v (%.2f%% CPU)\n",
+		ColorCyan, rt.NumGC, ColorReset, rt.LastPause, rt.TotalPause.Round(time.Microsecond), rt.GCCPU*100)
+
+	// The connection pool every writer, processor and job shares: once
+	// they outnumber -db-max-open, waits show them queueing for it
+	if p := snap.Pool; p != nil {
+		limit := "unlimited"
+		if p.MaxOpen > 0 {
+			limit = fmt.Sprintf("max %d", p.MaxOpen)
+		}
+		waitColor := ColorGreen
+		if p.WaitCount > 0 {
+			waitColor = ColorYellow
+		}
+		fmt.Fprintf(d.w, "\n%s🔌 Connection Pool:%s %s%d open%s (%s) shared by %d writer(s) and %d processor(s)\n",
+			Bold, ColorReset, ColorCyan, p.Open, ColorReset, limit, len(snap.Writers), len(snap.Processors))
+		fmt.Fprintf(d.w, "Connections       : %s%d in use%s, %d idle\n", ColorCyan, p.InUse, ColorReset, p.Idle)
+		fmt.Fprintf(d.w, "Waits             : %s%d waits%s for a free connection, %v in all, %v on average\n",
+			waitColor, p.WaitCount, ColorReset, p.WaitDuration.Round(time.Millisecond), simulator.RoundLatency(p.MeanWait()))
+		fmt.Fprintf(d.w, "Closed            : %d over -db-max-idle, %d past -db-max-lifetime\n", p.IdleClosed, p.LifetimeClosed)
+	}
+
+	// The periodic jobs the scheduler runs
+	if len(snap.Jobs) > 0 {
+		fmt.Fprintf(d.w, "\n%s🗓️  Jobs:%s\n", Bold, ColorReset)
+		fmt.Fprintf(d.w, "%-17s %-18s %6s %7s %10s %8s\n", "", "schedule", "runs", "failed", "last took", "next in")
+		for _, j := range snap.Jobs {
+			failColor := ColorGreen
+			if j.Failures > 0 {
+				failColor = ColorRed
+			}
+			next := "-"
+			if j.Running {
+				next = "running"
+			} else if !j.Next.IsZero() {
+				next = max(time.Until(j.Next), 0).Round(time.Second).String()
+			}
+			fmt.Fprintf(d.w, "%-17s %-18.18s %s%6d%s %s%7d%s %10v %8s\n", j.Name, j.Schedule,
+				ColorCyan, j.Runs, ColorReset, failColor, j.Failures, ColorReset, simulator.RoundLatency(j.LastTook), next)
+			if j.LastError != "" {
+				fmt.Fprintf(d.w, "%-17s %slast run failed: %.80s%s\n", "", ColorRed, j.LastError, ColorReset)
+			}
+		}
+	}
+
+	// Latency percentiles: the tail is where queueing shows up
+	fmt.Fprintf(d.w, "\n%s⏱️  Latency:%s%16s %10s %10s %10s\n", Bold, ColorReset, "p50", "p95", "p99", "max")
+	for _, op := range []struct{ name, key, color string }{
+		{"Writes", simulator.OpWrite, ColorBlue},
+		{"Reads", simulator.OpRead, ColorGreen},
+		{"Updates", simulator.OpUpdate, ColorMagenta},
+	} {
+		l := snap.Latency[op.key]
+		fmt.Fprintf(d.w, "%-17s %s%10v %10v %10v %10v%s\n", op.name, op.color,
+			simulator.RoundLatency(l.P50), simulator.RoundLatency(l.P95), simulator.RoundLatency(l.P99), simulator.RoundLatency(l.Max), ColorReset)
+	}
+	// Page loads span several queries, so they sit apart from the store's
+	if cfg.Reads.Ratio > 0 {
+		names := map[string]string{simulator.ReadFrontPage: "Front pages", simulator.ReadCommentPage: "Comment pages", simulator.ReadProfile: "Profiles"}
+		for _, r := range snap.PageLoads {
+			l := r.Latency
+			fmt.Fprintf(d.w, "%-17s %s%10v %10v %10v %10v%s\n", names[r.Kind], ColorCyan,
+				simulator.RoundLatency(l.P50), simulator.RoundLatency(l.P95), simulator.RoundLatency(l.P99), simulator.RoundLatency(l.Max), ColorReset)
+		}
+	}
+
+	// Backlog and time to processed, per priority
+	if cfg.Sink != config.SinkKafka {
+		fmt.Fprintf(d.w, "\n%s🚦 Priorities:%s %s(%s, %d at a time)%s %s%d waiting in all%s\n",
+			Bold, ColorReset, ColorCyan, simulator.ClaimDescription(cfg), snap.ProcessBatch, ColorReset, ColorYellow, snap.Backlog, ColorReset)
+		fmt.Fprintf(d.w, "%-10s %10s %10s %10s %10s %10s\n", "", "waiting", "wait p50", "p95", "p99", "max")
+		for _, p := range snap.Priorities {
+			w := p.Wait
+			fmt.Fprintf(d.w, "%-10s %s%10d%s %10v %10v %10v %10v\n", p.Priority, ColorYellow, p.Depth, ColorReset,
+				simulator.RoundLatency(w.P50), simulator.RoundLatency(w.P95), simulator.RoundLatency(w.P99), simulator.RoundLatency(w.Max))
+		}
+	}
+
+	// Throughput and time to processed, per event type
+	fmt.Fprintf(d.w, "\n%s🧩 Event Types:%s\n", Bold, ColorReset)
+	fmt.Fprintf(d.w, "%-10s %10s %10s %10s %10s %10s %10s\n", "", "events", "/second", "processed", "wait p50", "p95", "p99")
+	for _, t := range snap.Types {
+		w := t.Wait
+		fmt.Fprintf(d.w, "%-10s %s%10d %10.0f%s %s%10d%s %10v %10v %10v\n", t.Type, ColorGreen, t.Events, t.EventsPerSec, ColorReset,
+			ColorMagenta, t.Processed, ColorReset, simulator.RoundLatency(w.P50), simulator.RoundLatency(w.P95), simulator.RoundLatency(w.P99))
+	}
+}
+
+func (d dashboard) totals() {
+	snap, cfg := d.snap, d.cfg
+	fmt.Fprintf(d.w, "\n%s📈 Overall Statistics:%s\n", Bold, ColorReset)
+	fmt.Fprintf(d.w, "Total Events      : %s%d events generated%s\n", ColorGreen, snap.EventsGenerated, ColorReset)
+	if snap.EventsGenerated > 0 {
+		fmt.Fprintf(d.w, "Payload Data      : %s%s generated%s, %s per event on average, %s/second\n",
+			ColorGreen, formatBytes(uint64(snap.PayloadBytes)), ColorReset,
+			formatBytes(uint64(snap.PayloadBytes/snap.EventsGenerated)), formatBytes(uint64(float64(snap.PayloadBytes)/max(snap.Uptime, 1))))
+	}
+	if cfg.Generator.Overflow != config.OverflowBlock {
+		fmt.Fprintf(d.w, "Dropped Events    : %s%d events shed (%s, channel %d/%d)%s\n",
+			ColorRed, snap.Dropped, cfg.Generator.Overflow, snap.ChannelDepth, cfg.Generator.Buffer, ColorReset)
+	}
+	if cfg.RateLimit.PerUser > 0 || cfg.RateLimit.PerIP > 0 {
+		r := snap.RateLimit
+		if cfg.RateLimit.Action == config.RateLimitDelay {
+			fmt.Fprintf(d.w, "Rate Limited      : %s%d events delayed%s for a token, %v on average\n",
+				ColorYellow, r.Delayed, ColorReset, simulator.RoundLatency(r.MeanDelay))
+		} else {
+			fmt.Fprintf(d.w, "Rate Limited      : %s%d events rejected%s, %d over a user's limit and %d over an IP's\n",
+				ColorRed, r.UserRejected+r.IPRejected, ColorReset, r.UserRejected, r.IPRejected)
+		}
+	}
+	if cfg.Filter.Subreddits != "" || len(cfg.Filter.Sample) > 0 {
+		f := snap.Filter
+		fmt.Fprintf(d.w, "Filtered Events   : %s%d events left out%s, %d outside the subreddits and %d sampled out\n",
+			ColorYellow, f.Filtered+f.Sampled, ColorReset, f.Filtered, f.Sampled)
+	}
+	fmt.Fprintf(d.w, "Database Writes   : %s%d records written%s\n", ColorBlue, snap.Writes, ColorReset)
+	if cfg.ClickHouse.URL != "" {
+		c := snap.ClickHouse
+		fmt.Fprintf(d.w, "ClickHouse        : %s%d events inserted%s in %d batches, p50 %v p99 %v an insert (store p50 %v a write), %d pending",
+			ColorBlue, c.Inserted, ColorReset, c.Batches, simulator.RoundLatency(c.Latency.P50), simulator.RoundLatency(c.Latency.P99),
+			simulator.RoundLatency(snap.Latency[simulator.OpWrite].P50), c.Pending)
+		if c.Failed+c.Dropped > 0 {
+			fmt.Fprintf(d.w, ", %s%d failed, %d dropped%s", ColorRed, c.Failed, c.Dropped, ColorReset)
+		}
+		fmt.Fprintln(d.w)
+	}
+	if snap.DuplicatesRejected > 0 {
+		fmt.Fprintf(d.w, "Duplicates        : %s%d redelivered events rejected%s by idempotency key\n",
+			ColorYellow, snap.DuplicatesRejected, ColorReset)
+	}
+	if r := snap.Retries; r.ByOp[simulator.OpWrite]+r.ByOp[simulator.OpRead] > 0 {
+		fmt.Fprintf(d.w, "Store Retries     : %s%d write, %d claim retries%s, %d gave up after %d attempts\n",
+			ColorYellow, r.ByOp[simulator.OpWrite], r.ByOp[simulator.OpRead], ColorReset, r.Exhausted, cfg.Retry.MaxAttempts)
+	}
+	if dl := snap.DLQ; dl.Size > 0 || dl.Recovered > 0 {
+		fmt.Fprintf(d.w, "Dead Letters      : %s%d events waiting%s (%d parked after %d retries), %s%d recovered%s\n",
+			ColorRed, dl.Size, ColorReset, dl.Parked, cfg.DLQ.MaxRetries, ColorGreen, dl.Recovered, ColorReset)
+	}
+	fmt.Fprintf(d.w, "Database Reads    : %s%d records read%s\n", ColorGreen, snap.Reads, ColorReset)
+	fmt.Fprintf(d.w, "Records Processed : %s%d records updated%s in %d batches\n", ColorMagenta, snap.Processed, ColorReset, snap.Updates)
+	fmt.Fprintf(d.w, "Batch Flushes     : %s%d flushes, %v average%s\n", ColorYellow, snap.Flushes, snap.AvgFlush.Round(time.Microsecond), ColorReset)
+	fmt.Fprintf(d.w, "Uptime           : %s%.1f seconds%s\n", ColorCyan, snap.Uptime, ColorReset)
+}
+
+func (d dashboard) howItWorks() {
+	snap, cfg := d.snap, d.cfg
+	fmt.Fprintf(d.w, "\n%s💡 How It Works:%s\n", Bold, ColorReset)
+	if snap.Actors > 0 {
+		fmt.Fprintf(d.w, "1. The users online share a target of %g events/second, browsing, voting, commenting and posting\n", snap.TargetRate)
+	} else {
+		fmt.Fprintf(d.w, "1. %d generator(s) share a target of %g events/second\n", cfg.Generator.Count, snap.TargetRate)
+	}
+	if snap.WriteBatch > 1 {
+		fmt.Fprintf(d.w, "2. %d writer(s) save events to %s in batches of up to %d (or every %v)\n", len(snap.Writers), simulator.SinkName(cfg), snap.WriteBatch, cfg.Writer.FlushInterval)
+	} else {
+		fmt.Fprintf(d.w, "2. %d writer(s) instantly save each event to %s\n", len(snap.Writers), simulator.SinkName(cfg))
+	}
+	switch {
+	case cfg.Sink == config.SinkKafka:
+		fmt.Fprintf(d.w, "3. Processing is left to whoever consumes topic %q\n", cfg.Kafka.Topic)
+	case cfg.Processor.Mode == config.ProcessNotify:
+		fmt.Fprintf(d.w, "3. %d processor(s) wake on LISTEN/NOTIFY (%d wake-ups so far), polling every %v as a fallback\n", len(snap.Processors), snap.Wakeups, cfg.Processor.Interval)
+	default:
+		fmt.Fprintf(d.w, "3. %d processor(s) claim events in batches of %d every %v\n", len(snap.Processors), snap.ProcessBatch, cfg.Processor.Interval)
+	}
+	fmt.Fprintf(d.w, "%sAll operations run simultaneously with zero blocking!%s\n", ColorYellow, ColorReset)
+}
+
+// gaugeBar draws a level against its limit, named of, as a bar width
+// cells wide, followed by the sparkline of its history.
+func gaugeBar(w io.Writer, label string, value, limit int, of string, width int, color, spark string) {
+	filled := 0
+	if limit > 0 {
+		filled = min(value*width/limit, width)
+	}
+	if spark != "" {
+		spark += " "
+	}
+	fmt.Fprintf(w, "%-14s [%s%s%s%s]     %s%s%s%d of %d %s\n",
+		label, color, strings.Repeat("█", filled), strings.Repeat(" ", width-filled), ColorReset, color, spark, ColorReset, value, limit, of)
+}
+
+// barScale is where a rate's bar ends: the peak of the rate and its last
+// minute, rounded up to 1, 2 or 5 times a power of ten, so the bar keeps
+// room for the rate whatever it runs at and scales back down after a burst.
+func barScale(rate float64, history []float64) float64 {
+	peak := rate
+	for _, v := range history {
+		peak = max(peak, v)
+	}
+	scale := 10.0
+	for scale < peak {
+		switch digit := scale / math.Pow(10, math.Floor(math.Log10(scale))); {
+		case digit < 1.5:
+			scale *= 2
+		case digit < 3:
+			scale *= 2.5
+		default:
+			scale *= 2
+		}
+	}
+	return scale
+}
+
+// scaleLabel writes a bar's scale compactly: 500, 2k, 10k, 1M.
+func scaleLabel(v float64) string {
+	switch {
+	case v >= 1e6:
+		return strconv.FormatFloat(v/1e6, 'g', -1, 64) + "M"
+	case v >= 1e3:
+		return strconv.FormatFloat(v/1e3, 'g', -1, 64) + "k"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// activityBar draws value against max as a bar width cells wide, with max
+// at its end and followed by the sparkline of its history.
+func activityBar(w io.Writer, label string, value, max float64, width int, color, unit, spark string) {
+	filled := int((value / max) * float64(width))
+	if filled > width {
+		filled = width
+	}
+
+	if spark != "" {
+		spark += " "
+	}
+	fmt.Fprintf(w, "%-14s [%s%s%s%s]%-4s %s%s%s%d %s/second\n",
+		label,
+		color,
+		strings.Repeat("█", filled),
+		strings.Repeat(" ", width-filled),
+		ColorReset,
+		scaleLabel(max),
+		color,
+		spark,
+		ColorReset,
+		int(value),
+		unit,
+	)
+}
+
+// sparkLevels are a sparkline's cells, lowest to highest.
+var sparkLevels = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline draws the last width values, oldest first, each as a cell
+// scaled to the largest of them. Fewer values than width are padded on
+// the left, so the newest is always in the last cell.
+func sparkline(values []float64, width int) string {
+	values = values[max(len(values)-width, 0):]
+	top := 0.0
+	for _, v := range values {
+		top = max(top, v)
+	}
+	var b strings.Builder
+	b.WriteString(strings.Repeat(" ", width-len(values)))
+	for _, v := range values {
+		level := 0
+		if top > 0 {
+			level = min(int(v/top*float64(len(sparkLevels)-1)+0.5), len(sparkLevels)-1)
+		}
+		b.WriteRune(sparkLevels[level])
+	}
+	return b.String()
+}
+
+// formatBytes renders a byte count in binary units.
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return strconv.FormatUint(b, 10) + " B"
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return strconv.FormatFloat(float64(b)/float64(div), 'f', 1, 64) + " " + string("KMGTPE"[exp]) + "iB"
+}
@@ -0,0 +1,163 @@
+package dashboard
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/mattn/go-isatty"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/simulator"
+)
+
+// rateStep is how much + and - scale the event rate by.
+const rateStep = 1.25
+
+// isTerminal reports whether the TUI can run: it needs a terminal to draw
+// on and one to read keys from.
+func isTerminal() bool {
+	return isatty.IsTerminal(os.Stdout.Fd()) && isatty.IsTerminal(os.Stdin.Fd())
+}
+
+var (
+	titleStyle     = lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("14"))
+	tabStyle       = lipgloss.NewStyle().Padding(0, 1)
+	activeTabStyle = tabStyle.Reverse(true).Bold(true)
+	helpStyle      = lipgloss.NewStyle().Faint(true)
+)
+
+// tuiModel is the Bubble Tea model of the interactive dashboard. It
+// redraws from a fresh snapshot every refresh and turns key presses into
+// run controls. Quitting stops the whole run, the same as Ctrl+C does
+// outside the TUI.
+type tuiModel struct {
+	ctx     context.Context
+	cfg     *config.Config
+	metrics *simulator.RedditMetrics
+	ctl     *simulator.Controls
+	stop    func()
+
+	snap          simulator.Snapshot
+	panel         int
+	width, height int
+}
+
+type tickMsg time.Time
+
+// runTUI runs the interactive dashboard on the alternate screen until ctx
+// is done or the user quits, in which case it calls stop.
+func runTUI(ctx context.Context, cfg *config.Config, metrics *simulator.RedditMetrics, ctl *simulator.Controls, stop func()) error {
+	m := tuiModel{
+		ctx:     ctx,
+		cfg:     cfg,
+		metrics: metrics,
+		ctl:     ctl,
+		stop:    stop,
+		snap:    metrics.Snapshot(),
+		width:   plainWidth,
+	}
+	// Signals are the caller's to handle; the TUI notices ctx instead
+	_, err := tea.NewProgram(m, tea.WithAltScreen(), tea.WithoutSignalHandler()).Run()
+	return err
+}
+
+func (m tuiModel) tick() tea.Cmd {
+	return tea.Tick(m.cfg.Visualizer.Refresh, func(t time.Time) tea.Msg { return tickMsg(t) })
+}
+
+func (m tuiModel) Init() tea.Cmd {
+	return m.tick()
+}
+
+func (m tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tickMsg:
+		if m.ctx.Err() != nil {
+			return m, tea.Quit
+		}
+		m.snap = m.metrics.Snapshot()
+		return m, m.tick()
+
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+
+	case tea.KeyMsg:
+		keys := []string{msg.String()}
+		if msg.Type == tea.KeyRunes && !msg.Paste {
+			// Keys typed faster than they are read arrive as one message
+			keys = keys[:0]
+			for _, r := range msg.Runes {
+				keys = append(keys, string(r))
+			}
+		}
+		for _, k := range keys {
+			if m.key(k) {
+				m.stop()
+				return m, tea.Quit
+			}
+		}
+		// Show the effect of a key straight away rather than on the next tick
+		m.snap = m.metrics.Snapshot()
+	}
+	return m, nil
+}
+
+// key acts on a single key press, reporting whether it was a quit.
+func (m *tuiModel) key(k string) bool {
+	switch k {
+	case "q", "ctrl+c", "esc":
+		return true
+	case "p", " ":
+		m.ctl.TogglePaused()
+	case "+", "=":
+		m.ctl.SetRate(m.ctl.Rate() * rateStep)
+	case "-", "_":
+		m.ctl.SetRate(m.ctl.Rate() / rateStep)
+	case "tab", "right":
+		m.panel = (m.panel + 1) % numPanels
+	case "shift+tab", "left":
+		m.panel = (m.panel + numPanels - 1) % numPanels
+	case "1", "2", "3", "4":
+		m.panel = int(k[0] - '1')
+	}
+	return false
+}
+
+func (m tuiModel) View() string {
+	tabs := make([]string, numPanels)
+	for i, name := range panelNames {
+		style := tabStyle
+		if i == m.panel {
+			style = activeTabStyle
+		}
+		tabs[i] = style.Render(fmt.Sprintf("%d %s", i+1, name))
+	}
+	header := lipgloss.JoinVertical(lipgloss.Left,
+		titleStyle.Render("🚀 Go Concurrency Demo - Real-time Event Processing"),
+		lipgloss.JoinHorizontal(lipgloss.Top, tabs...),
+	)
+
+	state := "running"
+	if m.snap.Paused {
+		state = "paused"
+	}
+	help := helpStyle.Render(fmt.Sprintf("%s at %g events/s · p pause · +/- rate · tab/1-4 panel · q quit", state, m.snap.TargetRate))
+
+	var body strings.Builder
+	renderDashboard(&body, m.cfg, m.snap, m.panel, m.width)
+	frame := lipgloss.NewStyle().MaxWidth(m.width)
+	if m.height > 0 {
+		// Keep the header and help line on screen however tall the panel is
+		frame = frame.MaxHeight(max(m.height-lipgloss.Height(header)-1, 1))
+	}
+	return lipgloss.JoinVertical(lipgloss.Left,
+		lipgloss.NewStyle().MaxWidth(m.width).Render(header),
+		frame.Render(strings.TrimSuffix(body.String(), "\n")),
+		lipgloss.NewStyle().MaxWidth(m.width).Render(help),
+	)
+}
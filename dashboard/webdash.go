@@ -0,0 +1,95 @@
+package dashboard
+
+import (
+	"context"
+	_ "embed"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/simulator"
+)
+
+//go:embed web/dashboard.html
+var dashboardHTML []byte
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// dashboardUpdate is the message pushed to browsers on every refresh: the
+// metrics snapshot plus the static bits the terminal view prints.
+type dashboardUpdate struct {
+	Backend    string  `json:"backend"`
+	TargetRate float64 `json:"target_rate"`
+	Buffer     int     `json:"buffer"`
+	// BacklogLimit is the memory backend's capacity; other backends have
+	// none
+	BacklogLimit int                `json:"backlog_limit,omitempty"`
+	Metrics      simulator.Snapshot `json:"metrics"`
+}
+
+// registerWebDashboard mounts the browser dashboard at / and its WebSocket
+// feed at /ws. Each connected client gets its own push loop, which ends
+// when the client goes away or ctx is cancelled.
+func registerWebDashboard(ctx context.Context, mux *http.ServeMux, cfg *config.Config, metrics *simulator.RedditMetrics) {
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(dashboardHTML)
+	})
+
+	mux.HandleFunc("GET /ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return // Upgrade has already replied with an error
+		}
+		defer conn.Close()
+
+		// Drain incoming frames so pings/closes are handled; a read error
+		// means the browser is gone.
+		gone := make(chan struct{})
+		go func() {
+			defer close(gone)
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ticker := time.NewTicker(cfg.Visualizer.Refresh)
+		defer ticker.Stop()
+
+		backlogLimit := 0
+		if cfg.Backend == config.BackendMemory {
+			backlogLimit = cfg.MemoryCapacity
+		}
+		for {
+			update := dashboardUpdate{
+				Backend:      simulator.BackendName(cfg),
+				TargetRate:   cfg.Generator.Rate,
+				Buffer:       cfg.Generator.Buffer,
+				BacklogLimit: backlogLimit,
+				Metrics:      metrics.Snapshot(),
+			}
+			conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			if err := conn.WriteJSON(update); err != nil {
+				return
+			}
+
+			select {
+			case <-ctx.Done():
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseGoingAway, "simulation finished"),
+					time.Now().Add(time.Second))
+				return
+			case <-gone:
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
@@ -0,0 +1,162 @@
+// Package event is the simulator's events: what a simulated user did,
+// and its JSON as the stores, brokers and API carry it.
+package event
+
+import (
+	"fmt"
+	"time"
+)
+
+// Type identifies what a simulated user did.
+type Type uint8
+
+const (
+	Post Type = iota
+	Comment
+	Upvote
+	Downvote
+	// Moderation: a user reports a post or comment, a moderator removes or
+	// approves it, and may ban its author from the subreddit.
+	Report
+	Remove
+	Ban
+	Approve
+)
+
+// Types lists every type in declaration order, for per-type
+// breakdowns.
+var Types = []Type{Post, Comment, Upvote, Downvote, Report, Remove, Ban, Approve}
+
+// UserActions are what ordinary activity is drawn from. Moderation events
+// are far rarer and generated separately.
+var UserActions = []Type{Post, Comment, Upvote, Downvote}
+
+var eventTypeNames = map[Type]string{
+	Post:     "post",
+	Comment:  "comment",
+	Upvote:   "upvote",
+	Downvote: "downvote",
+	Report:   "report",
+	Remove:   "remove",
+	Ban:      "ban",
+	Approve:  "approve",
+}
+
+func (t Type) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventType(%d)", uint8(t))
+}
+
+// MarshalText keeps the JSON and database representation human readable.
+func (t Type) MarshalText() ([]byte, error) {
+	if _, ok := eventTypeNames[t]; !ok {
+		return nil, fmt.Errorf("unknown event type %d", uint8(t))
+	}
+	return []byte(t.String()), nil
+}
+
+func (t *Type) UnmarshalText(text []byte) error {
+	parsed, err := ParseType(string(text))
+	if err != nil {
+		return err
+	}
+	*t = parsed
+	return nil
+}
+
+// Priority is how urgently an event is processed.
+type Priority uint8
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+)
+
+// PriorityLevels is the number of priorities.
+const PriorityLevels = 3
+
+// Priorities lists every priority, highest first.
+var Priorities = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityHigh:
+		return "high"
+	case PriorityNormal:
+		return "normal"
+	case PriorityLow:
+		return "low"
+	}
+	return fmt.Sprintf("Priority(%d)", uint8(p))
+}
+
+// Priority ranks the types: moderation is rare and a report left waiting
+// behind a vote backlog is a real problem, while a vote landing late is
+// not.
+func (t Type) Priority() Priority {
+	switch t {
+	case Report, Remove, Ban, Approve:
+		return PriorityHigh
+	case Post, Comment:
+		return PriorityNormal
+	}
+	return PriorityLow
+}
+
+// ParseType is the inverse of Type.String.
+func ParseType(s string) (Type, error) {
+	for t, name := range eventTypeNames {
+		if name == s {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown event type %q", s)
+}
+
+// Event is a single simulated user action. ID is zero until the event has
+// been stored.
+//
+// PostID is the post the action is about: the new post's ID for a post
+// event, the target post for comments and votes. CommentID is the new
+// comment's ID for a comment event, or the comment voted on for a vote on
+// a comment. ParentID is what a comment replies to: its post for a
+// top-level comment, another comment (t1_) for a reply.
+//
+// Key is the event's idempotency key, a UUID the generator assigns. A
+// redelivered event keeps its key, which is how the stores recognise it.
+//
+// Moderation events use PostID and CommentID for the thing reported,
+// removed or approved. Their User is the reporter or the moderator, and
+// Target the author of the thing, who a ban is for.
+type Event struct {
+	ID        int64     `json:"id,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	Type      Type      `json:"type"`
+	User      string    `json:"user"`
+	Subreddit string    `json:"subreddit"`
+	PostID    string    `json:"post_id,omitempty"`
+	CommentID string    `json:"comment_id,omitempty"`
+	ParentID  string    `json:"parent_id,omitempty"`
+	Target    string    `json:"target,omitempty"`
+	Payload   string    `json:"payload"`
+	Timestamp time.Time `json:"timestamp"`
+	// Client is where the event was sent from, once the enrichment stage
+	// has filled it in.
+	Client Client `json:"client,omitzero"`
+	// TraceParent is the W3C trace context of the event's trace, when it
+	// is sampled.
+	TraceParent string `json:"traceparent,omitempty"`
+
+	// Received is when a writer took the event off the channel.
+	Received time.Time `json:"-"`
+}
+
+// Client is the app or browser a user sent an event from.
+type Client struct {
+	Country    string `json:"country"`
+	Device     string `json:"device"`
+	AppVersion string `json:"app_version"`
+}
@@ -0,0 +1,70 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SchemaVersion is the version of the event JSON this build writes,
+// as its schema_version. JSON without one was written before there were
+// versions, and is version 1.
+//
+//	1: the original event
+//	2: comments have parent_id; a version 1 comment is top-level
+//	3: events may have the client they were sent from
+const SchemaVersion = 3
+
+// eventMigrations[v] upgrades a decoded version v event to version v+1.
+// Fields are only ever added, so an old event decodes as it is and its
+// migrations fill in what it didn't have: stored events, and messages
+// still on a broker from an older build, are read as the current version.
+var eventMigrations = map[int]func(*Event){
+	1: func(e *Event) {
+		if e.Type == Comment && e.ParentID == "" {
+			e.ParentID = e.PostID
+		}
+	},
+	// An older event was never enriched, and has no client to fill in
+	2: func(*Event) {},
+}
+
+// JSON is the fields of an Event, without its methods.
+type JSON Event
+
+// MarshalJSON writes the event with the current schema_version.
+func (e Event) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		SchemaVersion int `json:"schema_version"`
+		JSON
+	}{SchemaVersion, JSON(e)})
+}
+
+// UnmarshalJSON reads an event of any version up to the current one and
+// migrates it to the current one.
+func (e *Event) UnmarshalJSON(data []byte) error {
+	v := struct {
+		SchemaVersion int `json:"schema_version"`
+		*JSON
+	}{JSON: (*JSON)(e)}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return Migrate(e, v.SchemaVersion)
+}
+
+// Migrate upgrades e from version to the current version.
+func Migrate(e *Event, version int) error {
+	if version == 0 {
+		version = 1
+	}
+	if version < 0 {
+		return fmt.Errorf("event schema version %d is not a version", version)
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("event schema version %d is newer than this build's %d", version, SchemaVersion)
+	}
+	for ; version < SchemaVersion; version++ {
+		eventMigrations[version](e)
+	}
+	return nil
+}
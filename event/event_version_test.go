@@ -0,0 +1,81 @@
+package event
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      Event
+		version int
+		want    string // ParentID after migrating
+		wantErr bool
+	}{
+		{"v1 comment becomes top-level", Event{Type: Comment, PostID: "p1"}, 1, "p1", false},
+		{"unversioned is v1", Event{Type: Comment, PostID: "p1"}, 0, "p1", false},
+		{"v1 reply keeps its parent", Event{Type: Comment, PostID: "p1", ParentID: "c1"}, 1, "c1", false},
+		{"v1 post has no parent", Event{Type: Post, PostID: "p1"}, 1, "", false},
+		{"v1 vote has no parent", Event{Type: Upvote, PostID: "p1"}, 1, "", false},
+		{"v2 top-level comment left alone", Event{Type: Comment, PostID: "p1"}, 2, "", false},
+		{"current left alone", Event{Type: Comment, PostID: "p1"}, SchemaVersion, "", false},
+		{"newer than the build", Event{Type: Comment, PostID: "p1"}, SchemaVersion + 1, "", true},
+		{"negative", Event{Type: Comment, PostID: "p1"}, -1, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.in
+			err := Migrate(&e, tt.version)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Migrate(v%d) error = %v, want error %v", tt.version, err, tt.wantErr)
+			}
+			if err == nil && e.ParentID != tt.want {
+				t.Errorf("ParentID = %q, want %q", e.ParentID, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalMigrates(t *testing.T) {
+	tests := []struct {
+		name    string
+		json    string
+		want    string
+		wantErr bool
+	}{
+		{"no schema_version", `{"type":"comment","user":"u","subreddit":"s","post_id":"p1","payload":"x"}`, "p1", false},
+		{"v1", `{"schema_version":1,"type":"comment","post_id":"p1"}`, "p1", false},
+		{"v2", `{"schema_version":2,"type":"comment","post_id":"p1"}`, "", false},
+		{"too new", `{"schema_version":99,"type":"comment","post_id":"p1"}`, "", true},
+		{"negative", `{"schema_version":-1,"type":"comment","post_id":"p1"}`, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var e Event
+			err := json.Unmarshal([]byte(tt.json), &e)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unmarshal error = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && e.ParentID != tt.want {
+				t.Errorf("ParentID = %q, want %q", e.ParentID, tt.want)
+			}
+		})
+	}
+}
+
+func TestMarshalWritesVersion(t *testing.T) {
+	data, err := json.Marshal(Event{Type: Post, PostID: "p1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf(`"schema_version":%d`, SchemaVersion)) {
+		t.Errorf("%s: no schema_version %d", data, SchemaVersion)
+	}
+	var back Event
+	if err := json.Unmarshal(data, &back); err != nil || back.Type != Post || back.PostID != "p1" {
+		t.Errorf("round trip = %+v, %v", back, err)
+	}
+}
@@ -0,0 +1,9 @@
+package event
+
+// Thing is a post or comment, in Reddit's terminology.
+type Thing struct {
+	ID        string
+	PostID    string // the post a comment belongs to; a post's own ID
+	Subreddit string // the post's subreddit
+	Author    string
+}
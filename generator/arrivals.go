@@ -0,0 +1,73 @@
+package generator
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"web-traffic-sim/config"
+)
+
+// Arrivals is an arrival process: when the next event of a stream of rate()
+// events/second happens. The rate is read at every arrival, so it can be
+// changed while the stream is running.
+type Arrivals struct {
+	r       *rand.Rand
+	rate    func() float64
+	poisson bool
+}
+
+func NewArrivals(r *rand.Rand, rate func() float64, process string) Arrivals {
+	return Arrivals{r: r, rate: rate, poisson: process == config.ArrivalPoisson}
+}
+
+// gap returns the time until the next arrival. Poisson arrivals have
+// exponentially distributed gaps with mean 1/rate: mostly short, now and
+// then long, so events bunch up the way real users do and queues build
+// and drain instead of sitting at a steady level.
+func (a Arrivals) gap() time.Duration {
+	mean := float64(time.Second) / a.rate()
+	if a.poisson {
+		return time.Duration(a.r.ExpFloat64() * mean)
+	}
+	return time.Duration(mean)
+}
+
+// maxLag bounds how far a paced stream may fall behind schedule. After a
+// long stall on a full channel the stream skips ahead instead of emitting
+// everything it owes in one burst.
+const maxLag = time.Second
+
+// Pace calls send at every arrival until ctx is done or stop fires (a nil
+// stop never fires). Arrivals closer together than minTick are sent
+// back-to-back from a single wake-up rather than sleeping for each one.
+// send returns false to stop early.
+func Pace(ctx context.Context, a Arrivals, stop <-chan time.Time, send func() bool) error {
+	next := time.Now().Add(a.gap())
+	timer := time.NewTimer(max(time.Until(next), minTick))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stop:
+			return nil
+		case now := <-timer.C:
+			if now.Sub(next) > maxLag {
+				next = now
+			}
+			for !next.After(now) {
+				if !send() {
+					return ctx.Err()
+				}
+				next = next.Add(a.gap())
+			}
+			timer.Reset(max(time.Until(next), minTick))
+		}
+	}
+}
+
+// minTick bounds how often a generator wakes up. Above 1000 events/s per
+// generator, each wake-up emits several events instead of sleeping less.
+const minTick = time.Millisecond
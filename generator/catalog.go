@@ -0,0 +1,118 @@
+package generator
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"web-traffic-sim/config"
+)
+
+// Catalog is the set of subreddits posts go to, each with a
+// popularity weight. It is read-only once built, so every generator shares
+// one.
+type Catalog struct {
+	names []string
+	cum   []float64 // cumulative weights, for picking
+	// Share is each subreddit's fraction of the total weight: the share of
+	// the traffic it should get.
+	Share map[string]float64
+}
+
+// NewCatalog loads cfg.SubredditFile, or else generates
+// cfg.Subreddits subreddits named subreddit_0, subreddit_1, ... whose
+// weights fall off as a Zipf power law of exponent cfg.Skew (equal weights
+// when it's 0).
+func NewCatalog(cfg config.Generator) (*Catalog, error) {
+	if cfg.SubredditFile != "" {
+		return loadSubreddits(cfg.SubredditFile)
+	}
+	names := make([]string, cfg.Subreddits)
+	weights := make([]float64, cfg.Subreddits)
+	for i := range names {
+		names[i] = fmt.Sprintf("subreddit_%d", i)
+		weights[i] = 1
+		if cfg.Skew > 0 {
+			weights[i] = math.Pow(float64(i+1), -cfg.Skew)
+		}
+	}
+	return buildCatalog(names, weights), nil
+}
+
+// loadSubreddits reads a catalog file: one subreddit per line, optionally
+// followed by its weight (default 1). Blank lines and lines starting with
+// # are skipped.
+//
+//	AskReddit 40
+//	golang    2.5
+//	programming
+func loadSubreddits(path string) (*Catalog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		names   []string
+		weights []float64
+		seen    = map[string]bool{}
+	)
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		name, weight := fields[0], 1.0
+		switch {
+		case len(fields) > 2:
+			return nil, fmt.Errorf("%s:%d: want a name and an optional weight", path, n)
+		case len(fields) == 2:
+			weight, err = strconv.ParseFloat(fields[1], 64)
+			if err != nil || weight <= 0 {
+				return nil, fmt.Errorf("%s:%d: weight must be a positive number, got %q", path, n, fields[1])
+			}
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("%s:%d: %s is listed twice", path, n, name)
+		}
+		seen[name] = true
+		names = append(names, name)
+		weights = append(weights, weight)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("%s lists no subreddits", path)
+	}
+	return buildCatalog(names, weights), nil
+}
+
+func buildCatalog(names []string, weights []float64) *Catalog {
+	c := &Catalog{names: names, cum: make([]float64, len(names)), Share: make(map[string]float64, len(names))}
+	total := 0.0
+	for i, w := range weights {
+		total += w
+		c.cum[i] = total
+	}
+	for i, w := range weights {
+		c.Share[names[i]] = w / total
+	}
+	return c
+}
+
+// Pick draws a subreddit with probability proportional to its weight.
+func (c *Catalog) Pick(r *rand.Rand) string {
+	x := r.Float64() * c.cum[len(c.cum)-1]
+	i := sort.SearchFloat64s(c.cum, x)
+	return c.names[min(i, len(c.names)-1)]
+}
+
+func (c *Catalog) size() int { return len(c.names) }
@@ -0,0 +1,174 @@
+package generator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"web-traffic-sim/config"
+)
+
+// corpus is what the text generator learns from: enough Reddit-flavoured
+// sentences for its chain to produce varied, plausible-looking text.
+const corpus = `
+I finally got the database migration working after three days of debugging.
+Does anyone else think the new update made the app slower?
+This is the best explanation of the problem I have read so far.
+My cat knocked the router off the shelf and now the whole house is offline.
+Can someone explain why the index is not used when the query has a function in it?
+I have been running this setup for two years and it never failed once.
+The real answer is that it depends on your workload and your budget.
+We tried the same thing at work and it made the latency much worse.
+Honestly the documentation is better than most people give it credit for.
+Today I learned that octopuses have three hearts and blue blood.
+What is the one game you keep coming back to after all these years?
+The trick is to batch your writes and let the database do the heavy lifting.
+Nobody talks about how much time goes into reading logs at three in the morning.
+This thread is gold and I am saving it for later.
+I switched to a standing desk last month and my back has never felt better.
+The movie was fine but the book is so much better in every way.
+Why does every city think it has the best pizza in the country?
+Just finished my first marathon and I can barely walk today.
+Is it worth learning Go in this year or should I stick with Python?
+The queue kept growing until the workers finally caught up at midnight.
+My grandmother still uses the same recipe she learned seventy years ago.
+Serious question: how do you keep a side project going for more than a week?
+I read the whole paper and the results are not as impressive as the headline says.
+Every time I think I understand time zones something new breaks.
+The view from the top of the mountain made the whole hike worth it.
+Please stop posting the same meme every single day.
+We moved the hot table to its own disk and the problem went away.
+Any tips for a beginner who wants to get into astronomy on a budget?
+The comments here are more interesting than the article itself.
+After the outage the team wrote a great postmortem about what went wrong.
+I did not expect this post to blow up like this, thank you all.
+The new season is slow at first but the last three episodes are amazing.
+Turns out the bug was a missing semicolon in a config file nobody remembered.
+What is something you changed in your routine that actually made a difference?
+This is why you always test your backups before you need them.
+`
+
+// Parts of Reddit's auto-generated usernames, Adjective_Noun_1234.
+var (
+	nameAdjectives = []string{
+		"Ancient", "Brave", "Calm", "Clever", "Curious", "Dapper", "Eager", "Fancy",
+		"Gentle", "Grumpy", "Happy", "Humble", "Jolly", "Lazy", "Lucky", "Mighty",
+		"Quiet", "Rapid", "Silly", "Sleepy", "Sneaky", "Sunny", "Witty", "Zesty",
+	}
+	nameNouns = []string{
+		"Badger", "Beaver", "Cactus", "Comet", "Falcon", "Ferret", "Goose", "Hedgehog",
+		"Koala", "Lemur", "Lobster", "Meerkat", "Narwhal", "Otter", "Panda", "Pickle",
+		"Raccoon", "Salmon", "Squirrel", "Taco", "Toaster", "Walrus", "Wombat",
+	}
+)
+
+// UserName gives user rank a plausible, stable Reddit username: the same
+// rank always gets the same name and different ranks never share one.
+func UserName(rank int) string {
+	a, n := len(nameAdjectives), len(nameNouns)
+	adj, round := rank%a, rank/(a*n)
+	// Shifting the noun by the adjective keeps the mapping one-to-one while
+	// neighbouring ranks (the busiest users) get different words; the
+	// number is padded with digits derived from both, and round keeps it
+	// unique.
+	noun := (rank/a + adj*5) % n
+	return fmt.Sprintf("%s_%s_%d",
+		nameAdjectives[adj*7%a], nameNouns[noun], round*10000+(adj*397+noun*131)%9000+1000)
+}
+
+// TextGen writes titles and comment bodies with a word-level Markov chain
+// trained on corpus. It's read-only once built, so generators share one
+// and each passes in its own source of randomness.
+type TextGen struct {
+	starts                   []string            // words that begin a sentence
+	next                     map[string][]string // words seen after each word; "" ends a sentence
+	titleWords, commentWords config.Distribution
+	payloadBytes             config.Distribution
+}
+
+func NewTextGen(cfg config.Content) *TextGen {
+	g := &TextGen{next: map[string][]string{}, titleWords: cfg.TitleWords, commentWords: cfg.CommentWords, payloadBytes: cfg.PayloadBytes}
+	for line := range strings.Lines(corpus) {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			continue
+		}
+		g.starts = append(g.starts, words[0])
+		for i, w := range words {
+			follow := ""
+			if i+1 < len(words) {
+				follow = words[i+1]
+			}
+			g.next[w] = append(g.next[w], follow)
+		}
+	}
+	return g
+}
+
+func (g *TextGen) Title(r *rand.Rand) string {
+	return strings.TrimSuffix(g.words(r, drawSize(r, g.titleWords)), ".")
+}
+
+func (g *TextGen) Comment(r *rand.Rand) string {
+	return g.words(r, drawSize(r, g.commentWords))
+}
+
+// Sized returns text cut or grown to a size drawn from the payload
+// distribution, or text itself when there is none. Growing keeps walking
+// the chain, so a big payload is still text rather than padding that
+// compresses to nothing when PostgreSQL TOASTs it.
+func (g *TextGen) Sized(r *rand.Rand, text string) string {
+	if g.payloadBytes.Kind == "" {
+		return text
+	}
+	n := drawSize(r, g.payloadBytes)
+	if len(text) >= n {
+		return text[:n]
+	}
+	var b strings.Builder
+	b.Grow(n + 64)
+	b.WriteString(text)
+	for b.Len() < n {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(g.words(r, 32))
+	}
+	return b.String()[:n]
+}
+
+// words walks the chain for n words, starting a new sentence whenever one
+// ends.
+func (g *TextGen) words(r *rand.Rand, n int) string {
+	var b strings.Builder
+	w := g.starts[r.Intn(len(g.starts))]
+	for i := range n {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(w)
+		follow := g.next[w]
+		if w = follow[r.Intn(len(follow))]; w == "" {
+			w = g.starts[r.Intn(len(g.starts))]
+		}
+	}
+	return b.String()
+}
+
+// drawSize draws a whole, positive size from d.
+func drawSize(r *rand.Rand, d config.Distribution) int {
+	var v float64
+	switch d.Kind {
+	case config.DistFixed:
+		v = d.Value
+	case config.DistUniform:
+		v = d.Min + r.Float64()*(d.Max-d.Min)
+	case config.DistLogNormal:
+		v = d.Value * math.Exp(d.Sigma*r.NormFloat64())
+		if d.Max > 0 {
+			v = min(max(v, d.Min), d.Max)
+		}
+	}
+	return max(int(math.Round(v)), 1)
+}
@@ -0,0 +1,256 @@
+// Package generator simulates Reddit's users: random posts, comments,
+// votes and reports, paced by an arrival process and drawn from a world of
+// subreddits and of the posts and comments made so far, so that every
+// event refers to something that exists.
+package generator
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// Random is the random generator as an event source: Next waits for the
+// next arrival of its process and makes up a random event, as Pace would
+// send one. It isn't safe for concurrent use; give every generator one of
+// its own, sharing the World.
+type Random struct {
+	a    Arrivals
+	rng  *RandSource
+	w    *World
+	next time.Time
+}
+
+func NewRandom(a Arrivals, rng *RandSource, w *World) *Random {
+	return &Random{a: a, rng: rng, w: w}
+}
+
+// Next returns the next random event once it's due, or ctx's error if ctx
+// is done first.
+func (g *Random) Next(ctx context.Context) (event.Event, error) {
+	now := time.Now()
+	if g.next.IsZero() {
+		g.next = now.Add(g.a.gap())
+	}
+	if g.next.After(now) {
+		timer := time.NewTimer(max(g.next.Sub(now), minTick))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return event.Event{}, ctx.Err()
+		case now = <-timer.C:
+		}
+	}
+	if now.Sub(g.next) > maxLag {
+		g.next = now
+	}
+	g.next = g.next.Add(g.a.gap())
+
+	e := RandomEvent(g.rng, g.w)
+	e.Payload = g.w.Text.Sized(g.rng.Rand, e.Payload)
+	return e, nil
+}
+
+// CommentVoteShare is the fraction of votes cast on comments rather than
+// on posts.
+const CommentVoteShare = 0.3
+
+// replyShare is the fraction of comments that reply to another comment
+// rather than to the post, which is what grows threads deeper.
+const replyShare = 0.5
+
+// RandomEvent simulates one user action. Comments and votes target
+// recently created posts and comments, in the subreddit of their post;
+// until any post exists everything is a post, in a subreddit picked by
+// weight from the catalog.
+func RandomEvent(rng *RandSource, w *World) event.Event {
+	e := event.Event{
+		Type:      event.UserActions[rng.Intn(len(event.UserActions))],
+		User:      UserName(rng.Users.Next()),
+		Timestamp: time.Now(),
+	}
+	if report, ok := w.Report(rng.Rand, e.User); ok {
+		return report
+	}
+
+	switch e.Type {
+	case event.Comment:
+		if rng.Float64() < replyShare {
+			if parent, ok := w.Comments.Pick(rng.Rand); ok {
+				e.Subreddit, e.PostID, e.ParentID = parent.Subreddit, parent.PostID, parent.ID
+				e.CommentID = w.Comments.Create(parent.PostID, parent.Subreddit, e.User).ID
+				e.Payload = w.Text.Comment(rng.Rand)
+				return e
+			}
+		}
+		if post, ok := w.Posts.Pick(rng.Rand); ok {
+			e.Subreddit, e.PostID, e.ParentID = post.Subreddit, post.ID, post.ID
+			e.CommentID = w.Comments.Create(post.ID, post.Subreddit, e.User).ID
+			e.Payload = w.Text.Comment(rng.Rand)
+			return e
+		}
+	case event.Upvote, event.Downvote:
+		if rng.Float64() < CommentVoteShare {
+			if comment, ok := w.Comments.Pick(rng.Rand); ok {
+				e.Subreddit, e.PostID, e.CommentID = comment.Subreddit, comment.PostID, comment.ID
+				return e
+			}
+		}
+		if post, ok := w.Posts.Pick(rng.Rand); ok {
+			e.Subreddit, e.PostID = post.Subreddit, post.ID
+			return e
+		}
+	}
+	e.Type = event.Post
+	e.Subreddit = w.Subreddits.Pick(rng.Rand)
+	e.PostID = w.Posts.Create("", e.Subreddit, e.User).ID
+	e.Payload = w.Text.Title(rng.Rand)
+	return e
+}
+
+// How many of the most recent posts and comments new events can reference.
+const (
+	RecentPosts    = 1000
+	RecentComments = 5000
+)
+
+// World is the simulated Reddit state shared by all generators: the
+// subreddit catalog, the text generator, the chance that a user's next
+// action is a report (0 with moderation off) and enough memory of what has
+// been created for new events to reference it.
+type World struct {
+	Subreddits *Catalog
+	Text       *TextGen
+	reports    float64
+	Posts      *ThingPool
+	Comments   *ThingPool
+}
+
+func NewWorld(subreddits *Catalog, text *TextGen, reports float64) *World {
+	return &World{
+		Subreddits: subreddits,
+		Text:       text,
+		reports:    reports,
+		Posts:      newThingPool("t3_", RecentPosts),
+		Comments:   newThingPool("t1_", RecentComments),
+	}
+}
+
+// RandSource is one goroutine's private source of randomness. Each
+// generator owns one, so they never contend on (or interleave draws from)
+// a shared source.
+type RandSource struct {
+	*rand.Rand
+	Users *Popularity
+}
+
+func NewRandSource(seed int64, cfg config.Generator) *RandSource {
+	r := rand.New(rand.NewSource(seed))
+	return &RandSource{
+		Rand:  r,
+		Users: newPopularity(r, cfg.Users, cfg.Skew),
+	}
+}
+
+// Popularity picks which of n users acts next. With a Zipf
+// skew, rank 0 is the most active and activity falls off as a power law,
+// so a handful of power users produce most of the traffic, as on real
+// Reddit.
+type Popularity struct {
+	r    *rand.Rand
+	N    int
+	zipf *rand.Zipf // nil for uniform activity
+}
+
+func newPopularity(r *rand.Rand, n int, skew float64) *Popularity {
+	p := &Popularity{r: r, N: n}
+	if skew > 1 {
+		p.zipf = rand.NewZipf(r, skew, 1, uint64(n-1))
+	}
+	return p
+}
+
+func (p *Popularity) Next() int {
+	if p.zipf == nil {
+		return p.r.Intn(p.N)
+	}
+	return int(p.zipf.Uint64())
+}
+
+// ThingPool hands out IDs in Reddit's "<prefix><base36>" fullname style and
+// remembers the most recent ones, so that comments and votes reference
+// things that actually exist.
+type ThingPool struct {
+	mu     sync.Mutex
+	prefix string
+	next   int64
+	recent []event.Thing // ring of the last len(recent) things
+	pos    int           // where the next one goes in recent
+	size   int
+}
+
+func newThingPool(prefix string, capacity int) *ThingPool {
+	return &ThingPool{prefix: prefix, recent: make([]event.Thing, capacity)}
+}
+
+// Create allocates a new thing by author in subreddit. postID is the parent
+// post for comments; for posts pass "" and the post's own ID is used.
+func (p *ThingPool) Create(postID, subreddit, author string) event.Thing {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.next++
+	t := event.Thing{ID: p.prefix + strconv.FormatInt(p.next, 36), PostID: postID, Subreddit: subreddit, Author: author}
+	if t.PostID == "" {
+		t.PostID = t.ID
+	}
+	p.remember(t)
+	return t
+}
+
+// Add remembers a thing that already has an ID, like one ingested from
+// Reddit, for new events to reference.
+func (p *ThingPool) Add(t event.Thing) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.remember(t)
+}
+
+func (p *ThingPool) remember(t event.Thing) {
+	p.recent[p.pos] = t
+	p.pos = (p.pos + 1) % len(p.recent)
+	p.size = min(p.size+1, len(p.recent))
+}
+
+func (p *ThingPool) Pick(r *rand.Rand) (event.Thing, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.size == 0 {
+		return event.Thing{}, false
+	}
+	return p.recent[r.Intn(p.size)], true
+}
+
+// Restore fills the pool with things, newest first, as if it had just
+// created them, and carries on numbering after the highest of their IDs.
+func (p *ThingPool) Restore(things []event.Thing) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	things = things[:min(len(things), len(p.recent))]
+	for _, t := range things {
+		if n, err := strconv.ParseInt(strings.TrimPrefix(t.ID, p.prefix), 36, 64); err == nil {
+			p.next = max(p.next, n)
+		}
+	}
+	for i := len(things) - 1; i >= 0; i-- {
+		p.remember(things[i])
+	}
+}
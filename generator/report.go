@@ -0,0 +1,48 @@
+package generator
+
+import (
+	"math/rand"
+	"time"
+
+	"web-traffic-sim/event"
+)
+
+// reportReasons are what users report things for.
+var reportReasons = []string{
+	"spam",
+	"harassment",
+	"misinformation",
+	"off-topic",
+	"breaks subreddit rules",
+	"self-promotion",
+}
+
+// Report decides whether user's next action is a report and if so returns
+// it: a report on a recent post or comment, in its subreddit.
+func (w *World) Report(r *rand.Rand, user string) (event.Event, bool) {
+	if w.reports == 0 || r.Float64() >= w.reports {
+		return event.Event{}, false
+	}
+	target, ok := w.Posts.Pick(r)
+	if !ok {
+		return event.Event{}, false
+	}
+	if r.Float64() < CommentVoteShare {
+		if comment, ok := w.Comments.Pick(r); ok {
+			target = comment
+		}
+	}
+	e := event.Event{
+		Type:      event.Report,
+		User:      user,
+		Subreddit: target.Subreddit,
+		PostID:    target.PostID,
+		Target:    target.Author,
+		Payload:   reportReasons[r.Intn(len(reportReasons))],
+		Timestamp: time.Now(),
+	}
+	if target.ID != target.PostID {
+		e.CommentID = target.ID
+	}
+	return e, true
+}
@@ -0,0 +1,170 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Exporter pushes the registry's metrics somewhere, every interval and
+// once more at exit. Prometheus scrapes /metrics
+// instead, so it isn't one.
+type Exporter interface {
+	Export(families []Family) error
+	String() string
+}
+
+// Push pushes the registry to the exporters every interval until ctx is
+// done - run it in its own goroutine. Export once more after the last
+// count, so the last push has the final counts.
+func (r *Registry) Push(ctx context.Context, interval time.Duration, exporters []Exporter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.Export(exporters)
+		}
+	}
+}
+
+// Export pushes the registry to each of the exporters once, logging the
+// ones that fail.
+func (r *Registry) Export(exporters []Exporter) {
+	families := r.Gather()
+	for _, e := range exporters {
+		if err := e.Export(families); err != nil {
+			slog.Warn("export metrics", "to", e.String(), "err", err)
+		}
+	}
+}
+
+// statsdMaxPacket keeps a packet of lines under a typical MTU.
+const statsdMaxPacket = 1400
+
+// StatsdExporter sends the metrics to a StatsD server over UDP. Counters
+// go as the increase since the last push, gauges as they are, and a
+// histogram as the observations since the last push plus its p50, p95 and
+// p99 in seconds as gauges. A label becomes the last part of the name:
+// redditsim_db_operations_total.write.
+type StatsdExporter struct {
+	addr string
+	conn net.Conn
+	// Counter values as of the last push, by line name
+	last map[string]float64
+}
+
+func NewStatsdExporter(addr string) (*StatsdExporter, error) {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("statsd %s: %w", addr, err)
+	}
+	return &StatsdExporter{addr: addr, conn: conn, last: make(map[string]float64)}, nil
+}
+
+func (s *StatsdExporter) String() string { return "statsd://" + s.addr }
+
+func (s *StatsdExporter) Export(families []Family) error {
+	var packet bytes.Buffer
+	send := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := s.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	line := func(name string, v float64, kind string) error {
+		text := name + ":" + strconv.FormatFloat(v, 'f', -1, 64) + "|" + kind + "\n"
+		if packet.Len()+len(text) > statsdMaxPacket {
+			if err := send(); err != nil {
+				return err
+			}
+		}
+		packet.WriteString(text)
+		return nil
+	}
+
+	for _, f := range families {
+		for _, ms := range f.Series {
+			name := f.Name
+			if f.Label != "" {
+				name += "." + statsdName(ms.Label)
+			}
+			var err error
+			switch f.Type {
+			case KindCounter:
+				err = line(name, s.delta(name, ms.Value), "c")
+			case KindGauge:
+				err = line(name, ms.Value, "g")
+			case KindHistogram:
+				l := ms.Latency
+				if err = line(name+".count", s.delta(name+".count", float64(l.Count)), "c"); err == nil && l.Count > 0 {
+					for _, p := range []struct {
+						name string
+						v    time.Duration
+					}{{"p50", l.P50}, {"p95", l.P95}, {"p99", l.P99}} {
+						if err = line(name+"."+p.name, p.v.Seconds(), "g"); err != nil {
+							break
+						}
+					}
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return send()
+}
+
+// delta returns how much a counter went up since the last push.
+func (s *StatsdExporter) delta(name string, v float64) float64 {
+	d := v - s.last[name]
+	s.last[name] = v
+	return d
+}
+
+// statsdName makes a label value safe in a StatsD metric name.
+func statsdName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', ':', '|', '@', '#', ' ', '\n':
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// JSONDumpExporter rewrites a JSON file with every metric on each push,
+// for scripts that poll a file rather than scrape /metrics. The file is
+// written aside and renamed, so a reader never sees half of one.
+type JSONDumpExporter struct {
+	Path string
+}
+
+func (d JSONDumpExporter) String() string { return d.Path }
+
+func (d JSONDumpExporter) Export(families []Family) error {
+	data, err := json.MarshalIndent(struct {
+		Time    time.Time `json:"time"`
+		Metrics []Family  `json:"metrics"`
+	}{time.Now(), families}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := d.Path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, d.Path)
+}
@@ -0,0 +1,130 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+)
+
+// Buckets are the histogram upper bounds, Prometheus-style.
+var Buckets = []time.Duration{
+	50 * time.Microsecond,
+	100 * time.Microsecond,
+	250 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	2500 * time.Microsecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+	2500 * time.Millisecond,
+	// Up to a minute, for the time events spend queued
+	5 * time.Second,
+	10 * time.Second,
+	30 * time.Second,
+	time.Minute,
+}
+
+// LatencyHistogram counts observations into latencyBuckets. It is not safe
+// for concurrent use; Histogram is one that is.
+type LatencyHistogram struct {
+	// counts[i] is the number of observations <= latencyBuckets[i]
+	// (non-cumulative); the final slot catches everything larger.
+	counts []uint64
+	sum    time.Duration
+	count  uint64
+	max    time.Duration
+}
+
+func NewLatencyHistogram() *LatencyHistogram {
+	return &LatencyHistogram{counts: make([]uint64, len(Buckets)+1)}
+}
+
+func (h *LatencyHistogram) Observe(d time.Duration) {
+	i := sort.Search(len(Buckets), func(i int) bool { return d <= Buckets[i] })
+	h.counts[i]++
+	h.sum += d
+	h.count++
+	h.max = max(h.max, d)
+}
+
+// Quantile estimates the q-th quantile (0 < q <= 1), interpolating
+// linearly inside the bucket it falls in. Anything past the last bucket
+// is reported as the largest observation.
+func (h *LatencyHistogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	rank := q * float64(h.count)
+	var cumulative float64
+	for i, n := range h.counts {
+		if n == 0 || cumulative+float64(n) < rank {
+			cumulative += float64(n)
+			continue
+		}
+		if i == len(Buckets) {
+			return h.max
+		}
+		var lower time.Duration
+		if i > 0 {
+			lower = Buckets[i-1]
+		}
+		upper := min(Buckets[i], h.max)
+		frac := (rank - cumulative) / float64(n)
+		return lower + time.Duration(frac*float64(upper-lower))
+	}
+	return h.max
+}
+
+// LatencySnapshot is a histogram's count, mean and quantiles.
+type LatencySnapshot struct {
+	Count uint64        `json:"count"`
+	Mean  time.Duration `json:"mean_ns"`
+	P50   time.Duration `json:"p50_ns"`
+	P95   time.Duration `json:"p95_ns"`
+	P99   time.Duration `json:"p99_ns"`
+	Max   time.Duration `json:"max_ns"`
+}
+
+func (h *LatencyHistogram) Snapshot() LatencySnapshot {
+	return LatencySnapshot{
+		Count: h.count,
+		Mean:  h.Mean(),
+		P50:   h.Quantile(0.50),
+		P95:   h.Quantile(0.95),
+		P99:   h.Quantile(0.99),
+		Max:   h.max,
+	}
+}
+
+func (h *LatencyHistogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Since returns the observations made after prev, an earlier clone of the
+// same histogram. max can't be un-merged, so it stays the overall maximum.
+func (h *LatencyHistogram) Since(prev *LatencyHistogram) *LatencyHistogram {
+	d := h.Clone()
+	if prev == nil {
+		return d
+	}
+	for i := range d.counts {
+		d.counts[i] -= prev.counts[i]
+	}
+	d.sum -= prev.sum
+	d.count -= prev.count
+	return d
+}
+
+func (h *LatencyHistogram) Clone() *LatencyHistogram {
+	c := *h
+	c.counts = append([]uint64(nil), h.counts...)
+	return &c
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+)
+
+// Handler serves the registry's metrics in the Prometheus text
+// exposition format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w, r.Gather())
+	})
+}
+
+func WritePrometheus(w io.Writer, families []Family) {
+	for _, f := range families {
+		if len(f.Series) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "# HELP %s %s\n", f.Name, f.Help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.Series {
+			if f.Type == KindHistogram {
+				writeHistogram(w, f.Name, f.Label, s.Label, s.Histogram)
+				continue
+			}
+			fmt.Fprintf(w, "%s%s %s\n", f.Name, promLabels(f.Label, s.Label, ""), strconv.FormatFloat(s.Value, 'f', -1, 64))
+		}
+	}
+}
+
+// promLabels formats label="value" and the le bucket label, whichever are
+// set, as a series' label set.
+func promLabels(label, value, le string) string {
+	var labels string
+	if label != "" {
+		labels = fmt.Sprintf("%s=%q", label, value)
+	}
+	if le != "" {
+		if labels != "" {
+			labels += ","
+		}
+		labels += fmt.Sprintf("le=%q", le)
+	}
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+// writeHistogram writes the series of h, labelled label="value" if label
+// is set.
+func writeHistogram(w io.Writer, name, label, value string, h *LatencyHistogram) {
+	var cumulative uint64
+	for i, bound := range Buckets {
+		cumulative += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, promLabels(label, value, strconv.FormatFloat(bound.Seconds(), 'g', -1, 64)), cumulative)
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, promLabels(label, value, "+Inf"), h.count)
+	fmt.Fprintf(w, "%s_sum%s %g\n", name, promLabels(label, value, ""), h.sum.Seconds())
+	fmt.Fprintf(w, "%s_count%s %d\n", name, promLabels(label, value, ""), h.count)
+}
@@ -0,0 +1,289 @@
+// Package metrics is the simulator's metrics registry - counters, gauges
+// and latency histograms, registered by name - and what reads it: the
+// Prometheus handler and the push exporters.
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Metric types, as the exporters name them.
+const (
+	KindCounter   = "counter"
+	KindGauge     = "gauge"
+	KindHistogram = "histogram"
+)
+
+// Registry holds the metrics the subsystems register, for the
+// exporters - Prometheus, StatsD, the JSON dump - to read, and the
+// snapshot the dashboards render. Metrics are registered at startup by
+// whatever is running, each under its exported name. Counters and gauges
+// are atomics and histograms have a lock of their own, so counting never
+// takes a lock the caller holds.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	byName   map[string]*family
+}
+
+// family is a registered metric and its series, one per label value, or
+// a single one if it has no label.
+type family struct {
+	name, help, kind string
+	label            string
+	// seconds counts nanoseconds and exports them as seconds
+	seconds bool
+
+	mu     sync.Mutex
+	series []*series
+}
+
+type series struct {
+	label     string
+	counter   *Counter
+	gauge     *Gauge
+	histogram *Histogram
+	fn        func() float64
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*family)}
+}
+
+// register adds a family. Registering a name twice is a bug, not a
+// runtime condition, so it panics.
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, dup := r.byName[f.name]; dup {
+		panic(fmt.Sprintf("metric %s registered twice", f.name))
+	}
+	r.families = append(r.families, f)
+	r.byName[f.name] = f
+	return f
+}
+
+// with returns the series for the label value, creating it with add.
+func (f *family) with(value string, add func(s *series)) *series {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, s := range f.series {
+		if s.label == value {
+			return s
+		}
+	}
+	s := &series{label: value}
+	add(s)
+	f.series = append(f.series, s)
+	return s
+}
+
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.CounterVec(name, help, "").With("")
+}
+
+// SecondsCounter registers a counter of time spent, added to with
+// addDuration and exported in seconds.
+func (r *Registry) SecondsCounter(name, help string) *Counter {
+	f := r.register(&family{name: name, help: help, kind: KindCounter, seconds: true})
+	return f.with("", func(s *series) { s.counter = new(Counter) }).counter
+}
+
+func (r *Registry) CounterVec(name, help, label string) *CounterVec {
+	return &CounterVec{r.register(&family{name: name, help: help, kind: KindCounter, label: label})}
+}
+
+// CounterFunc registers a counter kept elsewhere, read with f on export.
+func (r *Registry) CounterFunc(name, help string, f func() float64) {
+	fam := r.register(&family{name: name, help: help, kind: KindCounter})
+	fam.with("", func(s *series) { s.fn = f })
+}
+
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.GaugeVec(name, help, "").With("")
+}
+
+func (r *Registry) GaugeVec(name, help, label string) *GaugeVec {
+	return &GaugeVec{r.register(&family{name: name, help: help, kind: KindGauge, label: label})}
+}
+
+// GaugeFunc registers a gauge read with f on export.
+func (r *Registry) GaugeFunc(name, help string, f func() float64) {
+	fam := r.register(&family{name: name, help: help, kind: KindGauge})
+	fam.with("", func(s *series) { s.fn = f })
+}
+
+func (r *Registry) HistogramVec(name, help, label string) *HistogramVec {
+	return &HistogramVec{r.register(&family{name: name, help: help, kind: KindHistogram, label: label})}
+}
+
+type CounterVec struct{ f *family }
+
+// With returns the counter for a label value. Look it up once, outside
+// the hot path: it takes the family's lock.
+func (v *CounterVec) With(value string) *Counter {
+	return v.f.with(value, func(s *series) { s.counter = new(Counter) }).counter
+}
+
+type GaugeVec struct{ f *family }
+
+func (v *GaugeVec) With(value string) *Gauge {
+	return v.f.with(value, func(s *series) { s.gauge = new(Gauge) }).gauge
+}
+
+// WithFunc has the gauge for a label value read with f on export.
+func (v *GaugeVec) WithFunc(value string, f func() float64) {
+	v.f.with(value, func(s *series) { s.fn = f })
+}
+
+type HistogramVec struct{ f *family }
+
+func (v *HistogramVec) With(value string) *Histogram {
+	return v.f.with(value, func(s *series) { s.histogram = NewHistogram() }).histogram
+}
+
+// Counter is a count that only goes up. A nil counter - the metric of a
+// subsystem that isn't running - counts nothing and reads as 0.
+type Counter struct{ v atomic.Int64 }
+
+func (c *Counter) Add(n int) {
+	if c != nil {
+		c.v.Add(int64(n))
+	}
+}
+
+func (c *Counter) Inc() { c.Add(1) }
+
+func (c *Counter) AddDuration(d time.Duration) {
+	if c != nil {
+		c.v.Add(int64(d))
+	}
+}
+
+func (c *Counter) Value() int {
+	if c == nil {
+		return 0
+	}
+	return int(c.v.Load())
+}
+
+func (c *Counter) Duration() time.Duration { return time.Duration(c.Value()) }
+
+// Gauge is a value that goes up and down. A nil gauge reads as 0.
+type Gauge struct{ bits atomic.Uint64 }
+
+func (g *Gauge) Set(v float64) {
+	if g != nil {
+		g.bits.Store(math.Float64bits(v))
+	}
+}
+
+func (g *Gauge) Add(d float64) {
+	if g == nil {
+		return
+	}
+	for {
+		old := g.bits.Load()
+		if g.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+d)) {
+			return
+		}
+	}
+}
+
+func (g *Gauge) Value() float64 {
+	if g == nil {
+		return 0
+	}
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Histogram is a LatencyHistogram safe for concurrent use. A nil
+// histogram observes nothing.
+type Histogram struct {
+	mu sync.Mutex
+	h  *LatencyHistogram
+}
+
+func NewHistogram() *Histogram { return &Histogram{h: NewLatencyHistogram()} }
+
+func (h *Histogram) Observe(d time.Duration) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.h.Observe(d)
+	h.mu.Unlock()
+}
+
+func (h *Histogram) Clone() *LatencyHistogram {
+	if h == nil {
+		return NewLatencyHistogram()
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.h.Clone()
+}
+
+func (h *Histogram) Snapshot() LatencySnapshot { return h.Clone().Snapshot() }
+
+// Family is a family as gathered for the exporters.
+type Family struct {
+	Name   string   `json:"name"`
+	Help   string   `json:"help"`
+	Type   string   `json:"type"`
+	Label  string   `json:"label,omitempty"`
+	Series []Series `json:"series"`
+}
+
+type Series struct {
+	// Label is the label's value
+	Label string `json:"label,omitempty"`
+	// Value is a counter's or gauge's, times in seconds
+	Value float64 `json:"value"`
+	// Histogram is a histogram's observations
+	Histogram *LatencyHistogram `json:"-"`
+	Latency   *LatencySnapshot  `json:"latency,omitempty"`
+}
+
+// Gather reads every metric, in the order they were registered. The
+// funcs are called without the registry's lock held, so they may take
+// locks of their own.
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mu.Unlock()
+
+	out := make([]Family, 0, len(families))
+	for _, f := range families {
+		f.mu.Lock()
+		all := append([]*series(nil), f.series...)
+		f.mu.Unlock()
+
+		mf := Family{Name: f.name, Help: f.help, Type: f.kind, Label: f.label}
+		for _, s := range all {
+			ms := Series{Label: s.label}
+			switch {
+			case s.counter != nil:
+				ms.Value = float64(s.counter.Value())
+				if f.seconds {
+					ms.Value = s.counter.Duration().Seconds()
+				}
+			case s.gauge != nil:
+				ms.Value = s.gauge.Value()
+			case s.histogram != nil:
+				ms.Histogram = s.histogram.Clone()
+				l := ms.Histogram.Snapshot()
+				ms.Latency = &l
+			case s.fn != nil:
+				ms.Value = s.fn()
+			}
+			mf.Series = append(mf.Series, ms)
+		}
+		out = append(out, mf)
+	}
+	return out
+}
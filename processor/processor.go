@@ -0,0 +1,202 @@
+// Package processor drains a store's backlog. Processors claim batches of
+// unprocessed events, fold them into the store's domain model where it has
+// one, and commit the claim; several can compete for the same store, whose
+// claims make sure no event is processed twice.
+package processor
+
+import (
+	"context"
+	"time"
+
+	"web-traffic-sim/event"
+	"web-traffic-sim/store"
+)
+
+// Materializer is implemented by batches that can turn their raw events
+// into domain rows (users, posts, comments, votes) as part of processing.
+// It runs inside the claim, so the rows land if and only if the batch
+// commits.
+type Materializer interface {
+	Materialize(ctx context.Context) (store.DomainCounts, error)
+}
+
+// OutboxWriter is implemented by batches that can record an activity row
+// and an outbox entry for each of their events. Both are written in the
+// transaction that marks the batch processed, so they land if and only if
+// the batch commits - the point of the transactional outbox.
+type OutboxWriter interface {
+	WriteOutbox(ctx context.Context) error
+}
+
+// Handler processes a claimed batch's events: materializes them and writes
+// their outbox entries, where the store and the run do that, inside the
+// claim's transaction.
+type Handler func(ctx context.Context, events []event.Event) error
+
+// Observer is told what a processor does, for whatever counts, traces or
+// announces it. Its methods are called from the processor's goroutine.
+type Observer interface {
+	// Woken is called when a notification wakes processor id up.
+	Woken(id int)
+	// Claiming is called before every claim.
+	Claiming(id int)
+	// Claimed is called after a claim, with how long it took.
+	Claimed(id int, took time.Duration)
+	// Failed is called when a step of processing fails - the claim,
+	// materializing, writing the outbox or the commit - unless it was
+	// cancelled. events is the size of the batch, 0 for a failed claim.
+	Failed(id int, step string, events int, err error)
+	// Processed is called when processing a claimed batch ends, from start
+	// to end, committed or failed with err.
+	Processed(id int, events []event.Event, start, end time.Time, err error)
+	// Committed is called once a batch has been processed and committed,
+	// with how long the commit took, the domain rows it materialized and
+	// how many outbox entries it wrote.
+	Committed(id int, events []event.Event, took time.Duration, counts store.DomainCounts, outboxed int)
+}
+
+// NopObserver ignores everything, for a processor no one watches.
+type NopObserver struct{}
+
+func (NopObserver) Woken(int)                                                            {}
+func (NopObserver) Claiming(int)                                                         {}
+func (NopObserver) Claimed(int, time.Duration)                                           {}
+func (NopObserver) Failed(int, string, int, error)                                       {}
+func (NopObserver) Processed(int, []event.Event, time.Time, time.Time, error)            {}
+func (NopObserver) Committed(int, []event.Event, time.Duration, store.DomainCounts, int) {}
+
+// Run processes events from st as processor id until ctx is done or quit
+// is closed - run it in its own goroutine, one per processor.
+// It wakes up every interval, and additionally whenever wake fires (nil in
+// plain polling mode). After a wake-up it keeps claiming batches until one
+// comes back short, so a notification never leaves a backlog behind; the
+// interval then only acts as a fallback for missed notifications.
+// batchSize is read for every batch. With outbox, every batch also writes
+// the outbox. wrap, if not nil, wraps the handler of every batch.
+func Run(ctx context.Context, id int, st store.Store, interval time.Duration, batchSize func() int, outbox bool, wrap func(Handler) Handler, wake <-chan struct{}, quit <-chan struct{}, obs Observer) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-quit:
+			return
+		case <-ticker.C:
+			if _, err := ProcessBatch(ctx, id, st, batchSize(), outbox, wrap, obs); err != nil && ctx.Err() != nil {
+				return
+			}
+		case <-wake:
+			obs.Woken(id)
+
+			for {
+				size := batchSize()
+				n, err := ProcessBatch(ctx, id, st, size, outbox, wrap, obs)
+				if err != nil && ctx.Err() != nil {
+					return
+				}
+				if err != nil || n < size {
+					break
+				}
+			}
+		}
+	}
+}
+
+// ProcessBatch claims up to batchSize events, processes them and commits
+// the claim, returning how many it handled. The claim and the update happen
+// in one transaction, so an event is processed by exactly one processor.
+// Errors go to obs; the caller only needs them to decide whether to stop.
+//
+// With wrap the claimed events are processed by wrap's handler instead,
+// which can look at them before and after the rest of processing, or
+// instead of it: the claim is committed once it returns nil, whether or
+// not it called the handler it wrapped, and rolled back, leaving the
+// events to be claimed again, when it returns an error. The claim is
+// processed whole, whatever events the handler is passed.
+func ProcessBatch(ctx context.Context, id int, st store.Store, batchSize int, outbox bool, wrap func(Handler) Handler, obs Observer) (int, error) {
+	obs.Claiming(id)
+	// First claim unprocessed events
+	start := time.Now()
+	batch, err := st.Claim(ctx, batchSize)
+	readTime := time.Since(start)
+	if err != nil {
+		if ctx.Err() == nil {
+			obs.Failed(id, "claim events", 0, err)
+		}
+		return 0, err
+	}
+	// A claim that isn't committed is released to be claimed again; if
+	// even that fails, its events may be lost, which obs has to hear
+	defer func() {
+		if err := batch.Rollback(); err != nil {
+			obs.Failed(id, "roll back claim", len(batch.Events()), err)
+		}
+	}()
+
+	obs.Claimed(id, readTime)
+
+	events := batch.Events()
+	if len(events) == 0 {
+		return 0, batch.Commit(ctx)
+	}
+
+	processStart := time.Now()
+	var (
+		counts   store.DomainCounts
+		outboxed int
+		failed   bool // a step below has told obs
+	)
+	var process Handler = func(ctx context.Context, _ []event.Event) error {
+		// Process: fold the events into the domain tables, where supported
+		if m, ok := batch.(Materializer); ok {
+			var err error
+			if counts, err = m.Materialize(ctx); err != nil {
+				if ctx.Err() == nil {
+					obs.Failed(id, "materialize events", len(events), err)
+				}
+				failed = true
+				return err
+			}
+		}
+
+		// Record the activity and its outbox entries alongside
+		if w, ok := batch.(OutboxWriter); ok && outbox {
+			if err := w.WriteOutbox(ctx); err != nil {
+				if ctx.Err() == nil {
+					obs.Failed(id, "write outbox", len(events), err)
+				}
+				failed = true
+				return err
+			}
+			outboxed = len(events)
+		}
+		return nil
+	}
+	if wrap != nil {
+		process = wrap(process)
+	}
+	if err = process(ctx, events); err != nil {
+		if !failed && ctx.Err() == nil {
+			obs.Failed(id, "process events", len(events), err)
+		}
+		obs.Processed(id, events, processStart, time.Now(), err)
+		return 0, err
+	}
+
+	// Mark the batch processed and release the claim
+	start = time.Now()
+	err = batch.Commit(ctx)
+	updateTime := time.Since(start)
+	obs.Processed(id, events, processStart, start.Add(updateTime), err)
+	if err != nil {
+		if ctx.Err() == nil {
+			obs.Failed(id, "commit batch", len(events), err)
+		}
+		return 0, err
+	}
+
+	obs.Committed(id, events, updateTime, counts, outboxed)
+	return len(events), nil
+}
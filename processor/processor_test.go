@@ -0,0 +1,127 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+	"web-traffic-sim/store"
+)
+
+// newPipeline opens a memory store holding n generated events.
+func newPipeline(t *testing.T, n int) store.Store {
+	t.Helper()
+	cfg := config.Default()
+	cfg.Backend = config.BackendMemory
+	cfg.MemoryCapacity = n
+	st, err := store.Open(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { st.Close() })
+
+	subreddits, err := generator.NewCatalog(cfg.Generator)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := generator.NewWorld(subreddits, generator.NewTextGen(cfg.Content), 0)
+	rng := generator.NewRandSource(1, cfg.Generator)
+	events := make([]event.Event, n)
+	for i := range events {
+		events[i] = generator.RandomEvent(rng, w)
+	}
+	if err := st.InsertBatch(context.Background(), events); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestProcessBatchPipeline(t *testing.T) {
+	const n, batchSize = 250, 40
+	st := newPipeline(t, n)
+
+	seen := make(map[int64]bool)
+	record := func(next Handler) Handler {
+		return func(ctx context.Context, events []event.Event) error {
+			for _, e := range events {
+				if seen[e.ID] {
+					t.Errorf("event %d processed twice", e.ID)
+				}
+				seen[e.ID] = true
+			}
+			return next(ctx, events)
+		}
+	}
+	total := 0
+	for {
+		got, err := ProcessBatch(context.Background(), 0, st, batchSize, false, record, NopObserver{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got > batchSize {
+			t.Fatalf("processed %d events in one batch of %d", got, batchSize)
+		}
+		if got == 0 {
+			break
+		}
+		total += got
+	}
+	if total != n || len(seen) != n {
+		t.Errorf("processed %d events (%d distinct), want %d", total, len(seen), n)
+	}
+}
+
+func TestProcessBatchRollsBack(t *testing.T) {
+	const n = 10
+	st := newPipeline(t, n)
+
+	errStage := errors.New("stage failed")
+	fail := func(Handler) Handler {
+		return func(context.Context, []event.Event) error { return errStage }
+	}
+	if got, err := ProcessBatch(context.Background(), 0, st, n, false, fail, NopObserver{}); !errors.Is(err, errStage) || got != 0 {
+		t.Fatalf("ProcessBatch = %d, %v, want 0, %v", got, err, errStage)
+	}
+	// The failed claim's events are claimed again
+	if got, err := ProcessBatch(context.Background(), 0, st, n, false, nil, NopObserver{}); err != nil || got != n {
+		t.Errorf("after rollback ProcessBatch = %d, %v, want %d", got, err, n)
+	}
+}
+
+// failures records the steps obs was told failed.
+type failures struct {
+	NopObserver
+	steps []string
+}
+
+func (f *failures) Failed(_ int, step string, _ int, _ error) { f.steps = append(f.steps, step) }
+
+func TestProcessBatchReportsLostRollback(t *testing.T) {
+	const n = 10
+	st := newPipeline(t, n)
+
+	// While the claim is held, new events take the room it left
+	fill := func(Handler) Handler {
+		return func(ctx context.Context, events []event.Event) error {
+			more := make([]event.Event, len(events))
+			if err := st.InsertBatch(ctx, more); err != nil {
+				t.Fatal(err)
+			}
+			return errors.New("stage failed")
+		}
+	}
+	obs := &failures{}
+	if _, err := ProcessBatch(context.Background(), 0, st, n, false, fill, obs); err == nil {
+		t.Fatal("ProcessBatch succeeded, want the stage's error")
+	}
+	if !slices.Contains(obs.steps, "roll back claim") {
+		t.Errorf("failed steps %q, want the rollback among them", obs.steps)
+	}
+	if lost := st.(interface{ Lost() int64 }).Lost(); lost != n {
+		t.Errorf("lost %d events, want %d", lost, n)
+	}
+}
@@ -0,0 +1,207 @@
+package simulator
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+	"web-traffic-sim/metrics"
+)
+
+// personaStats tracks the users of one persona.
+type personaStats struct {
+	name    string
+	users   int
+	online  metrics.Gauge
+	events  metrics.Counter
+	flagged metrics.Counter // users the detector flagged
+}
+
+type personaSnapshot struct {
+	Name         string  `json:"name"`
+	Users        int     `json:"users"`
+	Online       int     `json:"online"`
+	Events       int     `json:"events"`
+	EventsPerSec float64 `json:"events_per_sec"`
+	Flagged      int     `json:"flagged"`
+}
+
+// actorStep is where a user is in its browse → vote → comment loop.
+type actorStep uint8
+
+const (
+	stepBrowse actorStep = iota
+	stepComment
+)
+
+// actor is one simulated user. Unlike the generators' stateless events,
+// what it does next depends on what it did last: it comments on the post
+// it just voted on. How likely it is to, and how active it is, depends on
+// its persona.
+type actor struct {
+	user      string
+	persona   int // index into config.Actors.Personas and metrics.personas
+	p         config.Persona
+	subreddit string      // where this session's posts go
+	reading   event.Thing // the post (or comment) it last looked at
+	step      actorStep
+}
+
+// activityScale turns persona activity into the integer the online total
+// is kept in.
+const activityScale = 1000
+
+// runActors simulates cfg.Actors.Count users until ctx is done. The users
+// online share the global rate in proportion to their persona's activity,
+// so however many are logged on, the event rate follows the controls; each
+// user's think time between actions is drawn from the generators' arrival
+// process.
+func runActors(ctx context.Context, cfg *config.Config, ctl *Controls, w *generator.World, queue *eventQueue, metrics *RedditMetrics) {
+	personas := cfg.Actors.Personas
+	assigned := assignPersonas(cfg.Actors.Count, personas)
+
+	metrics.mutex.Lock()
+	metrics.personas = make([]personaStats, len(personas))
+	for i, p := range personas {
+		metrics.personas[i].name = p.Name
+	}
+	metrics.personaOf = make(map[string]int, len(assigned))
+	for i, p := range assigned {
+		metrics.personas[p].users++
+		metrics.personaOf[generator.UserName(i)] = p
+	}
+	metrics.mutex.Unlock()
+
+	// Total activity of the users online, in activityScale units
+	var online atomic.Int64
+	var wg sync.WaitGroup
+	for i, persona := range assigned {
+		act := &actor{user: generator.UserName(i), persona: persona, p: personas[persona]}
+		weight := int64(act.p.Activity * activityScale)
+		share := func() float64 {
+			return ctl.Rate() * float64(weight) / float64(max(online.Load(), weight))
+		}
+		rng := generator.NewRandSource(cfg.Generator.Seed+int64(i), cfg.Generator)
+		a := generator.NewArrivals(rng.Rand, share, cfg.Generator.Arrivals)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			act.live(ctx, cfg.Actors, a, rng, w, queue, &online, weight, metrics)
+		}()
+	}
+	wg.Wait()
+}
+
+// assignPersonas gives each of n users a persona, in exact proportion to
+// the shares and spread evenly over the users.
+func assignPersonas(n int, personas []config.Persona) []int {
+	total := 0.0
+	for _, p := range personas {
+		total += p.Share
+	}
+	assigned := make([]int, n)
+	for i := range assigned {
+		// Where user i falls on the cumulative shares
+		x := (float64(i) + 0.5) / float64(n) * total
+		for p := range personas {
+			assigned[i] = p
+			if x -= personas[p].Share; x < 0 {
+				break
+			}
+		}
+	}
+	return assigned
+}
+
+// live alternates sessions and idle spells until ctx is done. Both last an
+// exponentially distributed time; the first idle spell is uniform, so the
+// users don't all log on together.
+func (act *actor) live(ctx context.Context, cfg config.Actors, a generator.Arrivals, rng *generator.RandSource, w *generator.World, queue *eventQueue, online *atomic.Int64, weight int64, metrics *RedditMetrics) {
+	idle := time.Duration(rng.Float64() * float64(cfg.Idle))
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(idle):
+		}
+
+		online.Add(weight)
+		metrics.activeUsers.Add(1)
+		metrics.personas[act.persona].online.Add(1)
+
+		act.subreddit = w.Subreddits.Pick(rng.Rand)
+		act.step = stepBrowse
+		session := time.NewTimer(time.Duration(rng.ExpFloat64() * float64(cfg.Session)))
+		err := generator.Pace(ctx, a, session.C, func() bool {
+			e := act.next(rng, w)
+			e.Payload = w.Text.Sized(rng.Rand, e.Payload)
+			if !queue.send(ctx, e) {
+				return false
+			}
+
+			metrics.countEvent(e)
+			metrics.personas[act.persona].events.Inc()
+			return true
+		})
+		session.Stop()
+
+		online.Add(-weight)
+		metrics.activeUsers.Add(-1)
+		metrics.personas[act.persona].online.Add(-1)
+		if err != nil {
+			return
+		}
+		idle = time.Duration(rng.ExpFloat64() * float64(cfg.Idle))
+	}
+}
+
+// next takes the user one step through its loop and returns what it did.
+func (act *actor) next(rng *generator.RandSource, w *generator.World) event.Event {
+	e := event.Event{
+		User:      act.user,
+		Timestamp: time.Now(),
+	}
+
+	if act.step == stepComment {
+		// Reply to what was read: a comment, or the post itself
+		e.Type = event.Comment
+		e.Subreddit, e.PostID, e.ParentID = act.reading.Subreddit, act.reading.PostID, act.reading.ID
+		e.CommentID = w.Comments.Create(act.reading.PostID, act.reading.Subreddit, act.user).ID
+		e.Payload = w.Text.Comment(rng.Rand)
+		act.step = stepBrowse
+		return e
+	}
+
+	if report, ok := w.Report(rng.Rand, act.user); ok {
+		return report
+	}
+
+	// Read something and vote on it, unless it's time to post
+	read, ok := w.Posts.Pick(rng.Rand)
+	if !ok || rng.Float64() < act.p.Post {
+		e.Type = event.Post
+		e.Subreddit = act.subreddit
+		e.PostID = w.Posts.Create("", act.subreddit, act.user).ID
+		e.Payload = w.Text.Title(rng.Rand)
+		return e
+	}
+	if rng.Float64() < generator.CommentVoteShare {
+		if comment, ok := w.Comments.Pick(rng.Rand); ok {
+			read = comment
+			e.CommentID = comment.ID
+		}
+	}
+	e.Type, e.Subreddit, e.PostID = event.Upvote, read.Subreddit, read.PostID
+	if rng.Float64() < act.p.Downvote {
+		e.Type = event.Downvote
+	}
+	act.reading = read
+	if rng.Float64() < act.p.Comment {
+		act.step = stepComment
+	}
+	return e
+}
@@ -0,0 +1,36 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// registerAdmin mounts the run controls:
+//
+//	GET  /admin/controls
+//	POST /admin/controls   {"rate":2000,"writers":4,"write_batch":100,...}
+//
+// A POST changes only the fields it sets and answers with every control's
+// new value, so turning the rate up past what the writers can take and
+// back down shows backpressure form and drain without a restart.
+func registerAdmin(mux *http.ServeMux, ctl *Controls) {
+	mux.HandleFunc("GET /admin/controls", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ctl.settings())
+	})
+
+	mux.HandleFunc("POST /admin/controls", func(w http.ResponseWriter, r *http.Request) {
+		var s controlSettings
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&s); err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid controls: %w", err))
+			return
+		}
+		if err := ctl.apply(s); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, ctl.settings())
+	})
+}
@@ -0,0 +1,219 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"web-traffic-sim/event"
+	"web-traffic-sim/store"
+)
+
+// eventQuerier is implemented by stores that keep events around after
+// they're processed and can answer ad-hoc queries about them.
+type eventQuerier interface {
+	// ListEvents returns up to f.Limit events matching f, in ID order.
+	ListEvents(ctx context.Context, f store.EventFilter) ([]store.StoredEvent, error)
+	// GetEvent returns store.ErrEventNotFound if there is no event with id.
+	GetEvent(ctx context.Context, id int64) (store.StoredEvent, error)
+}
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 1000
+)
+
+// eventPage is one page of a listing. Pass Next as ?after= to get the
+// following page; it is omitted on the last one.
+type eventPage struct {
+	Events []store.StoredEvent `json:"events"`
+	Next   int64               `json:"next,omitempty"`
+}
+
+// registerAPI mounts the read-only JSON API:
+//
+//	GET /events                    ?type=&processed=&after=&limit=
+//	GET /events/{id}
+//	GET /subreddits/{name}/posts   ?after=&limit=
+//	GET /leaderboards
+//	GET /leaderboards/{board}      top_posts, top_commenters or active_subreddits
+//	GET /analytics                 ?limit=
+//	GET /stats
+//
+// The event endpoints need a store that implements eventQuerier, the
+// leaderboards one that implements leaderboardStore and the analytics one
+// that implements viewStore; they answer 501 otherwise. /stats always
+// works.
+func registerAPI(mux *http.ServeMux, st store.Store, metrics *RedditMetrics) {
+	mux.HandleFunc("GET /stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, metrics.Snapshot())
+	})
+
+	if lb, ok := st.(leaderboardStore); ok {
+		mux.HandleFunc("GET /leaderboards", func(w http.ResponseWriter, r *http.Request) {
+			boards, err := lb.Leaderboards(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, boards)
+		})
+		mux.HandleFunc("GET /leaderboards/{board}", func(w http.ResponseWriter, r *http.Request) {
+			boards, err := lb.Leaderboards(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			i := slices.IndexFunc(boards, func(b store.Leaderboard) bool { return b.Board == r.PathValue("board") })
+			if i < 0 {
+				writeError(w, http.StatusNotFound, errBoardNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, boards[i])
+		})
+	} else {
+		unsupported := func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotImplemented, errors.New("this backend does not keep leaderboards"))
+		}
+		mux.HandleFunc("GET /leaderboards", unsupported)
+		mux.HandleFunc("GET /leaderboards/{board}", unsupported)
+	}
+
+	if vs, ok := st.(viewStore); ok {
+		mux.HandleFunc("GET /analytics", func(w http.ResponseWriter, r *http.Request) {
+			limit := 10
+			if v := r.URL.Query().Get("limit"); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 1 || n > maxPageSize {
+					writeError(w, http.StatusBadRequest, errors.New("limit must be between 1 and 1000"))
+					return
+				}
+				limit = n
+			}
+			analytics, err := vs.Analytics(r.Context(), limit)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, analytics)
+		})
+	} else {
+		mux.HandleFunc("GET /analytics", func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotImplemented, errors.New("this backend does not keep analytics views"))
+		})
+	}
+
+	q, ok := st.(eventQuerier)
+	if !ok {
+		unsupported := func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotImplemented, errors.New("this backend does not keep queryable events"))
+		}
+		mux.HandleFunc("GET /events", unsupported)
+		mux.HandleFunc("GET /events/{id}", unsupported)
+		mux.HandleFunc("GET /subreddits/{name}/posts", unsupported)
+		return
+	}
+
+	mux.HandleFunc("GET /events", func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		listEvents(w, r, q, f)
+	})
+
+	mux.HandleFunc("GET /events/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, errors.New("id must be an integer"))
+			return
+		}
+		e, err := q.GetEvent(r.Context(), id)
+		switch {
+		case errors.Is(err, store.ErrEventNotFound):
+			writeError(w, http.StatusNotFound, err)
+		case err != nil:
+			writeError(w, http.StatusInternalServerError, err)
+		default:
+			writeJSON(w, http.StatusOK, e)
+		}
+	})
+
+	mux.HandleFunc("GET /subreddits/{name}/posts", func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseFilter(r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+		post := event.Post
+		f.Type = &post
+		f.Subreddit = r.PathValue("name")
+		listEvents(w, r, q, f)
+	})
+}
+
+func listEvents(w http.ResponseWriter, r *http.Request, q eventQuerier, f store.EventFilter) {
+	events, err := q.ListEvents(r.Context(), f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	page := eventPage{Events: events}
+	if page.Events == nil {
+		page.Events = []store.StoredEvent{}
+	}
+	if len(events) == f.Limit {
+		page.Next = events[len(events)-1].ID
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// parseFilter reads the type, processed, after and limit query parameters.
+func parseFilter(r *http.Request) (store.EventFilter, error) {
+	query := r.URL.Query()
+	f := store.EventFilter{Limit: defaultPageSize}
+
+	if v := query.Get("type"); v != "" {
+		t, err := event.ParseType(v)
+		if err != nil {
+			return f, err
+		}
+		f.Type = &t
+	}
+	if v := query.Get("processed"); v != "" {
+		p, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, errors.New("processed must be true or false")
+		}
+		f.Processed = &p
+	}
+	if v := query.Get("after"); v != "" {
+		after, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, errors.New("after must be an event id")
+		}
+		f.After = after
+	}
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return f, errors.New("limit must be between 1 and 1000")
+		}
+		f.Limit = limit
+	}
+	return f, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
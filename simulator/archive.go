@@ -0,0 +1,209 @@
+package simulator
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/parquet-go/parquet-go"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// archiveDest is where archived events are kept.
+type archiveDest interface {
+	// Put stores what r yields under name, a slash-separated path. Nothing
+	// is kept if reading r fails.
+	Put(ctx context.Context, name string, r io.Reader) error
+	String() string
+}
+
+// newArchiveDest returns the archive at location: s3://bucket/prefix on
+// the object store s3 describes, or else a directory.
+func newArchiveDest(location string, s3 config.S3) (archiveDest, error) {
+	if rest, ok := strings.CutPrefix(location, "s3://"); ok {
+		bucket, prefix, _ := strings.Cut(rest, "/")
+		return newS3Archive(s3, bucket, prefix)
+	}
+	if err := os.MkdirAll(location, 0o755); err != nil {
+		return nil, err
+	}
+	return dirArchive(location), nil
+}
+
+// dirArchive keeps archives as files under a directory. Each is written
+// to a temporary file and renamed into place, so a file that is there is
+// complete.
+type dirArchive string
+
+func (d dirArchive) Put(ctx context.Context, name string, r io.Reader) error {
+	path := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".archive-*")
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+func (d dirArchive) String() string { return string(d) }
+
+// s3Archive keeps archives as objects under a prefix of a bucket. An
+// object is uploaded in parts as it's encoded, and only appears once the
+// last part is in.
+type s3Archive struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+func newS3Archive(c config.S3, bucket, prefix string) (*s3Archive, error) {
+	creds := credentials.NewEnvAWS()
+	if c.AccessKey != "" {
+		creds = credentials.NewStaticV4(c.AccessKey, c.SecretKey, "")
+	}
+	client, err := minio.New(c.Endpoint, &minio.Options{Creds: creds, Secure: !c.Insecure, Region: c.Region})
+	if err != nil {
+		return nil, err
+	}
+	// Better to find a missing bucket or bad credentials now than on
+	// the first upload
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	exists, err := client.BucketExists(ctx, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("s3://%s: %w", bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("s3://%s: no such bucket", bucket)
+	}
+	return &s3Archive{client: client, bucket: bucket, prefix: strings.Trim(prefix, "/")}, nil
+}
+
+// s3PartSize is the size of the parts an object of unknown size is
+// uploaded in, and the memory each upload buffers: S3's smallest.
+const s3PartSize = 5 << 20
+
+func (a *s3Archive) Put(ctx context.Context, name string, r io.Reader) error {
+	contentType := "application/gzip"
+	if strings.HasSuffix(name, ".parquet") {
+		contentType = "application/vnd.apache.parquet"
+	}
+	_, err := a.client.PutObject(ctx, a.bucket, path.Join(a.prefix, name), r, -1, minio.PutObjectOptions{
+		ContentType: contentType,
+		PartSize:    s3PartSize,
+	})
+	return err
+}
+
+func (a *s3Archive) String() string { return "s3://" + path.Join(a.bucket, a.prefix) }
+
+// runStamp names the directory a run's archives go in after when it
+// started.
+func runStamp(start time.Time) string { return start.UTC().Format("20060102T150405Z") }
+
+// archiveExt is the file extension of each archive format.
+var archiveExt = map[string]string{
+	config.FormatNDJSON:  ".ndjson.gz",
+	config.FormatParquet: ".parquet",
+}
+
+// archiveEncoder encodes events in an archive format.
+type archiveEncoder interface {
+	encode(event.Event) error
+	// close writes out whatever is buffered; w isn't closed.
+	close() error
+}
+
+func newArchiveEncoder(format string, w io.Writer) archiveEncoder {
+	if format == config.FormatParquet {
+		return &parquetEncoder{w: newParquetWriter(w)}
+	}
+	gz := gzip.NewWriter(w)
+	return ndjsonEncoder{gz: gz, enc: json.NewEncoder(gz)}
+}
+
+// ndjsonEncoder writes one JSON object per line, gzipped.
+type ndjsonEncoder struct {
+	gz  *gzip.Writer
+	enc *json.Encoder
+}
+
+func (e ndjsonEncoder) encode(ev event.Event) error { return e.enc.Encode(ev) }
+func (e ndjsonEncoder) close() error                { return e.gz.Close() }
+
+// parquetEncoder writes a Parquet file, a row group at a time.
+type parquetEncoder struct {
+	w   *parquet.GenericWriter[parquetEvent]
+	row [1]parquetEvent
+}
+
+func (e *parquetEncoder) encode(ev event.Event) error {
+	e.row[0] = newParquetEvent(ev)
+	_, err := e.w.Write(e.row[:])
+	return err
+}
+
+func (e *parquetEncoder) close() error { return e.w.Close() }
+
+// writeArchive streams the events each emits to dest as name, in format,
+// and returns how many there were and the compressed size. The events are
+// encoded as dest reads them, so an NDJSON archive of any size takes no
+// more memory than the gzip window, and a Parquet one no more than a row
+// group.
+func writeArchive(ctx context.Context, dest archiveDest, name, format string, each func(emit func(event.Event) error) error) (events int, size int64, err error) {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		enc := newArchiveEncoder(format, pw)
+		err := each(func(e event.Event) error {
+			events++
+			return enc.encode(e)
+		})
+		if err == nil {
+			err = enc.close()
+		}
+		pw.CloseWithError(err)
+	}()
+
+	counted := &countingReader{r: pr}
+	err = dest.Put(ctx, name, counted)
+	// Unblocks the encoder if dest gave up before the end
+	pr.CloseWithError(io.ErrClosedPipe)
+	<-done
+	return events, counted.n, err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,215 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// domainStats totals the store.DomainCounts of every Materialize call,
+// for the processors to add to without the metrics mutex.
+type domainStats struct {
+	users, subreddits, posts, comments, votes metrics.Counter
+	reports, removed, bans                    metrics.Counter
+
+	deepest, busiest maxRecord
+}
+
+func (s *domainStats) add(o store.DomainCounts) {
+	s.users.Add(o.Users)
+	s.subreddits.Add(o.Subreddits)
+	s.posts.Add(o.Posts)
+	s.comments.Add(o.Comments)
+	s.votes.Add(o.Votes)
+	s.reports.Add(o.Reports)
+	s.removed.Add(o.Removed)
+	s.bans.Add(o.Bans)
+	s.deepest.offer(o.Deepest, o.DeepestPost)
+	s.busiest.offer(o.Busiest, o.BusiestPost)
+}
+
+func (s *domainStats) snapshot() domainSnapshot {
+	d := domainSnapshot{
+		Users:      s.users.Value(),
+		Subreddits: s.subreddits.Value(),
+		Posts:      s.posts.Value(),
+		Comments:   s.comments.Value(),
+		Votes:      s.votes.Value(),
+		Reports:    s.reports.Value(),
+		Removed:    s.removed.Value(),
+		Bans:       s.bans.Value(),
+	}
+	d.DeepestThread, d.DeepestPost = s.deepest.get()
+	d.BusiestComments, d.BusiestPost = s.busiest.get()
+	return d
+}
+
+// maxRecord is the largest n offered so far and the post it was for.
+type maxRecord struct {
+	p atomic.Pointer[record]
+}
+
+type record struct {
+	n    int
+	post string
+}
+
+func (r *maxRecord) offer(n int, post string) {
+	for {
+		cur := r.p.Load()
+		if n <= 0 || cur != nil && n <= cur.n {
+			return
+		}
+		if r.p.CompareAndSwap(cur, &record{n, post}) {
+			return
+		}
+	}
+}
+
+func (r *maxRecord) get() (int, string) {
+	if cur := r.p.Load(); cur != nil {
+		return cur.n, cur.post
+	}
+	return 0, ""
+}
+
+// notifier is implemented by stores that can push a signal when new events
+// arrive, letting the processor react instead of polling.
+type notifier interface {
+	// Notify returns a channel that receives a value whenever new events
+	// may be available. Bursts are coalesced. The subscription ends when
+	// ctx is cancelled.
+	Notify(ctx context.Context) (<-chan struct{}, error)
+}
+
+// connectStore is store.Open for a backend that may not be up yet - a
+// database starting beside the simulator under docker compose, say. It
+// retries transient failures, backing off exponentially up to
+// maxRetryDelay, until cfg.ConnectTimeout has passed or ctx is done.
+func connectStore(ctx context.Context, cfg *config.Config) (store.Store, error) {
+	deadline := time.Now().Add(cfg.ConnectTimeout)
+	delay := 250 * time.Millisecond
+	for {
+		store, err := store.Open(cfg)
+		if err == nil || !transient(err) || time.Now().Add(delay).After(deadline) {
+			return store, err
+		}
+		slog.Warn("backend not reachable yet", "backend", cfg.Backend, "retry_in", delay, "err", err)
+		fmt.Printf("     %s isn't reachable yet, retrying in %v...\n", cfg.Backend, delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, err
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// ClaimDescription says in words which events processors claim first.
+func ClaimDescription(cfg *config.Config) string {
+	if !priorityBackend(cfg.Backend) {
+		return "oldest first"
+	}
+	order := map[string]string{
+		config.ClaimFIFO:   "oldest first",
+		config.ClaimLIFO:   "newest first",
+		config.ClaimRandom: "at random",
+	}[cfg.Processor.Claim]
+	if cfg.Processor.Priority {
+		order = "highest first, then " + order
+	}
+	return order
+}
+
+// priorityBackend reports whether backend can claim by priority; the
+// brokers deliver strictly in order.
+func priorityBackend(backend string) bool {
+	switch backend {
+	case config.BackendPostgres, config.BackendSQLite, config.BackendMemory:
+		return true
+	}
+	return false
+}
+
+// deduplicator is implemented by stores that recognise a redelivered event
+// by its idempotency key and skip it, which makes the writers' at-least-once
+// delivery exactly-once.
+type deduplicator interface {
+	// Duplicates returns how many events were skipped so far.
+	Duplicates() int64
+}
+
+// lossyStore is implemented by stores that can lose claimed events, when
+// a rollback has nowhere to put them back.
+type lossyStore interface {
+	// Lost returns how many events were lost so far.
+	Lost() int64
+}
+
+// BackendName is the human-readable name of the configured store, for the
+// dashboard and startup messages.
+func BackendName(cfg *config.Config) string {
+	switch cfg.Backend {
+	case config.BackendSQLite:
+		return "SQLite"
+	case config.BackendMemory:
+		return "in-memory ring buffer"
+	case config.BackendNATS:
+		return fmt.Sprintf("NATS JetStream stream %s at %s", cfg.NATS.Stream, cfg.NATS.URL)
+	case config.BackendRedis:
+		return fmt.Sprintf("Redis stream %s at %s", cfg.Redis.Stream, cfg.Redis.Addr)
+	case config.BackendRabbitMQ:
+		return fmt.Sprintf("RabbitMQ queue %s", cfg.RabbitMQ.Queue)
+	default:
+		return "PostgreSQL"
+	}
+}
+
+// SinkName describes where the writers send events: the store, Kafka or
+// both.
+func SinkName(cfg *config.Config) string {
+	kafka := fmt.Sprintf("Kafka topic %q at %s", cfg.Kafka.Topic, cfg.Kafka.Brokers)
+	switch cfg.Sink {
+	case config.SinkKafka:
+		return kafka
+	case config.SinkBoth:
+		return BackendName(cfg) + " and " + kafka
+	default:
+		return BackendName(cfg)
+	}
+}
+
+// queueDepther is implemented by broker-backed stores that can report how
+// many messages are waiting on the broker for a processor.
+type queueDepther interface {
+	QueueDepth(ctx context.Context) (int, error)
+}
+
+// watchQueueDepth polls the broker's queue depth into the metrics every
+// interval - runs in its own goroutine for stores that support it.
+func watchQueueDepth(ctx context.Context, q queueDepther, interval time.Duration, metrics *RedditMetrics) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			depth, err := q.QueueDepth(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("read queue depth", "err", err)
+				}
+				continue
+			}
+			metrics.queueDepth.Set(float64(depth))
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package simulator
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// eventQueue is the producer side of the event channel. It decides what
+// happens when the channel is full: block until a writer makes room (the
+// default), drop the oldest buffered event to make room, or drop the new
+// event. Dropping keeps generators running at their target rate no matter
+// how far behind the writers fall, and the dropped counter shows how much
+// the system is shedding.
+//
+// Every event is also published to the firehose, shown to the anomaly
+// detector (det is nil unless -detect is set) and recorded (rec is nil
+// unless -record is set), whatever happens to it here. While the
+// generators are paused from the controls, or chaos (nil unless -chaos is
+// set) has them stalled, send waits before doing anything. Before that,
+// an event over its user's or IP's rate limit (limits is nil unless one
+// is set) is rejected or held back until it's within it. A report sent
+// goes to the modqueue as well (mod is nil with moderation off).
+type eventQueue struct {
+	ch      chan event.Event
+	policy  string
+	hose    *firehose
+	ctl     *Controls
+	chaos   *chaos
+	rec     *recorder
+	limits  *rateLimits
+	det     *detector
+	mod     *modQueue
+	metrics *RedditMetrics
+}
+
+func newEventQueue(ch chan event.Event, policy string, hose *firehose, ctl *Controls, chaos *chaos, rec *recorder, limits *rateLimits, det *detector, mod *modQueue, metrics *RedditMetrics) *eventQueue {
+	return &eventQueue{ch: ch, policy: policy, hose: hose, ctl: ctl, chaos: chaos, rec: rec, limits: limits, det: det, mod: mod, metrics: metrics}
+}
+
+// send gives e its idempotency key and offers it to the channel according
+// to the overflow policy. It returns false only if ctx was cancelled while
+// blocked; a dropped or rate-limited event still counts as sent.
+func (q *eventQueue) send(ctx context.Context, e event.Event) bool {
+	if !q.offer(ctx, e) {
+		return false
+	}
+	q.mod.submit(e)
+	return true
+}
+
+func (q *eventQueue) offer(ctx context.Context, e event.Event) bool {
+	if !q.limits.admit(ctx, e) {
+		return ctx.Err() == nil
+	}
+	e, ok := q.prepare(ctx, e)
+	if !ok {
+		return false
+	}
+
+	switch q.policy {
+	case config.OverflowDropNewest:
+		select {
+		case q.ch <- e:
+		default:
+			q.dropped()
+		}
+		return true
+
+	case config.OverflowDropOldest:
+		for {
+			select {
+			case q.ch <- e:
+				return true
+			default:
+			}
+			// Full: evict the head and try again. A writer may have
+			// taken it first, in which case there's room now anyway.
+			select {
+			case <-q.ch:
+				q.dropped()
+			default:
+			}
+		}
+
+	default:
+		select {
+		case q.ch <- e:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// prepare waits out a pause or stall, records e, then gives it its
+// idempotency key and trace and publishes it to the firehose: everything
+// send does short of the channel. A replay gives the events fresh keys, so
+// replaying into tables that hold the recorded run stores them again. It
+// returns false if ctx was cancelled while waiting.
+func (q *eventQueue) prepare(ctx context.Context, e event.Event) (event.Event, bool) {
+	if !q.ctl.waitResumed(ctx) || !q.chaos.waitStall(ctx) {
+		return e, false
+	}
+	q.rec.record(e)
+	e.Key = uuid.NewString()
+	e.TraceParent = traceGenerated(e)
+	q.hose.publish(e)
+	q.det.observe(e)
+	return e, true
+}
+
+func (q *eventQueue) dropped() {
+	q.metrics.dropped.Inc()
+}
@@ -0,0 +1,155 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// errBreakerOpen is returned without touching the store while the circuit
+// breaker is open.
+var errBreakerOpen = errors.New("circuit breaker open: store calls suspended")
+
+// breakerState is the circuit breaker's position.
+type breakerState int
+
+const (
+	breakerClosed   breakerState = iota // calls go through
+	BreakerHalfOpen                     // one probe call is let through
+	BreakerOpen                         // calls fail fast
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// breakerStats tracks the circuit breaker.
+type breakerStats struct {
+	state *metrics.Gauge // a breakerState
+	trips *metrics.Counter
+}
+
+func (s *breakerStats) register(reg *metrics.Registry) {
+	s.state = reg.Gauge("redditsim_breaker_state", "Circuit breaker state: 0 closed, 1 half-open, 2 open.")
+	s.trips = reg.Counter("redditsim_breaker_trips_total", "Times the circuit breaker has opened.")
+}
+
+// breakerStore stops hammering a store that keeps failing. After Threshold
+// consecutive failed calls (each already retried by retryStore) it opens
+// and fails every Insert, InsertBatch and Claim straight away. Writers'
+// batches go to the dead-letter queue meanwhile, so events are buffered
+// rather than lost. After Cooldown it half-opens and lets a single call
+// through as a probe: success closes it again, failure reopens it.
+type breakerStore struct {
+	store.Store
+	threshold int
+	cooldown  time.Duration
+	metrics   *RedditMetrics
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+func newBreakerStore(s store.Store, threshold int, cooldown time.Duration, metrics *RedditMetrics) *breakerStore {
+	metrics.breaker.register(metrics.registry)
+	return &breakerStore{Store: s, threshold: threshold, cooldown: cooldown, metrics: metrics}
+}
+
+func (b *breakerStore) Insert(ctx context.Context, e event.Event) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := b.Store.Insert(ctx, e)
+	b.record(err)
+	return err
+}
+
+func (b *breakerStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	if err := b.allow(); err != nil {
+		return err
+	}
+	err := b.Store.InsertBatch(ctx, events)
+	b.record(err)
+	return err
+}
+
+func (b *breakerStore) Claim(ctx context.Context, limit int) (store.Batch, error) {
+	if err := b.allow(); err != nil {
+		return nil, err
+	}
+	batch, err := b.Store.Claim(ctx, limit)
+	b.record(err)
+	return batch, err
+}
+
+// allow decides whether a call may go through, half-opening the breaker
+// once the cooldown is over.
+func (b *breakerStore) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return errBreakerOpen
+		}
+		b.setState(BreakerHalfOpen)
+		fallthrough
+	case BreakerHalfOpen:
+		if b.probing {
+			return errBreakerOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// record updates the breaker with the outcome of a call that allow let
+// through. A cancelled call says nothing about the store's health, and a
+// full memory store is backpressure: opening the breaker would also stop
+// the processors from making room.
+func (b *breakerStore) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wasProbe := b.probing
+	b.probing = false
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, store.ErrFull):
+	case err == nil:
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.setState(breakerClosed)
+		}
+	case wasProbe || b.state == breakerClosed && b.failures+1 >= b.threshold:
+		b.failures++
+		b.openedAt = time.Now()
+		b.setState(BreakerOpen)
+	default:
+		b.failures++
+	}
+}
+
+// setState moves the breaker and publishes it; b.mu must be held.
+func (b *breakerStore) setState(s breakerState) {
+	b.state = s
+	if s == BreakerOpen {
+		b.metrics.breaker.trips.Inc()
+	}
+	b.metrics.breaker.state.Set(float64(s))
+}
@@ -0,0 +1,312 @@
+package simulator
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// cacheStats tracks the read cache. A hit's time is the lookup and
+// decoding; a miss's is the lookup, the query and filling the cache, so
+// the difference between the two is what each hit saves.
+type cacheStats struct {
+	hits      *metrics.Counter
+	misses    *metrics.Counter
+	evictions *metrics.Counter // entries pushed out to make room
+	expired   *metrics.Counter // entries found past their TTL
+	errors    *metrics.Counter // lookups or fills that failed, the read going to the database
+	hitTime   *metrics.Counter
+	missTime  *metrics.Counter
+}
+
+func (s *cacheStats) register(reg *metrics.Registry) {
+	s.hits = reg.Counter("redditsim_cache_hits_total", "Reads the cache answered.")
+	s.misses = reg.Counter("redditsim_cache_misses_total", "Reads that went to the database and filled the cache.")
+	s.evictions = reg.Counter("redditsim_cache_evictions_total", "Cache entries evicted to make room.")
+	s.expired = reg.Counter("redditsim_cache_expired_total", "Cache entries that outlived -cache-ttl.")
+	s.errors = reg.Counter("redditsim_cache_errors_total", "Cache lookups and fills that failed.")
+	s.hitTime = reg.SecondsCounter("redditsim_cache_hit_seconds_total", "Time spent answering reads from the cache.")
+	s.missTime = reg.SecondsCounter("redditsim_cache_miss_seconds_total", "Time spent on reads the cache missed, query and fill included.")
+}
+
+type cacheSnapshot struct {
+	Hits      int           `json:"hits"`
+	Misses    int           `json:"misses"`
+	Evictions int           `json:"evictions"`
+	Expired   int           `json:"expired"`
+	Errors    int           `json:"errors"`
+	HitRate   float64       `json:"hit_rate"`
+	MeanHit   time.Duration `json:"mean_hit_ns"`
+	MeanMiss  time.Duration `json:"mean_miss_ns"`
+	// Saved estimates the query time the hits spared the database.
+	Saved time.Duration `json:"saved_ns"`
+}
+
+func (c cacheStats) snapshot() cacheSnapshot {
+	s := cacheSnapshot{Hits: c.hits.Value(), Misses: c.misses.Value(), Evictions: c.evictions.Value(), Expired: c.expired.Value(), Errors: c.errors.Value()}
+	if s.Hits > 0 {
+		s.MeanHit = c.hitTime.Duration() / time.Duration(s.Hits)
+	}
+	if s.Misses > 0 {
+		s.MeanMiss = c.missTime.Duration() / time.Duration(s.Misses)
+	}
+	if n := s.Hits + s.Misses; n > 0 {
+		s.HitRate = float64(s.Hits) / float64(n)
+	}
+	if s.Misses > 0 && s.MeanMiss > s.MeanHit {
+		s.Saved = time.Duration(s.Hits) * (s.MeanMiss - s.MeanHit)
+	}
+	return s
+}
+
+// readCache holds encoded reads by key. Entries are stored encoded even in
+// process, as they would be anywhere else, so an LRU hit costs what a hit
+// costs and the two backends compare fairly.
+type readCache interface {
+	// get reports false for a key that isn't cached or has expired.
+	get(ctx context.Context, key string) ([]byte, bool, error)
+	set(ctx context.Context, key string, value []byte) error
+	Close() error
+}
+
+func newReadCache(cfg config.Cache, metrics *RedditMetrics) (readCache, error) {
+	metrics.cache.register(metrics.registry)
+	if cfg.Backend == config.CacheRedis {
+		return newRedisCache(cfg)
+	}
+	return newLRUCache(cfg.Size, cfg.TTL, metrics), nil
+}
+
+// lruCache is an in-process cache of up to size entries, evicting the least
+// recently used to make room. Expired entries go when they're next looked
+// up or evicted, whichever comes first.
+type lruCache struct {
+	size    int
+	ttl     time.Duration
+	mu      sync.Mutex
+	order   *list.List // most recently used at the front
+	entries map[string]*list.Element
+	metrics *RedditMetrics
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+func newLRUCache(size int, ttl time.Duration, metrics *RedditMetrics) *lruCache {
+	return &lruCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+		metrics: metrics,
+	}
+}
+
+func (c *lruCache) get(_ context.Context, key string) ([]byte, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+	e := el.Value.(*lruEntry)
+	if time.Now().After(e.expires) {
+		c.order.Remove(el)
+		delete(c.entries, key)
+		c.metrics.cache.expired.Inc()
+		return nil, false, nil
+	}
+	c.order.MoveToFront(el)
+	return e.value, true, nil
+}
+
+func (c *lruCache) set(_ context.Context, key string, value []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := time.Now().Add(c.ttl)
+	if el, ok := c.entries[key]; ok {
+		e := el.Value.(*lruEntry)
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+	if c.order.Len() > c.size {
+		el := c.order.Back()
+		c.order.Remove(el)
+		delete(c.entries, el.Value.(*lruEntry).key)
+		c.metrics.cache.evictions.Inc()
+	}
+	return nil
+}
+
+func (c *lruCache) Close() error { return nil }
+
+// redisCacheTimeout bounds each lookup and fill, so a slow Redis costs a
+// read the time of a miss rather than holding it up.
+const redisCacheTimeout = 100 * time.Millisecond
+
+// redisCachePrefix namespaces the cache's keys in a Redis shared with
+// other things.
+const redisCachePrefix = "redditsim:cache:"
+
+// redisCache keeps reads in Redis, expiring them with the keys' TTL. Redis
+// bounds its size with maxmemory and its eviction policy, not the
+// simulator; what it evicts and expires is read from INFO by watchCache.
+type redisCache struct {
+	rdb *redis.Client
+	ttl time.Duration
+	// INFO's counters as of the last look, so only this run's count
+	evicted, expired int
+}
+
+func newRedisCache(cfg config.Cache) (*redisCache, error) {
+	c := &redisCache{rdb: redis.NewClient(&redis.Options{Addr: cfg.Addr}), ttl: cfg.TTL}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	evicted, expired, err := c.counts(ctx)
+	if err != nil {
+		c.rdb.Close()
+		return nil, fmt.Errorf("redis cache at %s: %w", cfg.Addr, err)
+	}
+	c.evicted, c.expired = evicted, expired
+	return c, nil
+}
+
+func (c *redisCache) get(ctx context.Context, key string) ([]byte, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, redisCacheTimeout)
+	defer cancel()
+	b, err := c.rdb.Get(ctx, redisCachePrefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	return b, err == nil, err
+}
+
+func (c *redisCache) set(ctx context.Context, key string, value []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, redisCacheTimeout)
+	defer cancel()
+	return c.rdb.Set(ctx, redisCachePrefix+key, value, c.ttl).Err()
+}
+
+// counts reads the server's evicted_keys and expired_keys, both server-wide.
+func (c *redisCache) counts(ctx context.Context) (evicted, expired int, err error) {
+	info, err := c.rdb.Info(ctx, "stats").Result()
+	if err != nil {
+		return 0, 0, err
+	}
+	for _, line := range strings.Split(info, "\n") {
+		name, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch name {
+		case "evicted_keys":
+			evicted, _ = strconv.Atoi(value)
+		case "expired_keys":
+			expired, _ = strconv.Atoi(value)
+		}
+	}
+	return evicted, expired, nil
+}
+
+func (c *redisCache) Close() error { return c.rdb.Close() }
+
+// Polls Redis for the keys it has evicted and expired since the cache
+// connected - runs in its own goroutine with the redis cache.
+func watchCache(ctx context.Context, c *redisCache, interval time.Duration, metrics *RedditMetrics) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			evicted, expired, err := c.counts(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Warn("read redis cache stats", "err", err)
+				}
+				continue
+			}
+			// A restarted server starts its counters over
+			metrics.cache.evictions.Add(max(evicted-c.evicted, 0))
+			metrics.cache.expired.Add(max(expired-c.expired, 0))
+			c.evicted, c.expired = evicted, expired
+		}
+	}
+}
+
+// cachedQuerier puts a cache in front of q, cache-aside: a read looks in
+// the cache first, and on a miss queries q and fills the cache with what
+// it got. Only reads that succeed are cached, so a user who doesn't exist
+// yet is looked up again every time. A cache that fails is counted and
+// skipped, never failing the read.
+type cachedQuerier struct {
+	q       graphQuerier
+	cache   readCache
+	metrics *RedditMetrics
+}
+
+func (c *cachedQuerier) Posts(ctx context.Context, f store.PostFilter) ([]store.RankedPost, error) {
+	return cacheAside(ctx, c, fmt.Sprintf("posts:%+v", f), func() ([]store.RankedPost, error) { return c.q.Posts(ctx, f) })
+}
+
+func (c *cachedQuerier) Comments(ctx context.Context, f store.CommentFilter) ([]store.Comment, error) {
+	return cacheAside(ctx, c, fmt.Sprintf("comments:%+v", f), func() ([]store.Comment, error) { return c.q.Comments(ctx, f) })
+}
+
+func (c *cachedQuerier) User(ctx context.Context, name string) (store.User, error) {
+	return cacheAside(ctx, c, "user:"+name, func() (store.User, error) { return c.q.User(ctx, name) })
+}
+
+func cacheAside[T any](ctx context.Context, c *cachedQuerier, key string, load func() (T, error)) (T, error) {
+	start := time.Now()
+	data, ok, err := c.cache.get(ctx, key)
+	if ok {
+		var v T
+		if err = json.Unmarshal(data, &v); err == nil {
+			c.metrics.cache.hits.Inc()
+			c.metrics.cache.hitTime.AddDuration(time.Since(start))
+			return v, nil
+		}
+	}
+	failed := err != nil
+	if failed {
+		slog.Debug("cache lookup", "key", key, "err", err)
+	}
+
+	v, loadErr := load()
+	if loadErr == nil {
+		if data, err = json.Marshal(v); err == nil {
+			err = c.cache.set(ctx, key, data)
+		}
+		if err != nil {
+			failed = true
+			slog.Debug("cache fill", "key", key, "err", err)
+		}
+	}
+	c.metrics.cache.misses.Inc()
+	c.metrics.cache.missTime.AddDuration(time.Since(start))
+	if failed {
+		c.metrics.cache.errors.Inc()
+	}
+	return v, loadErr
+}
@@ -0,0 +1,182 @@
+package simulator
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// Kinds of injected failure, used as metric keys.
+const (
+	ChaosConnDrop     = "conn_drop"
+	ChaosLatency      = "latency"
+	ChaosSlowConsumer = "slow_consumer"
+	ChaosStall        = "generator_stall"
+	ChaosLostAck      = "lost_ack"
+)
+
+// chaos injects failures into a run when -chaos is set, each kind with its
+// own probability, so the retry, circuit breaker and dead-letter paths get
+// exercised without a real outage. Every injection is counted.
+type chaos struct {
+	cfg     config.Chaos
+	metrics *RedditMetrics
+
+	mu           sync.Mutex
+	r            *rand.Rand
+	stalledUntil time.Time
+}
+
+// chaosKinds are the kinds of failure, in the order they're reported.
+var chaosKinds = []string{ChaosConnDrop, ChaosLatency, ChaosSlowConsumer, ChaosStall, ChaosLostAck}
+
+func newChaos(cfg config.Chaos, seed int64, m *RedditMetrics) *chaos {
+	injected := m.registry.CounterVec("redditsim_chaos_injected_total", "Failures injected by -chaos, by kind.", "kind")
+	m.chaos = make(map[string]*metrics.Counter, len(chaosKinds))
+	for _, kind := range chaosKinds {
+		m.chaos[kind] = injected.With(kind)
+	}
+	return &chaos{cfg: cfg, metrics: m, r: rand.New(rand.NewSource(seed))}
+}
+
+// roll reports whether an event with probability p happens this time.
+func (c *chaos) roll(p float64) bool {
+	if p <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.r.Float64() < p
+}
+
+func (c *chaos) injected(kind string) {
+	c.metrics.chaos[kind].Inc()
+}
+
+// Stalls the generators now and then - runs in its own goroutine. Once a
+// second, with probability GeneratorStall, every generator freezes for
+// StallDuration, like an upstream service hiccuping.
+func (c *chaos) stallGenerators(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if !c.roll(c.cfg.GeneratorStall) {
+				continue
+			}
+			until := now.Add(c.cfg.StallDuration)
+			c.mu.Lock()
+			c.stalledUntil = until
+			c.mu.Unlock()
+
+			c.metrics.chaos[ChaosStall].Inc()
+			c.metrics.mutex.Lock()
+			c.metrics.stalledUntil = until
+			c.metrics.mutex.Unlock()
+		}
+	}
+}
+
+// waitStall blocks while the generators are stalled. It returns false if
+// ctx was cancelled first. A nil chaos never stalls.
+func (c *chaos) waitStall(ctx context.Context) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	wait := time.Until(c.stalledUntil)
+	c.mu.Unlock()
+	if wait <= 0 {
+		return true
+	}
+	select {
+	case <-time.After(wait):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// chaosStore sits directly on the real store, below the retries and the
+// circuit breaker, and makes its calls fail as if the connection dropped,
+// or run slowly. Claims can also hold on to their batch for a while, like
+// a slow consumer.
+type chaosStore struct {
+	store.Store
+	c *chaos
+}
+
+// before injects a dropped connection or extra latency ahead of a call.
+func (s *chaosStore) before(ctx context.Context) error {
+	if s.c.roll(s.c.cfg.ConnDrop) {
+		s.c.injected(ChaosConnDrop)
+		return fmt.Errorf("chaos: %w", driver.ErrBadConn)
+	}
+	if s.c.roll(s.c.cfg.Latency) {
+		s.c.injected(ChaosLatency)
+		return sleepCtx(ctx, s.c.cfg.LatencyDelay)
+	}
+	return nil
+}
+
+// after loses the acknowledgement of a write that succeeded: the caller
+// sees a dropped connection and retries, delivering the events again.
+func (s *chaosStore) after(err error) error {
+	if err != nil || !s.c.roll(s.c.cfg.LostAck) {
+		return err
+	}
+	s.c.injected(ChaosLostAck)
+	return fmt.Errorf("chaos: ack lost: %w", driver.ErrBadConn)
+}
+
+func (s *chaosStore) Insert(ctx context.Context, e event.Event) error {
+	if err := s.before(ctx); err != nil {
+		return err
+	}
+	return s.after(s.Store.Insert(ctx, e))
+}
+
+func (s *chaosStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	if err := s.before(ctx); err != nil {
+		return err
+	}
+	return s.after(s.Store.InsertBatch(ctx, events))
+}
+
+func (s *chaosStore) Claim(ctx context.Context, limit int) (store.Batch, error) {
+	if err := s.before(ctx); err != nil {
+		return nil, err
+	}
+	b, err := s.Store.Claim(ctx, limit)
+	if err != nil || len(b.Events()) == 0 || !s.c.roll(s.c.cfg.SlowConsumer) {
+		return b, err
+	}
+	s.c.injected(ChaosSlowConsumer)
+	if err := sleepCtx(ctx, s.c.cfg.SlowConsumerDelay); err != nil {
+		b.Rollback()
+		return nil, err
+	}
+	return b, nil
+}
+
+// sleepCtx sleeps for d unless ctx is cancelled first.
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,318 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+)
+
+// clickhouseStats tracks the ClickHouse sink. Inserted, failed and
+// dropped count events; the insert latency is per request.
+type clickhouseStats struct {
+	inserted *metrics.Counter
+	batches  *metrics.Counter
+	retries  *metrics.Counter
+	failed   *metrics.Counter // out of attempts
+	dropped  *metrics.Counter // the buffer was full
+	latency  *metrics.Histogram
+	pending  func() int // events waiting in the buffer
+}
+
+func (s *clickhouseStats) register(reg *metrics.Registry, table string, pending func() int) {
+	s.inserted = reg.Counter("redditsim_clickhouse_inserted_total", "Events inserted into ClickHouse.")
+	s.batches = reg.Counter("redditsim_clickhouse_batches_total", "Inserts ClickHouse accepted.")
+	s.retries = reg.Counter("redditsim_clickhouse_retries_total", "ClickHouse inserts retried.")
+	s.failed = reg.Counter("redditsim_clickhouse_failed_total", "Events whose ClickHouse insert was given up on.")
+	s.dropped = reg.Counter("redditsim_clickhouse_dropped_total", "Events dropped because the ClickHouse buffer was full.")
+	s.latency = reg.HistogramVec("redditsim_clickhouse_insert_duration_seconds", "Latency of the ClickHouse inserts accepted.", "table").With(table)
+	s.pending = pending
+	reg.GaugeFunc("redditsim_clickhouse_pending", "Events waiting in the ClickHouse buffer.", func() float64 {
+		return float64(pending())
+	})
+}
+
+type clickhouseSnapshot struct {
+	Inserted int                     `json:"inserted"`
+	Batches  int                     `json:"batches"`
+	Retries  int                     `json:"retries"`
+	Failed   int                     `json:"failed"`
+	Dropped  int                     `json:"dropped"`
+	Pending  int                     `json:"pending"`
+	Latency  metrics.LatencySnapshot `json:"latency"`
+}
+
+func (s clickhouseStats) snapshot() clickhouseSnapshot {
+	snap := clickhouseSnapshot{
+		Inserted: s.inserted.Value(),
+		Batches:  s.batches.Value(),
+		Retries:  s.retries.Value(),
+		Failed:   s.failed.Value(),
+		Dropped:  s.dropped.Value(),
+	}
+	if s.latency != nil {
+		snap.Latency, snap.Pending = s.latency.Snapshot(), s.pending()
+	}
+	return snap
+}
+
+// clickhouseRow is an event's row in the ClickHouse table, as JSONEachRow.
+type clickhouseRow struct {
+	Key        string `json:"key"`
+	Type       string `json:"type"`
+	User       string `json:"user"`
+	Subreddit  string `json:"subreddit"`
+	PostID     string `json:"post_id"`
+	CommentID  string `json:"comment_id"`
+	ParentID   string `json:"parent_id"`
+	Target     string `json:"target"`
+	Payload    string `json:"payload"`
+	Timestamp  string `json:"timestamp"`
+	Country    string `json:"country"`
+	Device     string `json:"device"`
+	AppVersion string `json:"app_version"`
+}
+
+// clickhouseTime is how a DateTime64(6) is written in JSONEachRow.
+const clickhouseTime = "2006-01-02 15:04:05.000000"
+
+// clickhouseSchema is the events table: a MergeTree sorted for the usual
+// analytical queries, by subreddit, type and time, with the columns of few
+// distinct values dictionary-encoded.
+const clickhouseSchema = `CREATE TABLE IF NOT EXISTS %s (
+	key String,
+	type LowCardinality(String),
+	user String,
+	subreddit LowCardinality(String),
+	post_id String,
+	comment_id String,
+	parent_id String,
+	target String,
+	payload String,
+	timestamp DateTime64(6, 'UTC'),
+	country LowCardinality(String),
+	device LowCardinality(String),
+	app_version LowCardinality(String),
+	inserted_at DateTime64(6, 'UTC') DEFAULT now64(6)
+) ENGINE = MergeTree
+PARTITION BY toYYYYMMDD(timestamp)
+ORDER BY (subreddit, type, timestamp)`
+
+// clickhouseBaseDelay is the wait before the first retry of an insert,
+// doubled for every retry after it.
+const clickhouseBaseDelay = 250 * time.Millisecond
+
+// clickhouseSink dual-writes the events the writers store to ClickHouse,
+// the Postgres-for-OLTP, ClickHouse-for-analytics split. It batches on
+// its own: ClickHouse wants few large inserts, where the store's batches
+// are sized for latency. The writers hand events over without waiting,
+// and a goroutine inserts them BatchSize at a time, so a slow or failing
+// ClickHouse costs its own copy of the events and never the store's
+// throughput. A nil sink writes nothing.
+type clickhouseSink struct {
+	cfg     config.ClickHouse
+	client  *http.Client
+	table   string
+	metrics *RedditMetrics
+
+	mu     sync.Mutex // guards closed against the queue being closed
+	closed bool
+	queue  chan event.Event
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// newClickHouseSink creates the table if it's missing and starts the
+// sink's inserter.
+func newClickHouseSink(ctx context.Context, cfg config.ClickHouse, metrics *RedditMetrics) (*clickhouseSink, error) {
+	s := &clickhouseSink{
+		cfg:     cfg,
+		client:  &http.Client{},
+		table:   cfg.Database + "." + cfg.Table,
+		metrics: metrics,
+		queue:   make(chan event.Event, cfg.Buffer),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if _, err := s.query(ctx, []byte(fmt.Sprintf(clickhouseSchema, s.table))); err != nil {
+		return nil, fmt.Errorf("create clickhouse table %s: %w", s.table, err)
+	}
+	metrics.clickhouse.register(metrics.registry, s.table, func() int { return len(s.queue) })
+	go s.run()
+	return s, nil
+}
+
+// add queues a copy of batch for insertion, dropping what doesn't fit.
+// The writers call it concurrently.
+func (s *clickhouseSink) add(batch []event.Event) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	for i, e := range batch {
+		select {
+		case s.queue <- e:
+		default:
+			s.metrics.clickhouse.dropped.Add(len(batch) - i)
+			return
+		}
+	}
+}
+
+// run inserts the queued events once BatchSize of them are waiting or the
+// first has waited FlushInterval, until the queue is closed and drained.
+func (s *clickhouseSink) run() {
+	defer close(s.done)
+	batch := make([]event.Event, 0, s.cfg.BatchSize)
+	timer := time.NewTimer(s.cfg.FlushInterval)
+	timer.Stop()
+	flush := func() {
+		if len(batch) > 0 {
+			s.insert(batch)
+			batch = batch[:0]
+		}
+	}
+	for {
+		select {
+		case e, ok := <-s.queue:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(s.cfg.FlushInterval)
+			}
+			batch = append(batch, e)
+			if len(batch) >= s.cfg.BatchSize {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+// insert writes batch in one INSERT until ClickHouse accepts it, it's
+// been tried cfg.Attempts times, or ClickHouse rejects it outright with a
+// 4xx other than 408 or 429. Retries back off exponentially with jitter,
+// like the webhook's; once the run is over, what's left gets one attempt.
+func (s *clickhouseSink) insert(batch []event.Event) {
+	var body bytes.Buffer
+	body.WriteString("INSERT INTO " + s.table + " FORMAT JSONEachRow\n")
+	enc := json.NewEncoder(&body)
+	for _, e := range batch {
+		enc.Encode(clickhouseRow{
+			Key:        e.Key,
+			Type:       e.Type.String(),
+			User:       e.User,
+			Subreddit:  e.Subreddit,
+			PostID:     e.PostID,
+			CommentID:  e.CommentID,
+			ParentID:   e.ParentID,
+			Target:     e.Target,
+			Payload:    e.Payload,
+			Timestamp:  e.Timestamp.UTC().Format(clickhouseTime),
+			Country:    e.Client.Country,
+			Device:     e.Client.Device,
+			AppVersion: e.Client.AppVersion,
+		})
+	}
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.Timeout)
+		start := time.Now()
+		retry, err := s.query(ctx, body.Bytes())
+		elapsed := time.Since(start)
+		cancel()
+		if err == nil {
+			s.metrics.clickhouse.latency.Observe(elapsed)
+			s.metrics.clickhouse.inserted.Add(len(batch))
+			s.metrics.clickhouse.batches.Inc()
+			return
+		}
+		closing := false
+		select {
+		case <-s.quit:
+			closing = true
+		default:
+		}
+		if !retry || closing || attempt >= s.cfg.Attempts {
+			slog.Error("insert into clickhouse", "table", s.table, "events", len(batch), "attempts", attempt, "err", err)
+			s.metrics.clickhouse.failed.Add(len(batch))
+			return
+		}
+
+		delay := min(clickhouseBaseDelay<<(attempt-1), maxRetryDelay)
+		delay -= time.Duration(rand.Float64() * 0.5 * float64(delay))
+		slog.Debug("retrying clickhouse insert", "table", s.table, "attempt", attempt, "delay", delay, "err", err)
+		s.metrics.clickhouse.retries.Inc()
+		select {
+		case <-s.quit:
+		case <-time.After(delay):
+		}
+	}
+}
+
+// query runs sql over the HTTP interface - an INSERT followed by its rows,
+// say - and reports whether a failure is worth retrying.
+func (s *clickhouseSink) query(ctx context.Context, sql []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.cfg.URL, bytes.NewReader(sql))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", "web-traffic-sim")
+	req.Header.Set("X-ClickHouse-User", s.cfg.User)
+	if s.cfg.Password != "" {
+		req.Header.Set("X-ClickHouse-Key", s.cfg.Password)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		io.Copy(io.Discard, resp.Body)
+		return false, nil
+	}
+	// ClickHouse explains a failure in the body
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	err = errors.New(resp.Status + ": " + strings.TrimSpace(string(msg)))
+	retry := resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, err
+}
+
+// Close inserts what's queued, without waiting to retry any of it, and
+// returns once it's done. Events added after it are dropped, and closing
+// it again does nothing.
+func (s *clickhouseSink) Close() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	s.closed = true
+	close(s.queue)
+	s.mu.Unlock()
+	close(s.quit)
+	<-s.done
+}
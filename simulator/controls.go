@@ -0,0 +1,215 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+
+	"web-traffic-sim/config"
+)
+
+// Controls are the knobs that can be turned while a run is in progress:
+// the global event rate the generators share, whether they are paused,
+// the writer and processor batch sizes and the size of both pools. The
+// TUI and the admin endpoint turn them; generators, writers and
+// processors read them as they go. Every change is mirrored into metrics
+// so the dashboards show the current setting rather than the configured
+// one.
+type Controls struct {
+	mu     sync.Mutex
+	target float64
+	paused bool
+	// resumed is closed while running and replaced by an open channel on
+	// pause, so any number of generators can wait on it.
+	resumed      chan struct{}
+	writeBatch   int
+	processBatch int
+	// The pools are set by Run once they exist; processors stays nil when
+	// nothing is processed (-sink kafka). In sequential mode the pools stay
+	// empty and can't be resized: the loop is all there is.
+	writers    *workerPool
+	processors *workerPool
+	sequential bool
+	metrics    *RedditMetrics
+}
+
+// minRate is the lowest rate the controls go down to.
+const minRate = 1
+
+// maxWorkers bounds each pool, so a typo can't start a million goroutines.
+const maxWorkers = 256
+
+func newControls(cfg *config.Config, metrics *RedditMetrics) *Controls {
+	c := &Controls{
+		target:       cfg.Generator.Rate,
+		resumed:      make(chan struct{}),
+		writeBatch:   cfg.Writer.BatchSize,
+		processBatch: cfg.Processor.BatchSize,
+		sequential:   cfg.Mode == config.ModeSequential,
+		metrics:      metrics,
+	}
+	close(c.resumed)
+	c.publish()
+	return c
+}
+
+// Rate returns the current global target in events/second.
+func (c *Controls) Rate() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.target
+}
+
+// SetRate changes the global target, rounded to a whole number of
+// events/second and no lower than minRate, and returns what it was set to.
+func (c *Controls) SetRate(rate float64) float64 {
+	c.mu.Lock()
+	c.target = max(math.Round(rate), minRate)
+	rate = c.target
+	c.mu.Unlock()
+	c.publish()
+	return rate
+}
+
+// setPaused pauses or resumes the generators.
+func (c *Controls) setPaused(paused bool) {
+	c.mu.Lock()
+	if paused != c.paused {
+		c.paused = paused
+		if paused {
+			c.resumed = make(chan struct{})
+		} else {
+			close(c.resumed)
+		}
+	}
+	c.mu.Unlock()
+	c.publish()
+}
+
+func (c *Controls) TogglePaused() {
+	c.mu.Lock()
+	paused := c.paused
+	c.mu.Unlock()
+	c.setPaused(!paused)
+}
+
+// waitResumed blocks while the generators are paused. It returns false if
+// ctx is done first. A nil controls is never paused.
+func (c *Controls) waitResumed(ctx context.Context) bool {
+	if c == nil {
+		return true
+	}
+	c.mu.Lock()
+	resumed := c.resumed
+	c.mu.Unlock()
+
+	select {
+	case <-resumed:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// writeBatchSize and processBatchSize return the current batch sizes;
+// writers and processors pick up a change with their next batch.
+func (c *Controls) writeBatchSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.writeBatch
+}
+
+func (c *Controls) processBatchSize() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.processBatch
+}
+
+// controlSettings is a set of changes to the controls, and how the admin
+// endpoint reports them. Nil fields are left alone.
+type controlSettings struct {
+	Rate         *float64 `json:"rate,omitempty"`
+	Paused       *bool    `json:"paused,omitempty"`
+	WriteBatch   *int     `json:"write_batch,omitempty"`
+	ProcessBatch *int     `json:"process_batch,omitempty"`
+	Writers      *int     `json:"writers,omitempty"`
+	Processors   *int     `json:"processors,omitempty"`
+}
+
+// settings returns the current value of every control.
+func (c *Controls) settings() controlSettings {
+	c.mu.Lock()
+	rate, paused, writeBatch, processBatch := c.target, c.paused, c.writeBatch, c.processBatch
+	c.mu.Unlock()
+
+	writers := c.writers.size()
+	s := controlSettings{Rate: &rate, Paused: &paused, WriteBatch: &writeBatch, ProcessBatch: &processBatch, Writers: &writers}
+	if c.processors != nil {
+		processors := c.processors.size()
+		s.Processors = &processors
+	}
+	return s
+}
+
+// apply validates every change in s and then makes them all, so a bad
+// request changes nothing.
+func (c *Controls) apply(s controlSettings) error {
+	switch {
+	case s.Rate != nil && *s.Rate < minRate:
+		return fmt.Errorf("rate must be at least %d", minRate)
+	case s.WriteBatch != nil && *s.WriteBatch < 1:
+		return errors.New("write_batch must be at least 1")
+	case s.ProcessBatch != nil && *s.ProcessBatch < 1:
+		return errors.New("process_batch must be at least 1")
+	case (s.Writers != nil || s.Processors != nil) && c.sequential:
+		return errors.New("there are no pools to resize in sequential mode")
+	case s.Writers != nil && (*s.Writers < 1 || *s.Writers > maxWorkers):
+		return fmt.Errorf("writers must be between 1 and %d", maxWorkers)
+	case s.Processors != nil && c.processors == nil:
+		return errors.New("there are no processors when events only go to Kafka")
+	case s.Processors != nil && (*s.Processors < 1 || *s.Processors > maxWorkers):
+		return fmt.Errorf("processors must be between 1 and %d", maxWorkers)
+	}
+
+	if s.Rate != nil {
+		c.SetRate(*s.Rate)
+	}
+	if s.Paused != nil {
+		c.setPaused(*s.Paused)
+	}
+	c.mu.Lock()
+	if s.WriteBatch != nil {
+		c.writeBatch = *s.WriteBatch
+	}
+	if s.ProcessBatch != nil {
+		c.processBatch = *s.ProcessBatch
+	}
+	c.mu.Unlock()
+	// Stats slots have to exist before a new worker can report to them
+	if s.Writers != nil {
+		c.metrics.setWriters(*s.Writers)
+		c.writers.resize(*s.Writers)
+	}
+	if s.Processors != nil {
+		c.metrics.setProcessors(*s.Processors)
+		c.processors.resize(*s.Processors)
+	}
+	c.publish()
+	return nil
+}
+
+func (c *Controls) publish() {
+	c.mu.Lock()
+	target, paused := c.target, c.paused
+	writeBatch, processBatch := c.writeBatch, c.processBatch
+	c.mu.Unlock()
+
+	c.metrics.mutex.Lock()
+	c.metrics.control.target = target
+	c.metrics.control.paused = paused
+	c.metrics.control.writeBatch = writeBatch
+	c.metrics.control.processBatch = processBatch
+	c.metrics.mutex.Unlock()
+}
@@ -0,0 +1,65 @@
+package simulator
+
+import (
+	"database/sql"
+	"time"
+
+	"web-traffic-sim/metrics"
+)
+
+// poolStater is implemented by stores backed by a database/sql pool.
+type poolStater interface {
+	PoolStats() sql.DBStats
+}
+
+// poolSnapshot is the connection pool as database/sql reports it.
+type poolSnapshot struct {
+	MaxOpen int `json:"max_open"` // 0 = unlimited
+	Open    int `json:"open"`
+	InUse   int `json:"in_use"`
+	Idle    int `json:"idle"`
+	// Waits for a connection because all MaxOpen were in use, and the
+	// total time spent waiting
+	WaitCount    int64         `json:"wait_count"`
+	WaitDuration time.Duration `json:"wait_duration_ns"`
+	// Connections closed for exceeding MaxIdle or MaxLifetime
+	IdleClosed     int64 `json:"max_idle_closed"`
+	LifetimeClosed int64 `json:"max_lifetime_closed"`
+}
+
+func newPoolSnapshot(s sql.DBStats) *poolSnapshot {
+	return &poolSnapshot{
+		MaxOpen:        s.MaxOpenConnections,
+		Open:           s.OpenConnections,
+		InUse:          s.InUse,
+		Idle:           s.Idle,
+		WaitCount:      s.WaitCount,
+		WaitDuration:   s.WaitDuration,
+		IdleClosed:     s.MaxIdleClosed,
+		LifetimeClosed: s.MaxLifetimeClosed,
+	}
+}
+
+// registerPool registers the metrics of the connection pool stats reports.
+func registerPool(reg *metrics.Registry, stats func() sql.DBStats) {
+	conns := reg.GaugeVec("redditsim_db_connections", "Connections in the database/sql pool by state.", "state")
+	conns.WithFunc("in_use", func() float64 { return float64(stats().InUse) })
+	conns.WithFunc("idle", func() float64 { return float64(stats().Idle) })
+	reg.GaugeFunc("redditsim_db_connections_max", "The pool's -db-max-open (0 = unlimited).", func() float64 {
+		return float64(stats().MaxOpenConnections)
+	})
+	reg.CounterFunc("redditsim_db_connection_waits_total", "Times a worker waited for a free connection.", func() float64 {
+		return float64(stats().WaitCount)
+	})
+	reg.CounterFunc("redditsim_db_connection_wait_seconds_total", "Total time workers waited for a free connection.", func() float64 {
+		return stats().WaitDuration.Seconds()
+	})
+}
+
+// MeanWait is the average time a worker waited for a connection.
+func (p poolSnapshot) MeanWait() time.Duration {
+	if p.WaitCount == 0 {
+		return 0
+	}
+	return p.WaitDuration / time.Duration(p.WaitCount)
+}
@@ -0,0 +1,227 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"slices"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// Why the detector flagged a user, as stored in the flags table.
+const (
+	flagRate   = "rate"
+	flagRepeat = "repeat"
+)
+
+// detectStats tracks the anomaly detector.
+type detectStats struct {
+	observed *metrics.Counter
+	dropped  *metrics.Counter // events the detector fell too far behind to see
+	rate     *metrics.Counter // users flagged for their event rate
+	repeat   *metrics.Counter // users flagged for repeating themselves
+	recent   []store.UserFlag
+}
+
+func (s *detectStats) register(reg *metrics.Registry) {
+	s.observed = reg.Counter("redditsim_detector_observed_total", "Events the anomaly detector has seen.")
+	s.dropped = reg.Counter("redditsim_detector_dropped_total", "Events the anomaly detector was too far behind to see.")
+	flagged := reg.CounterVec("redditsim_flagged_users_total", "Users the anomaly detector flagged, by reason.", "reason")
+	s.rate, s.repeat = flagged.With(flagRate), flagged.With(flagRepeat)
+}
+
+type detectSnapshot struct {
+	Observed int              `json:"observed"`
+	Dropped  int              `json:"dropped"`
+	Rate     int              `json:"rate_flagged"`
+	Repeat   int              `json:"repeat_flagged"`
+	Recent   []store.UserFlag `json:"recent"`
+}
+
+// flagStore is implemented by stores that keep the detector's flags.
+type flagStore interface {
+	Flag(ctx context.Context, flags []store.UserFlag) error
+}
+
+const (
+	// detectQueue is how many events may wait for the detector before it
+	// starts missing them.
+	detectQueue = 10_000
+	// detectBuckets is how many slices each user's window is counted in.
+	detectBuckets = 12
+	// detectRecent is how many of a user's posts and comments are compared
+	// for repeats.
+	detectRecent = 20
+	// detectShortText is the length under which text isn't compared: short
+	// replies like "this" repeat on their own.
+	detectShortText = 16
+	// detectRecentFlags is how many flags the dashboard shows.
+	detectRecentFlags = 5
+)
+
+// userActivity is what the detector knows of one user.
+type userActivity struct {
+	events slidingCount
+	recent [detectRecent]uint64 // hashes of the last posts and comments
+	next   int
+}
+
+// detector watches the events on their way into the pipeline for users
+// acting like spammers or bots. It sees each event as it's sent, before
+// storage, and is fed without blocking so it never holds up the senders.
+// A nil detector watches nothing.
+type detector struct {
+	cfg     config.Detect
+	events  chan event.Event
+	users   map[string]*userActivity
+	flagged map[string]bool  // by reason + user, each flagged once a run
+	pending []store.UserFlag // for the store, written each tick
+	metrics *RedditMetrics
+}
+
+func newDetector(cfg config.Detect, metrics *RedditMetrics) *detector {
+	metrics.detect.register(metrics.registry)
+	return &detector{
+		cfg:     cfg,
+		events:  make(chan event.Event, detectQueue),
+		users:   make(map[string]*userActivity),
+		flagged: make(map[string]bool),
+		metrics: metrics,
+	}
+}
+
+// observe offers e to the detector, dropping it if the detector is behind.
+func (d *detector) observe(e event.Event) {
+	if d == nil || e.User == "" {
+		return
+	}
+	select {
+	case d.events <- e:
+	default:
+		d.metrics.detect.dropped.Inc()
+	}
+}
+
+// Flags abnormal users - runs in its own goroutine with -detect. Every
+// event counts towards its user's sliding window, and posts and comments
+// are checked against the user's last few for the same text. Once a
+// second every active user's count is compared with the median's, and
+// the flags raised since the last tick go to fs, if the store keeps them.
+func (d *detector) run(ctx context.Context, fs flagStore) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e := <-d.events:
+			d.count(e)
+		case now := <-ticker.C:
+			d.checkRates(now)
+			if len(d.pending) == 0 {
+				continue
+			}
+			if fs != nil {
+				if err := fs.Flag(ctx, d.pending); err != nil && ctx.Err() == nil {
+					slog.Error("store flags", "count", len(d.pending), "err", err)
+				}
+			}
+			d.pending = d.pending[:0]
+		}
+	}
+}
+
+func (d *detector) count(e event.Event) {
+	now := time.Now()
+	u := d.users[e.User]
+	if u == nil {
+		u = &userActivity{events: newSlidingCount(d.cfg.Window, detectBuckets, now)}
+		d.users[e.User] = u
+	}
+	u.events.add(now, 1)
+	d.metrics.detect.observed.Inc()
+
+	if d.cfg.Repeats == 0 || (e.Type != event.Post && e.Type != event.Comment) || len(e.Payload) < detectShortText {
+		return
+	}
+	h := fnv.New64a()
+	h.Write([]byte(e.Payload))
+	sum := h.Sum64()
+	u.recent[u.next] = sum
+	u.next = (u.next + 1) % len(u.recent)
+	if seen := countHash(u.recent[:], sum); seen >= d.cfg.Repeats {
+		text := e.Payload
+		if len(text) > 40 {
+			text = text[:40] + "…"
+		}
+		d.flag(e.User, flagRepeat, u.events.sum(now), fmt.Sprintf("the same %s %d times: %q", e.Type, seen, text), now)
+	}
+}
+
+func countHash(hashes []uint64, h uint64) int {
+	n := 0
+	for _, x := range hashes {
+		if x == h {
+			n++
+		}
+	}
+	return n
+}
+
+// checkRates flags the users over the rate threshold, and forgets those
+// who have gone quiet.
+func (d *detector) checkRates(now time.Time) {
+	counts := make([]int, 0, len(d.users))
+	for name, u := range d.users {
+		n := u.events.sum(now)
+		if n == 0 {
+			delete(d.users, name)
+			continue
+		}
+		counts = append(counts, n)
+	}
+	if len(counts) == 0 {
+		return
+	}
+	slices.Sort(counts)
+	median := float64(counts[len(counts)/2])
+	threshold := max(float64(d.cfg.MinEvents), d.cfg.Factor*median)
+	for name, u := range d.users {
+		if n := u.events.sum(now); float64(n) >= threshold {
+			d.flag(name, flagRate, n, fmt.Sprintf("%d events in %v, %.1f× the median of %g", n, d.cfg.Window, float64(n)/median, median), now)
+		}
+	}
+}
+
+// flag records a flag, unless user has already been flagged for reason.
+func (d *detector) flag(user, reason string, events int, detail string, now time.Time) {
+	if d.flagged[reason+"/"+user] {
+		return
+	}
+	d.flagged[reason+"/"+user] = true
+	f := store.UserFlag{User: user, Reason: reason, Events: events, Detail: detail, FlaggedAt: now}
+	d.pending = append(d.pending, f)
+	slog.Info("user flagged", "user", user, "reason", reason, "detail", detail)
+
+	m := d.metrics
+	if reason == flagRate {
+		m.detect.rate.Inc()
+	} else {
+		m.detect.repeat.Inc()
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if p, ok := m.personaOf[user]; ok {
+		m.personas[p].flagged.Inc()
+	}
+	m.detect.recent = append(m.detect.recent, f)
+	if len(m.detect.recent) > detectRecentFlags {
+		m.detect.recent = m.detect.recent[1:]
+	}
+}
@@ -0,0 +1,177 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+)
+
+// maxDeadLetterBackoff caps the exponential backoff between retries.
+const maxDeadLetterBackoff = time.Minute
+
+// deadLetter is an event that could not be written, with why and how often
+// it has been retried.
+type deadLetter struct {
+	event   event.Event
+	err     string
+	retries int
+	failed  time.Time
+	// next is when the retrier tries again; zero once retries are
+	// exhausted and the event stays parked for good.
+	next time.Time
+}
+
+// dlqStats tracks the dead-letter queue.
+type dlqStats struct {
+	size      *metrics.Gauge   // events currently in the queue, parked ones included
+	parked    *metrics.Gauge   // events that ran out of retries
+	recovered *metrics.Counter // events written on a retry
+}
+
+func (s *dlqStats) register(reg *metrics.Registry) {
+	s.size = reg.Gauge("redditsim_dead_letters", "Events in the dead-letter queue, parked ones included.")
+	s.parked = reg.Gauge("redditsim_dead_letters_parked", "Dead letters that ran out of retries.")
+	s.recovered = reg.Counter("redditsim_dead_letters_recovered_total", "Dead letters written on a retry.")
+}
+
+// deadLetterQueue holds events the writers failed to store. A retrier
+// writes them again with exponential backoff, and after MaxRetries
+// failures an event is parked: it stays in the queue, visible on the
+// dashboard and in the report, but is no longer retried.
+//
+// Processing failures never end up here: a failed batch is rolled back
+// and its events are simply claimed again.
+type deadLetterQueue struct {
+	cfg     config.DLQ
+	letters []deadLetter
+	metrics *RedditMetrics
+}
+
+// newDeadLetterQueue returns an empty queue. It shares the metrics mutex,
+// since every change to it is also a change to the counters.
+func newDeadLetterQueue(cfg config.DLQ, metrics *RedditMetrics) *deadLetterQueue {
+	metrics.dlq.register(metrics.registry)
+	return &deadLetterQueue{cfg: cfg, metrics: metrics}
+}
+
+func (q *deadLetterQueue) add(events []event.Event, err error) {
+	now := time.Now()
+	q.metrics.mutex.Lock()
+	defer q.metrics.mutex.Unlock()
+	for _, e := range events {
+		q.letters = append(q.letters, deadLetter{event: e, err: err.Error(), failed: now, next: now.Add(q.cfg.Backoff)})
+	}
+	q.updateMetrics()
+}
+
+// due removes and returns the letters whose retry time has come.
+func (q *deadLetterQueue) due(now time.Time) []deadLetter {
+	q.metrics.mutex.Lock()
+	defer q.metrics.mutex.Unlock()
+
+	var due []deadLetter
+	kept := q.letters[:0]
+	for _, l := range q.letters {
+		if !l.next.IsZero() && !now.Before(l.next) {
+			due = append(due, l)
+		} else {
+			kept = append(kept, l)
+		}
+	}
+	q.letters = kept
+	return due
+}
+
+// retried puts back letters whose retry failed, backing off further or
+// parking them, and counts the ones that made it. A retry refused by the
+// open circuit breaker never reached the store, so it doesn't count.
+func (q *deadLetterQueue) retried(letters []deadLetter, err error) {
+	now := time.Now()
+	q.metrics.mutex.Lock()
+	defer q.metrics.mutex.Unlock()
+
+	if err == nil {
+		q.metrics.dlq.recovered.Add(len(letters))
+		for _, l := range letters {
+			q.metrics.countStored([]event.Event{l.event})
+		}
+		q.updateMetrics()
+		return
+	}
+	for _, l := range letters {
+		if errors.Is(err, errBreakerOpen) {
+			l.next = now.Add(q.cfg.Backoff)
+			q.letters = append(q.letters, l)
+			continue
+		}
+		l.retries++
+		l.err = err.Error()
+		if l.retries >= q.cfg.MaxRetries {
+			l.next = time.Time{}
+		} else {
+			l.next = now.Add(min(q.cfg.Backoff<<l.retries, maxDeadLetterBackoff))
+		}
+		q.letters = append(q.letters, l)
+	}
+	q.updateMetrics()
+}
+
+// putBack returns letters taken by due but not attempted.
+func (q *deadLetterQueue) putBack(letters []deadLetter) {
+	q.metrics.mutex.Lock()
+	defer q.metrics.mutex.Unlock()
+	q.letters = append(q.letters, letters...)
+}
+
+// updateMetrics publishes the queue size; the metrics mutex must be held.
+func (q *deadLetterQueue) updateMetrics() {
+	parked := 0
+	for _, l := range q.letters {
+		if l.next.IsZero() {
+			parked++
+		}
+	}
+	q.metrics.dlq.size.Set(float64(len(q.letters)))
+	q.metrics.dlq.parked.Set(float64(parked))
+}
+
+// Retries dead letters - runs in its own goroutine. Every tick it writes
+// whatever is due, in batches of up to batchSize, through the same
+// destination the writers use. After a failed batch the rest wait for the
+// next tick without it counting as a retry.
+func retryDeadLetters(ctx context.Context, q *deadLetterQueue, dest destination, batchSize int) {
+	ticker := time.NewTicker(min(q.cfg.Backoff, time.Second))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			letters := q.due(now)
+			for len(letters) > 0 {
+				n := min(batchSize, len(letters))
+				batch := letters[:n]
+				letters = letters[n:]
+
+				events := make([]event.Event, len(batch))
+				for i, l := range batch {
+					events[i] = l.event
+				}
+				err := dest.write(context.Background(), events)
+				q.retried(batch, err)
+				if err != nil {
+					slog.Warn("retry dead letters", "events", len(events), "err", err)
+					q.putBack(letters)
+					break
+				}
+				slog.Info("recovered dead letters", "events", len(events))
+			}
+		}
+	}
+}
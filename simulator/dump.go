@@ -0,0 +1,256 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+	"web-traffic-sim/metrics"
+)
+
+// dumpStats tracks the dump loader.
+type dumpStats struct {
+	lines    *metrics.Counter
+	skipped  *metrics.Counter // lines that weren't a post or comment
+	posts    *metrics.Counter
+	comments *metrics.Counter
+	votes    *metrics.Counter
+	done     bool
+}
+
+func (s *dumpStats) register(reg *metrics.Registry) {
+	s.lines = reg.Counter("redditsim_dump_lines_total", "Lines read from archive dumps.")
+	s.skipped = reg.Counter("redditsim_dump_skipped_total", "Dump lines that weren't a post or comment.")
+	sent := reg.CounterVec("redditsim_dump_events_total", "Events sent from archive dumps.", "type")
+	s.posts, s.comments, s.votes = sent.With("post"), sent.With("comment"), sent.With("vote")
+}
+
+type dumpSnapshot struct {
+	Lines    int  `json:"lines"`
+	Skipped  int  `json:"skipped"`
+	Posts    int  `json:"posts"`
+	Comments int  `json:"comments"`
+	Votes    int  `json:"votes"`
+	Done     bool `json:"done"`
+}
+
+// dumpThing is the part of a dump line the loader reads. Submissions and
+// comments share most of it: a comment is the one with a link_id.
+type dumpThing struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Subreddit string     `json:"subreddit"`
+	Author    string     `json:"author"`
+	Title     string     `json:"title"`
+	Selftext  string     `json:"selftext"`
+	Body      string     `json:"body"`
+	LinkID    string     `json:"link_id"`
+	ParentID  string     `json:"parent_id"`
+	Score     dumpNumber `json:"score"`
+	Created   dumpNumber `json:"created_utc"`
+}
+
+// dumpNumber is a number the older dumps sometimes quote.
+type dumpNumber float64
+
+func (n *dumpNumber) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		*n = 0
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	*n = dumpNumber(f)
+	return err
+}
+
+// fullname is the thing's "t3_..." or "t1_..." ID.
+func (t *dumpThing) fullname() string {
+	if t.Name != "" {
+		return t.Name
+	}
+	if t.LinkID != "" {
+		return "t1_" + t.ID
+	}
+	return "t3_" + t.ID
+}
+
+// dumpFile is one open dump and the next thing in it; head is nil once it
+// has run out.
+type dumpFile struct {
+	name string
+	r    *bufio.Reader
+	c    io.Closer
+	head *dumpThing
+}
+
+// advance reads the next post or comment, skipping lines that aren't one.
+func (f *dumpFile) advance(metrics *RedditMetrics) {
+	f.head = nil
+	for {
+		line, err := f.r.ReadBytes('\n')
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			var t dumpThing
+			ok := json.Unmarshal(line, &t) == nil && t.ID != "" && t.Subreddit != ""
+			metrics.dump.lines.Inc()
+			if !ok {
+				metrics.dump.skipped.Inc()
+			}
+			if ok {
+				f.head = &t
+				return
+			}
+		}
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				slog.Error("dump", "file", f.name, "err", err)
+			}
+			return
+		}
+	}
+}
+
+// dumpLoader merges dump files into one stream in created_utc order, so a
+// post goes out before the comments on it even when they're in different
+// files, and follows each thing with the votes its score calls for.
+type dumpLoader struct {
+	files   []*dumpFile
+	votes   float64
+	rng     *generator.RandSource
+	pending []event.Event // votes still to send for the last thing
+	metrics *RedditMetrics
+}
+
+func newDumpLoader(cfg config.Dump, rng *generator.RandSource, metrics *RedditMetrics) (*dumpLoader, error) {
+	l := &dumpLoader{votes: cfg.Votes, rng: rng, metrics: metrics}
+	for _, name := range strings.Split(cfg.Files, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		r, err := openRecording(name)
+		if err != nil {
+			l.Close()
+			return nil, err
+		}
+		f := &dumpFile{name: name, r: bufio.NewReaderSize(r, 1<<20), c: r}
+		f.advance(metrics)
+		l.files = append(l.files, f)
+	}
+	if len(l.files) == 0 {
+		return nil, fmt.Errorf("no dump files in %q", cfg.Files)
+	}
+	return l, nil
+}
+
+// next returns the next event, and false once every file has run out.
+func (l *dumpLoader) next() (event.Event, bool) {
+	if len(l.pending) > 0 {
+		e := l.pending[0]
+		l.pending = l.pending[1:]
+		return e, true
+	}
+	var first *dumpFile
+	for _, f := range l.files {
+		if f.head != nil && (first == nil || f.head.Created < first.head.Created) {
+			first = f
+		}
+	}
+	if first == nil {
+		return event.Event{}, false
+	}
+	t := first.head
+	first.advance(l.metrics)
+
+	e := event.Event{User: t.Author, Subreddit: t.Subreddit}
+	vote := event.Event{Subreddit: t.Subreddit}
+	if t.LinkID != "" {
+		e.Type, e.PostID, e.CommentID, e.ParentID, e.Payload = event.Comment, t.LinkID, t.fullname(), t.ParentID, t.Body
+		vote.PostID, vote.CommentID = t.LinkID, e.CommentID
+	} else {
+		e.Type, e.PostID, e.Payload = event.Post, t.fullname(), t.Title
+		if t.Selftext != "" {
+			e.Payload += "\n\n" + t.Selftext
+		}
+		vote.PostID = e.PostID
+	}
+
+	// The score is all a dump has of the voting, so the votes all go its
+	// way, cast by users as skewed as the generators'
+	vote.Type = event.Upvote
+	if t.Score < 0 {
+		vote.Type = event.Downvote
+	}
+	n := math.Abs(float64(t.Score)) * l.votes
+	count := int(n)
+	if l.rng.Float64() < n-float64(count) {
+		count++
+	}
+	l.pending = l.pending[:0]
+	for range count {
+		v := vote
+		v.User = generator.UserName(l.rng.Users.Next())
+		l.pending = append(l.pending, v)
+	}
+	return e, true
+}
+
+func (l *dumpLoader) Close() {
+	for _, f := range l.files {
+		f.c.Close()
+	}
+}
+
+// Sends the posts and comments of archive dumps in place of the
+// generators - runs in its own goroutine, counted as generator 0, at the
+// generator rate and with its arrival process, so -rate, the controls and
+// a scenario pace it as they would the generators. Each thing goes out
+// stamped with the time it's sent, followed by its votes. Once the dumps
+// run out, or turn out to be unreadable, done is called to end the run.
+func loadDump(ctx context.Context, cfg config.Dump, a generator.Arrivals, rng *generator.RandSource, queue *eventQueue, done func(), metrics *RedditMetrics) {
+	defer done()
+	l, err := newDumpLoader(cfg, rng, metrics)
+	if err != nil {
+		slog.Error("dump", "files", cfg.Files, "err", err)
+		return
+	}
+	defer l.Close()
+
+	generator.Pace(ctx, a, nil, func() bool {
+		e, ok := l.next()
+		if !ok {
+			metrics.mutex.Lock()
+			metrics.dump.done = true
+			metrics.mutex.Unlock()
+			return false
+		}
+		e.Timestamp = time.Now()
+		if !queue.send(ctx, e) {
+			return false
+		}
+
+		switch e.Type {
+		case event.Post:
+			metrics.dump.posts.Inc()
+		case event.Comment:
+			metrics.dump.comments.Inc()
+		default:
+			metrics.dump.votes.Inc()
+		}
+		metrics.countEvent(e)
+		metrics.generators[0].events.Inc()
+		metrics.generators[0].beat.beat()
+		return true
+	})
+}
@@ -0,0 +1,157 @@
+package simulator
+
+import (
+	"cmp"
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"slices"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+)
+
+// enrichStats counts the events enriched by each country, device and app
+// version the config names, and under otherClient those whose client was
+// already set to one it doesn't. The counters are all made up front, so
+// counting is a lookup in a map that's never written again, and input
+// can't add labels without bound.
+type enrichStats struct {
+	countries   map[string]*metrics.Counter
+	devices     map[string]*metrics.Counter
+	appVersions map[string]*metrics.Counter
+}
+
+func (s *enrichStats) register(reg *metrics.Registry, cfg config.Enrich) {
+	counters := func(vec *metrics.CounterVec, ws config.Weights) map[string]*metrics.Counter {
+		m := make(map[string]*metrics.Counter, len(ws)+1)
+		for _, w := range ws {
+			m[w.Name] = vec.With(w.Name)
+		}
+		if m[otherClient] == nil {
+			m[otherClient] = vec.With(otherClient)
+		}
+		return m
+	}
+	s.countries = counters(reg.CounterVec("redditsim_events_by_country_total", "Events enriched, by the country they were sent from.", "country"), cfg.Countries)
+	s.devices = counters(reg.CounterVec("redditsim_events_by_device_total", "Events enriched, by the device they were sent from.", "device"), cfg.Devices)
+	s.appVersions = counters(reg.CounterVec("redditsim_events_by_app_version_total", "Events enriched, by the app version they were sent from.", "app_version"), cfg.AppVersions)
+}
+
+// otherClient is the label events are counted under whose client names a
+// country, device or app version the config doesn't.
+const otherClient = "other"
+
+// countClient counts an event from name in m, or under otherClient if m
+// has no counter for it.
+func countClient(m map[string]*metrics.Counter, name string) {
+	c, ok := m[name]
+	if !ok {
+		c = m[otherClient]
+	}
+	c.Inc()
+}
+
+// ClientShare is how many of the enriched events came from one country,
+// device or app version.
+type ClientShare struct {
+	Name   string  `json:"name"`
+	Events int     `json:"events"`
+	Share  float64 `json:"share"`
+}
+
+type enrichSnapshot struct {
+	Countries   []ClientShare `json:"countries"`
+	Devices     []ClientShare `json:"devices"`
+	AppVersions []ClientShare `json:"app_versions"`
+}
+
+func (s enrichStats) snapshot() enrichSnapshot {
+	shares := func(m map[string]*metrics.Counter) []ClientShare {
+		var list []ClientShare
+		total := 0
+		for name, c := range m {
+			if n := c.Value(); n > 0 {
+				list = append(list, ClientShare{Name: name, Events: n})
+				total += n
+			}
+		}
+		for i := range list {
+			list[i].Share = float64(list[i].Events) / float64(total)
+		}
+		slices.SortFunc(list, func(a, b ClientShare) int {
+			return cmp.Or(cmp.Compare(b.Events, a.Events), cmp.Compare(a.Name, b.Name))
+		})
+		return list
+	}
+	return enrichSnapshot{Countries: shares(s.countries), Devices: shares(s.devices), AppVersions: shares(s.appVersions)}
+}
+
+// weightedPicker picks one of a Weights' names from a number in [0,1).
+type weightedPicker struct {
+	names []string
+	cum   []float64 // cumulative weights, scaled to end at 1
+}
+
+func newWeightedPicker(ws config.Weights) weightedPicker {
+	p := weightedPicker{names: make([]string, len(ws)), cum: make([]float64, len(ws))}
+	total := 0.0
+	for i, w := range ws {
+		total += w.Weight
+		p.names[i], p.cum[i] = w.Name, total
+	}
+	for i := range p.cum {
+		p.cum[i] /= total
+	}
+	return p
+}
+
+func (p weightedPicker) pick(u float64) string {
+	i, _ := slices.BinarySearch(p.cum, u)
+	return p.names[min(i, len(p.names)-1)]
+}
+
+// newEnricher returns the middleware that fills in the client of every
+// event in a batch, or nil if enrichment is off. Each of a user's country,
+// device and app version is picked by a hash of the user and the seed, so
+// a user always sends from the same client without the enricher having to
+// remember it, and a seeded run gives them the same one every time.
+func newEnricher(cfg config.Enrich, seed int64, metrics *RedditMetrics) Middleware {
+	if !cfg.Enabled {
+		return nil
+	}
+	metrics.enrich.register(metrics.registry, cfg)
+	countries, devices, appVersions := newWeightedPicker(cfg.Countries), newWeightedPicker(cfg.Devices), newWeightedPicker(cfg.AppVersions)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, batch []event.Event) error {
+			for i := range batch {
+				e := &batch[i]
+				if e.Client == (event.Client{}) {
+					e.Client = event.Client{
+						Country:    countries.pick(seededHash(seed, 'c', e.User)),
+						Device:     devices.pick(seededHash(seed, 'd', e.User)),
+						AppVersion: appVersions.pick(seededHash(seed, 'v', e.User)),
+					}
+				}
+				countClient(metrics.enrich.countries, e.Client.Country)
+				countClient(metrics.enrich.devices, e.Client.Device)
+				countClient(metrics.enrich.appVersions, e.Client.AppVersion)
+			}
+			return next(ctx, batch)
+		}
+	}
+}
+
+// seededHash hashes s, with the seed and a byte telling apart what it's
+// for, to a number in [0,1).
+func seededHash(seed int64, what byte, s string) float64 {
+	var salt [9]byte
+	binary.LittleEndian.PutUint64(salt[:], uint64(seed))
+	salt[8] = what
+	h := fnv.New64a()
+	h.Write(salt[:])
+	h.Write([]byte(s))
+	return float64(h.Sum64()>>11) / (1 << 53)
+}
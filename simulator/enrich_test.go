@@ -0,0 +1,41 @@
+package simulator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+func TestEnricherCountsUnknownClients(t *testing.T) {
+	cfg := config.Default().Enrich
+	cfg.Enabled = true
+	m := newRedditMetrics(1, 1, 1, time.Second)
+	enrich := newEnricher(cfg, 1, m)
+
+	batch := []event.Event{
+		{User: "u1"},
+		{User: "u2", Client: event.Client{Country: "US", Device: "ios", AppVersion: "2026.41.0"}},
+		{User: "u3", Client: event.Client{Country: "ZZ", Device: "fridge", AppVersion: "0.1"}},
+	}
+	nop := func(context.Context, []event.Event) error { return nil }
+	if err := enrich(nop)(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := m.enrich.snapshot()
+	for name, shares := range map[string][]ClientShare{"countries": snap.Countries, "devices": snap.Devices, "app versions": snap.AppVersions} {
+		total, other := 0, 0
+		for _, s := range shares {
+			total += s.Events
+			if s.Name == otherClient {
+				other = s.Events
+			}
+		}
+		if total != len(batch) || other != 1 {
+			t.Errorf("%s: counted %d events, %d as %q, want %d and 1", name, total, other, otherClient, len(batch))
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// exportStore is implemented by stores that can export processed events.
+type exportStore interface {
+	// ExportEvents hands up to limit processed events that haven't been
+	// exported yet, oldest first, to export, flags them exported if it
+	// succeeds, and returns how many there were.
+	ExportEvents(ctx context.Context, limit int, export func([]event.Event) error) (int, error)
+}
+
+// exportStats tracks the export job.
+type exportStats struct {
+	files  *metrics.Counter
+	events *metrics.Counter
+	bytes  *metrics.Counter
+	failed *metrics.Counter
+	// Time spent encoding and uploading the files
+	uploading *metrics.Counter
+}
+
+func (s *exportStats) register(reg *metrics.Registry) {
+	s.events = reg.Counter("redditsim_export_events_total", "Processed events exported.")
+	s.files = reg.Counter("redditsim_export_files_total", "Export files uploaded.")
+	s.bytes = reg.Counter("redditsim_export_bytes_total", "Compressed bytes of export files uploaded.")
+	s.failed = reg.Counter("redditsim_export_failures_total", "Export files that failed, leaving their events unexported.")
+	s.uploading = reg.SecondsCounter("redditsim_export_upload_seconds_total", "Time spent encoding and uploading export files.")
+}
+
+type exportSnapshot struct {
+	Files     int           `json:"files"`
+	Events    int           `json:"events"`
+	Bytes     int64         `json:"bytes"`
+	Failed    int           `json:"failed"`
+	Uploading time.Duration `json:"uploading_ns"`
+}
+
+// Throughput is the upload rate in bytes/second.
+func (s exportSnapshot) Throughput() float64 {
+	if s.Uploading == 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Uploading.Seconds()
+}
+
+// Exports processed events to dest every interval - runs in its own
+// goroutine, a warehouse-ingest pipeline downstream of the processors. Each
+// file holds up to batch events, and the job exports file after file until
+// it has caught up. A failed file leaves its events unexported, to go in
+// the next attempt's.
+func exportEvents(ctx context.Context, es exportStore, dest archiveDest, cfg config.Export, metrics *RedditMetrics) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	run := runStamp(time.Now())
+	export := func(events []event.Event) error {
+		name := fmt.Sprintf("%s/events-%d-%d%s", run, events[0].ID, events[len(events)-1].ID, archiveExt[cfg.Format])
+		start := time.Now()
+		_, size, err := writeArchive(ctx, dest, name, cfg.Format, store.EmitAll(events))
+		took := time.Since(start)
+
+		if err != nil {
+			metrics.export.failed.Inc()
+			return err
+		}
+		metrics.export.files.Inc()
+		metrics.export.events.Add(len(events))
+		metrics.export.bytes.Add(int(size))
+		metrics.export.uploading.AddDuration(took)
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := es.ExportEvents(ctx, cfg.Batch, export)
+				if err != nil && ctx.Err() == nil {
+					slog.Error("export events", "dest", dest.String(), "err", err)
+				}
+				if err != nil || n < cfg.Batch {
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package simulator
+
+import (
+	"context"
+	"strings"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+)
+
+// filterStats counts the events the filter left out.
+type filterStats struct {
+	filtered *metrics.Counter // outside the subreddits
+	sampled  *metrics.Counter // sampled out
+}
+
+func (s *filterStats) register(reg *metrics.Registry) {
+	left := reg.CounterVec("redditsim_events_filtered_total", "Events left out before they were stored, by reason.", "reason")
+	s.filtered, s.sampled = left.With("subreddit"), left.With("sampled")
+}
+
+type filterSnapshot struct {
+	Filtered int `json:"filtered"`
+	Sampled  int `json:"sampled"`
+}
+
+func (s filterStats) snapshot() filterSnapshot {
+	return filterSnapshot{Filtered: s.filtered.Value(), Sampled: s.sampled.Value()}
+}
+
+// newFilter returns the middleware that leaves out what cfg says to, or
+// nil if it keeps everything. Whether an event is sampled is decided by a
+// hash of what it says and the seed, not of its idempotency key, which is
+// random: so a redelivered event is kept or left out as it was the first
+// time, and a seeded run samples the same events every time.
+func newFilter(cfg config.Filter, seed int64, metrics *RedditMetrics) Middleware {
+	var subreddits map[string]bool
+	for _, name := range strings.Split(cfg.Subreddits, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			if subreddits == nil {
+				subreddits = make(map[string]bool)
+			}
+			subreddits[name] = true
+		}
+	}
+	if subreddits == nil && len(cfg.Sample) == 0 {
+		return nil
+	}
+	metrics.filter.register(metrics.registry)
+	return func(next Handler) Handler {
+		return func(ctx context.Context, batch []event.Event) error {
+			kept := make([]event.Event, 0, len(batch))
+			for _, e := range batch {
+				switch {
+				case subreddits != nil && !subreddits[e.Subreddit]:
+					metrics.filter.filtered.Inc()
+				case !sampled(seed, e, cfg.Sample.Fraction(e.Type.String())):
+					metrics.filter.sampled.Inc()
+				default:
+					kept = append(kept, e)
+				}
+			}
+			if len(kept) == 0 {
+				return nil
+			}
+			return next(ctx, kept)
+		}
+	}
+}
+
+// sampled reports whether e is among the fraction kept. Its time is left
+// out of the hash, being the one thing a rerun changes; two events that
+// agree on everything else are both kept or both left out.
+func sampled(seed int64, e event.Event, fraction float64) bool {
+	if fraction >= 1 {
+		return true
+	}
+	what := strings.Join([]string{e.Type.String(), e.User, e.Subreddit, e.PostID, e.CommentID, e.ParentID, e.Target, e.Payload}, "\x00")
+	return seededHash(seed, 's', what) < fraction
+}
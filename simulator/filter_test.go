@@ -0,0 +1,59 @@
+package simulator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+)
+
+func TestFilterSamplesSeededRunsAlike(t *testing.T) {
+	const seed, n = 42, 500
+	// run generates n events with seed, keyed and timed afresh as a run
+	// would, and returns the ones the filter keeps.
+	run := func() []event.Event {
+		cfg := config.Default()
+		subreddits, err := generator.NewCatalog(cfg.Generator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := generator.NewWorld(subreddits, generator.NewTextGen(cfg.Content), 0)
+		rng := generator.NewRandSource(seed, cfg.Generator)
+		batch := make([]event.Event, n)
+		for i := range batch {
+			batch[i] = generator.RandomEvent(rng, w)
+			batch[i].Key = uuid.NewString()
+		}
+
+		filter := newFilter(config.Filter{Sample: config.Sampling{"": 0.5}}, seed, newRedditMetrics(1, 1, 1, time.Second))
+		var kept []event.Event
+		store := func(_ context.Context, events []event.Event) error {
+			kept = append(kept, events...)
+			return nil
+		}
+		if err := filter(store)(context.Background(), batch); err != nil {
+			t.Fatal(err)
+		}
+		return kept
+	}
+
+	first, second := run(), run()
+	if len(first) == 0 || len(first) == n {
+		t.Fatalf("kept %d of %d events, want some left out", len(first), n)
+	}
+	if len(first) != len(second) {
+		t.Fatalf("kept %d events, then %d", len(first), len(second))
+	}
+	for i := range first {
+		a, b := first[i], second[i]
+		a.Key, a.Timestamp, b.Key, b.Timestamp = "", time.Time{}, "", time.Time{}
+		if a != b {
+			t.Fatalf("kept event %d differs: %+v, then %+v", i, a, b)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package simulator
+
+import (
+	"sync"
+
+	"web-traffic-sim/event"
+)
+
+// firehose fans every generated event out to any number of live
+// subscribers (gRPC streams, SSE clients). Publishing never blocks the generators:
+// a subscriber whose buffer is full is disconnected rather than allowed to
+// slow everyone else down.
+type firehose struct {
+	mu      sync.Mutex
+	subs    map[*subscription]struct{}
+	buffer  int // events a subscriber may fall behind before it is cut off
+	metrics *RedditMetrics
+}
+
+// subscription is one consumer's view of the firehose. events is closed
+// when the subscriber is disconnected for being too slow.
+type subscription struct {
+	events chan event.Event
+}
+
+func newFirehose(buffer int, metrics *RedditMetrics) *firehose {
+	return &firehose{subs: make(map[*subscription]struct{}), buffer: buffer, metrics: metrics}
+}
+
+func (f *firehose) subscribe() *subscription {
+	s := &subscription{events: make(chan event.Event, f.buffer)}
+	f.mu.Lock()
+	f.subs[s] = struct{}{}
+	f.updateMetrics(false)
+	f.mu.Unlock()
+	return s
+}
+
+// unsubscribe is safe to call after the subscription has been dropped.
+func (f *firehose) unsubscribe(s *subscription) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.subs[s]; ok {
+		delete(f.subs, s)
+		close(s.events)
+		f.updateMetrics(false)
+	}
+}
+
+func (f *firehose) publish(e event.Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		select {
+		case s.events <- e:
+		default:
+			// Too slow: cut it off instead of blocking the generators
+			delete(f.subs, s)
+			close(s.events)
+			f.updateMetrics(true)
+		}
+	}
+}
+
+// updateMetrics publishes the subscriber count; f.mu must be held.
+func (f *firehose) updateMetrics(disconnected bool) {
+	f.metrics.mutex.Lock()
+	f.metrics.firehose.subscribers = len(f.subs)
+	if disconnected {
+		f.metrics.firehose.disconnects++
+	}
+	f.metrics.mutex.Unlock()
+}
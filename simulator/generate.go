@@ -0,0 +1,44 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+
+	"web-traffic-sim/metrics"
+)
+
+// generatorStats tracks a single generator goroutine.
+type generatorStats struct {
+	events metrics.Counter
+	beat   workerHeartbeat
+}
+
+// Simulates user activity - runs in its own goroutine, one per generator,
+// sending what src makes to the queue and counting it as generator id's
+// until ctx is done or src runs out. The random generators each produce
+// their share of the global target rate, which the run controls can
+// change, and take all their randomness from their own source, so a run
+// with a fixed seed and a single generator replays exactly the same event
+// stream. Several generators share the queue; Run closes its channel once
+// all of them have returned so the writers can drain whatever is still
+// buffered.
+func generateEvents(ctx context.Context, id int, src EventSource, queue *eventQueue, metrics *RedditMetrics) {
+	for {
+		e, err := src.Next(ctx)
+		if err != nil {
+			if ctx.Err() == nil && !errors.Is(err, io.EOF) {
+				slog.Error("generate events", "generator", id, "err", err)
+			}
+			return
+		}
+		if !queue.send(ctx, e) {
+			return
+		}
+
+		metrics.countEvent(e)
+		metrics.generators[id].events.Inc()
+		metrics.generators[id].beat.beat()
+	}
+}
@@ -0,0 +1,306 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/graphql-go/graphql"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/store"
+)
+
+// graphQuerier is implemented by stores that materialize events into
+// posts, comments and users, and can read them back for the GraphQL API.
+type graphQuerier interface {
+	// Posts returns up to f.Limit posts matching f, in f.Sort order.
+	Posts(ctx context.Context, f store.PostFilter) ([]store.RankedPost, error)
+	// Comments returns up to f.Limit comments matching f, oldest first.
+	Comments(ctx context.Context, f store.CommentFilter) ([]store.Comment, error)
+	// User returns store.ErrUserNotFound if no one by that name has acted yet.
+	User(ctx context.Context, name string) (store.User, error)
+}
+
+// defaultGraphPage is how many items a list field returns when the query
+// doesn't say.
+const defaultGraphPage = 25
+
+// newGraphSchema builds the GraphQL schema over q:
+//
+//	posts(subreddit, author, sort: HOT|TOP|NEW, first)  post(id)  comment(id)  user(name)
+//
+// Posts, comments and users link to each other, and every field that
+// follows a link is resolved by a query of its own when it's asked for, so
+// a query can go as deep as the tree does.
+func newGraphSchema(q graphQuerier) (graphql.Schema, error) {
+	sort := graphql.NewEnum(graphql.EnumConfig{
+		Name: "Sort",
+		Values: graphql.EnumValueConfigMap{
+			"HOT": {Value: config.SortHot},
+			"TOP": {Value: config.SortTop},
+			"NEW": {Value: config.SortNew},
+		},
+	})
+	first := &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultGraphPage}
+	limit := func(p graphql.ResolveParams) int {
+		n, _ := p.Args["first"].(int)
+		return min(max(n, 0), maxPageSize)
+	}
+	str := func(p graphql.ResolveParams, name string) string {
+		s, _ := p.Args[name].(string)
+		return s
+	}
+
+	var post, comment, user *graphql.Object
+	postByID := func(ctx context.Context, id string) (any, error) {
+		posts, err := q.Posts(ctx, store.PostFilter{ID: id, Sort: config.SortNew, Limit: 1})
+		if err != nil || len(posts) == 0 {
+			return nil, err
+		}
+		return posts[0], nil
+	}
+	commentByID := func(ctx context.Context, id string) (any, error) {
+		comments, err := q.Comments(ctx, store.CommentFilter{ID: id, Limit: 1})
+		if err != nil || len(comments) == 0 {
+			return nil, err
+		}
+		return comments[0], nil
+	}
+	userByName := func(ctx context.Context, name string) (any, error) {
+		u, err := q.User(ctx, name)
+		if errors.Is(err, store.ErrUserNotFound) {
+			return nil, nil
+		}
+		return u, err
+	}
+
+	post = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Post",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			get := func(t graphql.Output, f func(store.RankedPost) any) *graphql.Field {
+				return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (any, error) {
+					return f(p.Source.(store.RankedPost)), nil
+				}}
+			}
+			return graphql.Fields{
+				"id":           get(graphql.NewNonNull(graphql.ID), func(p store.RankedPost) any { return p.ID }),
+				"subreddit":    get(graphql.NewNonNull(graphql.String), func(p store.RankedPost) any { return p.Subreddit }),
+				"title":        get(graphql.NewNonNull(graphql.String), func(p store.RankedPost) any { return p.Title }),
+				"ups":          get(graphql.NewNonNull(graphql.Int), func(p store.RankedPost) any { return p.Ups }),
+				"downs":        get(graphql.NewNonNull(graphql.Int), func(p store.RankedPost) any { return p.Downs }),
+				"score":        get(graphql.NewNonNull(graphql.Int), func(p store.RankedPost) any { return p.Ups - p.Downs }),
+				"hot":          get(graphql.NewNonNull(graphql.Float), func(p store.RankedPost) any { return p.Hot }),
+				"commentCount": get(graphql.NewNonNull(graphql.Int), func(p store.RankedPost) any { return p.Comments }),
+				"createdAt":    get(graphql.NewNonNull(graphql.DateTime), func(p store.RankedPost) any { return p.CreatedAt }),
+				"author": {
+					Type: user,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return userByName(p.Context, p.Source.(store.RankedPost).Author)
+					},
+				},
+				"comments": {
+					Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(comment))),
+					Description: "Top-level comments, oldest first.",
+					Args:        graphql.FieldConfigArgument{"first": first},
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return q.Comments(p.Context, store.CommentFilter{Post: p.Source.(store.RankedPost).ID, Limit: limit(p)})
+					},
+				},
+			}
+		}),
+	})
+
+	comment = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Comment",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			get := func(t graphql.Output, f func(store.Comment) any) *graphql.Field {
+				return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (any, error) {
+					return f(p.Source.(store.Comment)), nil
+				}}
+			}
+			return graphql.Fields{
+				"id":         get(graphql.NewNonNull(graphql.ID), func(c store.Comment) any { return c.ID }),
+				"body":       get(graphql.NewNonNull(graphql.String), func(c store.Comment) any { return c.Body }),
+				"depth":      get(graphql.NewNonNull(graphql.Int), func(c store.Comment) any { return c.Depth }),
+				"replyCount": get(graphql.NewNonNull(graphql.Int), func(c store.Comment) any { return c.Replies }),
+				"ups":        get(graphql.NewNonNull(graphql.Int), func(c store.Comment) any { return c.Ups }),
+				"downs":      get(graphql.NewNonNull(graphql.Int), func(c store.Comment) any { return c.Downs }),
+				"score":      get(graphql.NewNonNull(graphql.Int), func(c store.Comment) any { return c.Ups - c.Downs }),
+				"createdAt":  get(graphql.NewNonNull(graphql.DateTime), func(c store.Comment) any { return c.CreatedAt }),
+				"author": {
+					Type: user,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return userByName(p.Context, p.Source.(store.Comment).Author)
+					},
+				},
+				"post": {
+					Type: post,
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return postByID(p.Context, p.Source.(store.Comment).Post)
+					},
+				},
+				"parent": {
+					Type:        comment,
+					Description: "The comment this one replies to; null at the top level.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						if c := p.Source.(store.Comment); c.Parent != "" {
+							return commentByID(p.Context, c.Parent)
+						}
+						return nil, nil
+					},
+				},
+				"replies": {
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(comment))),
+					Args: graphql.FieldConfigArgument{"first": first},
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						c := p.Source.(store.Comment)
+						return q.Comments(p.Context, store.CommentFilter{Post: c.Post, Parent: c.ID, Limit: limit(p)})
+					},
+				},
+			}
+		}),
+	})
+
+	user = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			get := func(t graphql.Output, f func(store.User) any) *graphql.Field {
+				return &graphql.Field{Type: t, Resolve: func(p graphql.ResolveParams) (any, error) {
+					return f(p.Source.(store.User)), nil
+				}}
+			}
+			return graphql.Fields{
+				"name":         get(graphql.NewNonNull(graphql.String), func(u store.User) any { return u.Name }),
+				"postKarma":    get(graphql.NewNonNull(graphql.Int), func(u store.User) any { return u.PostKarma }),
+				"commentKarma": get(graphql.NewNonNull(graphql.Int), func(u store.User) any { return u.CommentKarma }),
+				"karma":        get(graphql.NewNonNull(graphql.Int), func(u store.User) any { return u.PostKarma + u.CommentKarma }),
+				"createdAt":    get(graphql.NewNonNull(graphql.DateTime), func(u store.User) any { return u.CreatedAt }),
+				"posts": {
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(post))),
+					Args: graphql.FieldConfigArgument{
+						"sort":  {Type: sort, DefaultValue: config.SortNew},
+						"first": first,
+					},
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return q.Posts(p.Context, store.PostFilter{Author: p.Source.(store.User).Name, Sort: str(p, "sort"), Limit: limit(p)})
+					},
+				},
+				"comments": {
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(comment))),
+					Args: graphql.FieldConfigArgument{"first": first},
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						return q.Comments(p.Context, store.CommentFilter{Author: p.Source.(store.User).Name, Limit: limit(p)})
+					},
+				},
+			}
+		}),
+	})
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"posts": {
+				Type:        graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(post))),
+				Description: "The front page, or a subreddit's or a user's posts.",
+				Args: graphql.FieldConfigArgument{
+					"subreddit": {Type: graphql.String},
+					"author":    {Type: graphql.String},
+					"sort":      {Type: sort, DefaultValue: config.SortHot},
+					"first":     first,
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return q.Posts(p.Context, store.PostFilter{
+						Subreddit: str(p, "subreddit"),
+						Author:    str(p, "author"),
+						Sort:      str(p, "sort"),
+						Limit:     limit(p),
+					})
+				},
+			},
+			"post": {
+				Type: post,
+				Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return postByID(p.Context, str(p, "id"))
+				},
+			},
+			"comment": {
+				Type: comment,
+				Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return commentByID(p.Context, str(p, "id"))
+				},
+			},
+			"user": {
+				Type: user,
+				Args: graphql.FieldConfigArgument{"name": {Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return userByName(p.Context, str(p, "name"))
+				},
+			},
+		},
+	})
+	return graphql.NewSchema(graphql.SchemaConfig{Query: query})
+}
+
+// graphRequest is a GraphQL request, as a POST body or GET parameters.
+type graphRequest struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// registerGraphQL mounts the GraphQL API at /graphql, for GET with the
+// query in ?query= and POST with a JSON body. With a nil q, as for a store
+// that doesn't implement graphQuerier, it answers 501.
+func registerGraphQL(mux *http.ServeMux, q graphQuerier) error {
+	if q == nil {
+		mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+			writeError(w, http.StatusNotImplemented, errors.New("this backend does not materialize posts and comments"))
+		})
+		return nil
+	}
+	schema, err := newGraphSchema(q)
+	if err != nil {
+		return err
+	}
+
+	mux.HandleFunc("/graphql", func(w http.ResponseWriter, r *http.Request) {
+		var req graphRequest
+		switch r.Method {
+		case http.MethodGet:
+			req.Query = r.URL.Query().Get("query")
+			req.OperationName = r.URL.Query().Get("operationName")
+			if v := r.URL.Query().Get("variables"); v != "" {
+				if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+					writeError(w, http.StatusBadRequest, errors.New("variables must be a JSON object"))
+					return
+				}
+			}
+		case http.MethodPost:
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, errors.New("body must be a JSON object with a query"))
+				return
+			}
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeError(w, http.StatusMethodNotAllowed, errors.New("use GET or POST"))
+			return
+		}
+		if req.Query == "" {
+			writeError(w, http.StatusBadRequest, errors.New("query is required"))
+			return
+		}
+		result := graphql.Do(graphql.Params{
+			Schema:         schema,
+			RequestString:  req.Query,
+			VariableValues: req.Variables,
+			OperationName:  req.OperationName,
+			Context:        r.Context(),
+		})
+		writeJSON(w, http.StatusOK, result)
+	})
+	return nil
+}
@@ -0,0 +1,136 @@
+package simulator
+
+//go:generate protoc -I ../proto --go_out=.. --go_opt=module=web-traffic-sim --go-grpc_out=.. --go-grpc_opt=module=web-traffic-sim redditsim/v1/simulator.proto
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"web-traffic-sim/event"
+	"web-traffic-sim/pb"
+)
+
+// grpcServer implements the Simulator service from
+// proto/redditsim/v1/simulator.proto.
+type grpcServer struct {
+	pb.UnimplementedSimulatorServer
+	ctx     context.Context // ends every stream on shutdown
+	hose    *firehose
+	metrics *RedditMetrics
+}
+
+func (s *grpcServer) SubscribeEvents(req *pb.SubscribeEventsRequest, stream grpc.ServerStreamingServer[pb.Event]) error {
+	want := make(map[pb.EventType]bool, len(req.Types))
+	for _, t := range req.Types {
+		want[t] = true
+	}
+
+	sub := s.hose.subscribe()
+	defer s.hose.unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.ctx.Done():
+			return status.Error(codes.Unavailable, "simulation finished")
+		case e, ok := <-sub.events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "subscriber fell too far behind and was disconnected")
+			}
+			pe := eventToProto(e)
+			if len(want) > 0 && !want[pe.Type] {
+				continue
+			}
+			if err := stream.Send(pe); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *grpcServer) GetMetrics(ctx context.Context, req *pb.GetMetricsRequest) (*pb.Metrics, error) {
+	snap := s.metrics.Snapshot()
+	m := &pb.Metrics{
+		UptimeSeconds:   snap.Uptime,
+		EventsGenerated: int64(snap.EventsGenerated),
+		Dropped:         int64(snap.Dropped),
+		Writes:          int64(snap.Writes),
+		Reads:           int64(snap.Reads),
+		Updates:         int64(snap.Updates),
+		Processed:       int64(snap.Processed),
+		EventsPerSec:    snap.EventsPerSec,
+		WritesPerSec:    snap.WritesPerSec,
+		ProcessedPerSec: snap.ProcessedPerSec,
+		ChannelDepth:    int64(snap.ChannelDepth),
+		Latency:         make(map[string]*pb.Latency, len(snap.Latency)),
+		EventsByType:    make(map[string]int64, len(snap.ByType)),
+	}
+	for op, l := range snap.Latency {
+		m.Latency[op] = &pb.Latency{
+			Count: int64(l.Count),
+			P50:   durationpb.New(l.P50),
+			P95:   durationpb.New(l.P95),
+			P99:   durationpb.New(l.P99),
+			Max:   durationpb.New(l.Max),
+		}
+	}
+	for t, n := range snap.ByType {
+		m.EventsByType[t.String()] = int64(n)
+	}
+	return m, nil
+}
+
+func eventToProto(e event.Event) *pb.Event {
+	return &pb.Event{
+		// pb reserves 0 for EVENT_TYPE_UNSPECIFIED
+		Type:      pb.EventType(e.Type + 1),
+		User:      e.User,
+		Subreddit: e.Subreddit,
+		PostId:    e.PostID,
+		CommentId: e.CommentID,
+		ParentId:  e.ParentID,
+		Target:    e.Target,
+		Payload:   e.Payload,
+		Timestamp: timestamppb.New(e.Timestamp),
+	}
+}
+
+// serveGRPC runs the gRPC server until ctx is cancelled, then stops it,
+// giving in-flight calls a few seconds to finish.
+func serveGRPC(ctx context.Context, addr string, hose *firehose, metrics *RedditMetrics) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		slog.Error("listen for gRPC", "addr", addr, "err", err)
+		return
+	}
+
+	srv := grpc.NewServer()
+	pb.RegisterSimulatorServer(srv, &grpcServer{ctx: ctx, hose: hose, metrics: metrics})
+
+	go func() {
+		<-ctx.Done()
+		stopped := make(chan struct{})
+		go func() {
+			srv.GracefulStop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			srv.Stop()
+		}
+	}()
+
+	if err := srv.Serve(lis); err != nil {
+		slog.Error("serve gRPC", "addr", addr, "err", err)
+	}
+}
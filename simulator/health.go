@@ -0,0 +1,215 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"web-traffic-sim/store"
+)
+
+// workerHeartbeat is when a worker last showed it was alive: at each
+// event a generator (or the replay, dump or sequential loop) sends, each
+// wake-up of a writer and each batch a processor claims. A worker stuck in
+// a hung store call stops beating.
+type workerHeartbeat struct{ at atomic.Int64 }
+
+func (h *workerHeartbeat) beat() { h.at.Store(time.Now().UnixNano()) }
+
+// since is how long ago the last beat was, and false if there was none.
+func (h *workerHeartbeat) since(now time.Time) (time.Duration, bool) {
+	at := h.at.Load()
+	if at == 0 {
+		return 0, false
+	}
+	return now.Sub(time.Unix(0, at)), true
+}
+
+// pingStore is implemented by stores that can check their connection.
+type pingStore interface {
+	Ping(ctx context.Context) error
+}
+
+// healthCheck is one of the checks /healthz and /readyz report.
+type healthCheck struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type healthReport struct {
+	// Status is "ok", or "unhealthy" if any check failed
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks"`
+}
+
+// health answers the Kubernetes-style probes, for running the simulator
+// as a long-lived load generator: /healthz (liveness) fails when a worker
+// has stalled, which a restart may fix, and /readyz (readiness) also when
+// the store can't be reached, the breaker is open, the Kafka sink's
+// publishes keep failing, the backlog keeps growing or the run is shutting
+// down. Both answer 200 or 503 with the checks as JSON.
+type health struct {
+	ctx        context.Context // the run's: done once it's shutting down
+	store      store.Store
+	sink       *kafkaSink // nil without -sink kafka or both
+	ctl        *Controls
+	metrics    *RedditMetrics
+	stallAfter time.Duration
+}
+
+func registerHealth(mux *http.ServeMux, h *health) {
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		h.respond(w, h.workers(h.metrics.Snapshot()))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		snap := h.metrics.Snapshot()
+		checks := append(h.workers(snap), h.running(), h.storeCheck(r.Context(), snap))
+		if h.sink != nil {
+			checks = append(checks, h.sinkCheck())
+		}
+		h.respond(w, append(checks, h.backlog(snap)))
+	})
+}
+
+func (h *health) respond(w http.ResponseWriter, checks []healthCheck) {
+	report := healthReport{Status: "ok", Checks: checks}
+	status := http.StatusOK
+	for _, c := range checks {
+		if !c.OK {
+			report.Status, status = "unhealthy", http.StatusServiceUnavailable
+		}
+	}
+	writeJSON(w, status, report)
+}
+
+// workers checks each kind of worker for ones that have work but haven't
+// beaten for stallAfter. A processor always has work - it polls - and a
+// writer has while events wait in the channel. A generator has unless
+// paused, but at a low rate may go a while between events, so it's
+// allowed three of its gaps. A worker that has never beaten is timed from
+// the start of the run, so one that hangs before its first beat is caught
+// too. In sequential mode the loop beats as the first generator, for the
+// whole pipeline.
+func (h *health) workers(snap Snapshot) []healthCheck {
+	now := time.Now()
+	stalled := func(name string, beats []*workerHeartbeat, busy bool, grace time.Duration) healthCheck {
+		c := healthCheck{Name: name, OK: true}
+		var ids []string
+		for id, b := range beats {
+			since, ok := b.since(now)
+			if !ok {
+				since = now.Sub(h.metrics.startTime)
+			}
+			if busy && since > max(h.stallAfter, grace) {
+				if ok {
+					ids = append(ids, fmt.Sprintf("#%d (%v)", id+1, since.Round(time.Second)))
+				} else {
+					ids = append(ids, fmt.Sprintf("#%d (none in %v)", id+1, since.Round(time.Second)))
+				}
+			}
+		}
+		if len(ids) > 0 {
+			c.OK = false
+			c.Detail = "no heartbeat from " + strings.Join(ids, ", ")
+		} else {
+			c.Detail = fmt.Sprintf("%d alive", len(beats))
+		}
+		return c
+	}
+
+	var gens []*workerHeartbeat
+	for i := range h.metrics.generators {
+		gens = append(gens, &h.metrics.generators[i].beat)
+	}
+	var gap time.Duration
+	if snap.TargetRate > 0 {
+		gap = time.Duration(float64(len(gens)) / snap.TargetRate * float64(time.Second))
+	}
+	checks := []healthCheck{stalled("generators", gens, !snap.Paused && snap.TargetRate > 0, 3*gap)}
+
+	if h.ctl.writers != nil {
+		var beats []*workerHeartbeat
+		all := h.metrics.writers.all()
+		for _, w := range all[:min(h.ctl.writers.size(), len(all))] {
+			beats = append(beats, &w.beat)
+		}
+		checks = append(checks, stalled("writers", beats, snap.ChannelDepth > 0, 0))
+	}
+	if h.ctl.processors != nil {
+		var beats []*workerHeartbeat
+		all := h.metrics.processors.all()
+		for _, p := range all[:min(h.ctl.processors.size(), len(all))] {
+			beats = append(beats, &p.beat)
+		}
+		checks = append(checks, stalled("processors", beats, true, 0))
+	}
+	return checks
+}
+
+func (h *health) running() healthCheck {
+	if h.ctx.Err() != nil {
+		return healthCheck{Name: "run", Detail: "shutting down"}
+	}
+	return healthCheck{Name: "run", OK: true}
+}
+
+// storeCheck pings the store, if it can be pinged, and reports the
+// breaker's state if there is one.
+func (h *health) storeCheck(ctx context.Context, snap Snapshot) healthCheck {
+	c := healthCheck{Name: "store", OK: true}
+	if h.store == nil {
+		c.Detail = "none (-sink kafka)"
+		return c
+	}
+	if p, ok := h.store.(pingStore); ok {
+		ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		defer cancel()
+		start := time.Now()
+		if err := p.Ping(ctx); err != nil {
+			c.OK, c.Detail = false, err.Error()
+			return c
+		}
+		c.Detail = fmt.Sprintf("ping %v", RoundLatency(time.Since(start)))
+	}
+	if snap.Breaker.State == BreakerOpen.String() {
+		c.OK, c.Detail = false, "circuit breaker open"
+	}
+	return c
+}
+
+// sinkCheck fails while the Kafka sink is failing: its last publish
+// failed, and none has got through for stallAfter, or at all. A failure
+// now and then, between deliveries, doesn't count.
+func (h *health) sinkCheck() healthCheck {
+	c := healthCheck{Name: "kafka", OK: true}
+	now := time.Now()
+	failed, anyFailed := h.sink.failed.since(now)
+	delivered, anyDelivered := h.sink.delivered.since(now)
+	switch {
+	case anyFailed && (!anyDelivered || failed < delivered && delivered > h.stallAfter):
+		c.OK = false
+		c.Detail = "publishes failing, none delivered"
+		if anyDelivered {
+			c.Detail += fmt.Sprintf(" for %v", delivered.Round(time.Second))
+		}
+	case anyDelivered:
+		c.Detail = fmt.Sprintf("delivered %v ago", delivered.Round(time.Millisecond))
+	default:
+		c.Detail = "nothing published yet"
+	}
+	return c
+}
+
+// backlog fails while the consumer lag alert is up: the processors have
+// fallen behind and the backlog has grown for -lag-alert without easing.
+func (h *health) backlog(snap Snapshot) healthCheck {
+	c := healthCheck{Name: "backlog", OK: !snap.Lag.Alert, Detail: fmt.Sprintf("%d waiting", snap.Backlog)}
+	if snap.Lag.Alert {
+		c.Detail = fmt.Sprintf("grown from %d to %d over %v", snap.Lag.From, snap.Backlog, snap.Lag.Growing.Round(time.Second))
+	}
+	return c
+}
@@ -0,0 +1,41 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHealthWorkersStalled(t *testing.T) {
+	const stallAfter = 30 * time.Second
+	tests := []struct {
+		name    string
+		started time.Duration // how long ago the run started
+		beat    time.Duration // how long ago the generator beat; 0 for never
+		paused  bool
+		want    bool
+	}{
+		{"beating", time.Hour, time.Second, false, true},
+		{"hung after beating", time.Hour, time.Minute, false, false},
+		{"hung before its first beat", time.Minute, 0, false, false},
+		{"not beaten yet, just started", time.Second, 0, false, true},
+		{"paused", time.Hour, time.Minute, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newRedditMetrics(1, 0, 0, time.Second)
+			m.startTime = time.Now().Add(-tt.started)
+			if tt.beat > 0 {
+				m.generators[0].beat.at.Store(time.Now().Add(-tt.beat).UnixNano())
+			}
+			h := &health{ctl: &Controls{}, metrics: m, stallAfter: stallAfter}
+
+			checks := h.workers(Snapshot{TargetRate: 100, Paused: tt.paused})
+			if len(checks) != 1 || checks[0].Name != "generators" {
+				t.Fatalf("checks = %+v, want just the generators'", checks)
+			}
+			if checks[0].OK != tt.want {
+				t.Errorf("ok = %v (%s), want %v", checks[0].OK, checks[0].Detail, tt.want)
+			}
+		})
+	}
+}
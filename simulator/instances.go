@@ -0,0 +1,134 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// instanceStore is implemented by stores several simulator processes can
+// share.
+type instanceStore interface {
+	// Register adds self to the instances table. It fails if a live
+	// instance - one that heartbeated within stale - already has the name.
+	Register(ctx context.Context, self store.InstanceStatus, stale time.Duration) error
+	// Heartbeat updates self's row with its latest counters.
+	Heartbeat(ctx context.Context, self store.InstanceStatus) error
+	// Instances returns the instances that heartbeated within stale.
+	Instances(ctx context.Context, stale time.Duration) ([]store.InstanceStatus, error)
+	Deregister(ctx context.Context, name string) error
+}
+
+// instanceStale is how many missed heartbeats make an instance count as
+// gone.
+const instanceStale = 3
+
+// newInstance describes this process, named name or, if that is empty,
+// after the host and process ID.
+func newInstance(name string) store.InstanceStatus {
+	host, _ := os.Hostname()
+	self := store.InstanceStatus{Name: name, Host: host, PID: os.Getpid(), Started: time.Now()}
+	if self.Name == "" {
+		self.Name = fmt.Sprintf("%s-%d", host, self.PID)
+	}
+	return self
+}
+
+// clusterStats is what this instance knows about its peers, as of its last
+// heartbeat.
+type clusterStats struct {
+	self      string
+	peers     []store.InstanceStatus
+	instances *metrics.Gauge // len(peers), for the exporters
+}
+
+func (s *clusterStats) register(reg *metrics.Registry, self string) {
+	s.self = self
+	s.instances = reg.Gauge("redditsim_instances", "Simulators heartbeating into the shared database, this one included.")
+}
+
+type clusterSnapshot struct {
+	Self      string                 `json:"self"`
+	Instances []store.InstanceStatus `json:"instances"`
+	// The cluster's combined throughput and backlog; this instance's own
+	// backlog figure can't see the events its peers stored or processed
+	EventsPerSec    float64 `json:"events_per_sec"`
+	ProcessedPerSec float64 `json:"processed_per_sec"`
+	Backlog         int     `json:"backlog"`
+	// Leader is the instance running the leader's jobs, if any
+	Leader string `json:"leader,omitempty"`
+}
+
+func (s clusterStats) snapshot() clusterSnapshot {
+	snap := clusterSnapshot{Self: s.self, Instances: append([]store.InstanceStatus(nil), s.peers...)}
+	stored, processed := 0, 0
+	for _, p := range s.peers {
+		snap.EventsPerSec += p.EventsPerSec
+		snap.ProcessedPerSec += p.ProcessedPerSec
+		stored += p.Stored
+		processed += p.Processed
+		if p.Leader {
+			snap.Leader = p.Name
+		}
+	}
+	snap.Backlog = max(stored-processed, 0)
+	return snap
+}
+
+// Heartbeats this instance into the instances table and reads back its
+// live peers - runs in its own goroutine. The row is removed on the way
+// out so peers stop counting this instance straight away rather than once
+// its heartbeat goes stale.
+func heartbeat(ctx context.Context, store instanceStore, self store.InstanceStatus, interval time.Duration, metrics *RedditMetrics) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := store.Deregister(ctx, self.Name); err != nil {
+			slog.Error("deregister instance", "instance", self.Name, "err", err)
+		}
+	}()
+
+	prev, prevTime := self, time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			metrics.mutex.Lock()
+			self.Generated = metrics.eventsHandled.Value()
+			self.Stored = metrics.dbOperations.writes.Value()
+			self.Processed = metrics.processed.Value()
+			self.Leader = metrics.leader.leading
+			metrics.mutex.Unlock()
+			secs := now.Sub(prevTime).Seconds()
+			self.EventsPerSec = float64(self.Generated-prev.Generated) / secs
+			self.ProcessedPerSec = float64(self.Processed-prev.Processed) / secs
+			prev, prevTime = self, now
+
+			if err := store.Heartbeat(ctx, self); err != nil {
+				if ctx.Err() == nil {
+					slog.Error("heartbeat", "instance", self.Name, "err", err)
+				}
+				continue
+			}
+			peers, err := store.Instances(ctx, instanceStale*interval)
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("list instances", "err", err)
+				}
+				continue
+			}
+			metrics.mutex.Lock()
+			metrics.cluster.peers = peers
+			metrics.mutex.Unlock()
+			metrics.cluster.instances.Set(float64(len(peers)))
+		}
+	}
+}
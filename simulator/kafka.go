@@ -0,0 +1,104 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+)
+
+// kafkaStats tracks deliveries to the Kafka sink. A message only counts as
+// delivered once every in-sync replica has acknowledged it.
+type kafkaStats struct {
+	delivered *metrics.Counter
+	failed    *metrics.Counter
+	batches   *metrics.Counter
+	ackTime   *metrics.Counter
+}
+
+func (s *kafkaStats) register(reg *metrics.Registry) {
+	s.delivered = reg.Counter("redditsim_kafka_delivered_total", "Events acknowledged by the Kafka sink's brokers.")
+	s.failed = reg.Counter("redditsim_kafka_failed_total", "Events the Kafka sink failed to deliver.")
+	s.batches = reg.Counter("redditsim_kafka_batches_total", "Batches the Kafka sink published.")
+	s.ackTime = reg.SecondsCounter("redditsim_kafka_ack_seconds_total", "Time spent waiting for the brokers to acknowledge batches.")
+}
+
+// kafkaSink publishes events to a Kafka topic, as JSON keyed by post ID so
+// everything that happens to a post lands on one partition, in order.
+type kafkaSink struct {
+	w       *kafka.Writer
+	metrics *RedditMetrics
+	// When a publish last got all its events through, and when one last
+	// didn't, for /readyz
+	delivered, failed workerHeartbeat
+}
+
+func newKafkaSink(cfg config.Kafka, metrics *RedditMetrics) *kafkaSink {
+	metrics.kafka.register(metrics.registry)
+	return &kafkaSink{w: newKafkaWriter(cfg.Brokers, cfg.Topic), metrics: metrics}
+}
+
+// newKafkaWriter returns a producer for topic on the comma-separated
+// brokers that hashes message keys to partitions and waits for every
+// in-sync replica.
+func newKafkaWriter(brokers, topic string) *kafka.Writer {
+	return &kafka.Writer{
+		Addr:                   kafka.TCP(strings.Split(brokers, ",")...),
+		Topic:                  topic,
+		Balancer:               &kafka.Hash{},
+		RequiredAcks:           kafka.RequireAll,
+		AllowAutoTopicCreation: true,
+		// Callers already batch; hand each batch straight to the producer
+		// instead of waiting for it to fill its own
+		BatchTimeout: time.Millisecond,
+		ErrorLogger: kafka.LoggerFunc(func(msg string, args ...any) {
+			slog.Debug("kafka", "msg", msg, "args", args)
+		}),
+	}
+}
+
+// publish writes events and waits for the brokers to acknowledge them.
+func (s *kafkaSink) publish(ctx context.Context, events []event.Event) error {
+	msgs := make([]kafka.Message, 0, len(events))
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		msgs = append(msgs, kafka.Message{Key: []byte(e.PostID), Value: data, Time: e.Timestamp})
+	}
+
+	start := time.Now()
+	err := s.w.WriteMessages(ctx, msgs...)
+	elapsed := time.Since(start)
+
+	// A failed batch may still have been partly delivered
+	failed := 0
+	if err != nil {
+		failed = len(msgs)
+		if werr, ok := err.(kafka.WriteErrors); ok {
+			failed = werr.Count()
+		}
+		slog.Error("publish to kafka", "topic", s.w.Topic, "events", len(msgs), "failed", failed, "err", err)
+		s.failed.beat()
+	} else {
+		s.delivered.beat()
+	}
+
+	s.metrics.kafka.delivered.Add(len(msgs) - failed)
+	s.metrics.kafka.failed.Add(failed)
+	s.metrics.kafka.batches.Inc()
+	s.metrics.kafka.ackTime.AddDuration(elapsed)
+	return err
+}
+
+func (s *kafkaSink) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,55 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"web-traffic-sim/store"
+)
+
+// karmaStore is implemented by stores with a domain model to derive karma
+// from.
+type karmaStore interface {
+	// AggregateKarma recomputes every user's karma from the votes table.
+	AggregateKarma(ctx context.Context) error
+	// TopKarma returns the n users with the most total karma.
+	TopKarma(ctx context.Context, n int) ([]store.KarmaEntry, error)
+}
+
+// karmaStats tracks the karma aggregation job.
+type karmaStats struct {
+	runs     int
+	lastRun  time.Duration
+	topUsers []store.KarmaEntry
+}
+
+// Aggregates votes into per-user karma - the karma job, which the
+// scheduler runs every -karma-interval. It's a second, derived-data
+// pipeline fed by what the processors have materialized, running on its
+// own schedule. Of several instances sharing the database only the leader
+// aggregates; the rest just read the result.
+func aggregateKarma(ctx context.Context, store karmaStore, metrics *RedditMetrics) error {
+	lead := metrics.leading()
+	start := time.Now()
+	if lead {
+		if err := store.AggregateKarma(ctx); err != nil {
+			return fmt.Errorf("aggregate karma: %w", err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	top, err := store.TopKarma(ctx, 5)
+	if err != nil {
+		return fmt.Errorf("read top karma: %w", err)
+	}
+
+	metrics.mutex.Lock()
+	if lead {
+		metrics.karma.runs++
+		metrics.karma.lastRun = elapsed
+	}
+	metrics.karma.topUsers = top
+	metrics.mutex.Unlock()
+	return nil
+}
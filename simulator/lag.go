@@ -0,0 +1,87 @@
+package simulator
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"web-traffic-sim/metrics"
+)
+
+// lagSample is how often watchLag looks at the backlog.
+const lagSample = time.Second
+
+// lagStats tracks consumer lag: whether the backlog has been growing, and
+// since when.
+type lagStats struct {
+	since    time.Time // start of the current growth streak; zero if none
+	from     int       // backlog when the streak started
+	peak     int       // largest backlog seen
+	alerting bool
+	alerts   *metrics.Counter
+}
+
+func (s *lagStats) register(reg *metrics.Registry) {
+	s.alerts = reg.Counter("redditsim_lag_alerts_total", "Times the backlog grew for -lag-alert without shrinking.")
+}
+
+type lagSnapshot struct {
+	Peak int `json:"peak"`
+	// Growing is how long the backlog has grown without shrinking
+	Growing time.Duration `json:"growing_ns"`
+	From    int           `json:"from"`
+	Alert   bool          `json:"alert"`
+	Alerts  int           `json:"alerts"`
+}
+
+func (s lagStats) snapshot(now time.Time) lagSnapshot {
+	snap := lagSnapshot{Peak: s.peak, From: s.from, Alert: s.alerting, Alerts: s.alerts.Value()}
+	if !s.since.IsZero() {
+		snap.Growing = now.Sub(s.since)
+	}
+	return snap
+}
+
+// Watches the backlog for consumer lag - runs in its own goroutine. The
+// backlog comes from delta accounting (events stored minus processed), so
+// watching it costs nothing, not even a count(*). A backlog that goes up
+// and down is processors keeping up with bursts; one that only ever grows
+// means they have fallen behind for good, and once that has gone on for
+// window the dashboard raises an alert until it shrinks again. Zero window
+// tracks the streak without alerting.
+func watchLag(ctx context.Context, window time.Duration, metrics *RedditMetrics) {
+	ticker := time.NewTicker(lagSample)
+	defer ticker.Stop()
+
+	metrics.mutex.Lock()
+	last, lastTime := metrics.backlog(), time.Now()
+	metrics.mutex.Unlock()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			metrics.mutex.Lock()
+			backlog := metrics.backlog()
+			lag := &metrics.lag
+			lag.peak = max(lag.peak, backlog)
+			switch {
+			case backlog < last:
+				if lag.alerting {
+					slog.Info("backlog shrinking again", "backlog", backlog)
+				}
+				lag.since, lag.alerting = time.Time{}, false
+			case backlog > last && lag.since.IsZero():
+				lag.since, lag.from = lastTime, last
+			}
+			if window > 0 && !lag.alerting && !lag.since.IsZero() && now.Sub(lag.since) >= window {
+				lag.alerting = true
+				lag.alerts.Inc()
+				slog.Warn("consumer lag: backlog keeps growing", "backlog", backlog, "from", lag.from, "for", now.Sub(lag.since).Round(time.Second))
+			}
+			metrics.mutex.Unlock()
+			last, lastTime = backlog, now
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package simulator
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"web-traffic-sim/metrics"
+)
+
+// leaderStore is implemented by stores that can elect one of the
+// simulators sharing them to run the jobs only one of them should.
+type leaderStore interface {
+	// TryLead makes this instance the leader if no other instance is, and
+	// reports whether it leads. Once it leads it keeps leading until it
+	// resigns or loses its connection.
+	TryLead(ctx context.Context) (bool, error)
+	Resign(ctx context.Context) error
+}
+
+// leaderStats tracks this instance's part in the leader election.
+type leaderStats struct {
+	elected   bool // whether there is an election at all
+	leading   bool
+	since     time.Time      // when this instance last won or lost the lead
+	elections int            // times this instance took the lead
+	lead      *metrics.Gauge // leading, for the exporters
+}
+
+func (s *leaderStats) register(reg *metrics.Registry) {
+	s.elected = true
+	s.lead = reg.Gauge("redditsim_leader", "1 while this instance leads and runs the karma, ranking and leaderboard jobs.")
+}
+
+type leaderSnapshot struct {
+	Elected bool `json:"elected"`
+	Leading bool `json:"leading"`
+	// How long this instance has been leading or following
+	For       time.Duration `json:"for_ns"`
+	Elections int           `json:"elections"`
+}
+
+func (s leaderStats) snapshot(now time.Time) leaderSnapshot {
+	snap := leaderSnapshot{Elected: s.elected, Leading: s.leading, Elections: s.elections}
+	if !s.since.IsZero() {
+		snap.For = now.Sub(s.since)
+	}
+	return snap
+}
+
+// boolGauge is a gauge's value for b.
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// leading reports whether this instance should run the leader's jobs:
+// always, unless it is in an election and hasn't won it.
+func (m *RedditMetrics) leading() bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return !m.leader.elected || m.leader.leading
+}
+
+// Campaigns for the lead every interval - runs in its own goroutine. The
+// first instance to ask wins and keeps the lead as long as it runs; the
+// others take over within an interval of it stopping or losing its
+// connection.
+func elect(ctx context.Context, store leaderStore, interval time.Duration, metrics *RedditMetrics) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := store.Resign(ctx); err != nil {
+			slog.Error("resign lead", "err", err)
+		}
+	}()
+
+	for {
+		leading, err := store.TryLead(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.Error("leader election", "err", err)
+		}
+		metrics.mutex.Lock()
+		if l := &metrics.leader; leading != l.leading || l.since.IsZero() {
+			if leading {
+				l.elections++
+				slog.Info("took the lead")
+			} else if l.leading {
+				slog.Warn("lost the lead")
+			}
+			l.leading, l.since = leading, time.Now()
+			l.lead.Set(boolGauge(leading))
+		}
+		metrics.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"web-traffic-sim/store"
+)
+
+var errBoardNotFound = errors.New("no such leaderboard")
+
+// leaderboardStore is implemented by stores with a domain model to rank.
+type leaderboardStore interface {
+	// RefreshLeaderboards recomputes every board's top n entries in place
+	// of the last.
+	RefreshLeaderboards(ctx context.Context, n int) error
+	// Leaderboards returns the boards as last computed, in boardNames
+	// order; a board not computed yet has no entries.
+	Leaderboards(ctx context.Context) ([]store.Leaderboard, error)
+}
+
+// leaderboardStats tracks the leaderboard job.
+type leaderboardStats struct {
+	runs    int
+	lastRun time.Duration
+	boards  []store.Leaderboard
+}
+
+type leaderboardSnapshot struct {
+	Runs    int                 `json:"runs"`
+	LastRun time.Duration       `json:"last_run_ns"`
+	Boards  []store.Leaderboard `json:"boards"`
+}
+
+// Recomputes the leaderboards - the leaderboards job, which the scheduler
+// runs every -leaderboard-interval. Like the karma job it's a batch job
+// over what the processors have materialized, on its own, slower
+// schedule; only the leader recomputes, and every instance reads back
+// what's persisted for the dashboard.
+func refreshLeaderboards(ctx context.Context, store leaderboardStore, size int, metrics *RedditMetrics) error {
+	lead := metrics.leading()
+	start := time.Now()
+	if lead {
+		if err := store.RefreshLeaderboards(ctx, size); err != nil {
+			return fmt.Errorf("refresh leaderboards: %w", err)
+		}
+	}
+	elapsed := time.Since(start)
+
+	boards, err := store.Leaderboards(ctx)
+	if err != nil {
+		return fmt.Errorf("read leaderboards: %w", err)
+	}
+
+	metrics.mutex.Lock()
+	if lead {
+		metrics.leaderboards.runs++
+		metrics.leaderboards.lastRun = elapsed
+	}
+	metrics.leaderboards.boards = boards
+	metrics.mutex.Unlock()
+	return nil
+}
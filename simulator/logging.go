@@ -0,0 +1,41 @@
+package simulator
+
+import (
+	"io"
+	"log/slog"
+	"os"
+
+	"web-traffic-sim/config"
+)
+
+// setupLogging installs the default slog logger. Logs go to a file rather
+// than the terminal so they don't tear through the ANSI dashboard; use
+// -log-file - to send them to stderr instead. The returned closer flushes
+// and closes the log file.
+func setupLogging(cfg config.Log) (io.Closer, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, err
+	}
+
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if cfg.File != "-" {
+		f, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		out = f
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler = slog.NewTextHandler(out, opts)
+	if cfg.Format == config.LogJSON {
+		h = slog.NewJSONHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(h))
+	return out, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
@@ -0,0 +1,836 @@
+package simulator
+
+import (
+	"database/sql"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// RedditMetrics is what the simulation counts. What the pipeline counts
+// per event or batch - the counters, histograms and per-worker stats - is
+// atomic and needs no lock, so counting never waits on a dashboard taking
+// a snapshot. mutex guards the rest: lists, flags and the periodic jobs'
+// results, which change a few times a second at most.
+type RedditMetrics struct {
+	// The metrics registry the exporters read; the handles below, and the
+	// subsystems' stats, are metrics registered in it
+	registry *metrics.Registry
+	// Simulated users with -actors, and how many are logged on, overall
+	// and per persona
+	actors        int
+	activeUsers   *metrics.Gauge
+	personas      []personaStats
+	personaOf     map[string]int // each user's index in personas
+	eventsHandled *metrics.Counter
+	// Events by type through the pipeline, and generated by subreddit with
+	// trending's windows; byType has every type in event.Types and isn't
+	// added to after
+	byType     map[event.Type]*typeStats
+	subreddits *generator.Catalog
+	trending   *trending
+	// Bytes of payload across all generated events
+	payloadBytes *metrics.Counter
+	// Events shed by the channel overflow policy
+	dropped      *metrics.Counter
+	dbOperations struct {
+		writes  *metrics.Counter
+		reads   *metrics.Counter
+		updates *metrics.Counter
+	}
+	startTime time.Time
+	// Rates over the last -rate-window, from the counters above, and the
+	// last minute of them for the sparklines
+	rates   *rateWindow
+	history *history
+	// Writer batch flushes
+	flushes   *metrics.Counter
+	flushTime *metrics.Counter
+	// Events marked processed (dbOperations.updates counts batches)
+	processed *metrics.Counter
+	// Events stored and processed per priority, and how long the processed
+	// ones took from being generated
+	byPriority [event.PriorityLevels]priorityStats
+	// Rows materialized into the Reddit domain tables
+	domain domainStats
+	karma  karmaStats
+	// The leaderboards as last read back from the store
+	leaderboards leaderboardStats
+	// The analytics views' refreshes, and their rows as last read back
+	views viewStats
+	// The scheduler's jobs, in the order they were added
+	jobs []*jobStats
+	// The events table's time partitions, if it has them
+	partitions partitionStats
+	retention  retentionStats
+	export     exportStats
+	parquet    parquetStats
+	// The modqueue and moderator
+	moderation moderationStats
+	scores     scoreStats
+	ranking    rankingStats
+	viral      viralStats
+	reddit     redditStats
+	dump       dumpStats
+	kafka      kafkaStats
+	outbox     outboxStats
+	webhook    webhookStats
+	rateLimit  rateLimitStats
+	filter     filterStats
+	enrich     enrichStats
+	clickhouse clickhouseStats
+	detect     detectStats
+	// Page loads by the readers, keyed by readFrontPage/readCommentPage/readProfile
+	reads map[string]readStats
+	cache cacheStats
+	// Consumer lag: how the backlog has been moving
+	lag lagStats
+	// The simulators sharing the database, as of the last heartbeat
+	cluster clusterStats
+	leader  leaderStats
+	dlq     dlqStats
+	breaker breakerStats
+	// The -scenario timeline, if any
+	scenario scenarioStats
+	// Current setting of the run controls
+	control struct {
+		target       float64
+		paused       bool
+		writeBatch   int
+		processBatch int
+	}
+	// Failures injected by -chaos, by kind
+	chaos        map[string]*metrics.Counter
+	stalledUntil time.Time
+	retries      retryStats
+	// Live firehose consumers and how many were cut off for being slow
+	firehose struct {
+		subscribers int
+		disconnects int
+	}
+	// Messages waiting on the broker, for broker-backed stores
+	queueDepth *metrics.Gauge
+	// Processor wake-ups triggered by store notifications
+	wakeups    *metrics.Counter
+	writers    workerList[writerStats]
+	generators []generatorStats
+	processors workerList[processorStats]
+	// How many writers and processors are currently running; the stats of
+	// workers retired by a pool shrink stay behind in the lists.
+	activeWriters    int
+	activeProcessors int
+	// Per-operation latency, keyed by opWrite/opRead/opUpdate
+	latency map[string]*metrics.Histogram
+	// channelDepth reports the event channel occupancy; set once by Run
+	// before any goroutine starts.
+	channelDepth func() int
+	// duplicates reports how many events the store turned away as already
+	// written; set once by Run for stores that deduplicate.
+	duplicates func() int64
+	// poolStats reports the database/sql connection pool; set once by Run
+	// for stores that have one.
+	poolStats func() sql.DBStats
+	mutex     sync.Mutex
+}
+
+// Store operation kinds, used as latency histogram keys and metric labels.
+const (
+	OpWrite  = "write"
+	OpRead   = "read"
+	OpUpdate = "update"
+)
+
+func newRedditMetrics(generators, writers, processors int, rateWindow time.Duration) *RedditMetrics {
+	start := time.Now()
+	m := &RedditMetrics{
+		registry:         metrics.NewRegistry(),
+		startTime:        start,
+		rates:            newRateWindow(rateWindow, start),
+		history:          newHistory(start),
+		byType:           make(map[event.Type]*typeStats, len(event.Types)),
+		trending:         newTrending(time.Now()),
+		payloadBytes:     new(metrics.Counter),
+		flushes:          new(metrics.Counter),
+		flushTime:        new(metrics.Counter),
+		processed:        new(metrics.Counter),
+		wakeups:          new(metrics.Counter),
+		generators:       make([]generatorStats, generators),
+		activeWriters:    writers,
+		activeProcessors: processors,
+	}
+	m.writers.grow(writers)
+	m.processors.grow(processors)
+	for i := range m.byPriority {
+		m.byPriority[i].wait = metrics.NewHistogram()
+	}
+
+	reg := m.registry
+	generated := reg.CounterVec("redditsim_events_generated_by_type_total", "Events produced by the generators, by type.", "type")
+	stored := reg.CounterVec("redditsim_events_stored_by_type_total", "Events written to the store, by type.", "type")
+	processed := reg.CounterVec("redditsim_events_processed_by_type_total", "Events processed, by type.", "type")
+	wait := reg.HistogramVec("redditsim_event_wait_seconds", "Time from an event's generation to its processing, by type.", "type")
+	for _, t := range event.Types {
+		name := t.String()
+		m.byType[t] = &typeStats{events: generated.With(name), stored: stored.With(name), processed: processed.With(name), wait: wait.With(name)}
+	}
+	m.eventsHandled = reg.Counter("redditsim_events_generated_total", "Events produced by the generators.")
+	m.dropped = reg.Counter("redditsim_events_dropped_total", "Events shed because the event channel was full.")
+	m.activeUsers = reg.Gauge("redditsim_active_users", "Simulated users logged on (-actors).")
+	ops := reg.CounterVec("redditsim_db_operations_total", "Database operations by kind.", "op")
+	m.dbOperations.writes, m.dbOperations.reads, m.dbOperations.updates = ops.With(OpWrite), ops.With(OpRead), ops.With(OpUpdate)
+	latency := reg.HistogramVec("redditsim_operation_duration_seconds", "Latency of store operations.", "op")
+	m.latency = map[string]*metrics.Histogram{OpWrite: latency.With(OpWrite), OpRead: latency.With(OpRead), OpUpdate: latency.With(OpUpdate)}
+	reg.GaugeFunc("redditsim_channel_depth", "Events waiting in the generator->writer channel.", func() float64 {
+		if m.channelDepth == nil {
+			return 0
+		}
+		return float64(m.channelDepth())
+	})
+	reg.GaugeFunc("redditsim_backlog", "Events stored but not processed yet.", func() float64 {
+		return float64(m.backlog())
+	})
+	m.queueDepth = reg.Gauge("redditsim_broker_queue_depth", "Messages waiting on the broker (nats and rabbitmq backends).")
+	registerRuntime(reg)
+	return m
+}
+
+// setWriters and setProcessors record a pool resize, making room for the
+// stats of new workers.
+func (m *RedditMetrics) setWriters(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.writers.grow(n)
+	m.activeWriters = n
+}
+
+func (m *RedditMetrics) setProcessors(n int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.processors.grow(n)
+	m.activeProcessors = n
+}
+
+// workerList holds the stats of a pool's workers by id. A worker finds
+// its own without the mutex: growing the list replaces it with a longer
+// copy, under the mutex, and stats once added stay where they are.
+type workerList[T any] struct {
+	list atomic.Pointer[[]*T]
+}
+
+func (l *workerList[T]) grow(n int) {
+	old := l.all()
+	if len(old) >= n {
+		return
+	}
+	list := slices.Grow(slices.Clone(old), n-len(old))
+	for len(list) < n {
+		list = append(list, new(T))
+	}
+	l.list.Store(&list)
+}
+
+func (l *workerList[T]) get(id int) *T { return l.all()[id] }
+
+func (l *workerList[T]) all() []*T {
+	if p := l.list.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+// writerStats tracks a single writer goroutine of the pool.
+type writerStats struct {
+	writes metrics.Counter
+	// busy is the time spent inside the store, as opposed to waiting on
+	// the channel. A writer that is busy ~100% of the time is saturated.
+	busy metrics.Counter
+	beat workerHeartbeat
+}
+
+// Snapshot is a consistent, point-in-time copy of RedditMetrics with
+// rates already derived, so views never have to hold the mutex while
+// rendering.
+type Snapshot struct {
+	Uptime          float64 `json:"uptime_seconds"`
+	EventsGenerated int     `json:"events_generated"`
+	PayloadBytes    int     `json:"payload_bytes"`
+	Actors          int     `json:"actors,omitempty"`
+	ActiveUsers     int     `json:"active_users"`
+	Dropped         int     `json:"dropped"`
+	// ByType counts generated events per type
+	ByType          map[event.Type]int `json:"by_type"`
+	Writes          int                `json:"writes"`
+	Reads           int                `json:"reads"`
+	Updates         int                `json:"updates"`
+	Processed       int                `json:"processed"`
+	EventsPerSec    float64            `json:"events_per_sec"`
+	WritesPerSec    float64            `json:"writes_per_sec"`
+	ReadsPerSec     float64            `json:"reads_per_sec"`
+	UpdatesPerSec   float64            `json:"updates_per_sec"`
+	ProcessedPerSec float64            `json:"processed_per_sec"`
+	PageLoadsPerSec float64            `json:"page_loads_per_sec"`
+	// Rates are over the last -rate-window, where the figures above are
+	// over the whole run
+	Rates rateSnapshot `json:"rates"`
+	// History is the last minute of the dashboard's bars, a value a second
+	History historySnapshot `json:"history"`
+	// Latency summarizes store operation times, keyed by opWrite, opRead
+	// and opUpdate.
+	Latency      map[string]metrics.LatencySnapshot `json:"latency"`
+	Flushes      int                                `json:"flushes"`
+	AvgFlush     time.Duration                      `json:"avg_flush_ns"`
+	ChannelDepth int                                `json:"channel_depth"`
+	// Backlog is how many stored events are waiting to be processed
+	Backlog    int `json:"backlog"`
+	QueueDepth int `json:"queue_depth"`
+	// DuplicatesRejected counts redelivered events the store recognised by
+	// their idempotency key and did not write again.
+	DuplicatesRejected int64 `json:"duplicates_rejected"`
+	Wakeups            int   `json:"wakeups"`
+	// Pool is the store's connection pool, if it has one
+	Pool *poolSnapshot `json:"pool,omitempty"`
+	// TargetRate, Paused and the batch sizes are the current controls,
+	// which may have been changed since the run started.
+	TargetRate   float64 `json:"target_rate"`
+	Paused       bool    `json:"paused"`
+	WriteBatch   int     `json:"write_batch"`
+	ProcessBatch int     `json:"process_batch"`
+
+	Runtime    runtimeSnapshot     `json:"runtime"`
+	Domain     domainSnapshot      `json:"domain"`
+	Karma      karmaSnapshot       `json:"karma"`
+	Partitions partitionSnapshot   `json:"partitions"`
+	Retention  retentionSnapshot   `json:"retention"`
+	Export     exportSnapshot      `json:"export"`
+	Parquet    parquetSnapshot     `json:"parquet"`
+	Moderation moderationSnapshot  `json:"moderation"`
+	Scores     scoresSnapshot      `json:"scores"`
+	Ranking    rankingSnapshot     `json:"ranking"`
+	Viral      viralSnapshot       `json:"viral"`
+	Reddit     redditSnapshot      `json:"reddit"`
+	Dump       dumpSnapshot        `json:"dump"`
+	Firehose   firehoseSnapshot    `json:"firehose"`
+	Kafka      kafkaSnapshot       `json:"kafka"`
+	Outbox     outboxSnapshot      `json:"outbox"`
+	Webhook    webhookSnapshot     `json:"webhook"`
+	PageLoads  []readSnapshot      `json:"page_loads"`
+	Cache      cacheSnapshot       `json:"cache"`
+	RateLimit  rateLimitSnapshot   `json:"rate_limit"`
+	Filter     filterSnapshot      `json:"filter"`
+	Enrich     enrichSnapshot      `json:"enrich"`
+	ClickHouse clickhouseSnapshot  `json:"clickhouse"`
+	Detect     detectSnapshot      `json:"detect"`
+	Lag        lagSnapshot         `json:"lag"`
+	Cluster    clusterSnapshot     `json:"cluster"`
+	Leader     leaderSnapshot      `json:"leader"`
+	DLQ        dlqSnapshot         `json:"dlq"`
+	Retries    retrySnapshot       `json:"retries"`
+	Breaker    breakerSnapshot     `json:"breaker"`
+	Generators []generatorSnapshot `json:"generators"`
+	// Subreddits are the busiest subreddits, by events generated
+	Subreddits []subredditSnapshot `json:"subreddits"`
+	Trending   []trendingSnapshot  `json:"trending"`
+	Personas   []personaSnapshot   `json:"personas,omitempty"`
+	Writers    []writerSnapshot    `json:"writers"`
+	// Priorities are highest first
+	Priorities []prioritySnapshot `json:"priorities"`
+	// Types break the pipeline down by event type: the user actions
+	// always, the moderation events once there are any
+	Types      []typeSnapshot      `json:"types"`
+	Processors []processorSnapshot `json:"processors"`
+
+	// Chaos counts injected failures by kind; Stalled is set while chaos
+	// has the generators frozen.
+	Chaos   map[string]int `json:"chaos"`
+	Stalled bool           `json:"generators_stalled"`
+
+	// Scenario is the -scenario timeline so far, with the phase boundaries.
+	Scenario scenarioSnapshot `json:"scenario"`
+
+	// Leaderboards are the leaderboard job's runs and the boards as last
+	// read back from the store.
+	Leaderboards leaderboardSnapshot `json:"leaderboards"`
+	// Views are the views job's refreshes and the analytics views' top
+	// rows as last read back from the store.
+	Views viewSnapshot `json:"views"`
+	// Jobs are the scheduler's periodic jobs, in the order they were added.
+	Jobs []jobSnapshot `json:"jobs"`
+}
+
+type rateSnapshot struct {
+	Window          time.Duration `json:"window_ns"`
+	EventsPerSec    float64       `json:"events_per_sec"`
+	WritesPerSec    float64       `json:"writes_per_sec"`
+	ReadsPerSec     float64       `json:"reads_per_sec"`
+	UpdatesPerSec   float64       `json:"updates_per_sec"`
+	ProcessedPerSec float64       `json:"processed_per_sec"`
+	PageLoadsPerSec float64       `json:"page_loads_per_sec"`
+}
+
+type domainSnapshot struct {
+	Users      int `json:"users"`
+	Subreddits int `json:"subreddits"`
+	Posts      int `json:"posts"`
+	Comments   int `json:"comments"`
+	Votes      int `json:"votes"`
+	Reports    int `json:"reports"`
+	Removed    int `json:"removed"`
+	Bans       int `json:"bans"`
+	// Deepest reply chain and most commented post seen so far
+	DeepestThread   int    `json:"deepest_thread"`
+	DeepestPost     string `json:"deepest_post,omitempty"`
+	BusiestPost     string `json:"busiest_post,omitempty"`
+	BusiestComments int    `json:"busiest_comments"`
+}
+
+type karmaSnapshot struct {
+	Runs     int                `json:"runs"`
+	LastRun  time.Duration      `json:"last_run_ns"`
+	TopUsers []store.KarmaEntry `json:"top_users"`
+}
+
+type scoresSnapshot struct {
+	Runs    int           `json:"runs"`
+	Folded  int           `json:"votes_folded"`
+	Upserts int           `json:"upserts"`
+	LastRun time.Duration `json:"last_run_ns"`
+	// Top posts by score, with fuzzed ups and downs
+	Top []store.ScoredPost `json:"top"`
+}
+
+type rankingSnapshot struct {
+	Runs      int                `json:"runs"`
+	Rescored  int                `json:"rescored"`
+	LastRun   time.Duration      `json:"last_run_ns"`
+	FrontPage []store.RankedPost `json:"front_page"`
+}
+
+type firehoseSnapshot struct {
+	Subscribers int `json:"subscribers"`
+	Disconnects int `json:"disconnects"`
+}
+
+type kafkaSnapshot struct {
+	Delivered int           `json:"delivered"`
+	Failed    int           `json:"failed"`
+	AvgAck    time.Duration `json:"avg_ack_ns"`
+}
+
+type dlqSnapshot struct {
+	Size      int `json:"size"`
+	Parked    int `json:"parked"`
+	Recovered int `json:"recovered"`
+}
+
+type retrySnapshot struct {
+	ByOp      map[string]int `json:"by_op"`
+	Exhausted int            `json:"exhausted"`
+}
+
+type breakerSnapshot struct {
+	State string `json:"state"`
+	Trips int    `json:"trips"`
+}
+
+type viralSnapshot struct {
+	Spikes int    `json:"spikes"`
+	Total  int    `json:"total_events"`
+	Post   string `json:"post,omitempty"`
+	Events int    `json:"events"`
+}
+
+type generatorSnapshot struct {
+	Events       int     `json:"events"`
+	EventsPerSec float64 `json:"events_per_sec"`
+}
+
+type processorSnapshot struct {
+	Batches         int     `json:"batches"`
+	Events          int     `json:"events"`
+	ProcessedPerSec float64 `json:"processed_per_sec"`
+}
+
+type writerSnapshot struct {
+	Writes       int     `json:"writes"`
+	WritesPerSec float64 `json:"writes_per_sec"`
+	BusyPct      float64 `json:"busy_pct"`
+}
+
+// typeStats tracks the events of one type through the pipeline.
+type typeStats struct {
+	events, stored, processed *metrics.Counter
+	// wait is the time from generation to processing
+	wait *metrics.Histogram
+}
+
+type typeSnapshot struct {
+	Type            string                  `json:"type"`
+	Events          int                     `json:"events"`
+	EventsPerSec    float64                 `json:"events_per_sec"`
+	Stored          int                     `json:"stored"`
+	Processed       int                     `json:"processed"`
+	ProcessedPerSec float64                 `json:"processed_per_sec"`
+	Wait            metrics.LatencySnapshot `json:"wait"`
+}
+
+// priorityStats tracks the events of one priority through the store.
+type priorityStats struct {
+	stored, processed metrics.Counter
+	wait              *metrics.Histogram
+}
+
+type prioritySnapshot struct {
+	Priority  string `json:"priority"`
+	Stored    int    `json:"stored"`
+	Processed int    `json:"processed"`
+	// Depth is how many are stored but not yet processed
+	Depth int                     `json:"depth"`
+	Wait  metrics.LatencySnapshot `json:"wait"`
+}
+
+// backlog is how many stored events haven't been processed yet.
+func (m *RedditMetrics) backlog() int {
+	n := 0
+	for i := range m.byPriority {
+		n += m.byPriority[i].depth()
+	}
+	return n
+}
+
+// depth is how many of the priority's events are stored but not processed.
+// Processed is read first: read the other way round, an event stored and
+// processed in between would count as processed but not stored.
+func (ps *priorityStats) depth() int {
+	processed := ps.processed.Value()
+	return max(ps.stored.Value()-processed, 0)
+}
+
+// counterValues reads counters keyed by label.
+func counterValues(counters map[string]*metrics.Counter) map[string]int {
+	values := make(map[string]int, len(counters))
+	for k, c := range counters {
+		values[k] = c.Value()
+	}
+	return values
+}
+
+// countStored records events written to the store.
+func (m *RedditMetrics) countStored(events []event.Event) {
+	m.dbOperations.writes.Add(len(events))
+	for _, e := range events {
+		m.byPriority[e.Type.Priority()].stored.Inc()
+		m.byType[e.Type].stored.Inc()
+	}
+}
+
+// countProcessed records events processed at now, and how long each spent
+// between being generated and processed.
+func (m *RedditMetrics) countProcessed(events []event.Event, now time.Time) {
+	m.processed.Add(len(events))
+	for _, e := range events {
+		wait := now.Sub(e.Timestamp)
+		p := &m.byPriority[e.Type.Priority()]
+		p.processed.Inc()
+		p.wait.Observe(wait)
+		t := m.byType[e.Type]
+		t.processed.Inc()
+		t.wait.Observe(wait)
+	}
+}
+
+// countEvent records a generated event.
+func (m *RedditMetrics) countEvent(e event.Event) {
+	m.eventsHandled.Inc()
+	m.byType[e.Type].events.Inc()
+	m.trending.add(e.Subreddit, time.Now())
+	m.payloadBytes.Add(len(e.Payload))
+}
+
+// byTypeValues reads the per-type counts, leaving out types not seen.
+func (m *RedditMetrics) byTypeValues() map[event.Type]int {
+	values := make(map[event.Type]int, len(m.byType))
+	for t, ts := range m.byType {
+		if n := ts.events.Value(); n > 0 {
+			values[t] = n
+		}
+	}
+	return values
+}
+
+// Snapshot reads the counters and copies the rest under the lock, and
+// derives rates from them. The counters are read as they go, without
+// stopping the pipeline, so two of them can be an event or batch apart.
+func (m *RedditMetrics) Snapshot() Snapshot {
+	rt := readRuntime()
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	s := Snapshot{
+		Uptime:          time.Since(m.startTime).Seconds(),
+		EventsGenerated: m.eventsHandled.Value(),
+		PayloadBytes:    m.payloadBytes.Value(),
+		Actors:          m.actors,
+		ActiveUsers:     int(m.activeUsers.Value()),
+		Dropped:         m.dropped.Value(),
+		Runtime:         rt,
+		ByType:          m.byTypeValues(),
+		Subreddits:      m.topSubredditsSnapshot(topSubreddits),
+		Trending:        m.trending.top(trendingTop, time.Now()),
+		Chaos:           counterValues(m.chaos),
+		Stalled:         time.Now().Before(m.stalledUntil),
+		Writes:          m.dbOperations.writes.Value(),
+		Reads:           m.dbOperations.reads.Value(),
+		Updates:         m.dbOperations.updates.Value(),
+		Processed:       m.processed.Value(),
+		Flushes:         m.flushes.Value(),
+		Wakeups:         m.wakeups.Value(),
+		QueueDepth:      int(m.queueDepth.Value()),
+		TargetRate:      m.control.target,
+		Paused:          m.control.paused,
+		WriteBatch:      m.control.writeBatch,
+		ProcessBatch:    m.control.processBatch,
+		Domain:          m.domain.snapshot(),
+		Karma: karmaSnapshot{
+			Runs:     m.karma.runs,
+			LastRun:  m.karma.lastRun,
+			TopUsers: append([]store.KarmaEntry(nil), m.karma.topUsers...),
+		},
+		Leaderboards: leaderboardSnapshot{
+			Runs:    m.leaderboards.runs,
+			LastRun: m.leaderboards.lastRun,
+			Boards:  append([]store.Leaderboard(nil), m.leaderboards.boards...),
+		},
+		Views: m.views.snapshot(),
+		Partitions: partitionSnapshot{
+			Runs:       m.partitions.runs,
+			Created:    m.partitions.created.Value(),
+			Dropped:    m.partitions.dropped.Value(),
+			LastRun:    m.partitions.lastRun,
+			Partitions: append([]store.PartitionInfo(nil), m.partitions.partitions...),
+		},
+		Retention: retentionSnapshot{
+			Runs:          m.retention.runs,
+			LastRun:       m.retention.lastRun,
+			Deleted:       m.retention.deleted.Value(),
+			Partitions:    m.retention.partitions.Value(),
+			Archives:      m.retention.archives.Value(),
+			Archived:      m.retention.archived.Value(),
+			ArchiveBytes:  int64(m.retention.archiveBytes.Value()),
+			ArchiveFailed: m.retention.archiveFailed.Value(),
+		},
+		Export: exportSnapshot{
+			Files:     m.export.files.Value(),
+			Events:    m.export.events.Value(),
+			Bytes:     int64(m.export.bytes.Value()),
+			Failed:    m.export.failed.Value(),
+			Uploading: m.export.uploading.Duration(),
+		},
+		Parquet: parquetSnapshot{
+			Files:  m.parquet.files.Value(),
+			Rows:   m.parquet.rows.Value(),
+			Bytes:  int64(m.parquet.bytes.Value()),
+			Failed: m.parquet.failed.Value(),
+		},
+		Moderation: m.moderationSnapshot(),
+		Scores: scoresSnapshot{
+			Runs:    m.scores.runs,
+			Folded:  m.scores.folded,
+			Upserts: m.scores.upserts,
+			LastRun: m.scores.lastRun,
+			Top:     append([]store.ScoredPost(nil), m.scores.top...),
+		},
+		Firehose: firehoseSnapshot{
+			Subscribers: m.firehose.subscribers,
+			Disconnects: m.firehose.disconnects,
+		},
+		Outbox:     m.outbox.snapshot(),
+		Cache:      m.cache.snapshot(),
+		RateLimit:  m.rateLimit.snapshot(),
+		Filter:     m.filter.snapshot(),
+		Enrich:     m.enrich.snapshot(),
+		ClickHouse: m.clickhouse.snapshot(),
+		Detect: detectSnapshot{
+			Observed: m.detect.observed.Value(),
+			Dropped:  m.detect.dropped.Value(),
+			Rate:     m.detect.rate.Value(),
+			Repeat:   m.detect.repeat.Value(),
+			Recent:   append([]store.UserFlag(nil), m.detect.recent...),
+		},
+		Webhook: webhookSnapshot{
+			Sent:    m.webhook.sent.Value(),
+			Retries: m.webhook.retries.Value(),
+			Failed:  m.webhook.failed.Value(),
+			Dropped: m.webhook.dropped.Value(),
+		},
+		Lag:     m.lag.snapshot(time.Now()),
+		Cluster: m.cluster.snapshot(),
+		Leader:  m.leader.snapshot(time.Now()),
+		Kafka: kafkaSnapshot{
+			Delivered: m.kafka.delivered.Value(),
+			Failed:    m.kafka.failed.Value(),
+		},
+		DLQ: dlqSnapshot{
+			Size:      int(m.dlq.size.Value()),
+			Parked:    int(m.dlq.parked.Value()),
+			Recovered: m.dlq.recovered.Value(),
+		},
+		Retries: retrySnapshot{
+			ByOp:      counterValues(m.retries.byOp),
+			Exhausted: m.retries.exhausted.Value(),
+		},
+		Breaker: breakerSnapshot{
+			State: breakerState(m.breaker.state.Value()).String(),
+			Trips: m.breaker.trips.Value(),
+		},
+		Viral: viralSnapshot{
+			Spikes: m.viral.spikes,
+			Total:  m.viral.total.Value(),
+			Post:   m.viral.post,
+			Events: m.viral.total.Value() - m.viral.spikeStart,
+		},
+		Reddit: redditSnapshot{
+			Requests: m.reddit.requests.Value(),
+			Failed:   m.reddit.failed.Value(),
+			Limited:  m.reddit.limited.Value(),
+			Posts:    m.reddit.posts.Value(),
+			Comments: m.reddit.comments.Value(),
+		},
+		Dump: dumpSnapshot{
+			Lines:    m.dump.lines.Value(),
+			Skipped:  m.dump.skipped.Value(),
+			Posts:    m.dump.posts.Value(),
+			Comments: m.dump.comments.Value(),
+			Votes:    m.dump.votes.Value(),
+			Done:     m.dump.done,
+		},
+		Ranking: rankingSnapshot{
+			Runs:      m.ranking.runs,
+			Rescored:  m.ranking.rescored,
+			LastRun:   m.ranking.lastRun,
+			FrontPage: append([]store.RankedPost(nil), m.ranking.frontPage...),
+		},
+	}
+	if m.channelDepth != nil {
+		s.ChannelDepth = m.channelDepth()
+	}
+	if m.duplicates != nil {
+		s.DuplicatesRejected = m.duplicates()
+	}
+	if m.poolStats != nil {
+		s.Pool = newPoolSnapshot(m.poolStats())
+	}
+	s.Scenario = m.scenario.snapshot(m, time.Now())
+	for _, js := range m.jobs {
+		s.Jobs = append(s.Jobs, js.snapshot())
+	}
+
+	perSec := func(n int) float64 {
+		if s.Uptime <= 0 {
+			return 0
+		}
+		return float64(n) / s.Uptime
+	}
+	s.EventsPerSec = perSec(s.EventsGenerated)
+	s.WritesPerSec = perSec(s.Writes)
+	s.ReadsPerSec = perSec(s.Reads)
+	s.UpdatesPerSec = perSec(s.Updates)
+	s.ProcessedPerSec = perSec(s.Processed)
+
+	s.Latency = make(map[string]metrics.LatencySnapshot, len(m.latency))
+	for op, h := range m.latency {
+		s.Latency[op] = h.Snapshot()
+	}
+	var loads int
+	for _, kind := range readKinds {
+		r := m.reads[kind]
+		s.PageLoads = append(s.PageLoads, readSnapshot{Kind: kind, Count: r.count.Value(), Errors: r.errors.Value(), Latency: r.latency.Snapshot()})
+		loads += r.count.Value()
+	}
+	s.PageLoadsPerSec = perSec(loads)
+	var counts [numRates]int
+	counts[rateEvents], counts[rateWrites], counts[rateReads] = s.EventsGenerated, s.Writes, s.Reads
+	counts[rateUpdates], counts[rateProcessed], counts[ratePageLoads] = s.Updates, s.Processed, loads
+	now := time.Now()
+	r := m.rates.rates(now, counts)
+	s.Rates = rateSnapshot{
+		Window:          m.rates.span,
+		EventsPerSec:    r[rateEvents],
+		WritesPerSec:    r[rateWrites],
+		ReadsPerSec:     r[rateReads],
+		UpdatesPerSec:   r[rateUpdates],
+		ProcessedPerSec: r[rateProcessed],
+		PageLoadsPerSec: r[ratePageLoads],
+	}
+	m.history.record(now, counts, s.ChannelDepth, m.backlog())
+	s.History = m.history.snapshot()
+	s.Backlog = m.backlog()
+	for _, p := range event.Priorities {
+		ps := &m.byPriority[p]
+		depth := ps.depth()
+		s.Priorities = append(s.Priorities, prioritySnapshot{
+			Priority:  p.String(),
+			Stored:    ps.stored.Value(),
+			Processed: ps.processed.Value(),
+			Depth:     depth,
+			Wait:      ps.wait.Snapshot(),
+		})
+	}
+	for _, t := range event.Types {
+		ts := m.byType[t]
+		events, processed := ts.events.Value(), ts.processed.Value()
+		if events == 0 && processed == 0 && !slices.Contains(event.UserActions, t) {
+			continue
+		}
+		s.Types = append(s.Types, typeSnapshot{
+			Type:            t.String(),
+			Events:          events,
+			EventsPerSec:    perSec(events),
+			Stored:          ts.stored.Value(),
+			Processed:       processed,
+			ProcessedPerSec: perSec(processed),
+			Wait:            ts.wait.Snapshot(),
+		})
+	}
+	if batches := m.kafka.batches.Value(); batches > 0 {
+		s.Kafka.AvgAck = m.kafka.ackTime.Duration() / time.Duration(batches)
+	}
+	if s.Flushes > 0 {
+		s.AvgFlush = m.flushTime.Duration() / time.Duration(s.Flushes)
+	}
+
+	for i := range m.generators {
+		events := m.generators[i].events.Value()
+		s.Generators = append(s.Generators, generatorSnapshot{Events: events, EventsPerSec: perSec(events)})
+	}
+	for i := range m.personas {
+		p := &m.personas[i]
+		s.Personas = append(s.Personas, personaSnapshot{
+			Name:         p.name,
+			Users:        p.users,
+			Online:       int(p.online.Value()),
+			Events:       p.events.Value(),
+			EventsPerSec: perSec(p.events.Value()),
+			Flagged:      p.flagged.Value(),
+		})
+	}
+	for _, w := range m.writers.all()[:m.activeWriters] {
+		busyPct := 0.0
+		if s.Uptime > 0 {
+			busyPct = w.busy.Duration().Seconds() / s.Uptime * 100
+		}
+		writes := w.writes.Value()
+		s.Writers = append(s.Writers, writerSnapshot{Writes: writes, WritesPerSec: perSec(writes), BusyPct: busyPct})
+	}
+	for _, p := range m.processors.all()[:m.activeProcessors] {
+		events := p.events.Value()
+		s.Processors = append(s.Processors, processorSnapshot{Batches: p.batches.Value(), Events: events, ProcessedPerSec: perSec(events)})
+	}
+	return s
+}
@@ -0,0 +1,113 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/processor"
+)
+
+// Handler takes a batch of events on its way to the store, or a batch a
+// processor claimed on its way to being processed.
+type Handler func(ctx context.Context, batch []event.Event) error
+
+// Middleware is a stage of the write path: it wraps next, doing what it
+// likes with each batch before, after or instead of passing it on - adding
+// to the events, leaving some out, or dropping the batch by not calling
+// next at all. The handler it returns is called from every writer at once,
+// and must not keep the batch once it has returned. An error it returns
+// without next having been called is logged, and the batch is lost.
+//
+// On the processing side a stage wraps the processing of a claimed batch
+// instead, from every processor at once. Not calling next marks the batch
+// processed without materializing it; an error rolls the claim back, to
+// be claimed again. The batch is processed as claimed: a stage can look at
+// the events, but changing them or leaving some out changes nothing.
+type Middleware func(next Handler) Handler
+
+// Chain returns h behind mws, the first of them outermost.
+func Chain(h Handler, mws ...Middleware) Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+// processChain returns the wrapper processor.ProcessBatch puts mws around
+// its processing with, or nil without any.
+func processChain(mws []Middleware) func(processor.Handler) processor.Handler {
+	if len(mws) == 0 {
+		return nil
+	}
+	return func(next processor.Handler) processor.Handler {
+		return processor.Handler(Chain(Handler(next), mws...))
+	}
+}
+
+// Stage makes a named middleware for a run, given its config, for
+// writer.stages or processor.stages to name.
+type Stage func(cfg *config.Config) (Middleware, error)
+
+var (
+	stagesMu sync.Mutex
+	stages   = map[string]Stage{
+		"audit": auditStage,
+	}
+)
+
+// RegisterStage makes stage available to writer.stages and
+// processor.stages as name, beside the simulator's own; registering a name
+// again replaces it.
+func RegisterStage(name string, stage Stage) {
+	stagesMu.Lock()
+	defer stagesMu.Unlock()
+	stages[name] = stage
+}
+
+// configStages returns the middleware names, cfg's key, names in order.
+func configStages(cfg *config.Config, key, names string) ([]Middleware, error) {
+	stagesMu.Lock()
+	defer stagesMu.Unlock()
+	var mws []Middleware
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		stage, ok := stages[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: unknown stage %q", key, name)
+		}
+		mw, err := stage(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", key, name, err)
+		}
+		mws = append(mws, mw)
+	}
+	return mws, nil
+}
+
+// auditStage logs every batch that comes through it once the rest of the
+// chain has had it: how many events of each type, the first and last
+// idempotency keys, and whether they were stored, or processed.
+func auditStage(*config.Config) (Middleware, error) {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, batch []event.Event) error {
+			err := next(ctx, batch)
+			if len(batch) == 0 {
+				return err
+			}
+			types := make(map[string]int)
+			for _, e := range batch {
+				types[e.Type.String()]++
+			}
+			slog.Info("audit", "events", len(batch), "types", types, "first", batch[0].Key, "last", batch[len(batch)-1].Key, "ok", err == nil)
+			return err
+		}
+	}, nil
+}
@@ -0,0 +1,161 @@
+package simulator
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+)
+
+// modQueueSize is how many reports can wait for a moderator. Reports past
+// that are never reviewed, like a modqueue nobody keeps up with.
+const modQueueSize = 1000
+
+// moderators is how many users moderate. They're the top-ranked users: on
+// Reddit the most active users are the ones who end up as mods.
+const moderators = 10
+
+// moderationStats tracks the modqueue and the moderator working it.
+type moderationStats struct {
+	reviewed, removed, approved, banned int
+	overflow                            int // reports that found the modqueue full
+	reviewTime                          time.Duration
+}
+
+type moderationSnapshot struct {
+	Reports  int `json:"reports"`
+	Pending  int `json:"pending"`
+	Reviewed int `json:"reviewed"`
+	Removed  int `json:"removed"`
+	Approved int `json:"approved"`
+	Banned   int `json:"banned"`
+	Overflow int `json:"overflow"`
+	// Mean time from report to moderator action
+	MeanReview time.Duration `json:"mean_review_ns"`
+}
+
+// moderationSnapshot counts reports from the per-type totals: the pending
+// ones are those neither reviewed nor lost to a full modqueue. Callers hold
+// the metrics mutex.
+func (m *RedditMetrics) moderationSnapshot() moderationSnapshot {
+	mod := m.moderation
+	s := moderationSnapshot{
+		Reports:  m.byType[event.Report].events.Value(),
+		Reviewed: mod.reviewed,
+		Removed:  mod.removed,
+		Approved: mod.approved,
+		Banned:   mod.banned,
+		Overflow: mod.overflow,
+	}
+	s.Pending = max(s.Reports-s.Reviewed-s.Overflow, 0)
+	if mod.reviewed > 0 {
+		s.MeanReview = mod.reviewTime / time.Duration(mod.reviewed)
+	}
+	return s
+}
+
+// modQueue carries reports from the users who make them to the moderator.
+// A nil *modQueue is moderation turned off.
+type modQueue struct {
+	cfg     config.Moderation
+	reports chan event.Event
+	metrics *RedditMetrics
+}
+
+func newModQueue(cfg config.Moderation, metrics *RedditMetrics) *modQueue {
+	if cfg.Reports == 0 {
+		return nil
+	}
+	return &modQueue{cfg: cfg, reports: make(chan event.Event, modQueueSize), metrics: metrics}
+}
+
+// submit puts a report sent to the writers in the modqueue. Other events,
+// and reports with moderation off, are ignored.
+func (q *modQueue) submit(e event.Event) {
+	if q == nil || e.Type != event.Report {
+		return
+	}
+	select {
+	case q.reports <- e:
+	default:
+		q.metrics.mutex.Lock()
+		q.metrics.moderation.overflow++
+		q.metrics.mutex.Unlock()
+	}
+}
+
+// Works the modqueue - runs in its own goroutine. Reports are reviewed in
+// the order they were made, each once it is cfg.Delay old. A handful of
+// events a second at most, but each one acts on the firehose's data: a
+// removal has to find the post or comment, a ban its author.
+func moderate(ctx context.Context, q *modQueue, seed int64, queue *eventQueue, metrics *RedditMetrics) {
+	rng := rand.New(rand.NewSource(seed))
+	for {
+		var report event.Event
+		select {
+		case <-ctx.Done():
+			return
+		case report = <-q.reports:
+		}
+		if wait := time.Until(report.Timestamp.Add(q.cfg.Delay)); wait > 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+
+		actions := review(rng, q.cfg, report)
+		for _, e := range actions {
+			if !queue.send(ctx, e) {
+				return
+			}
+		}
+
+		metrics.mutex.Lock()
+		for _, e := range actions {
+			metrics.countEvent(e)
+			switch e.Type {
+			case event.Remove:
+				metrics.moderation.removed++
+			case event.Approve:
+				metrics.moderation.approved++
+			case event.Ban:
+				metrics.moderation.banned++
+			}
+		}
+		metrics.moderation.reviewed++
+		metrics.moderation.reviewTime += time.Since(report.Timestamp)
+		metrics.mutex.Unlock()
+	}
+}
+
+// review is a moderator's decision on report: remove the thing, and maybe
+// ban its author, or approve it.
+func review(r *rand.Rand, cfg config.Moderation, report event.Event) []event.Event {
+	action := event.Event{
+		Type:      event.Approve,
+		User:      generator.UserName(r.Intn(moderators)),
+		Subreddit: report.Subreddit,
+		PostID:    report.PostID,
+		CommentID: report.CommentID,
+		Target:    report.Target,
+		Timestamp: time.Now(),
+	}
+	if r.Float64() >= cfg.Remove {
+		return []event.Event{action}
+	}
+	action.Type = event.Remove
+	action.Payload = report.Payload
+	actions := []event.Event{action}
+	if r.Float64() < cfg.Ban {
+		ban := action
+		ban.Type = event.Ban
+		ban.PostID, ban.CommentID = "", ""
+		actions = append(actions, ban)
+	}
+	return actions
+}
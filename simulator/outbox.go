@@ -0,0 +1,144 @@
+package simulator
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// outboxStore is implemented by stores with an outbox table.
+type outboxStore interface {
+	// RelayOutbox takes up to limit unpublished entries, oldest first,
+	// hands them to publish and marks them published if it succeeds. An
+	// entry whose publish succeeded can still be published again if
+	// marking it fails, so consumers must tolerate duplicates. It returns
+	// how many entries it published.
+	RelayOutbox(ctx context.Context, limit int, publish func(context.Context, []store.OutboxEntry) error) (int, error)
+}
+
+// outboxSink is where the relay publishes outbox entries.
+type outboxSink interface {
+	publish(ctx context.Context, entries []store.OutboxEntry) error
+	Close() error
+}
+
+func newOutboxSink(cfg *config.Config) outboxSink {
+	if cfg.Outbox.Sink == config.OutboxKafka {
+		return kafkaOutboxSink{newKafkaWriter(cfg.Kafka.Brokers, cfg.Outbox.Topic)}
+	}
+	return logOutboxSink{}
+}
+
+// logOutboxSink writes each entry to the log, which is enough to watch
+// the pattern work without a broker.
+type logOutboxSink struct{}
+
+func (logOutboxSink) publish(ctx context.Context, entries []store.OutboxEntry) error {
+	for _, e := range entries {
+		slog.Info("outbox", "id", e.ID, "key", e.Key, "payload", string(e.Payload))
+	}
+	return nil
+}
+
+func (logOutboxSink) Close() error { return nil }
+
+// kafkaOutboxSink publishes entries to a Kafka topic, keyed like the
+// entries themselves.
+type kafkaOutboxSink struct {
+	w *kafka.Writer
+}
+
+func (s kafkaOutboxSink) publish(ctx context.Context, entries []store.OutboxEntry) error {
+	msgs := make([]kafka.Message, len(entries))
+	for i, e := range entries {
+		msgs[i] = kafka.Message{Key: []byte(e.Key), Value: e.Payload, Time: e.CreatedAt}
+	}
+	return s.w.WriteMessages(ctx, msgs...)
+}
+
+func (s kafkaOutboxSink) Close() error { return s.w.Close() }
+
+// outboxStats tracks the outbox: entries processors wrote, and what the
+// relay did with them.
+type outboxStats struct {
+	written   *metrics.Counter
+	published *metrics.Counter
+	failed    *metrics.Counter // publishes that failed; their entries are retried
+	lag       *metrics.Counter // from being written to being published, in all
+}
+
+func (s *outboxStats) register(reg *metrics.Registry) {
+	s.written = reg.Counter("redditsim_outbox_written_total", "Outbox entries written by processors (-outbox).")
+	s.published = reg.Counter("redditsim_outbox_published_total", "Outbox entries published by the relay.")
+	s.failed = reg.Counter("redditsim_outbox_publish_failures_total", "Outbox publishes that failed, their entries left to retry.")
+	s.lag = reg.SecondsCounter("redditsim_outbox_lag_seconds_total", "Time entries waited between being written and published.")
+}
+
+type outboxSnapshot struct {
+	Written   int `json:"written"`
+	Published int `json:"published"`
+	Pending   int `json:"pending"`
+	Failed    int `json:"failed"`
+	// Mean time from an entry being written to its publication
+	MeanLag time.Duration `json:"mean_lag_ns"`
+}
+
+func (s outboxStats) snapshot() outboxSnapshot {
+	snap := outboxSnapshot{
+		Written:   s.written.Value(),
+		Published: s.published.Value(),
+		Failed:    s.failed.Value(),
+	}
+	snap.Pending = max(snap.Written-snap.Published, 0)
+	if snap.Published > 0 {
+		snap.MeanLag = s.lag.Duration() / time.Duration(snap.Published)
+	}
+	return snap
+}
+
+// Relays the outbox to sink - runs in its own goroutine. Every interval
+// it publishes pending entries batch at a time until it has caught up.
+func relayOutbox(ctx context.Context, ob outboxStore, sink outboxSink, interval time.Duration, batch int, metrics *RedditMetrics) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	publish := func(ctx context.Context, entries []store.OutboxEntry) error {
+		err := sink.publish(ctx, entries)
+		now := time.Now()
+		if err != nil {
+			metrics.outbox.failed.Inc()
+			return err
+		}
+		metrics.outbox.published.Add(len(entries))
+		for _, e := range entries {
+			metrics.outbox.lag.AddDuration(now.Sub(e.CreatedAt))
+		}
+		return nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for {
+				n, err := ob.RelayOutbox(ctx, batch, publish)
+				if err != nil {
+					if ctx.Err() == nil {
+						slog.Error("relay outbox", "err", err)
+					}
+					break
+				}
+				if n < batch {
+					break
+				}
+			}
+		}
+	}
+}
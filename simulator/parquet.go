@@ -0,0 +1,253 @@
+package simulator
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+)
+
+// parquetEvent is an event's row in a Parquet file. Columns with few
+// distinct values are dictionary-encoded, and the IDs and client an event
+// may not have are null rather than empty.
+type parquetEvent struct {
+	Key        string    `parquet:"key,optional"`
+	Type       string    `parquet:"type,dict"`
+	User       string    `parquet:"user,dict"`
+	Subreddit  string    `parquet:"subreddit,dict"`
+	PostID     string    `parquet:"post_id,optional"`
+	CommentID  string    `parquet:"comment_id,optional"`
+	ParentID   string    `parquet:"parent_id,optional"`
+	Target     string    `parquet:"target,optional,dict"`
+	Payload    string    `parquet:"payload"`
+	Timestamp  time.Time `parquet:"timestamp,timestamp(microsecond)"`
+	Country    string    `parquet:"country,optional,dict"`
+	Device     string    `parquet:"device,optional,dict"`
+	AppVersion string    `parquet:"app_version,optional,dict"`
+}
+
+func newParquetEvent(e event.Event) parquetEvent {
+	return parquetEvent{
+		Key:        e.Key,
+		Type:       e.Type.String(),
+		User:       e.User,
+		Subreddit:  e.Subreddit,
+		PostID:     e.PostID,
+		CommentID:  e.CommentID,
+		ParentID:   e.ParentID,
+		Target:     e.Target,
+		Payload:    e.Payload,
+		Timestamp:  e.Timestamp,
+		Country:    e.Client.Country,
+		Device:     e.Client.Device,
+		AppVersion: e.Client.AppVersion,
+	}
+}
+
+// parquetRowGroup is the most rows a Parquet writer buffers before it
+// writes them out as a row group.
+const parquetRowGroup = 50_000
+
+// newParquetWriter returns a writer of zstd-compressed Parquet to w.
+func newParquetWriter(w io.Writer) *parquet.GenericWriter[parquetEvent] {
+	return parquet.NewGenericWriter[parquetEvent](w,
+		parquet.Compression(&parquet.Zstd),
+		parquet.MaxRowsPerRowGroup(parquetRowGroup),
+		parquet.CreatedBy("web-traffic-sim", "", ""),
+	)
+}
+
+// parquetStats tracks the Parquet mirror.
+type parquetStats struct {
+	files  *metrics.Counter
+	rows   *metrics.Counter
+	bytes  *metrics.Counter
+	failed *metrics.Counter
+}
+
+func (s *parquetStats) register(reg *metrics.Registry) {
+	s.rows = reg.Counter("redditsim_parquet_rows_total", "Events in finished Parquet mirror files.")
+	s.files = reg.Counter("redditsim_parquet_files_total", "Parquet mirror files finished.")
+	s.bytes = reg.Counter("redditsim_parquet_bytes_total", "Bytes of Parquet mirror files finished.")
+	s.failed = reg.Counter("redditsim_parquet_failures_total", "Parquet mirror files dropped after a write failed.")
+}
+
+type parquetSnapshot struct {
+	Files  int   `json:"files"`
+	Rows   int   `json:"rows"`
+	Bytes  int64 `json:"bytes"`
+	Failed int   `json:"failed"`
+}
+
+// parquetMirror writes a copy of every event the writers send to rolling
+// Parquet files in a directory. A file is written as .tmp and renamed once
+// it's finished, so a .parquet file that is there is complete; one is
+// finished once the bytes written to it pass the rotation size, which it
+// may overshoot by up to a row group, or it has been open for the rotation
+// interval.
+type parquetMirror struct {
+	cfg     config.Parquet
+	run     string
+	metrics *RedditMetrics
+
+	mu     sync.Mutex
+	seq    int
+	file   *os.File
+	out    *countingWriter
+	w      *parquet.GenericWriter[parquetEvent]
+	rows   int
+	opened time.Time
+	buf    []parquetEvent
+	closed bool
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+func newParquetMirror(cfg config.Parquet, metrics *RedditMetrics) (*parquetMirror, error) {
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, err
+	}
+	m := &parquetMirror{
+		cfg:     cfg,
+		run:     runStamp(time.Now()),
+		metrics: metrics,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	metrics.parquet.register(metrics.registry)
+	go m.rotateEvery()
+	return m, nil
+}
+
+// rotateEvery finishes the open file once it has been open for the
+// rotation interval, so a quiet run still produces files to look at.
+func (m *parquetMirror) rotateEvery() {
+	defer close(m.done)
+	if m.cfg.RotateEvery <= 0 {
+		<-m.quit
+		return
+	}
+	ticker := time.NewTicker(m.cfg.RotateEvery / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.quit:
+			return
+		case <-ticker.C:
+			m.mu.Lock()
+			if m.w != nil && time.Since(m.opened) >= m.cfg.RotateEvery {
+				m.finish()
+			}
+			m.mu.Unlock()
+		}
+	}
+}
+
+// add appends batch to the open file, starting one if there is none. A
+// failure is logged and counted, and drops the file it happened in: the
+// mirror is a copy and never fails the write.
+func (m *parquetMirror) add(batch []event.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return
+	}
+	if m.w == nil {
+		if err := m.open(); err != nil {
+			m.fail(err)
+			return
+		}
+	}
+	m.buf = m.buf[:0]
+	for _, e := range batch {
+		m.buf = append(m.buf, newParquetEvent(e))
+	}
+	if _, err := m.w.Write(m.buf); err != nil {
+		m.fail(err)
+		return
+	}
+	m.rows += len(batch)
+	if m.cfg.RotateSize > 0 && m.out.n >= int64(m.cfg.RotateSize) {
+		m.finish()
+	}
+}
+
+func (m *parquetMirror) open() error {
+	m.seq++
+	path := filepath.Join(m.cfg.Dir, fmt.Sprintf("events-%s-%04d.parquet.tmp", m.run, m.seq))
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	m.file = f
+	m.out = &countingWriter{w: f}
+	m.w = newParquetWriter(m.out)
+	m.rows = 0
+	m.opened = time.Now()
+	return nil
+}
+
+// finish writes out the open file's footer and renames it into place.
+func (m *parquetMirror) finish() {
+	err := m.w.Close()
+	if cerr := m.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		tmp := m.file.Name()
+		err = os.Rename(tmp, tmp[:len(tmp)-len(".tmp")])
+	}
+	if err != nil {
+		m.fail(err)
+		return
+	}
+	m.metrics.parquet.files.Inc()
+	m.metrics.parquet.rows.Add(m.rows)
+	m.metrics.parquet.bytes.Add(int(m.out.n))
+	m.file, m.w = nil, nil
+}
+
+// fail drops the open file, if any.
+func (m *parquetMirror) fail(err error) {
+	slog.Error("parquet mirror", "dir", m.cfg.Dir, "err", err)
+	if m.file != nil {
+		m.file.Close()
+		os.Remove(m.file.Name())
+	}
+	m.file, m.w = nil, nil
+	m.metrics.parquet.failed.Inc()
+}
+
+// Close finishes the open file. Events added after it are dropped.
+func (m *parquetMirror) Close() {
+	close(m.quit)
+	<-m.done
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.w != nil {
+		m.finish()
+	}
+	m.closed = true
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,87 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// partitionStore is implemented by stores that can split their events
+// table by time.
+type partitionStore interface {
+	// MaintainPartitions creates whichever of the partitions from now's
+	// to the last one ahead of it don't exist yet, drops the ones past
+	// their retention, and returns the names of both.
+	MaintainPartitions(ctx context.Context, now time.Time) (created, dropped []string, err error)
+	// Partitions returns the time partitions, oldest first.
+	Partitions(ctx context.Context) ([]store.PartitionInfo, error)
+}
+
+// partitionStats tracks the partition maintenance job.
+type partitionStats struct {
+	runs       int
+	created    *metrics.Counter
+	dropped    *metrics.Counter
+	lastRun    time.Duration
+	partitions []store.PartitionInfo
+	count      *metrics.Gauge // len(partitions), for the exporters
+}
+
+func (s *partitionStats) register(reg *metrics.Registry) {
+	s.count = reg.Gauge("redditsim_partitions", "Time partitions of the events table, the default one aside.")
+	s.created = reg.Counter("redditsim_partitions_created_total", "Partitions this instance created ahead of the clock.")
+	s.dropped = reg.Counter("redditsim_partitions_dropped_total", "Expired partitions this instance dropped, events and all.")
+}
+
+type partitionSnapshot struct {
+	Runs       int                   `json:"runs"`
+	Created    int                   `json:"created"`
+	Dropped    int                   `json:"dropped"`
+	LastRun    time.Duration         `json:"last_run_ns"`
+	Partitions []store.PartitionInfo `json:"partitions"`
+}
+
+// Keeps the events table's partitions ahead of the clock and drops the
+// expired ones - the partitions job, which the scheduler runs at start and
+// then every -partition-interval. Only the leader changes the partitions;
+// every instance lists them, even when changing them failed part way.
+func maintainPartitions(ctx context.Context, store partitionStore, metrics *RedditMetrics) error {
+	lead := metrics.leading()
+	start := time.Now()
+	var created, dropped []string
+	var maintainErr error
+	if lead {
+		created, dropped, maintainErr = store.MaintainPartitions(ctx, start)
+		if maintainErr != nil {
+			maintainErr = fmt.Errorf("maintain partitions: %w", maintainErr)
+		}
+		for _, name := range created {
+			slog.Info("created partition", "partition", name)
+		}
+		for _, name := range dropped {
+			slog.Info("dropped partition", "partition", name)
+		}
+	}
+	elapsed := time.Since(start)
+
+	parts, err := store.Partitions(ctx)
+	if err != nil {
+		return errors.Join(maintainErr, fmt.Errorf("list partitions: %w", err))
+	}
+	metrics.partitions.created.Add(len(created))
+	metrics.partitions.dropped.Add(len(dropped))
+	metrics.partitions.count.Set(float64(len(parts)))
+	metrics.mutex.Lock()
+	if lead {
+		metrics.partitions.runs++
+		metrics.partitions.lastRun = elapsed
+	}
+	metrics.partitions.partitions = parts
+	metrics.mutex.Unlock()
+	return maintainErr
+}
@@ -0,0 +1,62 @@
+package simulator
+
+import "sync"
+
+// workerPool runs a resizable set of numbered worker goroutines. Each
+// worker gets its id and a quit channel that is closed when a shrink
+// retires it. Ids stay dense: shrinking retires the highest-numbered
+// workers and growing again reuses their ids, so per-worker stats can be
+// kept in a slice.
+type workerPool struct {
+	mu     sync.Mutex
+	wg     sync.WaitGroup
+	run    func(id int, quit <-chan struct{})
+	quits  []chan struct{}
+	closed bool
+}
+
+func newWorkerPool(run func(id int, quit <-chan struct{})) *workerPool {
+	return &workerPool{run: run}
+}
+
+// resize grows or shrinks the pool to n workers. Retired workers finish
+// what they are doing in the background. It does nothing once wait has
+// been called.
+func (p *workerPool) resize(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+
+	for len(p.quits) > n {
+		last := len(p.quits) - 1
+		close(p.quits[last])
+		p.quits = p.quits[:last]
+	}
+	for len(p.quits) < n {
+		id := len(p.quits)
+		quit := make(chan struct{})
+		p.quits = append(p.quits, quit)
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			p.run(id, quit)
+		}()
+	}
+}
+
+func (p *workerPool) size() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.quits)
+}
+
+// wait stops any further resizing and waits for every worker, retired or
+// not, to return.
+func (p *workerPool) wait() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+	p.wg.Wait()
+}
@@ -0,0 +1,62 @@
+package simulator
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// processorStats tracks a single processor goroutine.
+type processorStats struct {
+	batches metrics.Counter
+	events  metrics.Counter
+	beat    workerHeartbeat
+}
+
+// processorObserver keeps the metrics of the processors, traces their
+// batches and announces every batch processed to hook, if there is one.
+type processorObserver struct {
+	hook    *webhook
+	metrics *RedditMetrics
+}
+
+func (o processorObserver) Woken(id int) { o.metrics.wakeups.Inc() }
+
+func (o processorObserver) Claiming(id int) { o.metrics.processors.get(id).beat.beat() }
+
+func (o processorObserver) Claimed(id int, took time.Duration) {
+	o.metrics.dbOperations.reads.Inc()
+	o.metrics.latency[OpRead].Observe(took)
+}
+
+// Failed logs the error, unless it's the breaker turning calls away.
+func (o processorObserver) Failed(id int, step string, events int, err error) {
+	if errors.Is(err, errBreakerOpen) {
+		return
+	}
+	if events == 0 {
+		slog.Error(step, "processor", id, "err", err)
+		return
+	}
+	slog.Error(step, "processor", id, "events", events, "err", err)
+}
+
+func (o processorObserver) Processed(id int, events []event.Event, start, end time.Time, err error) {
+	traceProcessed(id, events, start, end, err)
+}
+
+func (o processorObserver) Committed(id int, events []event.Event, took time.Duration, counts store.DomainCounts, outboxed int) {
+	o.metrics.dbOperations.updates.Inc()
+	o.metrics.outbox.written.Add(outboxed)
+	o.metrics.latency[OpUpdate].Observe(took)
+	o.metrics.countProcessed(events, time.Now())
+	ps := o.metrics.processors.get(id)
+	ps.batches.Inc()
+	ps.events.Add(len(events))
+	o.metrics.domain.add(counts)
+	o.hook.notify(id, events)
+}
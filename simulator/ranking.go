@@ -0,0 +1,64 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"web-traffic-sim/store"
+)
+
+// rankingStore is implemented by stores that can rank posts.
+type rankingStore interface {
+	// RefreshRanks rescores the posts touched since the last refresh and
+	// returns how many it updated.
+	RefreshRanks(ctx context.Context) (int, error)
+	// FrontPage returns the first n posts in the given sort order.
+	FrontPage(ctx context.Context, sort string, n int) ([]store.RankedPost, error)
+}
+
+// rankingStats tracks the ranking job and the last front page it read.
+type rankingStats struct {
+	runs      int
+	rescored  int
+	lastRun   time.Duration
+	frontPage []store.RankedPost
+}
+
+// Keeps post rankings fresh and reads the front page - the ranking job,
+// which the scheduler runs every -rank-interval. Only posts that were
+// created or voted on since the last pass are rescored; the front page
+// read afterwards is the read-heavy half of the workload, like real Reddit
+// where listings vastly outnumber votes. Of several instances sharing the
+// database only the leader rescores, but they all read the front page.
+func rankPosts(ctx context.Context, store rankingStore, sort string, metrics *RedditMetrics) error {
+	lead := metrics.leading()
+	n, elapsed := 0, time.Duration(0)
+	if lead {
+		start := time.Now()
+		var err error
+		if n, err = store.RefreshRanks(ctx); err != nil {
+			return fmt.Errorf("rank posts: %w", err)
+		}
+		elapsed = time.Since(start)
+	}
+
+	start := time.Now()
+	page, err := store.FrontPage(ctx, sort, 10)
+	if err != nil {
+		return fmt.Errorf("read %s front page: %w", sort, err)
+	}
+	readTime := time.Since(start)
+
+	metrics.mutex.Lock()
+	if lead {
+		metrics.ranking.runs++
+		metrics.ranking.rescored += n
+		metrics.ranking.lastRun = elapsed
+	}
+	metrics.ranking.frontPage = page
+	metrics.mutex.Unlock()
+	metrics.dbOperations.reads.Inc()
+	metrics.latency[OpRead].Observe(readTime)
+	return nil
+}
@@ -0,0 +1,204 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+)
+
+// rateLimitStats tracks the rate limits.
+type rateLimitStats struct {
+	userRejected *metrics.Counter
+	ipRejected   *metrics.Counter
+	delayed      *metrics.Counter
+	delay        *metrics.Counter // time waited for tokens in all
+}
+
+func (s *rateLimitStats) register(reg *metrics.Registry) {
+	rejected := reg.CounterVec("redditsim_rate_limited_total", "Events rejected over a rate limit, by limit.", "limit")
+	s.userRejected, s.ipRejected = rejected.With("user"), rejected.With("ip")
+	s.delayed = reg.Counter("redditsim_rate_limit_delayed_total", "Events held back for a rate limit token.")
+	s.delay = reg.SecondsCounter("redditsim_rate_limit_delay_seconds_total", "Time events were held back for rate limit tokens.")
+}
+
+type rateLimitSnapshot struct {
+	UserRejected int           `json:"user_rejected"`
+	IPRejected   int           `json:"ip_rejected"`
+	Delayed      int           `json:"delayed"`
+	MeanDelay    time.Duration `json:"mean_delay_ns"`
+}
+
+func (s rateLimitStats) snapshot() rateLimitSnapshot {
+	snap := rateLimitSnapshot{UserRejected: s.userRejected.Value(), IPRejected: s.ipRejected.Value(), Delayed: s.delayed.Value()}
+	if snap.Delayed > 0 {
+		snap.MeanDelay = s.delay.Duration() / time.Duration(snap.Delayed)
+	}
+	return snap
+}
+
+// tokenBucket holds up to burst tokens and gains rate of them a second.
+// Tokens may go negative, a debt later calls wait out.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// keyedLimiter is a token bucket per key, made on first use. A bucket that
+// has refilled is as good as a new one, so buckets are swept away once
+// they have, keeping only the active keys'. It's safe for concurrent use.
+type keyedLimiter struct {
+	rate    float64
+	burst   float64
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	swept   time.Time
+}
+
+func newKeyedLimiter(rate float64, burst int) *keyedLimiter {
+	return &keyedLimiter{rate: rate, burst: float64(burst), buckets: make(map[string]*tokenBucket), swept: time.Now()}
+}
+
+// bucket returns key's bucket refilled up to now. l.mu must be held.
+func (l *keyedLimiter) bucket(key string, now time.Time) *tokenBucket {
+	// An empty bucket refills in this long; one in debt takes longer, and
+	// is only swept once it has paid it off
+	full := time.Duration(l.burst / l.rate * float64(time.Second))
+	if now.Sub(l.swept) > full {
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+		return b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	return b
+}
+
+// allow takes one of key's tokens if it has one.
+func (l *keyedLimiter) allow(key string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(key, now)
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund gives back a token allow took.
+func (l *keyedLimiter) refund(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if b, ok := l.buckets[key]; ok {
+		b.tokens = min(l.burst, b.tokens+1)
+	}
+}
+
+// reserve takes one of key's tokens whether or not it has one, and
+// returns how long the caller must wait before acting on it.
+func (l *keyedLimiter) reserve(key string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(key, now)
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / l.rate * float64(time.Second))
+}
+
+// rateLimits applies the per-user and per-IP limits to events on their
+// way into the queue. Either limiter is nil when its rate is unlimited,
+// and a nil rateLimits limits nothing.
+type rateLimits struct {
+	user    *keyedLimiter
+	ip      *keyedLimiter
+	ips     int
+	delay   bool
+	metrics *RedditMetrics
+}
+
+func newRateLimits(cfg config.RateLimit, metrics *RedditMetrics) *rateLimits {
+	if cfg.PerUser == 0 && cfg.PerIP == 0 {
+		return nil
+	}
+	l := &rateLimits{ips: cfg.IPs, delay: cfg.Action == config.RateLimitDelay, metrics: metrics}
+	if cfg.PerUser > 0 {
+		l.user = newKeyedLimiter(cfg.PerUser, cfg.UserBurst)
+	}
+	if cfg.PerIP > 0 {
+		l.ip = newKeyedLimiter(cfg.PerIP, cfg.IPBurst)
+	}
+	metrics.rateLimit.register(metrics.registry)
+	return l
+}
+
+// userIP is the address user sends from: users are hashed onto a pool of
+// ips addresses in 10.0.0.0/8, so the busiest users' IPs carry others'
+// traffic too, like a NAT or a campus network.
+func userIP(user string, ips int) string {
+	h := fnv.New32a()
+	h.Write([]byte(user))
+	n := h.Sum32() % uint32(ips)
+	return fmt.Sprintf("10.%d.%d.%d", n>>16&0xff, n>>8&0xff, n&0xff)
+}
+
+// admit reports whether e may go on: in reject mode whether it's within
+// both limits, in delay mode once it is, after waiting for the tokens. It
+// also returns false if ctx is done while waiting.
+func (l *rateLimits) admit(ctx context.Context, e event.Event) bool {
+	if l == nil || e.Type == event.Remove || e.Type == event.Ban || e.Type == event.Approve {
+		return true
+	}
+	now := time.Now()
+	ip := userIP(e.User, l.ips)
+
+	if l.delay {
+		var wait time.Duration
+		if l.user != nil {
+			wait = l.user.reserve(e.User, now)
+		}
+		if l.ip != nil {
+			wait = max(wait, l.ip.reserve(ip, now))
+		}
+		if wait == 0 {
+			return true
+		}
+		l.metrics.rateLimit.delayed.Inc()
+		l.metrics.rateLimit.delay.AddDuration(wait)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+			return true
+		}
+	}
+
+	if l.user != nil && !l.user.allow(e.User, now) {
+		l.metrics.rateLimit.userRejected.Inc()
+		return false
+	}
+	if l.ip != nil && !l.ip.allow(ip, now) {
+		if l.user != nil {
+			l.user.refund(e.User)
+		}
+		l.metrics.rateLimit.ipRejected.Inc()
+		return false
+	}
+	return true
+}
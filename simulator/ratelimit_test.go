@@ -0,0 +1,79 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestKeyedLimiterRefill(t *testing.T) {
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	tests := []struct {
+		name  string
+		rate  float64
+		burst int
+		calls []time.Time
+		want  []bool
+	}{
+		{"burst then empty", 10, 2, []time.Time{at(0), at(0), at(0)}, []bool{true, true, false}},
+		{"one token back after a tenth of a second", 10, 2, []time.Time{at(0), at(0), at(0), at(100), at(100)}, []bool{true, true, false, true, false}},
+		{"refill stops at burst", 10, 2, []time.Time{at(0), at(10000), at(10000), at(10000)}, []bool{true, true, true, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newKeyedLimiter(tt.rate, tt.burst)
+			for i, now := range tt.calls {
+				if got := l.allow("u", now); got != tt.want[i] {
+					t.Errorf("call %d: allow = %v, want %v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestKeyedLimiterReserve(t *testing.T) {
+	start := time.Now()
+	l := newKeyedLimiter(1, 1)
+	for i, want := range []time.Duration{0, time.Second, 2 * time.Second} {
+		if got := l.reserve("u", start); got != want {
+			t.Errorf("reserve %d: wait %v, want %v", i, got, want)
+		}
+	}
+	// Other keys have buckets of their own
+	if got := l.reserve("v", start); got != 0 {
+		t.Errorf("other key: wait %v, want 0", got)
+	}
+}
+
+func TestKeyedLimiterSweep(t *testing.T) {
+	start := time.Now()
+	tests := []struct {
+		name    string
+		reserve int           // tokens "u" takes at start, with burst 1 at 1/s
+		after   time.Duration // when another key's call sweeps
+		kept    bool
+		wait    time.Duration // what "u" then waits for a token
+	}{
+		{"refilled bucket swept", 1, 1500 * time.Millisecond, false, 0},
+		{"bucket in debt kept", 3, 1500 * time.Millisecond, true, 1500 * time.Millisecond},
+		{"debt paid off, swept", 3, 3500 * time.Millisecond, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newKeyedLimiter(1, 1)
+			l.swept = start
+			for range tt.reserve {
+				l.reserve("u", start)
+			}
+			now := start.Add(tt.after)
+			l.allow("v", now)
+			if _, kept := l.buckets["u"]; kept != tt.kept {
+				t.Errorf("kept = %v, want %v", kept, tt.kept)
+			}
+			if got := l.reserve("u", now); got != tt.wait {
+				t.Errorf("wait %v, want %v", got, tt.wait)
+			}
+		})
+	}
+}
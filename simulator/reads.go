@@ -0,0 +1,141 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/generator"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// Page loads the readers make, used as metric keys and labels.
+const (
+	ReadFrontPage   = "front_page"
+	ReadCommentPage = "comment_page"
+	ReadProfile     = "profile"
+)
+
+var readKinds = []string{ReadFrontPage, ReadCommentPage, ReadProfile}
+
+// readMix is how a reader's page loads split between the kinds: mostly
+// front pages, then comment pages, then the odd profile.
+var readMix = []struct {
+	kind   string
+	weight float64
+}{
+	{ReadFrontPage, 0.50},
+	{ReadCommentPage, 0.35},
+	{ReadProfile, 0.15},
+}
+
+// readThreadLimit caps the comments a comment page loads, like Reddit's
+// "load more comments".
+const readThreadLimit = 500
+
+// readStats tracks the page loads of one kind. A load that fails counts
+// towards errors but not the latency.
+type readStats struct {
+	count   *metrics.Counter
+	errors  *metrics.Counter
+	latency *metrics.Histogram
+}
+
+// registerReads registers the readers' metrics, and returns their handles
+// by kind.
+func registerReads(reg *metrics.Registry) map[string]readStats {
+	loads := reg.CounterVec("redditsim_page_loads_total", "Pages loaded by the readers (-read-ratio), by kind.", "kind")
+	errs := reg.CounterVec("redditsim_page_load_errors_total", "Page loads that failed, by kind.", "kind")
+	latency := reg.HistogramVec("redditsim_page_load_duration_seconds", "Time to make every query of a page load.", "kind")
+	reads := make(map[string]readStats, len(readKinds))
+	for _, kind := range readKinds {
+		reads[kind] = readStats{count: loads.With(kind), errors: errs.With(kind), latency: latency.With(kind)}
+	}
+	return reads
+}
+
+type readSnapshot struct {
+	Kind    string                  `json:"kind"`
+	Count   int                     `json:"count"`
+	Errors  int                     `json:"errors"`
+	Latency metrics.LatencySnapshot `json:"latency"`
+}
+
+// readTraffic loads pages - runs in its own goroutine, -readers of them,
+// each at its share of -read-ratio times the generator rate, with the
+// generators' arrival process. A page load is every query the page needs,
+// timed as a whole: a front page is one ranked listing, a comment page the
+// post and its comment tree, a profile the user and what they've posted
+// and commented. What they load is picked like the generators pick what
+// to act on, so reads go where the writes are.
+func readTraffic(ctx context.Context, id int, q graphQuerier, a generator.Arrivals, rng *generator.RandSource, w *generator.World, metrics *RedditMetrics) {
+	generator.Pace(ctx, a, nil, func() bool {
+		kind := readMix[len(readMix)-1].kind
+		r := rng.Float64()
+		for _, m := range readMix {
+			if r < m.weight {
+				kind = m.kind
+				break
+			}
+			r -= m.weight
+		}
+
+		start := time.Now()
+		kind, err := loadPage(ctx, kind, q, rng, w)
+		took := time.Since(start)
+		if ctx.Err() != nil {
+			return false
+		}
+
+		s := metrics.reads[kind]
+		s.count.Inc()
+		if err != nil {
+			s.errors.Inc()
+		} else {
+			s.latency.Observe(took)
+		}
+		if err != nil {
+			slog.Warn("read", "reader", id, "page", kind, "err", err)
+		}
+		return true
+	})
+}
+
+// loadPage makes the queries for one page load of kind, and returns the
+// kind it loaded: a front page in place of a comment page while there are
+// no posts to open.
+func loadPage(ctx context.Context, kind string, q graphQuerier, rng *generator.RandSource, w *generator.World) (string, error) {
+	switch kind {
+	case ReadFrontPage:
+		// Half the time the front page, otherwise a subreddit's
+		f := store.PostFilter{Sort: config.SortHot, Limit: defaultGraphPage}
+		if rng.Intn(2) == 0 {
+			f.Subreddit = w.Subreddits.Pick(rng.Rand)
+		}
+		_, err := q.Posts(ctx, f)
+		return ReadFrontPage, err
+	case ReadCommentPage:
+		post, ok := w.Posts.Pick(rng.Rand)
+		if !ok {
+			return loadPage(ctx, ReadFrontPage, q, rng, w)
+		}
+		if _, err := q.Posts(ctx, store.PostFilter{ID: post.PostID, Sort: config.SortNew, Limit: 1}); err != nil {
+			return kind, err
+		}
+		_, err := q.Comments(ctx, store.CommentFilter{Post: post.PostID, Thread: true, Limit: readThreadLimit})
+		return kind, err
+	default:
+		name := generator.UserName(rng.Users.Next())
+		if _, err := q.User(ctx, name); err != nil && !errors.Is(err, store.ErrUserNotFound) {
+			return kind, err
+		}
+		if _, err := q.Posts(ctx, store.PostFilter{Author: name, Sort: config.SortNew, Limit: defaultGraphPage}); err != nil {
+			return kind, err
+		}
+		_, err := q.Comments(ctx, store.CommentFilter{Author: name, Limit: defaultGraphPage})
+		return kind, err
+	}
+}
@@ -0,0 +1,242 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+	"web-traffic-sim/metrics"
+)
+
+// redditStats tracks ingestion from Reddit.
+type redditStats struct {
+	requests *metrics.Counter
+	failed   *metrics.Counter
+	limited  *metrics.Counter // requests Reddit turned away with 429
+	posts    *metrics.Counter
+	comments *metrics.Counter
+}
+
+func (s *redditStats) register(reg *metrics.Registry) {
+	s.requests = reg.Counter("redditsim_reddit_requests_total", "Listing requests made to Reddit.")
+	s.failed = reg.Counter("redditsim_reddit_failures_total", "Listing requests to Reddit that failed, rate limits aside.")
+	s.limited = reg.Counter("redditsim_reddit_rate_limited_total", "Listing requests Reddit turned away with 429.")
+	ingested := reg.CounterVec("redditsim_reddit_ingested_total", "Real posts and comments ingested from Reddit.", "type")
+	s.posts, s.comments = ingested.With("post"), ingested.With("comment")
+}
+
+type redditSnapshot struct {
+	Requests int `json:"requests"`
+	Failed   int `json:"failed"`
+	Limited  int `json:"rate_limited"`
+	Posts    int `json:"posts"`
+	Comments int `json:"comments"`
+}
+
+// redditListing is the part of a listing response ingestion reads: posts
+// (t3) from new.json, comments (t1) from comments.json.
+type redditListing struct {
+	Data struct {
+		Children []struct {
+			Kind string      `json:"kind"`
+			Data redditThing `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type redditThing struct {
+	Name      string `json:"name"`
+	Subreddit string `json:"subreddit"`
+	Author    string `json:"author"`
+	Title     string `json:"title"`
+	Body      string `json:"body"`
+	LinkID    string `json:"link_id"`
+	ParentID  string `json:"parent_id"`
+}
+
+// redditRequestTimeout bounds each request, so a hung connection costs a
+// poll rather than the ingester.
+const redditRequestTimeout = 15 * time.Second
+
+// redditSeen is how many fullnames the ingester remembers, to skip what it
+// sent on an earlier poll: comfortably more than the two listings of 100
+// a poll reads.
+const redditSeen = 10_000
+
+// redditRateLimited is Reddit answering 429, and how long it asked to be
+// left alone.
+type redditRateLimited struct {
+	wait time.Duration
+}
+
+func (e *redditRateLimited) Error() string {
+	return fmt.Sprintf("rate limited for %v", e.wait)
+}
+
+// redditIngester polls the listings of a set of subreddits, read together
+// as one multireddit, and remembers what it has already seen.
+type redditIngester struct {
+	cfg    config.Reddit
+	path   string
+	client *http.Client
+	seen   map[string]bool
+	order  []string // ring of the fullnames in seen, oldest at pos
+	pos    int
+}
+
+func newRedditIngester(cfg config.Reddit) *redditIngester {
+	var subs []string
+	for _, s := range strings.Split(cfg.Subreddits, ",") {
+		if s = strings.TrimPrefix(strings.TrimSpace(s), "r/"); s != "" {
+			subs = append(subs, url.PathEscape(s))
+		}
+	}
+	return &redditIngester{
+		cfg:    cfg,
+		path:   "/r/" + strings.Join(subs, "+"),
+		client: &http.Client{Timeout: redditRequestTimeout},
+		seen:   make(map[string]bool, redditSeen),
+		order:  make([]string, redditSeen),
+	}
+}
+
+// Sends real posts and comments from Reddit down the pipeline - runs in
+// its own goroutine next to the generators when -reddit-subreddits is set.
+// Every interval it reads the newest posts and then the newest comments
+// across the subreddits, and sends those it hasn't sent before, oldest
+// first and stamped with the time they're sent. Ingested posts join the
+// generators' recent posts, so synthetic users comment on and vote for
+// them too: a hybrid of real content and simulated traffic. A failed poll
+// is logged and the next one tried as usual, or once Reddit's rate limit
+// has reset.
+func ingestReddit(ctx context.Context, cfg config.Reddit, w *generator.World, queue *eventQueue, metrics *RedditMetrics) {
+	r := newRedditIngester(cfg)
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		wait := cfg.Interval
+		for _, listing := range []string{"new", "comments"} {
+			things, err := r.fetch(ctx, listing)
+			if ctx.Err() != nil {
+				return
+			}
+			metrics.reddit.requests.Inc()
+			var limited *redditRateLimited
+			switch {
+			case errors.As(err, &limited):
+				metrics.reddit.limited.Inc()
+				wait = max(wait, limited.wait)
+			case err != nil:
+				metrics.reddit.failed.Inc()
+			}
+			if err != nil {
+				slog.Warn("reddit ingest", "listing", r.path+"/"+listing, "err", err)
+				break
+			}
+			if !r.send(ctx, things, w, queue, metrics) {
+				return
+			}
+		}
+		timer.Reset(wait)
+	}
+}
+
+// fetch reads one listing, newest first.
+func (r *redditIngester) fetch(ctx context.Context, listing string) ([]redditThing, error) {
+	u := strings.TrimSuffix(r.cfg.URL, "/") + r.path + "/" + listing + ".json?limit=100&raw_json=1"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", r.cfg.UserAgent)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return nil, &redditRateLimited{wait: retryAfter(resp.Header)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	var l redditListing
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, fmt.Errorf("%s: %w", u, err)
+	}
+	things := make([]redditThing, 0, len(l.Data.Children))
+	for _, c := range l.Data.Children {
+		if c.Kind == "t3" || c.Kind == "t1" {
+			things = append(things, c.Data)
+		}
+	}
+	return things, nil
+}
+
+// retryAfter is how long a 429 asks the client to wait: Retry-After, or
+// Reddit's own X-Ratelimit-Reset, both in seconds; a minute if neither
+// says.
+func retryAfter(h http.Header) time.Duration {
+	for _, name := range []string{"Retry-After", "X-Ratelimit-Reset"} {
+		if s, err := strconv.ParseFloat(h.Get(name), 64); err == nil && s > 0 {
+			return time.Duration(s * float64(time.Second))
+		}
+	}
+	return time.Minute
+}
+
+// send queues the things not seen before, oldest first, and reports false
+// once the run is over.
+func (r *redditIngester) send(ctx context.Context, things []redditThing, w *generator.World, queue *eventQueue, metrics *RedditMetrics) bool {
+	for i := len(things) - 1; i >= 0; i-- {
+		t := things[i]
+		if t.Name == "" || r.seen[t.Name] {
+			continue
+		}
+		r.remember(t.Name)
+
+		e := event.Event{User: t.Author, Subreddit: t.Subreddit, Timestamp: time.Now()}
+		if strings.HasPrefix(t.Name, "t3_") {
+			e.Type, e.PostID, e.Payload = event.Post, t.Name, t.Title
+			w.Posts.Add(event.Thing{ID: t.Name, PostID: t.Name, Subreddit: t.Subreddit, Author: t.Author})
+		} else {
+			e.Type, e.PostID, e.CommentID, e.ParentID, e.Payload = event.Comment, t.LinkID, t.Name, t.ParentID, t.Body
+			w.Comments.Add(event.Thing{ID: t.Name, PostID: t.LinkID, Subreddit: t.Subreddit, Author: t.Author})
+		}
+		if !queue.send(ctx, e) {
+			return false
+		}
+
+		if e.Type == event.Post {
+			metrics.reddit.posts.Inc()
+		} else {
+			metrics.reddit.comments.Inc()
+		}
+		metrics.countEvent(e)
+	}
+	return true
+}
+
+// remember adds name to seen, forgetting the oldest once it's full.
+func (r *redditIngester) remember(name string) {
+	delete(r.seen, r.order[r.pos])
+	r.order[r.pos] = name
+	r.pos = (r.pos + 1) % len(r.order)
+	r.seen[name] = true
+}
@@ -0,0 +1,189 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// recordedEvent is a line of a recording: an event as it was generated,
+// before it had a key, and how long after the first event that was.
+type recordedEvent struct {
+	Offset time.Duration `json:"offset_ns"`
+	Event  event.Event   `json:"event"`
+}
+
+// recorder writes every generated event to a file, one JSON object per
+// line, gzipped if the name ends in .gz. It is safe for concurrent use,
+// and a nil recorder records nothing.
+type recorder struct {
+	mu     sync.Mutex
+	file   *os.File
+	gz     *gzip.Writer
+	buf    *bufio.Writer
+	enc    *json.Encoder
+	start  time.Time
+	failed bool
+}
+
+func newRecorder(path string) (*recorder, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := &recorder{file: f}
+	var w io.Writer = f
+	if strings.HasSuffix(path, ".gz") {
+		r.gz = gzip.NewWriter(f)
+		w = r.gz
+	}
+	r.buf = bufio.NewWriter(w)
+	r.enc = json.NewEncoder(r.buf)
+	return r, nil
+}
+
+// record appends e. The first failure is logged and ends the recording,
+// rather than the run.
+func (r *recorder) record(e event.Event) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failed {
+		return
+	}
+	if r.start.IsZero() {
+		r.start = time.Now()
+	}
+	if err := r.enc.Encode(recordedEvent{Offset: time.Since(r.start), Event: e}); err != nil {
+		slog.Error("record events", "file", r.file.Name(), "err", err)
+		r.failed = true
+	}
+}
+
+// Close writes out what is buffered and closes the file.
+func (r *recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err := r.buf.Flush()
+	if r.gz != nil {
+		if gerr := r.gz.Close(); err == nil {
+			err = gerr
+		}
+	}
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// openRecording opens a recording or a dump for reading, decompressing it
+// if it's gzipped or zstd-compressed.
+func openRecording(path string) (io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	br := bufio.NewReader(f)
+	magic, _ := br.Peek(4)
+	switch {
+	case bytes.HasPrefix(magic, []byte{0x1f, 0x8b}):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{gz, f}, nil
+	case bytes.Equal(magic, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		// Pushshift's dumps are compressed with a window of up to 2GB
+		zr, err := zstd.NewReader(br, zstd.WithDecoderMaxWindow(1<<31), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return struct {
+			io.Reader
+			io.Closer
+		}{zr, closerFunc(func() error { zr.Close(); return f.Close() })}, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{br, f}, nil
+}
+
+type closerFunc func() error
+
+func (c closerFunc) Close() error { return c() }
+
+// Sends a recording's events in place of the generators - runs in its own
+// goroutine, counted as generator 0. Each event goes out once its recorded
+// offset, divided by r.Speed, has passed since the replay began, stamped
+// with the time it's sent; with Speed 0 they go as fast as the queue takes
+// them. Pausing the generators pauses the replay, and the time paused is
+// added to every later event's. Once the last event is sent, or the file
+// turns out to be unreadable, done is called to end the run.
+func replayEvents(ctx context.Context, r config.Replay, queue *eventQueue, done func(), metrics *RedditMetrics) {
+	defer done()
+	f, err := openRecording(r.File)
+	if err != nil {
+		slog.Error("replay", "file", r.File, "err", err)
+		return
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		var rec recordedEvent
+		if err := dec.Decode(&rec); err != nil {
+			if err != io.EOF {
+				slog.Error("replay", "file", r.File, "err", err)
+			}
+			return
+		}
+		if r.Speed > 0 {
+			at := start.Add(time.Duration(float64(rec.Offset) / r.Speed))
+			if wait := time.Until(at); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+				}
+			}
+		}
+		e := rec.Event
+		e.Timestamp = time.Now()
+		paused := time.Now()
+		if !queue.send(ctx, e) {
+			return
+		}
+		// Time spent waiting out a pause or a full channel under the
+		// block policy shifts the rest of the recording with it
+		start = start.Add(time.Since(paused))
+
+		metrics.countEvent(e)
+		metrics.generators[0].events.Inc()
+		metrics.generators[0].beat.beat()
+	}
+}
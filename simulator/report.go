@@ -0,0 +1,213 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// printSummary writes the run's main figures to w once it's over, for
+// -summary: all a headless run shows of how it went, short of the reports.
+func printSummary(w io.Writer, snap Snapshot) {
+	uptime := time.Duration(snap.Uptime * float64(time.Second)).Round(time.Second)
+	fmt.Fprintf(w, "\n📋 Summary after %v:\n", uptime)
+	fmt.Fprintf(w, "   Events    : %d generated (%.1f/second), %d dropped\n", snap.EventsGenerated, snap.EventsPerSec, snap.Dropped)
+	if f := snap.Filter; f.Filtered+f.Sampled > 0 {
+		fmt.Fprintf(w, "   Filtered  : %d left out before the store, %d outside the subreddits and %d sampled out\n", f.Filtered+f.Sampled, f.Filtered, f.Sampled)
+	}
+	for _, op := range []struct {
+		name  string
+		n     int
+		rate  float64
+		label string
+	}{
+		{"Writes", snap.Writes, snap.WritesPerSec, OpWrite},
+		{"Reads", snap.Reads, snap.ReadsPerSec, OpRead},
+		{"Updates", snap.Updates, snap.UpdatesPerSec, OpUpdate},
+	} {
+		l := snap.Latency[op.label]
+		fmt.Fprintf(w, "   %-10s: %d (%.1f/second), p50 %v, p99 %v, max %v\n",
+			op.name, op.n, op.rate, RoundLatency(l.P50), RoundLatency(l.P99), RoundLatency(l.Max))
+	}
+	if c := snap.ClickHouse; c.Batches+c.Failed+c.Dropped > 0 {
+		fmt.Fprintf(w, "   ClickHouse: %d (%.1f/second) in %d inserts, p50 %v, p99 %v, max %v; %d failed, %d dropped\n",
+			c.Inserted, float64(c.Inserted)/max(snap.Uptime, 1), c.Batches, RoundLatency(c.Latency.P50), RoundLatency(c.Latency.P99), RoundLatency(c.Latency.Max), c.Failed, c.Dropped)
+	}
+	fmt.Fprintf(w, "   Processed : %d (%.1f/second), %d left in the backlog\n", snap.Processed, snap.ProcessedPerSec, snap.Backlog)
+	if snap.DLQ.Size > 0 || snap.Lag.Alerts > 0 {
+		fmt.Fprintf(w, "   Trouble   : %d dead letters, %d consumer lag alerts\n", snap.DLQ.Size, snap.Lag.Alerts)
+	}
+}
+
+// runReport is the end-of-run summary written by -report-json.
+type runReport struct {
+	StartedAt time.Time     `json:"started_at"`
+	EndedAt   time.Time     `json:"ended_at"`
+	Config    config.Config `json:"config"`
+	Metrics   Snapshot      `json:"metrics"`
+}
+
+func newRunReport(cfg *config.Config, snap Snapshot) runReport {
+	c := *cfg
+	if u, err := url.Parse(c.DSN); err == nil {
+		c.DSN = u.Redacted()
+	}
+	end := time.Now()
+	return runReport{
+		StartedAt: end.Add(-time.Duration(snap.Uptime * float64(time.Second))),
+		EndedAt:   end,
+		Config:    c,
+		Metrics:   snap,
+	}
+}
+
+func (r runReport) writeJSON(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// csvColumns is the flat, one-row-per-run view of a report. Keep it
+// append-only so files from older runs still line up.
+var csvColumns = []struct {
+	name  string
+	value func(r runReport) string
+}{
+	{"started_at", func(r runReport) string { return r.StartedAt.Format(time.RFC3339) }},
+	{"backend", func(r runReport) string { return r.Config.Backend }},
+	{"seed", func(r runReport) string { return strconv.FormatInt(r.Config.Generator.Seed, 10) }},
+	{"generators", func(r runReport) string { return strconv.Itoa(r.Config.Generator.Count) }},
+	{"target_rate", func(r runReport) string { return formatFloat(r.Config.Generator.Rate) }},
+	{"arrivals", func(r runReport) string { return r.Config.Generator.Arrivals }},
+	{"buffer", func(r runReport) string { return strconv.Itoa(r.Config.Generator.Buffer) }},
+	{"overflow", func(r runReport) string { return r.Config.Generator.Overflow }},
+	{"writers", func(r runReport) string { return strconv.Itoa(r.Config.Writer.Count) }},
+	{"write_batch", func(r runReport) string { return strconv.Itoa(r.Config.Writer.BatchSize) }},
+	{"processors", func(r runReport) string { return strconv.Itoa(r.Config.Processor.Count) }},
+	{"process_mode", func(r runReport) string { return r.Config.Processor.Mode }},
+	{"batch_size", func(r runReport) string { return strconv.Itoa(r.Config.Processor.BatchSize) }},
+	{"uptime_seconds", func(r runReport) string { return formatFloat(r.Metrics.Uptime) }},
+	{"events", func(r runReport) string { return strconv.Itoa(r.Metrics.EventsGenerated) }},
+	{"posts", func(r runReport) string { return strconv.Itoa(r.Metrics.ByType[event.Post]) }},
+	{"comments", func(r runReport) string { return strconv.Itoa(r.Metrics.ByType[event.Comment]) }},
+	{"upvotes", func(r runReport) string { return strconv.Itoa(r.Metrics.ByType[event.Upvote]) }},
+	{"downvotes", func(r runReport) string { return strconv.Itoa(r.Metrics.ByType[event.Downvote]) }},
+	{"dropped", func(r runReport) string { return strconv.Itoa(r.Metrics.Dropped) }},
+	{"writes", func(r runReport) string { return strconv.Itoa(r.Metrics.Writes) }},
+	{"processed", func(r runReport) string { return strconv.Itoa(r.Metrics.Processed) }},
+	{"events_per_sec", func(r runReport) string { return formatFloat(r.Metrics.EventsPerSec) }},
+	{"writes_per_sec", func(r runReport) string { return formatFloat(r.Metrics.WritesPerSec) }},
+	{"processed_per_sec", func(r runReport) string { return formatFloat(r.Metrics.ProcessedPerSec) }},
+	{"write_p50_ms", latencyColumn(OpWrite, 50)},
+	{"write_p95_ms", latencyColumn(OpWrite, 95)},
+	{"write_p99_ms", latencyColumn(OpWrite, 99)},
+	{"read_p50_ms", latencyColumn(OpRead, 50)},
+	{"read_p95_ms", latencyColumn(OpRead, 95)},
+	{"read_p99_ms", latencyColumn(OpRead, 99)},
+	{"update_p50_ms", latencyColumn(OpUpdate, 50)},
+	{"update_p95_ms", latencyColumn(OpUpdate, 95)},
+	{"update_p99_ms", latencyColumn(OpUpdate, 99)},
+	{"scenario", func(r runReport) string { return r.Config.Scenario }},
+	{"phases", func(r runReport) string { return strconv.Itoa(len(r.Metrics.Scenario.Phases)) }},
+	{"payload_bytes", func(r runReport) string { return r.Config.Content.PayloadBytes.String() }},
+	{"avg_payload_bytes", func(r runReport) string {
+		if r.Metrics.EventsGenerated == 0 {
+			return "0"
+		}
+		return strconv.Itoa(r.Metrics.PayloadBytes / r.Metrics.EventsGenerated)
+	}},
+	{"prepared", func(r runReport) string { return strconv.FormatBool(r.Config.Prepare) }},
+	{"driver", func(r runReport) string { return r.Config.Driver }},
+	{"posts_per_sec", typeColumn(event.Post, false)},
+	{"post_wait_p99_ms", typeColumn(event.Post, true)},
+	{"comments_per_sec", typeColumn(event.Comment, false)},
+	{"comment_wait_p99_ms", typeColumn(event.Comment, true)},
+	{"upvotes_per_sec", typeColumn(event.Upvote, false)},
+	{"upvote_wait_p99_ms", typeColumn(event.Upvote, true)},
+	{"downvotes_per_sec", typeColumn(event.Downvote, false)},
+	{"downvote_wait_p99_ms", typeColumn(event.Downvote, true)},
+}
+
+func latencyColumn(op string, p int) func(r runReport) string {
+	return func(r runReport) string {
+		l := r.Metrics.Latency[op]
+		d := map[int]time.Duration{50: l.P50, 95: l.P95, 99: l.P99}[p]
+		return formatFloat(float64(d) / float64(time.Millisecond))
+	}
+}
+
+// typeColumn is an event type's events/second, or with wait its p99 time
+// from generation to processing.
+func typeColumn(t event.Type, wait bool) func(r runReport) string {
+	return func(r runReport) string {
+		for _, ts := range r.Metrics.Types {
+			if ts.Type != t.String() {
+				continue
+			}
+			if wait {
+				return formatFloat(float64(ts.Wait.P99) / float64(time.Millisecond))
+			}
+			return formatFloat(ts.EventsPerSec)
+		}
+		return "0"
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// appendCSV adds the report as one row to path, writing the header first
+// if the file is new, so repeated runs build up a comparison table.
+func (r runReport) appendCSV(path string) error {
+	_, err := os.Stat(path)
+	header := errors.Is(err, fs.ErrNotExist)
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	row := make([]string, len(csvColumns))
+	if header {
+		for i, c := range csvColumns {
+			row[i] = c.name
+		}
+		w.Write(row)
+	}
+	for i, c := range csvColumns {
+		row[i] = c.value(r)
+	}
+	w.Write(row)
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// RoundLatency trims a latency to three significant-ish digits for display.
+func RoundLatency(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(10 * time.Microsecond)
+	default:
+		return d.Round(time.Microsecond)
+	}
+}
@@ -0,0 +1,17 @@
+package simulator
+
+import (
+	"context"
+
+	"web-traffic-sim/store"
+)
+
+// resumeStore is implemented by stores that keep their events from one
+// run to the next, which a run can then carry on from.
+type resumeStore interface {
+	// Resume returns up to posts and comments of the most recently
+	// created posts and comments, newest first, and how many stored events
+	// at each priority are waiting to be processed. Events an earlier run
+	// claimed but never finished are handed out again.
+	Resume(ctx context.Context, posts, comments int) (store.Resumed, error)
+}
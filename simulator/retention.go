@@ -0,0 +1,133 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// retentionStore is implemented by stores that can remove expired events.
+type retentionStore interface {
+	// ExpireEvents removes up to limit processed events stored more than
+	// age ago, oldest first, and returns how many it removed; with
+	// exported, only ones already exported. With archive set it archives
+	// them first, and removes none if that fails.
+	ExpireEvents(ctx context.Context, age time.Duration, limit int, exported bool, archive store.ArchiveFunc) (int, error)
+}
+
+// partitionExpirer is implemented by stores that can remove expired events
+// a whole time partition at a time.
+type partitionExpirer interface {
+	// ExpirePartitions drops the partitions that ended more than age ago
+	// and hold no unprocessed events - with exported, no unexported ones
+	// either - archiving each first if archive is set, and returns their
+	// names.
+	ExpirePartitions(ctx context.Context, age time.Duration, exported bool, archive store.ArchiveFunc) ([]string, error)
+}
+
+// retentionStats tracks the retention job.
+type retentionStats struct {
+	runs    int
+	lastRun time.Duration
+	// Events deleted and partitions dropped
+	deleted    *metrics.Counter
+	partitions *metrics.Counter
+	// Archive files written, the events in them and their compressed size,
+	// and archives that failed
+	archives      *metrics.Counter
+	archived      *metrics.Counter
+	archiveBytes  *metrics.Counter
+	archiveFailed *metrics.Counter
+}
+
+func (s *retentionStats) register(reg *metrics.Registry) {
+	s.deleted = reg.Counter("redditsim_retention_deleted_total", "Expired events deleted by the retention job.")
+	s.partitions = reg.Counter("redditsim_retention_partitions_dropped_total", "Expired partitions dropped by the retention job.")
+	s.archives = reg.Counter("redditsim_archives_total", "Archive files of expired events written.")
+	s.archived = reg.Counter("redditsim_archived_events_total", "Expired events archived before they were removed.")
+	s.archiveBytes = reg.Counter("redditsim_archive_bytes_total", "Compressed bytes of event archives written.")
+	s.archiveFailed = reg.Counter("redditsim_archive_failures_total", "Event archives that failed, leaving their events in place.")
+}
+
+type retentionSnapshot struct {
+	Runs          int           `json:"runs"`
+	LastRun       time.Duration `json:"last_run_ns"`
+	Deleted       int           `json:"deleted"`
+	Partitions    int           `json:"partitions_dropped"`
+	Archives      int           `json:"archives"`
+	Archived      int           `json:"archived"`
+	ArchiveBytes  int64         `json:"archive_bytes"`
+	ArchiveFailed int           `json:"archive_failed"`
+}
+
+// retentionArchive returns the store.ArchiveFunc that writes expired events to
+// dest before they're removed, or nil without a dest. Archives are named
+// after the run they come from, so the files of a run whose schema was
+// recreated don't overwrite the last one's.
+func retentionArchive(ctx context.Context, dest archiveDest, metrics *RedditMetrics) store.ArchiveFunc {
+	if dest == nil {
+		return nil
+	}
+	run := runStamp(time.Now())
+	return func(name string, each func(emit func(event.Event) error) error) error {
+		events, size, err := writeArchive(ctx, dest, run+"/"+name+archiveExt[config.FormatNDJSON], config.FormatNDJSON, each)
+		if err != nil {
+			metrics.retention.archiveFailed.Inc()
+		} else {
+			metrics.retention.archives.Inc()
+			metrics.retention.archived.Add(events)
+			metrics.retention.archiveBytes.Add(int(size))
+		}
+		return err
+	}
+}
+
+// Removes expired events - the retention job, which the scheduler runs
+// every -retention-interval. Only the leader removes them. ps is only
+// used, and only needs to be set, for the drop method.
+func expireEvents(ctx context.Context, rs retentionStore, ps partitionExpirer, r config.Retention, exporting bool, archive store.ArchiveFunc, metrics *RedditMetrics) error {
+	if !metrics.leading() {
+		return nil
+	}
+	start := time.Now()
+	deleted, dropped := 0, 0
+	var err error
+	if r.Method == config.RetentionDrop {
+		var names []string
+		names, err = ps.ExpirePartitions(ctx, r.Age, exporting, archive)
+		if err != nil {
+			err = fmt.Errorf("expire partitions: %w", err)
+		}
+		for _, name := range names {
+			slog.Info("dropped expired partition", "partition", name)
+		}
+		dropped = len(names)
+	} else {
+		// Batch after batch until the expired events run out
+		for {
+			var n int
+			n, err = rs.ExpireEvents(ctx, r.Age, r.Batch, exporting, archive)
+			deleted += n
+			if err != nil {
+				err = fmt.Errorf("expire events: %w", err)
+			}
+			if err != nil || n < r.Batch {
+				break
+			}
+		}
+	}
+
+	metrics.retention.deleted.Add(deleted)
+	metrics.retention.partitions.Add(dropped)
+	metrics.mutex.Lock()
+	metrics.retention.runs++
+	metrics.retention.lastRun = time.Since(start)
+	metrics.mutex.Unlock()
+	return err
+}
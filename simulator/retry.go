@@ -0,0 +1,145 @@
+package simulator
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// retryStats tracks the store calls retryStore retried, by op, and how
+// many still failed after the last attempt.
+type retryStats struct {
+	byOp      map[string]*metrics.Counter
+	exhausted *metrics.Counter
+}
+
+func (s *retryStats) register(reg *metrics.Registry) {
+	retried := reg.CounterVec("redditsim_db_retries_total", "Store calls retried after a transient error.", "op")
+	s.byOp = map[string]*metrics.Counter{OpWrite: retried.With(OpWrite), OpRead: retried.With(OpRead)}
+	s.exhausted = reg.Counter("redditsim_db_retries_exhausted_total", "Store calls that still failed after the last retry.")
+}
+
+// maxRetryDelay caps the exponential backoff between attempts.
+const maxRetryDelay = 5 * time.Second
+
+// retryStore retries the pipeline's store calls - Insert, InsertBatch and
+// Claim - when they fail with a transient error such as a dropped
+// connection, a deadlock or a busy database, backing off exponentially with
+// jitter in between. Anything else fails straight away.
+//
+// Commit is not retried: a failed commit has already rolled the batch back,
+// and the events will be claimed again anyway.
+type retryStore struct {
+	store.Store
+	cfg     config.Retry
+	metrics *RedditMetrics
+}
+
+func newRetryStore(s store.Store, cfg config.Retry, metrics *RedditMetrics) *retryStore {
+	metrics.retries.register(metrics.registry)
+	return &retryStore{Store: s, cfg: cfg, metrics: metrics}
+}
+
+func (s *retryStore) Insert(ctx context.Context, e event.Event) error {
+	return s.do(ctx, OpWrite, func() error { return s.Store.Insert(ctx, e) })
+}
+
+func (s *retryStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	return s.do(ctx, OpWrite, func() error { return s.Store.InsertBatch(ctx, events) })
+}
+
+func (s *retryStore) Claim(ctx context.Context, limit int) (store.Batch, error) {
+	var b store.Batch
+	err := s.do(ctx, OpRead, func() error {
+		var err error
+		b, err = s.Store.Claim(ctx, limit)
+		return err
+	})
+	return b, err
+}
+
+// do runs fn up to MaxAttempts times while it fails transiently. The n-th
+// retry waits BaseDelay * 2^(n-1), shortened by up to Jitter of itself so
+// that writers which failed together don't all retry in lockstep.
+func (s *retryStore) do(ctx context.Context, op string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || !transient(err) {
+			return err
+		}
+		if attempt >= s.cfg.MaxAttempts {
+			s.metrics.retries.exhausted.Inc()
+			return err
+		}
+
+		delay := min(s.cfg.BaseDelay<<(attempt-1), maxRetryDelay)
+		delay -= time.Duration(rand.Float64() * s.cfg.Jitter * float64(delay))
+		slog.Debug("retrying store call", "op", op, "attempt", attempt, "delay", delay, "err", err)
+
+		s.metrics.retries.byOp[op].Inc()
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+// transient reports whether err is worth retrying: connection trouble, a
+// transaction the database aborted (serialization failure, deadlock),
+// server overload or a busy SQLite file, or a full memory store.
+func transient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, store.ErrFull) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	// lib/pq and, with -driver pgx, pgconn report the same SQLSTATEs
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return transientClass(string(pqErr.Code.Class()))
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return len(pgErr.Code) == 5 && transientClass(pgErr.Code[:2])
+	}
+	var liteErr *sqlite.Error
+	if errors.As(err, &liteErr) {
+		code := liteErr.Code() & 0xff // primary result code
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+	return false
+}
+
+// transientClass reports whether a PostgreSQL SQLSTATE class is worth
+// retrying.
+func transientClass(class string) bool {
+	switch class {
+	case "08", "40", "53", "57": // connection, rollback, resources, operator intervention
+		return true
+	}
+	return false
+}
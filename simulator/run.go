@@ -0,0 +1,843 @@
+// Package simulator runs the whole simulation: generators feeding the
+// event channel, writers storing batches, processors draining the
+// backlog, and the readers, jobs and servers around them, all wired up
+// from a config.Config the way the reddit-sim command does.
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/processor"
+	"web-traffic-sim/store"
+)
+
+// Run simulates the traffic s's config describes until ctx is done or its
+// duration has passed, then drains what's in flight and prints how it
+// went.
+func (s *Simulator) Run(ctx context.Context) error {
+	cfg, dash := s.cfg, s.dash
+	var scenario *config.Scenario
+	if cfg.Scenario != "" {
+		var err error
+		if scenario, err = config.LoadScenario(cfg.Scenario); err != nil {
+			return err
+		}
+		if cfg.Sink == config.SinkKafka && scenario.HasFault(config.FaultDBDown) {
+			return fmt.Errorf("%s: fault %s needs a store, and -sink kafka has none", cfg.Scenario, config.FaultDBDown)
+		}
+		cfg.Duration = scenario.Duration()
+	}
+	subreddits, err := generator.NewCatalog(cfg.Generator)
+	if err != nil {
+		return err
+	}
+	stages, err := configStages(cfg, "writer.stages", cfg.Writer.Stages)
+	if err != nil {
+		return err
+	}
+	processStages, err := configStages(cfg, "processor.stages", cfg.Processor.Stages)
+	if err != nil {
+		return err
+	}
+	logFile, err := setupLogging(cfg.Log)
+	if err != nil {
+		return err
+	}
+	defer logFile.Close()
+	slog.Info("starting simulation", "backend", cfg.Backend, "rate", cfg.Generator.Rate, "duration", cfg.Duration.String())
+
+	if cfg.Tracing.Endpoint != "" {
+		shutdown, err := setupTracing(context.Background(), cfg.Tracing)
+		if err != nil {
+			slog.Error("set up tracing", "endpoint", cfg.Tracing.Endpoint, "err", err)
+			return err
+		}
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := shutdown(shutdownCtx); err != nil {
+				slog.Error("flush traces", "err", err)
+			}
+		}()
+	}
+
+	if cfg.Generator.Seed == 0 {
+		cfg.Generator.Seed = time.Now().UnixNano()
+	}
+
+	var archive, export archiveDest
+	if cfg.Retention.Archive != "" {
+		archive, err = newArchiveDest(cfg.Retention.Archive, cfg.S3)
+		if err != nil {
+			return err
+		}
+	}
+	if cfg.Export.Dest != "" {
+		export, err = newArchiveDest(cfg.Export.Dest, cfg.S3)
+		if err != nil {
+			return err
+		}
+	}
+
+	var exporters []metrics.Exporter
+	if cfg.Metrics.StatsD != "" {
+		sd, err := metrics.NewStatsdExporter(cfg.Metrics.StatsD)
+		if err != nil {
+			return err
+		}
+		exporters = append(exporters, sd)
+	}
+	if cfg.Metrics.Dump != "" {
+		exporters = append(exporters, metrics.JSONDumpExporter{Path: cfg.Metrics.Dump})
+	}
+
+	// Stop when ctx is, after the demo duration, or when the dashboard
+	// is quit, whichever comes first
+	ctx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	// The pauses between startup steps are there to watch it happen;
+	// headless, no one is
+	pause := func(d time.Duration) {
+		if !cfg.Visualizer.Headless {
+			time.Sleep(d)
+		}
+	}
+
+	fmt.Println("🚀 Starting Go Concurrency Demo")
+	fmt.Println("Watch how Go handles multiple operations in parallel...")
+	fmt.Println("(press Ctrl+C at any time to stop)")
+	pause(2 * time.Second)
+
+	// Step 2: Setup Database
+	var backend store.Store
+	if s.store != nil {
+		fmt.Println("\n1️⃣  Using the store given...")
+		backend = s.store
+	} else {
+		fmt.Printf("\n1️⃣  Connecting to %s...\n", SinkName(cfg))
+		if cfg.Sink != config.SinkKafka {
+			backend, err = connectStore(ctx, cfg)
+			if err != nil {
+				slog.Error("open store", "backend", cfg.Backend, "err", err)
+				return err
+			}
+			defer backend.Close()
+		}
+	}
+	// A store peers can share registers this instance before it writes
+	// anything, so a clash of names stops it before it gets going
+	is, shared := backend.(instanceStore)
+	self := newInstance(cfg.Instance.Name)
+	if shared {
+		if err := is.Register(ctx, self, instanceStale*cfg.Instance.Heartbeat); err != nil {
+			slog.Error("register instance", "instance", self.Name, "err", err)
+			return err
+		}
+		if cfg.Instance.Join {
+			fmt.Printf("     Joined as instance %s\n", self.Name)
+		}
+	}
+	var resume store.Resumed
+	if rs, ok := backend.(resumeStore); ok && cfg.Resume {
+		resume, err = rs.Resume(ctx, generator.RecentPosts, generator.RecentComments)
+		if err != nil {
+			slog.Error("resume", "backend", cfg.Backend, "err", err)
+			return err
+		}
+		if len(resume.Posts) > 0 || resume.Backlog() > 0 {
+			fmt.Printf("     Resuming: %d posts and %d comments to build on, %d events waiting to be processed\n",
+				len(resume.Posts), len(resume.Comments), resume.Backlog())
+		}
+	}
+	pause(1 * time.Second)
+
+	// Step 3: Initialize channels and metrics
+	fmt.Println("2️⃣  Initializing communication channels...")
+	eventChan := make(chan event.Event, cfg.Generator.Buffer)
+	processors := cfg.Processor.Count
+	if backend == nil {
+		processors = 0
+	}
+	// Stateful users replace the generators, and take over their random
+	// streams
+	generatorCount, streams := cfg.Generator.Count, cfg.Generator.Count
+	if len(s.sources) > 0 {
+		generatorCount = len(s.sources)
+	}
+	if cfg.Actors.Count > 0 {
+		generatorCount, streams = 0, cfg.Actors.Count
+	}
+	// A replay takes the place of all of them, moderator, viral spikes and
+	// Reddit ingest included: what they sent is in the recording. So does
+	// a dump, which has real activity in it instead
+	replaying := cfg.Replay.File != "" || cfg.Dump.Files != ""
+	if replaying {
+		generatorCount = 1
+	}
+	// One loop does the generating, writing and processing in sequential
+	// mode, and counts as one of each
+	sequential := cfg.Mode == config.ModeSequential
+	writerCount := cfg.Writer.Count
+	if sequential {
+		generatorCount, streams, writerCount, processors = 1, 1, 1, min(processors, 1)
+	}
+	metrics := newRedditMetrics(generatorCount, writerCount, processors, cfg.Visualizer.RateWindow)
+	metrics.actors = cfg.Actors.Count
+	metrics.subreddits = subreddits
+	metrics.channelDepth = func() int { return len(eventChan) }
+	// The backlog resumed counts as stored; a peer's is its own to count
+	if !cfg.Instance.Join {
+		for p, n := range resume.Pending {
+			metrics.byPriority[p].stored.Add(n)
+		}
+	}
+	if dd, ok := backend.(deduplicator); ok {
+		metrics.duplicates = dd.Duplicates
+		metrics.registry.CounterFunc("redditsim_duplicates_rejected_total", "Redelivered events the store recognised by idempotency key and skipped.", func() float64 {
+			return float64(dd.Duplicates())
+		})
+	}
+	if ls, ok := backend.(lossyStore); ok {
+		metrics.registry.CounterFunc("redditsim_events_lost_total", "Claimed events the store dropped because a rollback had no room to put them back.", func() float64 {
+			return float64(ls.Lost())
+		})
+	}
+	if ps, ok := backend.(poolStater); ok {
+		metrics.poolStats = ps.PoolStats
+		registerPool(metrics.registry, ps.PoolStats)
+	}
+	if shared {
+		metrics.cluster.register(metrics.registry, self.Name)
+	}
+	ls, electing := backend.(leaderStore)
+	if electing {
+		metrics.leader.register(metrics.registry)
+	}
+	if cfg.Outbox.Enabled {
+		metrics.outbox.register(metrics.registry)
+	}
+	if scenario != nil {
+		metrics.scenario.total = len(scenario.Phases)
+	}
+	hose := newFirehose(cfg.HTTP.FirehoseBuffer, metrics)
+	var monkey *chaos
+	if cfg.Chaos.Enabled {
+		// Its own stream after the generators' and the viral simulator's
+		monkey = newChaos(cfg.Chaos, cfg.Generator.Seed+int64(streams)+1, metrics)
+	}
+	ctl := newControls(cfg, metrics)
+	var rec *recorder
+	if cfg.Record != "" {
+		if rec, err = newRecorder(cfg.Record); err != nil {
+			return err
+		}
+		defer func() {
+			if err := rec.Close(); err != nil {
+				slog.Error("record events", "file", cfg.Record, "err", err)
+			}
+		}()
+	}
+	// A replay or dump has been through whatever limits it met already
+	var limits *rateLimits
+	if !replaying {
+		limits = newRateLimits(cfg.RateLimit, metrics)
+	}
+	var det *detector
+	if cfg.Detect.Enabled {
+		det = newDetector(cfg.Detect, metrics)
+	}
+	// The moderator is a goroutine of its own, so there is none in
+	// sequential mode
+	var mod *modQueue
+	if !sequential && !replaying {
+		mod = newModQueue(cfg.Moderation, metrics)
+	}
+	queue := newEventQueue(eventChan, cfg.Generator.Overflow, hose, ctl, monkey, rec, limits, det, mod, metrics)
+	// The pipeline's own store calls ride out transient errors and stop
+	// once the store keeps failing; store itself stays unwrapped for the
+	// optional interfaces below
+	var pipeline store.Store
+	var faults *faultStore
+	if backend != nil {
+		pipeline = backend
+		if monkey != nil {
+			pipeline = &chaosStore{Store: backend, c: monkey}
+		}
+		if scenario != nil {
+			faults = &faultStore{Store: pipeline}
+			pipeline = faults
+		}
+		pipeline = newRetryStore(pipeline, cfg.Retry, metrics)
+		if cfg.Breaker.Threshold > 0 {
+			pipeline = newBreakerStore(pipeline, cfg.Breaker.Threshold, cfg.Breaker.Cooldown, metrics)
+		}
+	}
+	if enricher := newEnricher(cfg.Enrich, cfg.Generator.Seed, metrics); enricher != nil {
+		stages = append([]Middleware{enricher}, stages...)
+	}
+	if filter := newFilter(cfg.Filter, cfg.Generator.Seed, metrics); filter != nil {
+		stages = append([]Middleware{filter}, stages...)
+	}
+	dest := destination{store: pipeline, sinks: s.sinks, stages: append(stages, s.middleware...)}
+	process := processChain(append(processStages, s.processing...))
+	if len(s.sinks) > 0 {
+		dest.sinkFailures = metrics.registry.Counter("redditsim_sink_failures_total", "Batches a sink given to the simulator failed to write.")
+	}
+	if cfg.Sink != config.SinkStore {
+		dest.sink = newKafkaSink(cfg.Kafka, metrics)
+		defer dest.sink.Close()
+	}
+	if cfg.Parquet.Dir != "" {
+		dest.mirror, err = newParquetMirror(cfg.Parquet, metrics)
+		if err != nil {
+			return err
+		}
+		defer dest.mirror.Close()
+	}
+	if cfg.ClickHouse.URL != "" {
+		dest.click, err = newClickHouseSink(ctx, cfg.ClickHouse, metrics)
+		if err != nil {
+			return err
+		}
+		defer dest.click.Close()
+	}
+	dlq := newDeadLetterQueue(cfg.DLQ, metrics)
+	var hook *webhook
+	if cfg.Webhook.URL != "" && backend != nil {
+		hook = newWebhook(cfg.Webhook, metrics)
+	}
+	// The read path - the readers and /graphql - goes through the cache
+	// if there is one
+	querier, _ := backend.(graphQuerier)
+	var cache readCache
+	if querier != nil && cfg.Cache.Backend != config.CacheNone {
+		if cache, err = newReadCache(cfg.Cache, metrics); err != nil {
+			return err
+		}
+		defer cache.Close()
+		querier = &cachedQuerier{q: querier, cache: cache, metrics: metrics}
+	}
+	pause(1 * time.Second)
+
+	// Run for the configured duration unless interrupted first. A scenario
+	// ends the run itself once its last phase is over.
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if cfg.Duration > 0 && scenario == nil {
+		runCtx, cancel = context.WithTimeout(ctx, cfg.Duration)
+	} else {
+		runCtx, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
+
+	// Writers and processors run in pools the controls can resize; the
+	// writer pool is waited for last, since the writers must outlive the
+	// generators to drain the channel before the database is closed.
+	var workers sync.WaitGroup
+
+	// Step 4: Launch goroutines
+	fmt.Println("3️⃣  Launching goroutines...")
+	var generators sync.WaitGroup
+	// Each generator gets its own source derived from the seed, so the
+	// stream is reproducible without them contending on a shared one
+	var reports float64
+	if mod != nil {
+		reports = cfg.Moderation.Reports
+	}
+	w := generator.NewWorld(subreddits, generator.NewTextGen(cfg.Content), reports)
+	w.Posts.Restore(resume.Posts)
+	w.Comments.Restore(resume.Comments)
+	if sequential {
+		fmt.Println("     • Sequential Loop (generate → store → process, one at a time)")
+		rng := generator.NewRandSource(cfg.Generator.Seed, cfg.Generator)
+		a := generator.NewArrivals(rng.Rand, ctl.Rate, cfg.Generator.Arrivals)
+		var seqStore store.Store
+		if backend != nil {
+			seqStore = pipeline
+		}
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			runSequential(runCtx, a, rng, w, queue, dest, seqStore, ctl, cfg.Writer.FlushInterval, cfg.Outbox.Enabled, process, hook, dlq, metrics)
+		}()
+	} else if cfg.Dump.Files != "" {
+		fmt.Printf("     • Dump Loader of %s\n", cfg.Dump.Files)
+		metrics.dump.register(metrics.registry)
+		rng := generator.NewRandSource(cfg.Generator.Seed, cfg.Generator)
+		a := generator.NewArrivals(rng.Rand, ctl.Rate, cfg.Generator.Arrivals)
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			loadDump(runCtx, cfg.Dump, a, rng, queue, cancel, metrics)
+		}()
+	} else if replaying {
+		fmt.Printf("     • Replay of %s\n", cfg.Replay.File)
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			replayEvents(runCtx, cfg.Replay, queue, cancel, metrics)
+		}()
+	} else if cfg.Actors.Count > 0 {
+		fmt.Printf("     • User Actor x%d\n", cfg.Actors.Count)
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			runActors(runCtx, cfg, ctl, w, queue, metrics)
+		}()
+	} else if len(s.sources) > 0 {
+		fmt.Printf("     • Event Source x%d\n", generatorCount)
+		for i, src := range s.sources {
+			generators.Add(1)
+			go func() {
+				defer generators.Done()
+				generateEvents(runCtx, i, src, queue, metrics)
+			}()
+		}
+	} else {
+		fmt.Printf("     • Event Generator x%d\n", generatorCount)
+		share := func() float64 { return ctl.Rate() / float64(generatorCount) }
+		for i := range generatorCount {
+			rng := generator.NewRandSource(cfg.Generator.Seed+int64(i), cfg.Generator)
+			a := generator.NewArrivals(rng.Rand, share, cfg.Generator.Arrivals)
+			generators.Add(1)
+			go func() {
+				defer generators.Done()
+				generateEvents(runCtx, i, generator.NewRandom(a, rng, w), queue, metrics)
+			}()
+		}
+	}
+	if cfg.Viral.Enabled && !replaying {
+		fmt.Println("     • Viral Post Simulator")
+		rng := generator.NewRandSource(cfg.Generator.Seed+int64(streams), cfg.Generator)
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			simulateViral(runCtx, cfg.Viral, cfg.Generator.Arrivals, rng, w, queue, metrics)
+		}()
+	}
+	if cfg.Reddit.Subreddits != "" && !replaying {
+		fmt.Printf("     • Reddit Ingest of r/%s\n", cfg.Reddit.Subreddits)
+		metrics.reddit.register(metrics.registry)
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			ingestReddit(runCtx, cfg.Reddit, w, queue, metrics)
+		}()
+	}
+	if mod != nil {
+		fmt.Println("     • Moderator")
+		generators.Add(1)
+		go func() {
+			defer generators.Done()
+			moderate(runCtx, mod, cfg.Generator.Seed+int64(streams)+3, queue, metrics)
+		}()
+	}
+	if det != nil {
+		fmt.Println("     • Anomaly Detector")
+		fs, _ := backend.(flagStore)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			det.run(runCtx, fs)
+		}()
+	}
+	if monkey != nil {
+		fmt.Println("     • Chaos Monkey")
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			monkey.stallGenerators(runCtx)
+		}()
+	}
+	// Close the channel once every generator has stopped sending
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		generators.Wait()
+		close(eventChan)
+	}()
+	pause(500 * time.Millisecond)
+
+	ctl.writers = newWorkerPool(func(id int, quit <-chan struct{}) {
+		storeEvents(id, dest, eventChan, quit, ctl.writeBatchSize, cfg.Writer.FlushInterval, dlq, metrics)
+	})
+	if !sequential {
+		fmt.Printf("     • Database Writer x%d\n", cfg.Writer.Count)
+		ctl.writers.resize(cfg.Writer.Count)
+	}
+	if cfg.DLQ.MaxRetries > 0 {
+		fmt.Println("     • Dead-Letter Retrier")
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			retryDeadLetters(runCtx, dlq, dest, cfg.Writer.BatchSize)
+		}()
+	}
+	pause(500 * time.Millisecond)
+
+	// Events that only went to Kafka are someone else's to process
+	if backend != nil && !sequential {
+		fmt.Printf("     • Event Processor x%d\n", cfg.Processor.Count)
+		// In notify mode every processor gets its own subscription, so a
+		// single notification wakes all of them to compete for the batch.
+		// Subscriptions last the whole run; a processor that reuses the id
+		// of a retired one takes over its subscription.
+		var notify notifier
+		if cfg.Processor.Mode == config.ProcessNotify {
+			var ok bool
+			if notify, ok = backend.(notifier); !ok {
+				slog.Error("notify mode unsupported", "backend", cfg.Backend)
+				return fmt.Errorf("%s does not support notify mode", BackendName(cfg))
+			}
+		}
+		var wakesMu sync.Mutex
+		var wakes []<-chan struct{}
+		subscribe := func(id int) (<-chan struct{}, error) {
+			if notify == nil {
+				return nil, nil
+			}
+			wakesMu.Lock()
+			defer wakesMu.Unlock()
+			for len(wakes) <= id {
+				wake, err := notify.Notify(runCtx)
+				if err != nil {
+					return nil, err
+				}
+				wakes = append(wakes, wake)
+			}
+			return wakes[id], nil
+		}
+		// Subscribe the initial processors up front, so a failure stops the run
+		if _, err := subscribe(cfg.Processor.Count - 1); err != nil {
+			slog.Error("subscribe to notifications", "err", err)
+			return err
+		}
+
+		ctl.processors = newWorkerPool(func(id int, quit <-chan struct{}) {
+			wake, err := subscribe(id)
+			if err != nil {
+				slog.Error("subscribe to notifications", "processor", id, "err", err)
+				return
+			}
+			processor.Run(runCtx, id, pipeline, cfg.Processor.Interval, ctl.processBatchSize, cfg.Outbox.Enabled, process, wake, quit, processorObserver{hook, metrics})
+		})
+		ctl.processors.resize(cfg.Processor.Count)
+	}
+	pause(500 * time.Millisecond)
+
+	if processors > 0 {
+		metrics.lag.register(metrics.registry)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			watchLag(runCtx, cfg.Processor.LagAlert, metrics)
+		}()
+	}
+
+	if querier != nil && cfg.Reads.Ratio > 0 {
+		fmt.Printf("     • Reader x%d\n", cfg.Reads.Readers)
+		metrics.reads = registerReads(metrics.registry)
+		share := func() float64 { return cfg.Reads.Ratio * ctl.Rate() / float64(cfg.Reads.Readers) }
+		for i := range cfg.Reads.Readers {
+			rng := generator.NewRandSource(cfg.Generator.Seed+int64(streams)+4+int64(i), cfg.Generator)
+			a := generator.NewArrivals(rng.Rand, share, cfg.Generator.Arrivals)
+			workers.Add(1)
+			go func() {
+				defer workers.Done()
+				readTraffic(runCtx, i, querier, a, rng, w, metrics)
+			}()
+		}
+	}
+
+	if cache != nil {
+		fmt.Printf("     • Read Cache (%s, entries live %v)\n", cfg.Cache.Backend, cfg.Cache.TTL)
+	}
+	if rc, ok := cache.(*redisCache); ok {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			watchCache(runCtx, rc, cfg.Visualizer.Refresh, metrics)
+		}()
+	}
+
+	if shared {
+		fmt.Printf("     • Instance Heartbeat (%s)\n", self.Name)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			heartbeat(runCtx, is, self, cfg.Instance.Heartbeat, metrics)
+		}()
+	}
+
+	if electing {
+		fmt.Println("     • Leader Election (karma, ranking and leaderboards run on the leader only)")
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			elect(runCtx, ls, cfg.Instance.Heartbeat, metrics)
+		}()
+	}
+
+	if qd, ok := backend.(queueDepther); ok {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			watchQueueDepth(runCtx, qd, cfg.Visualizer.Refresh, metrics)
+		}()
+	}
+
+	// The periodic jobs, run by one scheduler
+	sched := newScheduler(metrics)
+
+	if ks, ok := backend.(karmaStore); ok {
+		fmt.Println("     • Karma Aggregator")
+		sched.add(config.JobKarma, cfg.ScheduleFor(config.JobKarma, cfg.Karma.Interval), func(ctx context.Context) error {
+			return aggregateKarma(ctx, ks, metrics)
+		})
+	}
+
+	if lb, ok := backend.(leaderboardStore); ok {
+		fmt.Println("     • Leaderboards")
+		sched.add(config.JobLeaderboards, cfg.ScheduleFor(config.JobLeaderboards, cfg.Leaderboard.Interval), func(ctx context.Context) error {
+			return refreshLeaderboards(ctx, lb, cfg.Leaderboard.Size, metrics)
+		})
+	}
+
+	if vs, ok := backend.(viewStore); ok {
+		fmt.Println("     • Analytics Views")
+		metrics.views.register(metrics.registry)
+		sched.add(config.JobViews, cfg.ScheduleFor(config.JobViews, cfg.Views.Interval), func(ctx context.Context) error {
+			return refreshViews(ctx, vs, cfg.Views.Size, metrics)
+		})
+	}
+
+	if ps, ok := backend.(partitionStore); ok && cfg.Partition.By != config.PartitionNone {
+		fmt.Printf("     • Partition Maintenance (%s partitions)\n", cfg.Partition.By)
+		metrics.partitions.register(metrics.registry)
+		sched.addNow(config.JobPartitions, cfg.ScheduleFor(config.JobPartitions, cfg.Partition.Interval), func(ctx context.Context) error {
+			return maintainPartitions(ctx, ps, metrics)
+		})
+	}
+
+	if rs, ok := backend.(retentionStore); ok && cfg.Retention.Age > 0 {
+		ps, _ := backend.(partitionExpirer)
+		fmt.Printf("     • Retention (%s processed events after %v)\n", cfg.Retention.Method, cfg.Retention.Age)
+		metrics.retention.register(metrics.registry)
+		archiveTo := retentionArchive(runCtx, archive, metrics)
+		sched.add(config.JobRetention, cfg.ScheduleFor(config.JobRetention, cfg.Retention.Interval), func(ctx context.Context) error {
+			return expireEvents(ctx, rs, ps, cfg.Retention, cfg.Export.Dest != "", archiveTo, metrics)
+		})
+	}
+
+	if es, ok := backend.(exportStore); ok && export != nil {
+		fmt.Printf("     • Event Export to %s\n", export)
+		metrics.export.register(metrics.registry)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			exportEvents(runCtx, es, export, cfg.Export, metrics)
+		}()
+	}
+
+	if ss, ok := backend.(scoreStore); ok {
+		fmt.Println("     • Score Aggregator")
+		rng := rand.New(rand.NewSource(cfg.Generator.Seed + int64(streams) + 2))
+		sched.add(config.JobScores, cfg.ScheduleFor(config.JobScores, cfg.Scores.Interval), func(ctx context.Context) error {
+			return aggregateScores(ctx, ss, cfg.Scores.Batch, cfg.Scores.Fuzz, rng, metrics)
+		})
+	}
+
+	if ob, ok := backend.(outboxStore); ok && cfg.Outbox.Enabled {
+		fmt.Printf("     • Outbox Relay to %s\n", cfg.Outbox.Sink)
+		sink := newOutboxSink(cfg)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			defer sink.Close()
+			relayOutbox(runCtx, ob, sink, cfg.Outbox.Interval, cfg.Outbox.Batch, metrics)
+		}()
+	}
+
+	if rs, ok := backend.(rankingStore); ok {
+		fmt.Println("     • Post Ranker")
+		sched.add(config.JobRanking, cfg.ScheduleFor(config.JobRanking, cfg.Ranking.Interval), func(ctx context.Context) error {
+			return rankPosts(ctx, rs, cfg.Ranking.Sort, metrics)
+		})
+	}
+
+	if len(sched.jobs) > 0 {
+		fmt.Printf("     • Job Scheduler (%d jobs)\n", len(sched.jobs))
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			sched.run(runCtx)
+		}()
+	}
+
+	if len(exporters) > 0 {
+		fmt.Printf("     • Metrics Exporter to %s (every %v)\n", exporters, cfg.Metrics.Interval)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			metrics.registry.Push(runCtx, cfg.Metrics.Interval, exporters)
+		}()
+	}
+
+	if cfg.HTTP.Addr != "" {
+		fmt.Printf("     • HTTP Server on %s (dashboard at /, /metrics, /healthz, /readyz, /firehose, API at /events, /stats and /graphql, controls at /admin/controls)\n", cfg.HTTP.Addr)
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.registry.Handler())
+		registerAPI(mux, backend, metrics)
+		if err := registerGraphQL(mux, querier); err != nil {
+			slog.Error("build GraphQL schema", "err", err)
+		}
+		registerAdmin(mux, ctl)
+		registerHealth(mux, &health{ctx: runCtx, store: backend, sink: dest.sink, ctl: ctl, metrics: metrics, stallAfter: cfg.HTTP.StallAfter})
+		registerFirehoseSSE(runCtx, mux, hose)
+		if dash != nil {
+			dash.Register(runCtx, mux, cfg, metrics)
+		}
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			serveHTTP(runCtx, cfg.HTTP.Addr, mux)
+		}()
+	}
+
+	if cfg.GRPC.Addr != "" {
+		fmt.Printf("     • gRPC Server on %s (SubscribeEvents, GetMetrics)\n", cfg.GRPC.Addr)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			serveGRPC(runCtx, cfg.GRPC.Addr, hose, metrics)
+		}()
+	}
+
+	if cfg.HTTP.DebugAddr != "" {
+		fmt.Printf("     • pprof on %s/debug/pprof/\n", cfg.HTTP.DebugAddr)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			serveHTTP(runCtx, cfg.HTTP.DebugAddr, debugMux())
+		}()
+	}
+
+	var samples []sample
+	if cfg.Series.CSV != "" || cfg.Series.SVG != "" {
+		fmt.Println("     • Time Series Recorder")
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			samples = recordSeries(runCtx, cfg.Series.Interval, metrics)
+		}()
+	}
+
+	if scenario != nil {
+		fmt.Printf("     • Scenario Runner (%d phases, %v)\n", len(scenario.Phases), scenario.Duration())
+	}
+	if dash != nil && !cfg.Visualizer.Headless {
+		fmt.Println("     • Metrics Visualizer")
+	}
+	pause(500 * time.Millisecond)
+
+	fmt.Println("\n4️⃣  All systems running! Watch the magic happen...")
+	// The timeline starts only now, so startup doesn't eat into the first phase
+	if scenario != nil {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			runScenario(runCtx, scenario, ctl, faults, cancel, metrics)
+		}()
+	}
+	// Started last: from here on the dashboard owns the terminal
+	if dash != nil && !cfg.Visualizer.Headless {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			dash.Show(runCtx, cfg, metrics, ctl, stop)
+		}()
+	}
+
+	<-runCtx.Done()
+
+	// Cleanup: stop producers first, then let the writer flush what's left
+	if ctx.Err() != nil {
+		fmt.Println("\n🛑 Shutdown requested, draining in-flight events...")
+	}
+	workers.Wait()
+	if ctl.processors != nil {
+		ctl.processors.wait()
+	}
+	hook.Close()
+	ctl.writers.wait()
+	dest.click.Close()
+	metrics.registry.Export(exporters)
+
+	written := metrics.dbOperations.writes.Value()
+	events := metrics.eventsHandled.Value()
+	fmt.Printf("\n💾 Flushed all pending events (%d records written).\n", written)
+	if cfg.Visualizer.Summary {
+		printSummary(os.Stdout, metrics.Snapshot())
+	}
+	if n := metrics.Snapshot().DLQ.Size; n > 0 {
+		fmt.Printf("☠️  %d events could not be stored and are still in the dead-letter queue (see %s).\n", n, cfg.Log.File)
+	}
+	if cfg.Report.JSON != "" || cfg.Report.CSV != "" {
+		report := newRunReport(cfg, metrics.Snapshot())
+		if cfg.Report.JSON != "" {
+			if err := report.writeJSON(cfg.Report.JSON); err != nil {
+				slog.Error("write JSON report", "path", cfg.Report.JSON, "err", err)
+			} else {
+				fmt.Printf("📄 Report written to %s\n", cfg.Report.JSON)
+			}
+		}
+		if cfg.Report.CSV != "" {
+			if err := report.appendCSV(cfg.Report.CSV); err != nil {
+				slog.Error("write CSV report", "path", cfg.Report.CSV, "err", err)
+			} else {
+				fmt.Printf("📄 Report appended to %s\n", cfg.Report.CSV)
+			}
+		}
+	}
+	if cfg.Series.CSV != "" {
+		if err := writeSeriesCSV(cfg.Series.CSV, samples); err != nil {
+			slog.Error("write time series", "path", cfg.Series.CSV, "err", err)
+		} else {
+			fmt.Printf("📈 Time series (%d samples) written to %s\n", len(samples), cfg.Series.CSV)
+		}
+	}
+	if cfg.Series.SVG != "" {
+		if err := writeSeriesSVG(cfg.Series.SVG, samples, metrics.Snapshot().Scenario.Phases); err != nil {
+			slog.Error("render charts", "path", cfg.Series.SVG, "err", err)
+		} else {
+			fmt.Printf("📈 Charts written to %s\n", cfg.Series.SVG)
+		}
+	}
+	slog.Info("simulation finished", "events", events, "written", written, "seed", cfg.Generator.Seed)
+	fmt.Printf("🎲 Seed %d (rerun with -seed %d to replay this event stream)\n", cfg.Generator.Seed, cfg.Generator.Seed)
+	fmt.Println("\n✨ Demo complete! This showed how Go makes concurrent programming simple and efficient.")
+	return nil
+}
+
+// Dashboard shows a run while it goes. Package dashboard has the
+// terminal and web ones.
+type Dashboard interface {
+	// Show draws the run until ctx is done, unless stop is called to end
+	// it early. It isn't called for a headless run.
+	Show(ctx context.Context, cfg *config.Config, metrics *RedditMetrics, ctl *Controls, stop func())
+	// Register adds the web dashboard's routes to mux, for the HTTP
+	// server.
+	Register(ctx context.Context, mux *http.ServeMux, cfg *config.Config, metrics *RedditMetrics)
+}
@@ -0,0 +1,71 @@
+package simulator
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"time"
+
+	"web-traffic-sim/metrics"
+)
+
+// runtimeSnapshot is the Go runtime's view of the simulator itself: how
+// many goroutines the pipeline is running and what the garbage collector
+// is doing under load.
+type runtimeSnapshot struct {
+	Goroutines int           `json:"goroutines"`
+	HeapAlloc  uint64        `json:"heap_alloc_bytes"`
+	HeapSys    uint64        `json:"heap_sys_bytes"`
+	HeapObjs   uint64        `json:"heap_objects"`
+	NumGC      uint32        `json:"num_gc"`
+	LastPause  time.Duration `json:"last_gc_pause_ns"`
+	TotalPause time.Duration `json:"total_gc_pause_ns"`
+	GCCPU      float64       `json:"gc_cpu_fraction"`
+}
+
+func readRuntime() runtimeSnapshot {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+
+	s := runtimeSnapshot{
+		Goroutines: runtime.NumGoroutine(),
+		HeapAlloc:  m.HeapAlloc,
+		HeapSys:    m.HeapSys,
+		HeapObjs:   m.HeapObjects,
+		NumGC:      m.NumGC,
+		TotalPause: time.Duration(m.PauseTotalNs),
+		GCCPU:      m.GCCPUFraction,
+	}
+	if m.NumGC > 0 {
+		s.LastPause = time.Duration(m.PauseNs[(m.NumGC+255)%256])
+	}
+	return s
+}
+
+// registerRuntime registers the runtime metrics the exporters report.
+func registerRuntime(reg *metrics.Registry) {
+	reg.GaugeFunc("redditsim_goroutines", "Goroutines currently running.", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+	reg.GaugeFunc("redditsim_heap_alloc_bytes", "Bytes of allocated heap objects.", func() float64 {
+		return float64(readRuntime().HeapAlloc)
+	})
+	reg.CounterFunc("redditsim_gc_cycles_total", "Completed GC cycles.", func() float64 {
+		return float64(readRuntime().NumGC)
+	})
+	reg.CounterFunc("redditsim_gc_pause_seconds_total", "Cumulative GC stop-the-world pause time.", func() float64 {
+		return readRuntime().TotalPause.Seconds()
+	})
+}
+
+// debugMux serves the net/http/pprof endpoints under /debug/pprof/. It is
+// kept off the public HTTP server since profiles expose internals.
+func debugMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,211 @@
+package simulator
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/store"
+)
+
+// rampStep is how often a ramping phase moves the rate.
+const rampStep = 250 * time.Millisecond
+
+// scenarioStats tracks the timeline of a -scenario run.
+type scenarioStats struct {
+	total   int
+	current int // 1-based; 0 before the first phase and after the last
+	ends    time.Time
+	phases  []phaseRecord
+}
+
+// phaseRecord is a phase that has started, with the counters at its
+// boundaries so the report can say what happened during it.
+type phaseRecord struct {
+	name, fault string
+	start, end  time.Time
+	// Counters when the phase started and when it ended
+	events, writes       int
+	endEvents, endWrites int
+}
+
+type scenarioSnapshot struct {
+	Total     int             `json:"total"`
+	Current   int             `json:"current"`
+	Remaining time.Duration   `json:"remaining_ns"`
+	Phases    []phaseSnapshot `json:"phases,omitempty"`
+}
+
+// phaseSnapshot is a phase boundary as the dashboards and reports show
+// it: offsets are seconds since the run started, and the counts cover the
+// phase alone. End is zero while the phase is running.
+type phaseSnapshot struct {
+	Name   string  `json:"name"`
+	Fault  string  `json:"fault,omitempty"`
+	Start  float64 `json:"start_seconds"`
+	End    float64 `json:"end_seconds,omitempty"`
+	Events int     `json:"events"`
+	Writes int     `json:"writes"`
+}
+
+// beginPhase closes the current phase, if any, and opens phase i of p.
+// Callers hold the metrics mutex.
+func (m *RedditMetrics) beginPhase(i int, p config.Phase, now time.Time) {
+	m.endPhase(now)
+	m.scenario.current = i + 1
+	m.scenario.ends = now.Add(p.Duration)
+	m.scenario.phases = append(m.scenario.phases, phaseRecord{
+		name:   p.Name,
+		fault:  p.Fault,
+		start:  now,
+		events: m.eventsHandled.Value(),
+		writes: m.dbOperations.writes.Value(),
+	})
+}
+
+// endPhase closes the current phase. Callers hold the metrics mutex.
+func (m *RedditMetrics) endPhase(now time.Time) {
+	if m.scenario.current == 0 {
+		return
+	}
+	p := &m.scenario.phases[len(m.scenario.phases)-1]
+	p.end = now
+	p.endEvents, p.endWrites = m.eventsHandled.Value(), m.dbOperations.writes.Value()
+	m.scenario.current = 0
+}
+
+// snapshot converts the timeline for display. Callers hold the metrics
+// mutex.
+func (s scenarioStats) snapshot(m *RedditMetrics, now time.Time) scenarioSnapshot {
+	snap := scenarioSnapshot{Total: s.total, Current: s.current}
+	if s.current > 0 {
+		snap.Remaining = s.ends.Sub(now)
+	}
+	for _, p := range s.phases {
+		ps := phaseSnapshot{
+			Name:  p.name,
+			Fault: p.fault,
+			Start: p.start.Sub(m.startTime).Seconds(),
+		}
+		if p.end.IsZero() {
+			ps.Events, ps.Writes = m.eventsHandled.Value()-p.events, m.dbOperations.writes.Value()-p.writes
+		} else {
+			ps.End = p.end.Sub(m.startTime).Seconds()
+			ps.Events, ps.Writes = p.endEvents-p.events, p.endWrites-p.writes
+		}
+		snap.Phases = append(snap.Phases, ps)
+	}
+	return snap
+}
+
+// runScenario plays the phases of sc in order, turning the controls and
+// switching faults as it goes, and calls stop once the timeline is over:
+// a scenario run lasts exactly as long as its phases.
+func runScenario(ctx context.Context, sc *config.Scenario, ctl *Controls, faults *faultStore, stop func(), metrics *RedditMetrics) {
+	defer stop()
+	defer faults.set("")
+
+	for i, p := range sc.Phases {
+		now := time.Now()
+		end := now.Add(p.Duration)
+		metrics.mutex.Lock()
+		metrics.beginPhase(i, p, now)
+		metrics.mutex.Unlock()
+		slog.Info("scenario phase", "phase", p.Name, "n", i+1, "of", len(sc.Phases), "duration", p.Duration.String(), "fault", p.Fault)
+
+		err := ctl.apply(controlSettings{
+			Rate:         p.Rate,
+			Paused:       p.Paused,
+			WriteBatch:   p.WriteBatch,
+			ProcessBatch: p.ProcessBatch,
+			Writers:      p.Writers,
+			Processors:   p.Processors,
+		})
+		if err != nil {
+			slog.Error("apply scenario phase", "phase", p.Name, "err", err)
+		}
+		faults.set(p.Fault)
+
+		if !rampRate(ctx, ctl, p.RampTo, now, end) {
+			return
+		}
+	}
+
+	metrics.mutex.Lock()
+	metrics.endPhase(time.Now())
+	metrics.mutex.Unlock()
+}
+
+// rampRate waits until end, moving the rate linearly from where it is to
+// to on the way (a nil to just waits). It returns false if ctx is done
+// first.
+func rampRate(ctx context.Context, ctl *Controls, to *float64, start, end time.Time) bool {
+	from := ctl.Rate()
+	ticker := time.NewTicker(rampStep)
+	defer ticker.Stop()
+	timer := time.NewTimer(time.Until(end))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			if to != nil {
+				ctl.SetRate(*to)
+			}
+			return true
+		case now := <-ticker.C:
+			if to != nil {
+				done := float64(now.Sub(start)) / float64(end.Sub(start))
+				ctl.SetRate(from + (*to-from)*min(done, 1))
+			}
+		}
+	}
+}
+
+// errDBDown is what every store call returns during a db-down phase. It
+// wraps driver.ErrBadConn so the retries and the breaker treat it as the
+// lost connection it stands for.
+var errDBDown = fmt.Errorf("scenario %s: %w", config.FaultDBDown, driver.ErrBadConn)
+
+// faultStore is where scenario faults are injected into the pipeline. It
+// sits under the retries and the breaker, like -chaos does.
+type faultStore struct {
+	store.Store
+	down atomic.Bool
+}
+
+// set switches to the faults of a phase; "" clears them. A nil faultStore
+// ignores it.
+func (s *faultStore) set(fault string) {
+	if s != nil {
+		s.down.Store(fault == config.FaultDBDown)
+	}
+}
+
+func (s *faultStore) Insert(ctx context.Context, e event.Event) error {
+	if s.down.Load() {
+		return errDBDown
+	}
+	return s.Store.Insert(ctx, e)
+}
+
+func (s *faultStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	if s.down.Load() {
+		return errDBDown
+	}
+	return s.Store.InsertBatch(ctx, events)
+}
+
+func (s *faultStore) Claim(ctx context.Context, limit int) (store.Batch, error) {
+	if s.down.Load() {
+		return nil, errDBDown
+	}
+	return s.Store.Claim(ctx, limit)
+}
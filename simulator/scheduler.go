@@ -0,0 +1,175 @@
+package simulator
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/metrics"
+)
+
+// jobStats tracks one scheduled job. A failed run counts as a run too.
+type jobStats struct {
+	name     string
+	schedule string
+	runs     *metrics.Counter
+	failures *metrics.Counter
+	running  bool
+	lastRun  time.Time // when the last run started
+	lastTook time.Duration
+	lastErr  string // the last run's error, if it failed
+	next     time.Time
+	// lastRun and lastTook, for the exporters
+	started, took *metrics.Gauge
+}
+
+type jobSnapshot struct {
+	Name      string        `json:"name"`
+	Schedule  string        `json:"schedule"`
+	Runs      int           `json:"runs"`
+	Failures  int           `json:"failures"`
+	Running   bool          `json:"running"`
+	LastRun   time.Time     `json:"last_run"`
+	LastTook  time.Duration `json:"last_took_ns"`
+	LastError string        `json:"last_error,omitempty"`
+	Next      time.Time     `json:"next"`
+}
+
+// job is a periodic task: one pass of it, which the scheduler repeats.
+type job struct {
+	name     string
+	schedule config.Schedule
+	atStart  bool
+	run      func(ctx context.Context) error
+	stats    *jobStats
+}
+
+// scheduler runs the periodic jobs - karma, ranking, retention and the
+// like - each on its schedule, and keeps their runs, durations and errors
+// in one place. Jobs are added before run is called.
+type scheduler struct {
+	jobs    []job
+	metrics *RedditMetrics
+
+	runs, failures *metrics.CounterVec
+	started, took  *metrics.GaugeVec
+}
+
+func newScheduler(metrics *RedditMetrics) *scheduler {
+	reg := metrics.registry
+	return &scheduler{
+		metrics:  metrics,
+		runs:     reg.CounterVec("redditsim_job_runs_total", "Runs of the scheduled jobs, failed ones included.", "job"),
+		failures: reg.CounterVec("redditsim_job_failures_total", "Runs of the scheduled jobs that failed.", "job"),
+		took:     reg.GaugeVec("redditsim_job_last_duration_seconds", "How long each scheduled job's last run took.", "job"),
+		started:  reg.GaugeVec("redditsim_job_last_run_timestamp_seconds", "When each scheduled job's last run started, in Unix time.", "job"),
+	}
+}
+
+// add schedules run as name. Its first run is the schedule's first time
+// after now: an interval from now, or the cron expression's next match.
+func (s *scheduler) add(name string, schedule config.Schedule, run func(ctx context.Context) error) {
+	js := &jobStats{
+		name:     name,
+		schedule: schedule.String(),
+		runs:     s.runs.With(name),
+		failures: s.failures.With(name),
+		started:  s.started.With(name),
+		took:     s.took.With(name),
+	}
+	s.jobs = append(s.jobs, job{name: name, schedule: schedule, run: run, stats: js})
+	s.metrics.mutex.Lock()
+	s.metrics.jobs = append(s.metrics.jobs, js)
+	s.metrics.mutex.Unlock()
+}
+
+// addNow is add for a job that also runs once straight away.
+func (s *scheduler) addNow(name string, schedule config.Schedule, run func(ctx context.Context) error) {
+	s.add(name, schedule, run)
+	s.jobs[len(s.jobs)-1].atStart = true
+}
+
+// Runs the jobs until ctx is done - runs in its own goroutine, and each job
+// in one of its own, so a slow job only holds itself up. A job's next run
+// is scheduled from when its last one finished, so runs of a job never
+// overlap and one that overruns its next slot skips it.
+func (s *scheduler) run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, j := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *scheduler) loop(ctx context.Context, j job) {
+	if j.atStart {
+		s.runOnce(ctx, j)
+	}
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			return
+		}
+		s.metrics.mutex.Lock()
+		j.stats.next = next
+		s.metrics.mutex.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.runOnce(ctx, j)
+	}
+}
+
+func (s *scheduler) runOnce(ctx context.Context, j job) {
+	start := time.Now()
+	s.metrics.mutex.Lock()
+	j.stats.running = true
+	s.metrics.mutex.Unlock()
+
+	err := j.run(ctx)
+	if ctx.Err() != nil {
+		return
+	}
+	took := time.Since(start)
+	if err != nil {
+		slog.Error("job failed", "job", j.name, "took", took, "err", err)
+	}
+
+	js := j.stats
+	js.runs.Inc()
+	js.started.Set(float64(start.UnixNano()) / 1e9)
+	js.took.Set(took.Seconds())
+	s.metrics.mutex.Lock()
+	defer s.metrics.mutex.Unlock()
+	js.running = false
+	js.lastRun, js.lastTook, js.lastErr = start, took, ""
+	if err != nil {
+		js.failures.Inc()
+		js.lastErr = err.Error()
+	}
+}
+
+func (js *jobStats) snapshot() jobSnapshot {
+	return jobSnapshot{
+		Name:      js.name,
+		Schedule:  js.schedule,
+		Runs:      js.runs.Value(),
+		Failures:  js.failures.Value(),
+		Running:   js.running,
+		LastRun:   js.lastRun,
+		LastTook:  js.lastTook,
+		LastError: js.lastErr,
+		Next:      js.next,
+	}
+}
@@ -0,0 +1,84 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"web-traffic-sim/store"
+)
+
+// scoreStore is implemented by stores that keep running post scores.
+type scoreStore interface {
+	// FoldScores claims up to limit processed vote events that haven't been
+	// counted yet and adds them to their posts' scores. It returns how many
+	// votes it folded and how many score rows it upserted.
+	FoldScores(ctx context.Context, limit int) (votes, posts int, err error)
+	// TopScores returns the n highest-scoring posts, unfuzzed.
+	TopScores(ctx context.Context, n int) ([]store.ScoredPost, error)
+}
+
+// scoreStats tracks the score aggregation job. top holds the fuzzed counts,
+// as a reader would see them.
+type scoreStats struct {
+	runs    int
+	folded  int
+	upserts int
+	lastRun time.Duration
+	top     []store.ScoredPost
+}
+
+// Folds vote events into running post scores - the scores job, which the
+// scheduler runs every -score-interval. Unlike the karma job, which
+// rebuilds its table on every pass, this one is incremental: each vote is
+// counted exactly once, as an upsert that adds to the post's row, so hot
+// posts see a steady stream of conflicting writes. A pass keeps folding
+// until it has caught up. rng fuzzes the votes shown.
+func aggregateScores(ctx context.Context, store scoreStore, batch int, fuzz float64, rng *rand.Rand, metrics *RedditMetrics) error {
+	start := time.Now()
+	folded, upserts := 0, 0
+	for {
+		votes, posts, err := store.FoldScores(ctx, batch)
+		folded += votes
+		upserts += posts
+		if err != nil {
+			return fmt.Errorf("fold post scores: %w", err)
+		}
+		if votes < batch {
+			break
+		}
+	}
+	elapsed := time.Since(start)
+
+	top, err := store.TopScores(ctx, 5)
+	if err != nil {
+		return fmt.Errorf("read top scores: %w", err)
+	}
+	for i := range top {
+		top[i].Ups, top[i].Downs = fuzzVotes(rng, top[i].Ups, top[i].Downs, fuzz)
+	}
+
+	metrics.mutex.Lock()
+	metrics.scores.runs++
+	metrics.scores.folded += folded
+	metrics.scores.upserts += upserts
+	metrics.scores.lastRun = elapsed
+	metrics.scores.top = top
+	metrics.mutex.Unlock()
+	return nil
+}
+
+// fuzzVotes obscures a post's vote split the way Reddit does, so that vote
+// bots can't tell whether their votes counted: up and down both get the
+// same random amount, up to fuzz of the total, added. The score they add up
+// to stays exact.
+func fuzzVotes(r *rand.Rand, ups, downs int, fuzz float64) (int, int) {
+	k := int(math.Ceil(float64(ups+downs) * fuzz))
+	if k <= 0 {
+		return ups, downs
+	}
+	d := r.Intn(k + 1)
+	return ups + d, downs + d
+}
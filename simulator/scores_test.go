@@ -0,0 +1,43 @@
+package simulator
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestFuzzVotes(t *testing.T) {
+	tests := []struct {
+		name       string
+		ups, downs int
+		fuzz       float64
+		maxAdded   int // 0: nothing may be added
+	}{
+		{"no fuzz", 100, 20, 0, 0},
+		{"no votes", 0, 0, 0.1, 0},
+		{"a tenth", 100, 20, 0.1, 12},
+		{"rounds up", 3, 0, 0.1, 1},
+		{"all downvotes", 0, 50, 0.2, 10},
+		{"whole total", 10, 10, 1, 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			seen := make(map[int]bool)
+			for range 1000 {
+				ups, downs := fuzzVotes(r, tt.ups, tt.downs, tt.fuzz)
+				if ups-downs != tt.ups-tt.downs {
+					t.Fatalf("score %d, want %d", ups-downs, tt.ups-tt.downs)
+				}
+				added := ups - tt.ups
+				if added < 0 || added > tt.maxAdded {
+					t.Fatalf("added %d, want 0-%d", added, tt.maxAdded)
+				}
+				seen[added] = true
+			}
+			// Every amount up to the most is drawn sometimes
+			if want := tt.maxAdded + 1; len(seen) != want {
+				t.Errorf("drew %d distinct amounts, want %d", len(seen), want)
+			}
+		})
+	}
+}
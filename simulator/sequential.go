@@ -0,0 +1,76 @@
+package simulator
+
+import (
+	"context"
+	"time"
+
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+	"web-traffic-sim/processor"
+	"web-traffic-sim/store"
+)
+
+// Runs the whole pipeline in one loop - the -mode sequential baseline the
+// goroutines are measured against. Each arrival is generated and added to
+// the write batch; once the batch is full, or has waited flushInterval, it
+// is stored, and then the loop processes until there is nothing left to
+// claim before it generates again. One thing at a time, so every insert
+// and every claim holds up generation, and the loop falls behind the
+// target rate as soon as the store is slower than the arrivals.
+// store is nil when events only go to Kafka, and then nothing is
+// processed. process wraps the processing of every batch, as it does the
+// processors'. Whatever is still batched when ctx ends is stored on the way
+// out, as the writers would. The loop beats as the first generator at each event
+// and each batch it processes, so a hung insert or claim shows as a stall.
+func runSequential(ctx context.Context, a generator.Arrivals, rng *generator.RandSource, w *generator.World, queue *eventQueue, dest destination, store store.Store, ctl *Controls, flushInterval time.Duration, outbox bool, process func(processor.Handler) processor.Handler, hook *webhook, dlq *deadLetterQueue, metrics *RedditMetrics) {
+	var (
+		batch []event.Event
+		first time.Time
+	)
+	write := batchWriter(0, dest, dlq, metrics)
+	flush := func() {
+		if len(batch) > 0 {
+			write(batch)
+			batch = batch[:0]
+		}
+	}
+	defer flush()
+
+	generator.Pace(ctx, a, nil, func() bool {
+		e := generator.RandomEvent(rng, w)
+		if !queue.limits.admit(ctx, e) {
+			return ctx.Err() == nil
+		}
+		e, ok := queue.prepare(ctx, e)
+		if !ok {
+			return false
+		}
+		e.Payload = w.Text.Sized(rng.Rand, e.Payload)
+		metrics.countEvent(e)
+		metrics.generators[0].events.Inc()
+		metrics.generators[0].beat.beat()
+
+		e.Received = time.Now()
+		if len(batch) == 0 {
+			first = e.Received
+		}
+		batch = append(batch, e)
+		if len(batch) < ctl.writeBatchSize() && time.Since(first) < flushInterval {
+			return true
+		}
+		flush()
+
+		for store != nil {
+			size := ctl.processBatchSize()
+			n, err := processor.ProcessBatch(ctx, 0, store, size, outbox, process, processorObserver{hook, metrics})
+			metrics.generators[0].beat.beat()
+			if err != nil && ctx.Err() != nil {
+				return false
+			}
+			if err != nil || n < size {
+				break
+			}
+		}
+		return true
+	})
+}
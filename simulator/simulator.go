@@ -0,0 +1,96 @@
+package simulator
+
+import (
+	"context"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/store"
+)
+
+// Simulator is a run of the simulation, put together by New's options.
+// Without any it's what reddit-sim does with no flags: the default
+// config, the random generators and the store that names.
+type Simulator struct {
+	cfg        *config.Config
+	dash       Dashboard
+	store      store.Store
+	sources    []EventSource
+	sinks      []Sink
+	middleware []Middleware
+	processing []Middleware
+}
+
+// Option configures a Simulator.
+type Option func(*Simulator)
+
+// New returns a Simulator with opts applied, ready to Run.
+func New(opts ...Option) *Simulator {
+	s := &Simulator{cfg: config.Default()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// WithConfig runs the simulation cfg describes, as the flags and profile
+// do for reddit-sim. Run fills in what it picks itself, such as the seed.
+func WithConfig(cfg *config.Config) Option {
+	return func(s *Simulator) { s.cfg = cfg }
+}
+
+// WithDashboard shows the run on d while it goes, in the terminal unless
+// the config says headless, and on the HTTP server if it has one.
+func WithDashboard(d Dashboard) Option {
+	return func(s *Simulator) { s.dash = d }
+}
+
+// WithStore writes to and processes from st instead of opening the
+// config's backend. st is the caller's: Run leaves it open.
+func WithStore(st store.Store) Option {
+	return func(s *Simulator) { s.store = st }
+}
+
+// WithSource adds src to the event sources that replace the random
+// generators, each read by a generator goroutine of its own. Actors, a
+// replay, a dump and sequential mode replace them as they do the random
+// ones.
+func WithSource(src EventSource) Option {
+	return func(s *Simulator) { s.sources = append(s.sources, src) }
+}
+
+// WithSink adds sink to where the writers send their batches, besides the
+// store.
+func WithSink(sink Sink) Option {
+	return func(s *Simulator) { s.sinks = append(s.sinks, sink) }
+}
+
+// WithMiddleware adds mws to the stages the writers pass their batches
+// through, after any the config names.
+func WithMiddleware(mws ...Middleware) Option {
+	return func(s *Simulator) { s.middleware = append(s.middleware, mws...) }
+}
+
+// WithProcessMiddleware adds mws to the stages the processors process their
+// claimed batches through, after any the config names.
+func WithProcessMiddleware(mws ...Middleware) Option {
+	return func(s *Simulator) { s.processing = append(s.processing, mws...) }
+}
+
+// EventSource is where a generator gets its events: the random ones
+// (generator.Random), or anything else - a file, an HTTP endpoint, a Kafka
+// topic. An event goes through the rest of the pipeline as a random one
+// does, rate limits and the firehose included.
+type EventSource interface {
+	// Next returns the next event, blocking until it's due; a source
+	// other than the random generator sets its own pace, out of the rate
+	// controls' and scenarios' reach. io.EOF ends the source, as does any
+	// other error, which is logged. Next should return once ctx is done.
+	Next(ctx context.Context) (event.Event, error)
+}
+
+// Sink is given every batch the writers write, once the store has taken
+// it. A failure is logged and counted, and the batch stays stored.
+type Sink interface {
+	Write(ctx context.Context, batch []event.Event) error
+}
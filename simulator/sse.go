@@ -0,0 +1,75 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"web-traffic-sim/event"
+)
+
+// registerFirehoseSSE mounts GET /firehose, a Server-Sent Events stream of
+// every generated event as JSON:
+//
+//	curl -N localhost:9090/firehose?type=post
+//
+// Each client reads from its own firehose subscription, so one slow
+// client never holds up the others or the generators; if it falls too far
+// behind it gets a final "disconnected" event and the stream ends.
+func registerFirehoseSSE(ctx context.Context, mux *http.ServeMux, hose *firehose) {
+	mux.HandleFunc("GET /firehose", func(w http.ResponseWriter, r *http.Request) {
+		var want *event.Type
+		if v := r.URL.Query().Get("type"); v != "" {
+			t, err := event.ParseType(v)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, err)
+				return
+			}
+			want = &t
+		}
+
+		rc := http.NewResponseController(w)
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.WriteHeader(http.StatusOK)
+		if err := rc.Flush(); err != nil {
+			return
+		}
+
+		sub := hose.subscribe()
+		defer hose.unsubscribe(sub)
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ctx.Done():
+				fmt.Fprint(w, "event: end\ndata: simulation finished\n\n")
+				rc.Flush()
+				return
+			case e, ok := <-sub.events:
+				if !ok {
+					fmt.Fprint(w, "event: disconnected\ndata: client fell too far behind\n\n")
+					rc.Flush()
+					return
+				}
+				if want != nil && e.Type != *want {
+					continue
+				}
+				data, err := json.Marshal(e)
+				if err != nil {
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Type, data)
+				// Flush only once the backlog is drained, so a busy
+				// stream sends many events per write
+				if len(sub.events) == 0 {
+					if err := rc.Flush(); err != nil {
+						return
+					}
+				}
+			}
+		}
+	})
+}
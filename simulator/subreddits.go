@@ -0,0 +1,39 @@
+package simulator
+
+import "sort"
+
+// topSubreddits is how many subreddits the dashboard breaks activity down
+// for.
+const topSubreddits = 5
+
+type subredditSnapshot struct {
+	Name   string  `json:"name"`
+	Events int     `json:"events"`
+	Share  float64 `json:"share"`  // of all events
+	Weight float64 `json:"weight"` // share of the catalog's weight
+}
+
+// topSubredditsSnapshot returns the busiest n subreddits.
+func (m *RedditMetrics) topSubredditsSnapshot(n int) []subredditSnapshot {
+	var top []subredditSnapshot
+	for name, events := range m.trending.totals() {
+		top = append(top, subredditSnapshot{Name: name, Events: events})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Events != top[j].Events {
+			return top[i].Events > top[j].Events
+		}
+		return top[i].Name < top[j].Name
+	})
+	top = top[:min(n, len(top))]
+	total := m.eventsHandled.Value()
+	for i := range top {
+		if total > 0 {
+			top[i].Share = float64(top[i].Events) / float64(total)
+		}
+		if m.subreddits != nil {
+			top[i].Weight = m.subreddits.Share[top[i].Name]
+		}
+	}
+	return top
+}
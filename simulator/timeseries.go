@@ -0,0 +1,245 @@
+package simulator
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"web-traffic-sim/metrics"
+)
+
+// sample is one point of the recorded time series. Rates and latency
+// percentiles cover the interval since the previous sample rather than
+// the whole run, so spikes and stalls stay visible.
+type sample struct {
+	Elapsed         float64 // seconds since the run started
+	EventsPerSec    float64
+	WritesPerSec    float64
+	ProcessedPerSec float64
+	DroppedPerSec   float64
+	ChannelDepth    int
+	Backlog         int // stored events not processed yet
+	WriteP50        time.Duration
+	WriteP99        time.Duration
+	ReadP99         time.Duration
+	UpdateP99       time.Duration
+	Phase           string // -scenario phase running at the time, if any
+}
+
+// recordSeries samples the metrics every interval until ctx is done and
+// returns everything it recorded - runs in its own goroutine.
+func recordSeries(ctx context.Context, interval time.Duration, metrics *RedditMetrics) []sample {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var samples []sample
+	prev, prevTime := readCounters(metrics), time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return samples
+		case now := <-ticker.C:
+			cur := readCounters(metrics)
+			secs := now.Sub(prevTime).Seconds()
+			rate := func(a, b int) float64 { return float64(a-b) / secs }
+			samples = append(samples, sample{
+				Elapsed:         now.Sub(metrics.startTime).Seconds(),
+				EventsPerSec:    rate(cur.events, prev.events),
+				WritesPerSec:    rate(cur.writes, prev.writes),
+				ProcessedPerSec: rate(cur.processed, prev.processed),
+				DroppedPerSec:   rate(cur.dropped, prev.dropped),
+				ChannelDepth:    cur.depth,
+				Backlog:         cur.backlog,
+				WriteP50:        cur.latency[OpWrite].Since(prev.latency[OpWrite]).Quantile(0.50),
+				WriteP99:        cur.latency[OpWrite].Since(prev.latency[OpWrite]).Quantile(0.99),
+				ReadP99:         cur.latency[OpRead].Since(prev.latency[OpRead]).Quantile(0.99),
+				UpdateP99:       cur.latency[OpUpdate].Since(prev.latency[OpUpdate]).Quantile(0.99),
+				Phase:           cur.phase,
+			})
+			prev, prevTime = cur, now
+		}
+	}
+}
+
+// counters is the raw, cumulative state a sample is derived from.
+type counters struct {
+	events, writes, processed, dropped, depth int
+	backlog                                   int
+	latency                                   map[string]*metrics.LatencyHistogram
+	phase                                     string
+}
+
+func readCounters(m *RedditMetrics) counters {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	c := counters{
+		events:    m.eventsHandled.Value(),
+		writes:    m.dbOperations.writes.Value(),
+		processed: m.processed.Value(),
+		dropped:   m.dropped.Value(),
+		backlog:   m.backlog(),
+		latency:   make(map[string]*metrics.LatencyHistogram, len(m.latency)),
+	}
+	if m.channelDepth != nil {
+		c.depth = m.channelDepth()
+	}
+	if sc := m.scenario; sc.current > 0 {
+		c.phase = sc.phases[len(sc.phases)-1].name
+	}
+	for op, h := range m.latency {
+		c.latency[op] = h.Clone()
+	}
+	return c
+}
+
+var seriesHeader = []string{
+	"elapsed_seconds", "events_per_sec", "writes_per_sec", "processed_per_sec", "dropped_per_sec",
+	"channel_depth", "backlog", "write_p50_ms", "write_p99_ms", "read_p99_ms", "update_p99_ms", "phase",
+}
+
+// writeSeriesCSV writes one row per sample to path.
+func writeSeriesCSV(path string, samples []sample) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	w.Write(seriesHeader)
+	for _, s := range samples {
+		w.Write([]string{
+			formatFloat(s.Elapsed),
+			formatFloat(s.EventsPerSec),
+			formatFloat(s.WritesPerSec),
+			formatFloat(s.ProcessedPerSec),
+			formatFloat(s.DroppedPerSec),
+			strconv.Itoa(s.ChannelDepth),
+			strconv.Itoa(s.Backlog),
+			formatMs(s.WriteP50),
+			formatMs(s.WriteP99),
+			formatMs(s.ReadP99),
+			formatMs(s.UpdateP99),
+			s.Phase,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func formatMs(d time.Duration) string {
+	return formatFloat(float64(d) / float64(time.Millisecond))
+}
+
+// chart is one panel of the SVG: a few series sharing a y axis.
+type chart struct {
+	title  string
+	unit   string
+	series []chartSeries
+}
+
+type chartSeries struct {
+	name   string
+	color  string
+	values func(s sample) float64
+}
+
+var charts = []chart{
+	{"Throughput", "per second", []chartSeries{
+		{"events", "#5f5", func(s sample) float64 { return s.EventsPerSec }},
+		{"writes", "#58f", func(s sample) float64 { return s.WritesPerSec }},
+		{"processed", "#f5f", func(s sample) float64 { return s.ProcessedPerSec }},
+		{"dropped", "#f55", func(s sample) float64 { return s.DroppedPerSec }},
+	}},
+	{"Channel depth", "events", []chartSeries{
+		{"depth", "#ff5", func(s sample) float64 { return float64(s.ChannelDepth) }},
+	}},
+	{"Backlog", "events stored, not processed", []chartSeries{
+		{"backlog", "#fa5", func(s sample) float64 { return float64(s.Backlog) }},
+	}},
+	{"Latency", "ms", []chartSeries{
+		{"write p50", "#8af", func(s sample) float64 { return float64(s.WriteP50) / float64(time.Millisecond) }},
+		{"write p99", "#58f", func(s sample) float64 { return float64(s.WriteP99) / float64(time.Millisecond) }},
+		{"read p99", "#5f5", func(s sample) float64 { return float64(s.ReadP99) / float64(time.Millisecond) }},
+		{"update p99", "#f5f", func(s sample) float64 { return float64(s.UpdateP99) / float64(time.Millisecond) }},
+	}},
+}
+
+const (
+	chartWidth  = 800
+	chartHeight = 200
+	chartMargin = 50
+)
+
+// writeSeriesSVG renders the samples as stacked line charts - throughput,
+// channel depth, backlog and latency over time - in a single standalone SVG file.
+// Each chart marks where the -scenario phases began.
+func writeSeriesSVG(path string, samples []sample, phases []phaseSnapshot) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	panel := chartHeight + 2*chartMargin
+	fmt.Fprintf(f, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" font-family="monospace" font-size="12">`+"\n",
+		chartWidth+2*chartMargin, panel*len(charts))
+	fmt.Fprintf(f, `<rect width="100%%" height="100%%" fill="#111"/>`+"\n")
+	for i, c := range charts {
+		renderChart(f, c, samples, phases, i*panel)
+	}
+	fmt.Fprintln(f, "</svg>")
+	return f.Close()
+}
+
+func renderChart(w io.Writer, c chart, samples []sample, phases []phaseSnapshot, top int) {
+	x0, y0 := chartMargin, top+chartMargin
+	fmt.Fprintf(w, `<text x="%d" y="%d" fill="#5ff" font-size="14">%s (%s)</text>`+"\n", x0, y0-20, c.title, c.unit)
+	fmt.Fprintf(w, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="#444"/>`+"\n", x0, y0, chartWidth, chartHeight)
+
+	var maxX, maxY float64
+	for _, s := range samples {
+		maxX = max(maxX, s.Elapsed)
+		for _, cs := range c.series {
+			maxY = max(maxY, cs.values(s))
+		}
+	}
+	if maxX == 0 {
+		maxX = 1
+	}
+	if maxY == 0 {
+		maxY = 1
+	}
+	fmt.Fprintf(w, `<text x="%d" y="%d" fill="#888" text-anchor="end">%.4g</text>`+"\n", x0-5, y0+10, maxY)
+	fmt.Fprintf(w, `<text x="%d" y="%d" fill="#888" text-anchor="end">0</text>`+"\n", x0-5, y0+chartHeight)
+	fmt.Fprintf(w, `<text x="%d" y="%d" fill="#888" text-anchor="end">%.0fs</text>`+"\n", x0+chartWidth, y0+chartHeight+15, maxX)
+
+	for _, p := range phases {
+		if p.Start > maxX {
+			break
+		}
+		x := float64(x0) + p.Start/maxX*chartWidth
+		fmt.Fprintf(w, `<line x1="%.1f" y1="%d" x2="%.1f" y2="%d" stroke="#666" stroke-dasharray="4 3"/>`+"\n", x, y0, x, y0+chartHeight)
+		fmt.Fprintf(w, `<text x="%.1f" y="%d" fill="#aaa">%s</text>`+"\n", x+3, y0+12, html.EscapeString(p.Name))
+	}
+
+	for i, cs := range c.series {
+		fmt.Fprintf(w, `<polyline fill="none" stroke="%s" stroke-width="1.5" points="`, cs.color)
+		for _, s := range samples {
+			x := float64(x0) + s.Elapsed/maxX*chartWidth
+			y := float64(y0+chartHeight) - cs.values(s)/maxY*chartHeight
+			fmt.Fprintf(w, "%.1f,%.1f ", x, y)
+		}
+		fmt.Fprintln(w, `"/>`)
+		fmt.Fprintf(w, `<text x="%d" y="%d" fill="%s">%s</text>`+"\n", x0+10+i*110, y0+chartHeight+15, cs.color, cs.name)
+	}
+}
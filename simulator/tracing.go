@@ -0,0 +1,130 @@
+package simulator
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// Every event gets its own trace: a root "generate" span, then "channel"
+// (time spent buffered in eventChan), "insert" (the writer's flush) and
+// "process" (claim to commit) spans as children. The W3C traceparent
+// travels inside the event's JSON, so the processor can pick the trace up
+// again after the event has been through the database.
+//
+// Until setupTracing installs a provider the global one is a no-op, so
+// none of this costs anything with tracing disabled.
+var tracer = otel.Tracer("web-traffic-sim")
+
+var propagator = propagation.TraceContext{}
+
+// setupTracing exports spans over OTLP/HTTP to cfg.Endpoint (a collector,
+// or Jaeger's OTLP port). The returned function flushes buffered spans and
+// must be called before exit.
+func setupTracing(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx,
+		otlptracehttp.WithEndpointURL(cfg.Endpoint),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", "web-traffic-sim"))),
+	)
+	otel.SetTracerProvider(provider)
+	// Export failures would otherwise be printed over the dashboard
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(func(err error) {
+		slog.Warn("export traces", "err", err)
+	}))
+	return provider.Shutdown, nil
+}
+
+func eventAttrs(e event.Event) trace.SpanStartEventOption {
+	return trace.WithAttributes(
+		attribute.String("event.type", e.Type.String()),
+		attribute.String("event.user", e.User),
+		attribute.String("event.post_id", e.PostID),
+	)
+}
+
+// traceGenerated starts the event's trace and returns its traceparent, or
+// "" if the trace isn't sampled.
+func traceGenerated(e event.Event) string {
+	ctx, span := tracer.Start(context.Background(), "generate "+e.Type.String(),
+		trace.WithTimestamp(e.Timestamp),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		eventAttrs(e),
+	)
+	span.End()
+
+	if !span.SpanContext().IsSampled() {
+		return ""
+	}
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// eventContext resumes the trace carried by e.
+func eventContext(e event.Event) context.Context {
+	return propagator.Extract(context.Background(), propagation.MapCarrier{"traceparent": e.TraceParent})
+}
+
+// traceStored records the channel dwell and insert of a flushed batch.
+func traceStored(writer int, batch []event.Event, start, end time.Time, err error) {
+	for _, e := range batch {
+		if e.TraceParent == "" {
+			continue
+		}
+		ctx := eventContext(e)
+		_, dwell := tracer.Start(ctx, "channel",
+			trace.WithTimestamp(e.Timestamp),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+		)
+		dwell.End(trace.WithTimestamp(e.Received))
+
+		_, insert := tracer.Start(ctx, "insert",
+			trace.WithTimestamp(start),
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.Int("writer.id", writer), attribute.Int("batch.size", len(batch))),
+		)
+		endSpan(insert, end, err)
+	}
+}
+
+// traceProcessed records the processing of a claimed batch.
+func traceProcessed(processor int, batch []event.Event, start, end time.Time, err error) {
+	for _, e := range batch {
+		if e.TraceParent == "" {
+			continue
+		}
+		_, span := tracer.Start(eventContext(e), "process",
+			trace.WithTimestamp(start),
+			trace.WithSpanKind(trace.SpanKindConsumer),
+			trace.WithAttributes(attribute.Int("processor.id", processor), attribute.Int("batch.size", len(batch))),
+		)
+		endSpan(span, end, err)
+	}
+}
+
+func endSpan(span trace.Span, end time.Time, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
@@ -0,0 +1,132 @@
+package simulator
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"web-traffic-sim/metrics"
+)
+
+// trendingWindows are the spans each subreddit's activity is counted over,
+// shortest first. The first is what's happening now and the last the
+// baseline it's compared with.
+var trendingWindows = []time.Duration{time.Minute, 5 * time.Minute, 15 * time.Minute}
+
+// trendingBuckets is how many slices each window is counted in.
+const trendingBuckets = 60
+
+// trendingTop is how many subreddits the "Trending now" panel shows.
+const trendingTop = 5
+
+// trending counts every subreddit's events, in all and over each of
+// trendingWindows, in memory as they're generated, whatever the store does
+// with them. A subreddit is trending when its last minute beats the pace of
+// its last fifteen. Generators count without the metrics mutex: a
+// subreddit's windows have a lock of their own, so only events for the same
+// subreddit ever wait on each other.
+type trending struct {
+	subreddits sync.Map // name -> *subredditActivity
+	start      time.Time
+}
+
+type subredditActivity struct {
+	events metrics.Counter
+	// Events with no subreddit are counted but don't trend
+	trends  bool
+	mu      sync.Mutex
+	windows []slidingCount // nil while the subreddit is quiet
+}
+
+func newTrending(now time.Time) *trending {
+	return &trending{start: now}
+}
+
+func (t *trending) add(subreddit string, now time.Time) {
+	v, ok := t.subreddits.Load(subreddit)
+	if !ok {
+		v, _ = t.subreddits.LoadOrStore(subreddit, &subredditActivity{trends: subreddit != ""})
+	}
+	a := v.(*subredditActivity)
+	a.events.Inc()
+	if !a.trends {
+		return
+	}
+	a.mu.Lock()
+	if a.windows == nil {
+		a.windows = make([]slidingCount, len(trendingWindows))
+		for i, span := range trendingWindows {
+			a.windows[i] = newSlidingCount(span, trendingBuckets, now)
+		}
+	}
+	for i := range a.windows {
+		a.windows[i].add(now, 1)
+	}
+	a.mu.Unlock()
+}
+
+// totals returns every subreddit's events since the run started.
+func (t *trending) totals() map[string]int {
+	totals := make(map[string]int)
+	t.subreddits.Range(func(name, v any) bool {
+		totals[name.(string)] = v.(*subredditActivity).events.Value()
+		return true
+	})
+	return totals
+}
+
+type trendingSnapshot struct {
+	Subreddit string `json:"subreddit"`
+	// Events over each of the windows, 1m, 5m and 15m
+	Events []int `json:"events"`
+	// Expected is the events the last minute would have had at the
+	// baseline's pace, and Velocity how many times that it had.
+	Expected float64 `json:"expected"`
+	Velocity float64 `json:"velocity"`
+}
+
+// top returns the n subreddits furthest ahead of their baseline, in events
+// over the expected, and forgets the windows of those quiet for the whole
+// baseline until they're busy again. Until
+// the run is a minute old nothing can be ahead, so they're the busiest.
+func (t *trending) top(n int, now time.Time) []trendingSnapshot {
+	last := len(trendingWindows) - 1
+	// The baseline covers the run so far until it's filled
+	baseline := min(now.Sub(t.start), trendingWindows[last])
+	scale := 1.0
+	if baseline > trendingWindows[0] {
+		scale = float64(trendingWindows[0]) / float64(baseline)
+	}
+
+	var top []trendingSnapshot
+	t.subreddits.Range(func(name, v any) bool {
+		a := v.(*subredditActivity)
+		s := trendingSnapshot{Subreddit: name.(string), Events: make([]int, len(trendingWindows))}
+		a.mu.Lock()
+		for i := range a.windows {
+			s.Events[i] = a.windows[i].sum(now)
+		}
+		if s.Events[last] == 0 {
+			a.windows = nil
+		}
+		a.mu.Unlock()
+		if s.Events[last] == 0 {
+			return true
+		}
+		s.Expected = float64(s.Events[last]) * scale
+		s.Velocity = float64(s.Events[0]) / s.Expected
+		top = append(top, s)
+		return true
+	})
+	sort.Slice(top, func(i, j int) bool {
+		ai, aj := float64(top[i].Events[0])-top[i].Expected, float64(top[j].Events[0])-top[j].Expected
+		if ai != aj {
+			return ai > aj
+		}
+		if top[i].Events[0] != top[j].Events[0] {
+			return top[i].Events[0] > top[j].Events[0]
+		}
+		return top[i].Subreddit < top[j].Subreddit
+	})
+	return top[:min(n, len(top))]
+}
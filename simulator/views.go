@@ -0,0 +1,96 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// viewStore is implemented by stores with analytics views to refresh.
+type viewStore interface {
+	// RefreshView refreshes one of store.Views without locking out its
+	// readers.
+	RefreshView(ctx context.Context, view string) error
+	// Analytics reads the top n rows of each view, as last refreshed.
+	Analytics(ctx context.Context, n int) (store.Analytics, error)
+}
+
+// viewStats tracks the views job. refresh is each view's refresh time;
+// the rest is guarded by metrics.mutex.
+type viewStats struct {
+	refresh   map[string]*metrics.Histogram
+	runs      int
+	lastRun   time.Duration
+	analytics store.Analytics
+}
+
+func (s *viewStats) register(reg *metrics.Registry) {
+	refresh := reg.HistogramVec("redditsim_view_refresh_seconds", "Time to refresh each analytics view.", "view")
+	s.refresh = make(map[string]*metrics.Histogram, len(store.Views))
+	for _, view := range store.Views {
+		s.refresh[view] = refresh.With(view)
+	}
+}
+
+// viewRefresh is how long an analytics view takes to refresh.
+type viewRefresh struct {
+	View string                  `json:"view"`
+	Took metrics.LatencySnapshot `json:"took"`
+}
+
+type viewSnapshot struct {
+	Runs      int             `json:"runs"`
+	LastRun   time.Duration   `json:"last_run_ns"`
+	Refresh   []viewRefresh   `json:"refresh"`
+	Analytics store.Analytics `json:"analytics"`
+}
+
+// snapshot reads the views job's stats. metrics.mutex must be held.
+func (s viewStats) snapshot() viewSnapshot {
+	snap := viewSnapshot{Runs: s.runs, LastRun: s.lastRun, Analytics: s.analytics}
+	for _, view := range store.Views {
+		if h := s.refresh[view]; h != nil {
+			snap.Refresh = append(snap.Refresh, viewRefresh{View: view, Took: h.Snapshot()})
+		}
+	}
+	return snap
+}
+
+// Refreshes the analytics views - the views job, which the scheduler runs
+// every -views-interval. The views are the OLAP side of the OLTP event
+// stream: aggregates over the whole events table, too slow to query on
+// every page load, computed once a run and read cheaply until the next.
+// As with the leaderboards only the leader refreshes, one view at a time
+// so they don't all scan the events table at once, and every instance
+// reads back the results.
+func refreshViews(ctx context.Context, st viewStore, size int, metrics *RedditMetrics) error {
+	lead := metrics.leading()
+	start := time.Now()
+	if lead {
+		for _, view := range store.Views {
+			viewStart := time.Now()
+			if err := st.RefreshView(ctx, view); err != nil {
+				return fmt.Errorf("refresh %s: %w", view, err)
+			}
+			metrics.views.refresh[view].Observe(time.Since(viewStart))
+		}
+	}
+	elapsed := time.Since(start)
+
+	analytics, err := st.Analytics(ctx, size)
+	if err != nil {
+		return fmt.Errorf("read analytics views: %w", err)
+	}
+
+	metrics.mutex.Lock()
+	if lead {
+		metrics.views.runs++
+		metrics.views.lastRun = elapsed
+	}
+	metrics.views.analytics = analytics
+	metrics.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,99 @@
+package simulator
+
+import (
+	"context"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/generator"
+	"web-traffic-sim/metrics"
+)
+
+// viralStats tracks viral spikes: how many there have been and the one in
+// progress, if any.
+type viralStats struct {
+	spikes int
+	total  metrics.Counter
+	post   string // post currently going viral, "" between spikes
+	// total when the current (or last) spike began
+	spikeStart int
+}
+
+// Simulates posts going viral - runs in its own goroutine next to the
+// generators when -viral is set. Every so often it picks a recent post and,
+// for a few seconds, floods it with votes and comments on top of the normal
+// traffic, so the writers and processors have to absorb a sudden spike.
+func simulateViral(ctx context.Context, cfg config.Viral, process string, rng *generator.RandSource, w *generator.World, queue *eventQueue, metrics *RedditMetrics) {
+	rate := float64(cfg.Events) / cfg.Duration.Seconds()
+	a := generator.NewArrivals(rng.Rand, func() float64 { return rate }, process)
+
+	for {
+		// Spikes arrive at random, on average once per interval
+		wait := time.Duration(rng.ExpFloat64() * float64(cfg.Interval))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		post, ok := w.Posts.Pick(rng.Rand)
+		if !ok {
+			continue
+		}
+
+		metrics.mutex.Lock()
+		metrics.viral.spikes++
+		metrics.viral.post = post.ID
+		metrics.viral.spikeStart = metrics.viral.total.Value()
+		metrics.mutex.Unlock()
+
+		err := spike(ctx, post, a, cfg.Duration, rng, w, queue, metrics)
+
+		metrics.mutex.Lock()
+		metrics.viral.post = ""
+		metrics.mutex.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// spike emits rate events/second at post for d, with the same arrival
+// process as the generators.
+func spike(ctx context.Context, post event.Thing, a generator.Arrivals, d time.Duration, rng *generator.RandSource, w *generator.World, queue *eventQueue, metrics *RedditMetrics) error {
+	return generator.Pace(ctx, a, time.After(d), func() bool {
+		e := viralEvent(rng, post, w)
+		e.Payload = w.Text.Sized(rng.Rand, e.Payload)
+		if !queue.send(ctx, e) {
+			return false
+		}
+
+		metrics.countEvent(e)
+		metrics.viral.total.Inc()
+		return true
+	})
+}
+
+// viralEvent is one reaction to a viral post: mostly upvotes, some
+// comments, the odd downvote. Voters come from the whole user base rather
+// than the usual power users - that's what makes it viral.
+func viralEvent(rng *generator.RandSource, post event.Thing, w *generator.World) event.Event {
+	e := event.Event{
+		Type:      event.Upvote,
+		User:      generator.UserName(rng.Intn(rng.Users.N)),
+		Subreddit: post.Subreddit,
+		PostID:    post.ID,
+		Timestamp: time.Now(),
+	}
+	switch r := rng.Float64(); {
+	case r < 0.15:
+		e.Type = event.Comment
+		e.ParentID = post.ID
+		e.CommentID = w.Comments.Create(post.ID, post.Subreddit, e.User).ID
+		e.Payload = w.Text.Comment(rng.Rand)
+	case r < 0.20:
+		e.Type = event.Downvote
+	}
+	return e
+}
@@ -0,0 +1,221 @@
+package simulator
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+)
+
+// webhookStats tracks webhook deliveries.
+type webhookStats struct {
+	sent    *metrics.Counter
+	retries *metrics.Counter
+	failed  *metrics.Counter // out of attempts
+	dropped *metrics.Counter // the queue was full
+}
+
+func (s *webhookStats) register(reg *metrics.Registry) {
+	s.sent = reg.Counter("redditsim_webhook_sent_total", "Processed batches delivered to the webhook.")
+	s.retries = reg.Counter("redditsim_webhook_retries_total", "Webhook attempts retried.")
+	s.failed = reg.Counter("redditsim_webhook_failed_total", "Webhook deliveries given up on.")
+	s.dropped = reg.Counter("redditsim_webhook_dropped_total", "Webhook deliveries dropped because the queue was full.")
+}
+
+type webhookSnapshot struct {
+	Sent    int `json:"sent"`
+	Retries int `json:"retries"`
+	Failed  int `json:"failed"`
+	Dropped int `json:"dropped"`
+}
+
+// webhookQueue is how many batches may wait for delivery before new ones
+// are dropped: a slow receiver costs notifications, never throughput.
+const webhookQueue = 1000
+
+// webhookBaseDelay is the wait before the first retry, doubled for every
+// retry after it.
+const webhookBaseDelay = 250 * time.Millisecond
+
+// webhookBody is what a webhook POSTs for one processed batch. Events is
+// only there with the batch body.
+type webhookBody struct {
+	Processor   int                `json:"processor"`
+	Count       int                `json:"count"`
+	ByType      map[event.Type]int `json:"by_type"`
+	FirstID     int64              `json:"first_id,omitempty"`
+	LastID      int64              `json:"last_id,omitempty"`
+	ProcessedAt time.Time          `json:"processed_at"`
+	Events      []event.Event      `json:"events,omitempty"`
+}
+
+type webhookDelivery struct {
+	id   int64
+	body []byte
+}
+
+// webhook notifies a URL of every batch the processors finish, from a
+// goroutine of its own so a slow or failing receiver never holds up a
+// processor. Deliveries are made one at a time in the order the batches
+// were processed. Each carries its number in the X-Webhook-Delivery
+// header, the same on every attempt, so a receiver can tell a retry from a
+// new batch. A nil webhook notifies no one.
+type webhook struct {
+	cfg     config.Webhook
+	client  *http.Client
+	queue   chan webhookDelivery
+	mu      sync.Mutex // numbers and queues deliveries in one go
+	next    int64
+	quit    chan struct{}
+	done    chan struct{}
+	metrics *RedditMetrics
+}
+
+func newWebhook(cfg config.Webhook, metrics *RedditMetrics) *webhook {
+	h := &webhook{
+		cfg:     cfg,
+		client:  &http.Client{},
+		queue:   make(chan webhookDelivery, webhookQueue),
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+		metrics: metrics,
+	}
+	metrics.webhook.register(metrics.registry)
+	go h.run()
+	return h
+}
+
+// notify queues a delivery for a batch processor has processed. Processors
+// call it concurrently.
+func (h *webhook) notify(processor int, events []event.Event) {
+	if h == nil {
+		return
+	}
+	body := webhookBody{
+		Processor:   processor,
+		Count:       len(events),
+		ByType:      make(map[event.Type]int),
+		FirstID:     events[0].ID,
+		LastID:      events[len(events)-1].ID,
+		ProcessedAt: time.Now(),
+	}
+	for _, e := range events {
+		body.ByType[e.Type]++
+	}
+	if h.cfg.Body == config.WebhookBatch {
+		body.Events = events
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		slog.Error("encode webhook", "err", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.next++
+	select {
+	case h.queue <- webhookDelivery{id: h.next, body: data}:
+	default:
+		h.metrics.webhook.dropped.Inc()
+	}
+}
+
+func (h *webhook) run() {
+	defer close(h.done)
+	for d := range h.queue {
+		h.deliver(d)
+	}
+}
+
+// deliver POSTs d until the receiver accepts it, it's been tried
+// cfg.Attempts times, or the receiver rejects it outright with a 4xx other
+// than 408 or 429. Retries back off exponentially with jitter, like the
+// store's. Once the run is over, what's left gets one attempt each.
+func (h *webhook) deliver(d webhookDelivery) {
+	for attempt := 1; ; attempt++ {
+		retry, err := h.post(d)
+		if err == nil {
+			h.metrics.webhook.sent.Inc()
+			return
+		}
+		closing := false
+		select {
+		case <-h.quit:
+			closing = true
+		default:
+		}
+		if !retry || closing || attempt >= h.cfg.Attempts {
+			slog.Error("deliver webhook", "url", h.cfg.URL, "delivery", d.id, "attempts", attempt, "err", err)
+			h.metrics.webhook.failed.Inc()
+			return
+		}
+
+		delay := min(webhookBaseDelay<<(attempt-1), maxRetryDelay)
+		delay -= time.Duration(rand.Float64() * 0.5 * float64(delay))
+		slog.Debug("retrying webhook", "delivery", d.id, "attempt", attempt, "delay", delay, "err", err)
+		h.metrics.webhook.retries.Inc()
+		select {
+		case <-h.quit:
+		case <-time.After(delay):
+		}
+	}
+}
+
+// post makes one attempt at d, and reports whether a failure is worth
+// retrying.
+func (h *webhook) post(d webhookDelivery) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.cfg.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "web-traffic-sim")
+	req.Header.Set("X-Webhook-Delivery", strconv.FormatInt(d.id, 10))
+	if h.cfg.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(h.cfg.Secret))
+		mac.Write(d.body)
+		req.Header.Set("X-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, errors.New(resp.Status)
+	}
+	return false, errors.New(resp.Status)
+}
+
+// Close delivers what's queued, without waiting to retry any of it, and
+// returns once it's done. Call it once the processors have stopped.
+func (h *webhook) Close() {
+	if h == nil {
+		return
+	}
+	close(h.quit)
+	close(h.queue)
+	<-h.done
+}
@@ -0,0 +1,196 @@
+package simulator
+
+import (
+	"slices"
+	"time"
+)
+
+// slidingCount counts what happened over the last window, in a ring of
+// buckets each covering an equal slice of it. As time passes the ring
+// advances and the oldest bucket's count falls off, so the sum is exact to
+// within one bucket and costs the same however much is counted. It is not
+// safe for concurrent use.
+type slidingCount struct {
+	counts []int
+	width  time.Duration
+	head   int       // the bucket counting now
+	start  time.Time // when head's slice began
+	total  int
+}
+
+func newSlidingCount(window time.Duration, buckets int, now time.Time) slidingCount {
+	width := window / time.Duration(buckets)
+	return slidingCount{counts: make([]int, buckets), width: width, start: now.Truncate(width)}
+}
+
+// advance moves the ring on to now, emptying the buckets it passes.
+func (c *slidingCount) advance(now time.Time) {
+	steps := int(now.Sub(c.start) / c.width)
+	if steps <= 0 {
+		return
+	}
+	if steps >= len(c.counts) {
+		clear(c.counts)
+		c.total = 0
+	} else {
+		for range steps {
+			c.head = (c.head + 1) % len(c.counts)
+			c.total -= c.counts[c.head]
+			c.counts[c.head] = 0
+		}
+	}
+	c.start = c.start.Add(time.Duration(steps) * c.width)
+}
+
+func (c *slidingCount) add(now time.Time, n int) {
+	c.advance(now)
+	c.counts[c.head] += n
+	c.total += n
+}
+
+// sum is the count over the window up to now.
+func (c *slidingCount) sum(now time.Time) int {
+	c.advance(now)
+	return c.total
+}
+
+// The counters rateWindow derives rates from.
+const (
+	rateEvents = iota
+	rateWrites
+	rateReads
+	rateUpdates
+	rateProcessed
+	ratePageLoads
+	numRates
+)
+
+// rateSamples is about how many samples rateWindow keeps per span.
+const rateSamples = 50
+
+// rateWindow turns ever-growing counters into rates over the last span,
+// which after a burst catch up in span rather than drifting back over the
+// whole run. It keeps samples of the counters, taken as snapshots read
+// them, in a ring, and a rate is the increase since the newest sample at
+// least span old. Callers hold the metrics mutex.
+type rateWindow struct {
+	span    time.Duration
+	samples []rateSample
+	head    int // where the next sample goes
+}
+
+type rateSample struct {
+	at     time.Time
+	counts [numRates]int
+}
+
+// newRateWindow starts the ring with every counter at zero at start, so
+// rates over a run younger than span are over the whole run.
+func newRateWindow(span time.Duration, start time.Time) *rateWindow {
+	w := &rateWindow{span: span, samples: make([]rateSample, 0, rateSamples+rateSamples/4)}
+	w.samples = append(w.samples, rateSample{at: start})
+	return w
+}
+
+// rates records counts at now and returns each counter's rate per second.
+func (w *rateWindow) rates(now time.Time, counts [numRates]int) [numRates]float64 {
+	newest := w.samples[(w.head-1+len(w.samples))%len(w.samples)]
+	if now.Sub(newest.at) >= w.span/rateSamples {
+		if len(w.samples) < cap(w.samples) {
+			w.samples = append(w.samples, rateSample{at: now, counts: counts})
+			w.head = len(w.samples) % cap(w.samples)
+		} else {
+			w.samples[w.head] = rateSample{at: now, counts: counts}
+			w.head = (w.head + 1) % len(w.samples)
+		}
+	}
+
+	// The oldest sample, unless a newer one is already span old
+	base := w.samples[w.head%len(w.samples)]
+	for i := range w.samples {
+		s := w.samples[(w.head+i)%len(w.samples)]
+		if now.Sub(s.at) < w.span {
+			break
+		}
+		base = s
+	}
+	var rates [numRates]float64
+	secs := now.Sub(base.at).Seconds()
+	if secs <= 0 {
+		return rates
+	}
+	for i := range rates {
+		rates[i] = float64(counts[i]-base.counts[i]) / secs
+	}
+	return rates
+}
+
+// HistoryLen is how many seconds of history the sparklines show at most.
+const HistoryLen = 60
+
+// The series history keeps: per-second rates of the first few rate
+// counters, then two levels.
+const (
+	historyWrites = iota
+	historyReads
+	historyUpdates
+	historyChannel
+	historyBacklog
+	numHistory
+)
+
+// history keeps the last historyLen seconds of the dashboard's activity
+// and gauge bars, one value a second, for the sparklines drawn beside
+// them. Like rateWindow it's fed by the snapshots: the seconds since the
+// last one each get the rate over them, and the levels as they are now.
+// Callers hold the metrics mutex.
+type history struct {
+	at     time.Time // when the last snapshot was recorded
+	counts [numRates]int
+	series [numHistory][]float64
+}
+
+func newHistory(start time.Time) *history {
+	return &history{at: start}
+}
+
+func (h *history) record(now time.Time, counts [numRates]int, channel, backlog int) {
+	seconds := int(now.Truncate(time.Second).Sub(h.at.Truncate(time.Second)) / time.Second)
+	if seconds <= 0 {
+		return
+	}
+	secs := now.Sub(h.at).Seconds()
+	var values [numHistory]float64
+	values[historyWrites] = float64(counts[rateWrites]-h.counts[rateWrites]) / secs
+	values[historyReads] = float64(counts[rateReads]-h.counts[rateReads]) / secs
+	values[historyUpdates] = float64(counts[rateUpdates]-h.counts[rateUpdates]) / secs
+	values[historyChannel] = float64(channel)
+	values[historyBacklog] = float64(backlog)
+	for i, v := range values {
+		for range min(seconds, HistoryLen) {
+			h.series[i] = append(h.series[i], v)
+		}
+		if over := len(h.series[i]) - HistoryLen; over > 0 {
+			h.series[i] = append(h.series[i][:0], h.series[i][over:]...)
+		}
+	}
+	h.at, h.counts = now, counts
+}
+
+type historySnapshot struct {
+	WritesPerSec  []float64 `json:"writes_per_sec"`
+	ReadsPerSec   []float64 `json:"reads_per_sec"`
+	UpdatesPerSec []float64 `json:"updates_per_sec"`
+	ChannelDepth  []float64 `json:"channel_depth"`
+	Backlog       []float64 `json:"backlog"`
+}
+
+func (h *history) snapshot() historySnapshot {
+	return historySnapshot{
+		WritesPerSec:  slices.Clone(h.series[historyWrites]),
+		ReadsPerSec:   slices.Clone(h.series[historyReads]),
+		UpdatesPerSec: slices.Clone(h.series[historyUpdates]),
+		ChannelDepth:  slices.Clone(h.series[historyChannel]),
+		Backlog:       slices.Clone(h.series[historyBacklog]),
+	}
+}
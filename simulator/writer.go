@@ -0,0 +1,155 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"web-traffic-sim/event"
+	"web-traffic-sim/metrics"
+	"web-traffic-sim/store"
+)
+
+// destination is wherever the writers send events: the store, the Kafka
+// sink, or both. With -sink kafka store is nil; with both, a Kafka failure
+// is counted by the sink but doesn't fail the stored batch. The Parquet
+// mirror and the ClickHouse sink, if any, get a copy of every batch that
+// was written, and so do the sinks given to New, whose failures are only
+// counted. The writers pass their batches through the stages first; a
+// dead-lettered batch has been through them already, and is written
+// straight back.
+type destination struct {
+	store  store.Store
+	sink   *kafkaSink
+	mirror *parquetMirror
+	click  *clickhouseSink
+
+	sinks        []Sink
+	sinkFailures *metrics.Counter
+	stages       []Middleware
+}
+
+func (d destination) write(ctx context.Context, batch []event.Event) error {
+	var err error
+	switch {
+	case d.store == nil:
+	case len(batch) == 1:
+		err = d.store.Insert(ctx, batch[0])
+	default:
+		err = d.store.InsertBatch(ctx, batch)
+	}
+	if err == nil && d.sink != nil {
+		if perr := d.sink.publish(ctx, batch); d.store == nil {
+			err = perr
+		}
+	}
+	if err == nil && d.mirror != nil {
+		d.mirror.add(batch)
+	}
+	if err == nil {
+		d.click.add(batch)
+	}
+	if err == nil {
+		for _, s := range d.sinks {
+			if serr := s.Write(ctx, batch); serr != nil {
+				slog.Warn("write to sink", "events", len(batch), "err", serr)
+				d.sinkFailures.Inc()
+			}
+		}
+	}
+	return err
+}
+
+// Stores events in the backing store - runs in its own goroutine, one per
+// writer in the pool, all reading from the same channel.
+// Events are accumulated and flushed once batchSize of them are waiting or
+// flushInterval has passed since the first one arrived, whichever is first.
+// It keeps going until eventChan is closed and drained, so no generated
+// event is lost on shutdown, and a batch that fails to store goes to the
+// dead-letter queue rather than being dropped. Writes deliberately don't
+// use the run context: an in-flight insert should finish rather than be
+// cancelled half-way. batchSize is read as the batch fills, and a writer
+// retired from the pool by closing quit flushes what it holds first.
+func storeEvents(id int, dest destination, eventChan <-chan event.Event, quit <-chan struct{}, batchSize func() int, flushInterval time.Duration, dlq *deadLetterQueue, metrics *RedditMetrics) {
+	batch := make([]event.Event, 0, batchSize())
+	timer := time.NewTimer(flushInterval)
+	timer.Stop()
+
+	write := batchWriter(id, dest, dlq, metrics)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		write(batch)
+		batch = batch[:0]
+	}
+
+	beat := &metrics.writers.get(id).beat
+	for {
+		beat.beat()
+		select {
+		case event, ok := <-eventChan:
+			if !ok {
+				flush()
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(flushInterval)
+			}
+			event.Received = time.Now()
+			batch = append(batch, event)
+			if len(batch) >= batchSize() {
+				timer.Stop()
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		case <-quit:
+			timer.Stop()
+			flush()
+			return
+		}
+	}
+}
+
+// batchWriter returns what writer id stores its batches with: writeBatch,
+// behind the stages.
+func batchWriter(id int, dest destination, dlq *deadLetterQueue, metrics *RedditMetrics) func(batch []event.Event) {
+	var reached bool
+	write := Chain(func(ctx context.Context, batch []event.Event) error {
+		reached = true
+		return writeBatch(id, dest, batch, dlq, metrics)
+	}, dest.stages...)
+	return func(batch []event.Event) {
+		reached = false
+		if err := write(context.Background(), batch); err != nil && !reached {
+			slog.Error("stage events", "writer", id, "events", len(batch), "err", err)
+		}
+	}
+}
+
+// writeBatch stores batch as writer id, sending it to the dead-letter
+// queue if that fails.
+func writeBatch(id int, dest destination, batch []event.Event, dlq *deadLetterQueue, metrics *RedditMetrics) error {
+	start := time.Now()
+	err := dest.write(context.Background(), batch)
+	elapsed := time.Since(start)
+	traceStored(id, batch, start, start.Add(elapsed), err)
+	if err != nil {
+		if !errors.Is(err, errBreakerOpen) {
+			slog.Error("store events", "writer", id, "events", len(batch), "err", err)
+		}
+		dlq.add(batch, err)
+		return err
+	}
+
+	metrics.latency[OpWrite].Observe(elapsed)
+	metrics.countStored(batch)
+	metrics.flushes.Inc()
+	metrics.flushTime.AddDuration(elapsed)
+	ws := metrics.writers.get(id)
+	ws.writes.Add(len(batch))
+	ws.busy.AddDuration(elapsed)
+	return nil
+}
@@ -0,0 +1,65 @@
+package store
+
+import "time"
+
+// KarmaEntry is a user's karma, as the karma job last aggregated it.
+type KarmaEntry struct {
+	User         string `json:"user"`
+	PostKarma    int    `json:"post_karma"`
+	CommentKarma int    `json:"comment_karma"`
+}
+
+// RankedPost is a post on the front page, with its hot score.
+type RankedPost struct {
+	ID        string    `json:"id"`
+	Subreddit string    `json:"subreddit"`
+	Author    string    `json:"author"`
+	Title     string    `json:"title"`
+	Ups       int       `json:"ups"`
+	Downs     int       `json:"downs"`
+	Comments  int       `json:"comments"`
+	Hot       float64   `json:"hot"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ScoredPost is a post's running score, its ups and downs.
+type ScoredPost struct {
+	ID        string `json:"id"`
+	Subreddit string `json:"subreddit"`
+	Ups       int    `json:"ups"`
+	Downs     int    `json:"downs"`
+}
+
+// UserFlag is one user the detector flagged, and why.
+type UserFlag struct {
+	User      string    `json:"user"`
+	Reason    string    `json:"reason"`
+	Events    int       `json:"events"` // in the window, when flagged
+	Detail    string    `json:"detail"`
+	FlaggedAt time.Time `json:"flagged_at"`
+}
+
+// The leaderboards, as named in the leaderboards table and the API.
+const (
+	BoardTopPosts         = "top_posts"
+	BoardTopCommenters    = "top_commenters"
+	BoardActiveSubreddits = "active_subreddits"
+)
+
+var boardNames = []string{BoardTopPosts, BoardTopCommenters, BoardActiveSubreddits}
+
+// Leaderboard is one board's entries, as last computed.
+type Leaderboard struct {
+	Board      string             `json:"board"`
+	ComputedAt time.Time          `json:"computed_at"`
+	Entries    []LeaderboardEntry `json:"entries"`
+}
+
+// LeaderboardEntry is a post, with its score, a commenter with their
+// comments or a subreddit with its posts and comments.
+type LeaderboardEntry struct {
+	Rank  int    `json:"rank"`
+	Item  string `json:"item"`
+	Title string `json:"title,omitempty"`
+	Score int64  `json:"score"`
+}
@@ -0,0 +1,802 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// Materialize folds the batch into the domain tables with one set-based
+// statement per table. Users and subreddits are upserted in sorted order so
+// that competing processors always take row locks in the same order and
+// can't deadlock each other.
+//
+// Comments and votes join against their post or comment, so one whose
+// target hasn't been materialized yet (still queued, or claimed by another
+// processor) is skipped rather than violating the foreign key. That
+// includes a reply whose parent comment is missing.
+func (b *pgBatch) Materialize(ctx context.Context) (DomainCounts, error) {
+	var (
+		counts                          DomainCounts
+		users, subreddits               []string
+		postIDs, postSubs, postAuthors  []string
+		postTitles, postTimes           []string
+		comments                        commentColumns
+		votePosts, voteUsers, voteTimes []string
+		voteValues                      []int64
+		cvoteComments, cvoteUsers       []string
+		cvoteTimes                      []string
+		cvoteValues                     []int64
+		mod                             moderationColumns
+	)
+	for _, e := range b.events {
+		users = append(users, e.User)
+		if e.Target != "" {
+			users = append(users, e.Target)
+		}
+		ts := e.Timestamp.Format(time.RFC3339Nano)
+		switch e.Type {
+		case event.Report, event.Remove, event.Approve, event.Ban:
+			if e.Type == event.Ban {
+				subreddits = append(subreddits, e.Subreddit)
+			}
+			mod.add(e, ts)
+		case event.Post:
+			subreddits = append(subreddits, e.Subreddit)
+			postIDs = append(postIDs, e.PostID)
+			postSubs = append(postSubs, e.Subreddit)
+			postAuthors = append(postAuthors, e.User)
+			postTitles = append(postTitles, e.Payload)
+			postTimes = append(postTimes, ts)
+		case event.Comment:
+			comments.ids = append(comments.ids, e.CommentID)
+			comments.posts = append(comments.posts, e.PostID)
+			comments.parents = append(comments.parents, e.ParentID)
+			comments.authors = append(comments.authors, e.User)
+			comments.bodies = append(comments.bodies, e.Payload)
+			comments.times = append(comments.times, ts)
+		case event.Upvote, event.Downvote:
+			value := int64(1)
+			if e.Type == event.Downvote {
+				value = -1
+			}
+			if e.CommentID != "" {
+				cvoteComments = append(cvoteComments, e.CommentID)
+				cvoteUsers = append(cvoteUsers, e.User)
+				cvoteValues = append(cvoteValues, value)
+				cvoteTimes = append(cvoteTimes, ts)
+				continue
+			}
+			votePosts = append(votePosts, e.PostID)
+			voteUsers = append(voteUsers, e.User)
+			voteValues = append(voteValues, value)
+			voteTimes = append(voteTimes, ts)
+		}
+	}
+	slices.Sort(users)
+	users = slices.Compact(users)
+	slices.Sort(subreddits)
+	subreddits = slices.Compact(subreddits)
+
+	exec := func(n *int, query string, args ...any) error {
+		res, err := b.tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		*n += int(affected)
+		return err
+	}
+
+	if err := exec(&counts.Users, `
+		INSERT INTO users (name)
+		SELECT unnest($1::text[])
+		ON CONFLICT (name) DO NOTHING
+	`, pq.Array(users)); err != nil {
+		return counts, err
+	}
+	if len(subreddits) > 0 {
+		if err := exec(&counts.Subreddits, `
+			INSERT INTO subreddits (name)
+			SELECT unnest($1::text[])
+			ON CONFLICT (name) DO NOTHING
+		`, pq.Array(subreddits)); err != nil {
+			return counts, err
+		}
+	}
+	if len(postIDs) > 0 {
+		if err := exec(&counts.Posts, `
+			INSERT INTO posts (id, subreddit_id, author_id, title, created_at)
+			SELECT v.id, s.id, u.id, v.title, v.ts
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::timestamptz[])
+				AS v(id, subreddit, author, title, ts)
+			JOIN subreddits s ON s.name = v.subreddit
+			JOIN users u ON u.name = v.author
+			ON CONFLICT (id) DO NOTHING
+		`, pq.Array(postIDs), pq.Array(postSubs), pq.Array(postAuthors), pq.Array(postTitles), pq.Array(postTimes)); err != nil {
+			return counts, err
+		}
+	}
+	if len(comments.ids) > 0 {
+		if err := b.insertComments(ctx, comments, &counts); err != nil {
+			return counts, err
+		}
+	}
+	if len(votePosts) > 0 {
+		// A user has one vote per post: the latest one in the batch wins,
+		// and it replaces any earlier vote already stored.
+		if err := exec(&counts.Votes, `
+			INSERT INTO votes (post_id, user_id, value, created_at)
+			SELECT DISTINCT ON (p.id, u.id) p.id, u.id, v.value, v.ts
+			FROM unnest($1::text[], $2::text[], $3::smallint[], $4::timestamptz[])
+				AS v(post, voter, value, ts)
+			JOIN posts p ON p.id = v.post
+			JOIN users u ON u.name = v.voter
+			ORDER BY p.id, u.id, v.ts DESC
+			ON CONFLICT (post_id, user_id) DO UPDATE
+				SET value = EXCLUDED.value, created_at = EXCLUDED.created_at
+		`, pq.Array(votePosts), pq.Array(voteUsers), pq.Array(voteValues), pq.Array(voteTimes)); err != nil {
+			return counts, err
+		}
+	}
+	if len(cvoteComments) > 0 {
+		if err := exec(&counts.Votes, `
+			INSERT INTO comment_votes (comment_id, user_id, value, created_at)
+			SELECT DISTINCT ON (c.id, u.id) c.id, u.id, v.value, v.ts
+			FROM unnest($1::text[], $2::text[], $3::smallint[], $4::timestamptz[])
+				AS v(comment, voter, value, ts)
+			JOIN comments c ON c.id = v.comment
+			JOIN users u ON u.name = v.voter
+			ORDER BY c.id, u.id, v.ts DESC
+			ON CONFLICT (comment_id, user_id) DO UPDATE
+				SET value = EXCLUDED.value, created_at = EXCLUDED.created_at
+		`, pq.Array(cvoteComments), pq.Array(cvoteUsers), pq.Array(cvoteValues), pq.Array(cvoteTimes)); err != nil {
+			return counts, err
+		}
+	}
+	if err := b.moderate(ctx, mod, &counts); err != nil {
+		return counts, err
+	}
+	if len(postIDs) > 0 || len(votePosts) > 0 {
+		// Flag every post this batch created or voted on for the ranker.
+		// Sorted, like the users upsert, so competing processors lock
+		// rank rows in the same order.
+		if _, err := b.tx.ExecContext(ctx, `
+			INSERT INTO post_ranks (post_id)
+			SELECT DISTINCT p.id
+			FROM unnest($1::text[]) AS v(id)
+			JOIN posts p ON p.id = v.id
+			ORDER BY p.id
+			ON CONFLICT (post_id) DO UPDATE SET dirty = TRUE
+		`, pq.Array(append(postIDs, votePosts...))); err != nil {
+			return counts, err
+		}
+	}
+	return counts, nil
+}
+
+// commentColumns are a batch's comments, one slice per column of the
+// set-based insert.
+type commentColumns struct {
+	ids, posts, parents, authors, bodies, times []string
+}
+
+// without returns the comments whose ID isn't in done.
+func (c commentColumns) without(done map[string]bool) commentColumns {
+	var rest commentColumns
+	for i, id := range c.ids {
+		if done[id] {
+			continue
+		}
+		rest.ids = append(rest.ids, id)
+		rest.posts = append(rest.posts, c.posts[i])
+		rest.parents = append(rest.parents, c.parents[i])
+		rest.authors = append(rest.authors, c.authors[i])
+		rest.bodies = append(rest.bodies, c.bodies[i])
+		rest.times = append(rest.times, c.times[i])
+	}
+	return rest
+}
+
+// insertComments stores comments in waves. A reply joins against its
+// parent comment, which one statement can't see if it inserts both, so
+// each wave stores the comments whose parent is already there and the
+// next wave retries the rest, until a wave stores nothing. It then adds
+// the new comments to their parents' reply counts and their posts'
+// comment counts, and records the deepest and busiest threads it saw.
+func (b *pgBatch) insertComments(ctx context.Context, pending commentColumns, counts *DomainCounts) error {
+	replies := map[string]int{}
+	perPost := map[string]int{}
+	wave := func() (map[string]bool, error) {
+		rows, err := b.tx.QueryContext(ctx, `
+			INSERT INTO comments (id, post_id, parent_id, depth, author_id, body, created_at)
+			SELECT v.id, p.id, pc.id, COALESCE(pc.depth, 0) + 1, u.id, v.body, v.ts
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[], $6::timestamptz[])
+				AS v(id, post, parent, author, body, ts)
+			JOIN posts p ON p.id = v.post
+			JOIN users u ON u.name = v.author
+			LEFT JOIN comments pc ON pc.id = v.parent AND pc.post_id = p.id
+			WHERE v.parent = v.post OR pc.id IS NOT NULL
+			ON CONFLICT (id) DO NOTHING
+			RETURNING id, post_id, parent_id, depth
+		`, pq.Array(pending.ids), pq.Array(pending.posts), pq.Array(pending.parents),
+			pq.Array(pending.authors), pq.Array(pending.bodies), pq.Array(pending.times))
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		inserted := map[string]bool{}
+		for rows.Next() {
+			var (
+				id, post string
+				parent   sql.NullString
+				depth    int
+			)
+			if err := rows.Scan(&id, &post, &parent, &depth); err != nil {
+				return nil, err
+			}
+			inserted[id] = true
+			perPost[post]++
+			if parent.Valid {
+				replies[parent.String]++
+			}
+			if depth > counts.Deepest {
+				counts.Deepest, counts.DeepestPost = depth, post
+			}
+		}
+		return inserted, rows.Err()
+	}
+	for len(pending.ids) > 0 {
+		inserted, err := wave()
+		if err != nil {
+			return err
+		}
+		if len(inserted) == 0 {
+			break
+		}
+		counts.Comments += len(inserted)
+		pending = pending.without(inserted)
+	}
+
+	// Bump the counters, locking the rows in ID order first so competing
+	// processors can't deadlock on them.
+	if len(replies) > 0 {
+		ids, n := sortedCounts(replies)
+		if _, err := b.tx.ExecContext(ctx, `
+			SELECT 1 FROM comments WHERE id = ANY($1) ORDER BY id FOR UPDATE
+		`, pq.Array(ids)); err != nil {
+			return err
+		}
+		if _, err := b.tx.ExecContext(ctx, `
+			UPDATE comments c SET replies = c.replies + v.n
+			FROM unnest($1::text[], $2::int[]) AS v(id, n)
+			WHERE c.id = v.id
+		`, pq.Array(ids), pq.Array(n)); err != nil {
+			return err
+		}
+	}
+	if len(perPost) > 0 {
+		ids, n := sortedCounts(perPost)
+		if _, err := b.tx.ExecContext(ctx, `
+			SELECT 1 FROM posts WHERE id = ANY($1) ORDER BY id FOR UPDATE
+		`, pq.Array(ids)); err != nil {
+			return err
+		}
+		rows, err := b.tx.QueryContext(ctx, `
+			UPDATE posts p SET comment_count = p.comment_count + v.n
+			FROM unnest($1::text[], $2::int[]) AS v(id, n)
+			WHERE p.id = v.id
+			RETURNING p.id, p.comment_count
+		`, pq.Array(ids), pq.Array(n))
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var (
+				id    string
+				total int
+			)
+			if err := rows.Scan(&id, &total); err != nil {
+				return err
+			}
+			if total > counts.Busiest {
+				counts.Busiest, counts.BusiestPost = total, id
+			}
+		}
+		return rows.Err()
+	}
+	return nil
+}
+
+// moderationColumns are a batch's moderation events, one slice per column
+// of the statements that apply them.
+type moderationColumns struct {
+	reportThings, reporters, reportReasons, reportTimes []string
+	// Removals and approvals resolve reports; removals also remove the
+	// post or comment
+	resolvedThings, resolutions, resolvedTimes []string
+	removedPosts, removedComments              []string
+	removedPostTimes, removedCommentTimes      []string
+	banSubreddits, banUsers, banMods           []string
+	banReasons, banTimes                       []string
+}
+
+func (m *moderationColumns) add(e event.Event, ts string) {
+	thing := e.PostID
+	if e.CommentID != "" {
+		thing = e.CommentID
+	}
+	switch e.Type {
+	case event.Report:
+		m.reportThings = append(m.reportThings, thing)
+		m.reporters = append(m.reporters, e.User)
+		m.reportReasons = append(m.reportReasons, e.Payload)
+		m.reportTimes = append(m.reportTimes, ts)
+	case event.Approve:
+		m.resolvedThings = append(m.resolvedThings, thing)
+		m.resolutions = append(m.resolutions, "approved")
+		m.resolvedTimes = append(m.resolvedTimes, ts)
+	case event.Remove:
+		m.resolvedThings = append(m.resolvedThings, thing)
+		m.resolutions = append(m.resolutions, "removed")
+		m.resolvedTimes = append(m.resolvedTimes, ts)
+		if e.CommentID != "" {
+			m.removedComments = append(m.removedComments, e.CommentID)
+			m.removedCommentTimes = append(m.removedCommentTimes, ts)
+		} else {
+			m.removedPosts = append(m.removedPosts, e.PostID)
+			m.removedPostTimes = append(m.removedPostTimes, ts)
+		}
+	case event.Ban:
+		m.banSubreddits = append(m.banSubreddits, e.Subreddit)
+		m.banUsers = append(m.banUsers, e.Target)
+		m.banMods = append(m.banMods, e.User)
+		m.banReasons = append(m.banReasons, e.Payload)
+		m.banTimes = append(m.banTimes, ts)
+	}
+}
+
+// moderate applies the batch's moderation events. Reports aren't tied to
+// their post or comment by a foreign key, since they may be for either, so
+// unlike votes they're stored even when it hasn't been materialized yet;
+// resolving them marks every open report on the thing.
+func (b *pgBatch) moderate(ctx context.Context, m moderationColumns, counts *DomainCounts) error {
+	exec := func(n *int, query string, args ...any) error {
+		res, err := b.tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		if n != nil {
+			affected, err := res.RowsAffected()
+			*n += int(affected)
+			return err
+		}
+		return nil
+	}
+
+	if len(m.reportThings) > 0 {
+		if err := exec(&counts.Reports, `
+			INSERT INTO reports (thing_id, reporter_id, reason, created_at)
+			SELECT v.thing, u.id, v.reason, v.ts
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::timestamptz[])
+				AS v(thing, reporter, reason, ts)
+			JOIN users u ON u.name = v.reporter
+		`, pq.Array(m.reportThings), pq.Array(m.reporters), pq.Array(m.reportReasons), pq.Array(m.reportTimes)); err != nil {
+			return err
+		}
+	}
+	if len(m.resolvedThings) > 0 {
+		if err := exec(nil, `
+			UPDATE reports r
+			SET resolution = v.resolution, resolved_at = v.ts
+			FROM unnest($1::text[], $2::text[], $3::timestamptz[]) AS v(thing, resolution, ts)
+			WHERE r.thing_id = v.thing AND r.resolution IS NULL
+		`, pq.Array(m.resolvedThings), pq.Array(m.resolutions), pq.Array(m.resolvedTimes)); err != nil {
+			return err
+		}
+	}
+	if len(m.removedPosts) > 0 {
+		if err := exec(&counts.Removed, `
+			UPDATE posts p SET removed_at = v.ts
+			FROM unnest($1::text[], $2::timestamptz[]) AS v(id, ts)
+			WHERE p.id = v.id AND p.removed_at IS NULL
+		`, pq.Array(m.removedPosts), pq.Array(m.removedPostTimes)); err != nil {
+			return err
+		}
+	}
+	if len(m.removedComments) > 0 {
+		if err := exec(&counts.Removed, `
+			UPDATE comments c SET removed_at = v.ts
+			FROM unnest($1::text[], $2::timestamptz[]) AS v(id, ts)
+			WHERE c.id = v.id AND c.removed_at IS NULL
+		`, pq.Array(m.removedComments), pq.Array(m.removedCommentTimes)); err != nil {
+			return err
+		}
+	}
+	if len(m.banUsers) > 0 {
+		if err := exec(&counts.Bans, `
+			INSERT INTO bans (subreddit_id, user_id, moderator_id, reason, created_at)
+			SELECT s.id, u.id, mu.id, v.reason, v.ts
+			FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::timestamptz[])
+				AS v(subreddit, banned, moderator, reason, ts)
+			JOIN subreddits s ON s.name = v.subreddit
+			JOIN users u ON u.name = v.banned
+			JOIN users mu ON mu.name = v.moderator
+			ON CONFLICT (subreddit_id, user_id) DO NOTHING
+		`, pq.Array(m.banSubreddits), pq.Array(m.banUsers), pq.Array(m.banMods), pq.Array(m.banReasons), pq.Array(m.banTimes)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedCounts flattens counts into parallel slices sorted by key.
+func sortedCounts(counts map[string]int) ([]string, []int64) {
+	keys := slices.Sorted(maps.Keys(counts))
+	n := make([]int64, len(keys))
+	for i, k := range keys {
+		n[i] = int64(counts[k])
+	}
+	return keys, n
+}
+
+// AggregateKarma rebuilds the karma table from scratch: a user's post karma
+// is the sum of votes on their posts, comment karma the sum of votes on
+// their comments.
+func (s *postgresStore) AggregateKarma(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO karma (user_id, post_karma, comment_karma, updated_at)
+		SELECT u.id, COALESCE(pk.karma, 0), COALESCE(ck.karma, 0), NOW()
+		FROM users u
+		LEFT JOIN (
+			SELECT p.author_id, SUM(v.value) AS karma
+			FROM votes v JOIN posts p ON p.id = v.post_id
+			GROUP BY p.author_id
+		) pk ON pk.author_id = u.id
+		LEFT JOIN (
+			SELECT c.author_id, SUM(v.value) AS karma
+			FROM comment_votes v JOIN comments c ON c.id = v.comment_id
+			GROUP BY c.author_id
+		) ck ON ck.author_id = u.id
+		ON CONFLICT (user_id) DO UPDATE
+			SET post_karma = EXCLUDED.post_karma,
+				comment_karma = EXCLUDED.comment_karma,
+				updated_at = EXCLUDED.updated_at
+	`)
+	return err
+}
+
+func (s *postgresStore) TopKarma(ctx context.Context, n int) ([]KarmaEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT u.name, k.post_karma, k.comment_karma
+		FROM karma k JOIN users u ON u.id = k.user_id
+		ORDER BY k.post_karma + k.comment_karma DESC, u.name
+		LIMIT $1
+	`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var top []KarmaEntry
+	for rows.Next() {
+		var k KarmaEntry
+		if err := rows.Scan(&k.User, &k.PostKarma, &k.CommentKarma); err != nil {
+			return nil, err
+		}
+		top = append(top, k)
+	}
+	return top, rows.Err()
+}
+
+// RefreshLeaderboards recomputes the leaderboards from the domain tables in
+// one transaction, so readers see either the last set or the new one:
+// posts by net votes, commenters by comments and subreddits by posts and
+// comments, leaving out removed ones.
+func (s *postgresStore) RefreshLeaderboards(ctx context.Context, n int) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM leaderboards`); err != nil {
+		return err
+	}
+	for _, q := range []string{
+		`INSERT INTO leaderboards (board, rank, item, title, score, computed_at)
+		SELECT 'top_posts', ROW_NUMBER() OVER (ORDER BY SUM(v.value) DESC, p.id), p.id, p.title, SUM(v.value), NOW()
+		FROM votes v JOIN posts p ON p.id = v.post_id
+		WHERE p.removed_at IS NULL
+		GROUP BY p.id
+		ORDER BY 2
+		LIMIT $1`,
+		`INSERT INTO leaderboards (board, rank, item, score, computed_at)
+		SELECT 'top_commenters', ROW_NUMBER() OVER (ORDER BY COUNT(*) DESC, u.name), u.name, COUNT(*), NOW()
+		FROM comments c JOIN users u ON u.id = c.author_id
+		WHERE c.removed_at IS NULL
+		GROUP BY u.name
+		ORDER BY 2
+		LIMIT $1`,
+		`INSERT INTO leaderboards (board, rank, item, score, computed_at)
+		SELECT 'active_subreddits', ROW_NUMBER() OVER (ORDER BY COUNT(*) DESC, s.name), s.name, COUNT(*), NOW()
+		FROM (
+			SELECT subreddit_id FROM posts WHERE removed_at IS NULL
+			UNION ALL
+			SELECT p.subreddit_id FROM comments c JOIN posts p ON p.id = c.post_id WHERE c.removed_at IS NULL
+		) a JOIN subreddits s ON s.id = a.subreddit_id
+		GROUP BY s.name
+		ORDER BY 2
+		LIMIT $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, q, n); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *postgresStore) Leaderboards(ctx context.Context) ([]Leaderboard, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT board, rank, item, title, score, computed_at
+		FROM leaderboards
+		ORDER BY board, rank
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	boards := make([]Leaderboard, len(boardNames))
+	for i, name := range boardNames {
+		boards[i] = Leaderboard{Board: name, Entries: []LeaderboardEntry{}}
+	}
+	for rows.Next() {
+		var board string
+		var e LeaderboardEntry
+		var at time.Time
+		if err := rows.Scan(&board, &e.Rank, &e.Item, &e.Title, &e.Score, &at); err != nil {
+			return nil, err
+		}
+		if i := slices.Index(boardNames, board); i >= 0 {
+			boards[i].ComputedAt = at
+			boards[i].Entries = append(boards[i].Entries, e)
+		}
+	}
+	return boards, rows.Err()
+}
+
+// RefreshRanks rescores the dirty posts with Reddit's hot formula: the
+// order of magnitude of the net score plus a bonus that grows by 1 every
+// 12.5 hours since the Reddit epoch (1134028003), so a post needs 10x the
+// votes to outrank one posted 12.5 hours later.
+func (s *postgresStore) RefreshRanks(ctx context.Context) (int, error) {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE post_ranks r
+		SET ups = t.ups, downs = t.downs, dirty = FALSE,
+			hot = SIGN(t.ups - t.downs) * LOG(GREATEST(ABS(t.ups - t.downs), 1))
+				+ (EXTRACT(EPOCH FROM t.created_at) - 1134028003) / 45000
+		FROM (
+			SELECT p.id, p.created_at,
+				COUNT(*) FILTER (WHERE v.value > 0) AS ups,
+				COUNT(*) FILTER (WHERE v.value < 0) AS downs
+			FROM post_ranks d
+			JOIN posts p ON p.id = d.post_id
+			LEFT JOIN votes v ON v.post_id = p.id
+			WHERE d.dirty
+			GROUP BY p.id
+		) t
+		WHERE r.post_id = t.id
+	`)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// frontPageOrder maps each sort to its ORDER BY clause.
+var frontPageOrder = map[string]string{
+	config.SortHot: "r.hot DESC",
+	config.SortTop: "r.ups - r.downs DESC, p.created_at DESC",
+	config.SortNew: "p.created_at DESC",
+}
+
+func (s *postgresStore) FrontPage(ctx context.Context, sort string, n int) ([]RankedPost, error) {
+	order, ok := frontPageOrder[sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", sort)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, sr.name, u.name, p.title, r.ups, r.downs, r.hot, p.created_at,
+			p.comment_count
+		FROM post_ranks r
+		JOIN posts p ON p.id = r.post_id
+		JOIN subreddits sr ON sr.id = p.subreddit_id
+		JOIN users u ON u.id = p.author_id
+		WHERE p.removed_at IS NULL
+		ORDER BY `+order+`
+		LIMIT $1
+	`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var page []RankedPost
+	for rows.Next() {
+		var p RankedPost
+		if err := rows.Scan(&p.ID, &p.Subreddit, &p.Author, &p.Title, &p.Ups, &p.Downs, &p.Hot, &p.CreatedAt, &p.Comments); err != nil {
+			return nil, err
+		}
+		page = append(page, p)
+	}
+	return page, rows.Err()
+}
+
+// postOrder maps each sort to its ORDER BY clause for Posts, which unlike
+// the front page includes posts the ranker hasn't scored yet.
+var postOrder = map[string]string{
+	config.SortHot: "r.hot DESC NULLS LAST, p.created_at DESC",
+	config.SortTop: "COALESCE(r.ups - r.downs, 0) DESC, p.created_at DESC",
+	config.SortNew: "p.created_at DESC",
+}
+
+func (s *postgresStore) Posts(ctx context.Context, f PostFilter) ([]RankedPost, error) {
+	order, ok := postOrder[f.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %q", f.Sort)
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, sr.name, u.name, p.title, COALESCE(r.ups, 0), COALESCE(r.downs, 0),
+			COALESCE(r.hot, 0), p.created_at, p.comment_count
+		FROM posts p
+		JOIN subreddits sr ON sr.id = p.subreddit_id
+		JOIN users u ON u.id = p.author_id
+		LEFT JOIN post_ranks r ON r.post_id = p.id
+		WHERE p.removed_at IS NULL
+			AND ($1 = '' OR p.id = $1)
+			AND ($2 = '' OR sr.name = $2)
+			AND ($3 = '' OR u.name = $3)
+		ORDER BY `+order+`
+		LIMIT $4
+	`, f.ID, f.Subreddit, f.Author, f.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []RankedPost{}
+	for rows.Next() {
+		var p RankedPost
+		if err := rows.Scan(&p.ID, &p.Subreddit, &p.Author, &p.Title, &p.Ups, &p.Downs, &p.Hot, &p.CreatedAt, &p.Comments); err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+func (s *postgresStore) Comments(ctx context.Context, f CommentFilter) ([]Comment, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.id, c.post_id, COALESCE(c.parent_id, ''), u.name,
+			CASE WHEN c.removed_at IS NULL THEN c.body ELSE '[removed]' END,
+			c.depth, c.replies,
+			COUNT(v.user_id) FILTER (WHERE v.value > 0),
+			COUNT(v.user_id) FILTER (WHERE v.value < 0),
+			c.created_at
+		FROM comments c
+		JOIN users u ON u.id = c.author_id
+		LEFT JOIN comment_votes v ON v.comment_id = c.id
+		WHERE ($1 = '' OR c.id = $1)
+			AND ($2 = '' OR c.post_id = $2)
+			AND (($3 = '' AND ($2 = '' OR $6 OR c.parent_id IS NULL)) OR c.parent_id = $3)
+			AND ($4 = '' OR u.name = $4)
+		GROUP BY c.id, u.name
+		ORDER BY c.created_at, c.id
+		LIMIT $5
+	`, f.ID, f.Post, f.Parent, f.Author, f.Limit, f.Thread)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		if err := rows.Scan(&c.ID, &c.Post, &c.Parent, &c.Author, &c.Body, &c.Depth, &c.Replies, &c.Ups, &c.Downs, &c.CreatedAt); err != nil {
+			return nil, err
+		}
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+func (s *postgresStore) User(ctx context.Context, name string) (User, error) {
+	u := User{Name: name}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(k.post_karma, 0), COALESCE(k.comment_karma, 0), u.created_at
+		FROM users u
+		LEFT JOIN karma k ON k.user_id = u.id
+		WHERE u.name = $1
+	`, name).Scan(&u.PostKarma, &u.CommentKarma, &u.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return u, ErrUserNotFound
+	}
+	return u, err
+}
+
+// FoldScores claims a batch of uncounted vote events, flags them scored
+// and adds them to post_scores in one statement. The events are locked
+// with SKIP LOCKED, so concurrent folds would split the backlog rather than
+// count a vote twice. Votes on comments, and on posts not yet materialized,
+// are flagged without being counted, as Materialize skips them too.
+func (s *postgresStore) FoldScores(ctx context.Context, limit int) (votes, posts int, err error) {
+	err = s.db.QueryRowContext(ctx, `
+		WITH claimed AS (
+			UPDATE events SET scored = TRUE
+			WHERE id IN (
+				SELECT id FROM events
+				WHERE processed AND NOT scored AND type IN ('upvote', 'downvote')
+				ORDER BY id
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING type, data->>'post_id' AS post_id, data->>'comment_id' AS comment_id
+		), upserted AS (
+			INSERT INTO post_scores (post_id, ups, downs, updated_at)
+			SELECT p.id,
+				COUNT(*) FILTER (WHERE c.type = 'upvote'),
+				COUNT(*) FILTER (WHERE c.type = 'downvote'),
+				NOW()
+			FROM claimed c JOIN posts p ON p.id = c.post_id
+			WHERE c.comment_id IS NULL
+			GROUP BY p.id
+			ORDER BY p.id
+			ON CONFLICT (post_id) DO UPDATE
+				SET ups = post_scores.ups + EXCLUDED.ups,
+					downs = post_scores.downs + EXCLUDED.downs,
+					updated_at = EXCLUDED.updated_at
+			RETURNING 1
+		)
+		SELECT (SELECT COUNT(*) FROM claimed), (SELECT COUNT(*) FROM upserted)
+	`, limit).Scan(&votes, &posts)
+	return votes, posts, err
+}
+
+func (s *postgresStore) TopScores(ctx context.Context, n int) ([]ScoredPost, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT p.id, sr.name, ps.ups, ps.downs
+		FROM post_scores ps
+		JOIN posts p ON p.id = ps.post_id
+		JOIN subreddits sr ON sr.id = p.subreddit_id
+		WHERE p.removed_at IS NULL
+		ORDER BY ps.ups - ps.downs DESC, p.id
+		LIMIT $1
+	`, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var top []ScoredPost
+	for rows.Next() {
+		var p ScoredPost
+		if err := rows.Scan(&p.ID, &p.Subreddit, &p.Ups, &p.Downs); err != nil {
+			return nil, err
+		}
+		top = append(top, p)
+	}
+	return top, rows.Err()
+}
@@ -0,0 +1,19 @@
+package store
+
+import "time"
+
+// InstanceStatus is one simulator process as its peers see it: its
+// cumulative counters and its throughput over its last heartbeat.
+type InstanceStatus struct {
+	Name            string    `json:"name"`
+	Host            string    `json:"host"`
+	PID             int       `json:"pid"`
+	Started         time.Time `json:"started"`
+	Heartbeat       time.Time `json:"heartbeat"`
+	Generated       int       `json:"generated"`
+	Stored          int       `json:"stored"`
+	Processed       int       `json:"processed"`
+	EventsPerSec    float64   `json:"events_per_sec"`
+	ProcessedPerSec float64   `json:"processed_per_sec"`
+	Leader          bool      `json:"leader"`
+}
@@ -0,0 +1,258 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// ErrFull is returned by memoryStore.Insert when the ring buffer has no
+// free slot left, i.e. the processor has fallen a whole capacity behind,
+// and by a Rollback that has no room to put its events back.
+var ErrFull = errors.New("memory store is full")
+
+// memoryStore keeps unprocessed events in fixed-size ring buffers, one per
+// priority (or a single one when priority is off), which share the
+// capacity. Claims take from the head of a ring, its tail or anywhere in
+// it, as the claim strategy says. It has no I/O at all, which makes it
+// useful for measuring how fast the channel pipeline itself can go when
+// the database is not the bottleneck.
+//
+// Claimed events leave the ring straight away and sit in inflight until
+// their batch is committed.
+//
+// Without a unique index to lean on, duplicates are caught by remembering
+// the keys of the last capacity events inserted: a retry comes within
+// moments of the original, well inside that window.
+//
+// A claim rolled back once inserts have filled the room it left has
+// nowhere to go: its events are dropped and counted in lost.
+type memoryStore struct {
+	mu         sync.Mutex
+	rings      [event.PriorityLevels]eventRing
+	priority   bool
+	claim      string
+	capacity   int
+	size       int // number of unclaimed events across the rings
+	nextID     int64
+	inflight   map[int64]struct{}
+	seen       map[string]struct{}
+	keys       []string // seen keys in insertion order, oldest at keyHead
+	keyHead    int
+	duplicates int64
+	lost       int64
+}
+
+func newMemoryStore(capacity int, p config.Processor) *memoryStore {
+	return &memoryStore{
+		priority: p.Priority,
+		claim:    p.Claim,
+		capacity: capacity,
+		inflight: make(map[int64]struct{}),
+		seen:     make(map[string]struct{}),
+	}
+}
+
+// remember records e's key, forgetting the oldest one once the window is
+// full. It reports false if the key was already there.
+func (s *memoryStore) remember(e event.Event) bool {
+	if e.Key == "" {
+		return true
+	}
+	if _, ok := s.seen[e.Key]; ok {
+		return false
+	}
+	if len(s.keys) < s.capacity {
+		s.keys = append(s.keys, e.Key)
+	} else {
+		delete(s.seen, s.keys[s.keyHead])
+		s.keys[s.keyHead] = e.Key
+		s.keyHead = (s.keyHead + 1) % s.capacity
+	}
+	s.seen[e.Key] = struct{}{}
+	return true
+}
+
+func (s *memoryStore) Duplicates() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.duplicates
+}
+
+// ring returns the ring e is queued in.
+// Lost returns how many claimed events were dropped so far because a
+// rollback found the rings full.
+func (s *memoryStore) Lost() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lost
+}
+
+func (s *memoryStore) ring(e event.Event) *eventRing {
+	r := &s.rings[0]
+	if s.priority {
+		r = &s.rings[e.Type.Priority()]
+	}
+	if r.buf == nil {
+		// Any one priority may end up holding everything
+		r.buf = make([]event.Event, s.capacity)
+	}
+	return r
+}
+
+func (s *memoryStore) Insert(ctx context.Context, e event.Event) error {
+	return s.InsertBatch(ctx, []event.Event{e})
+}
+
+func (s *memoryStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+len(events) > s.capacity {
+		return ErrFull
+	}
+	for _, e := range events {
+		if !s.remember(e) {
+			s.duplicates++
+			continue
+		}
+		s.nextID++
+		e.ID = s.nextID
+		s.ring(e).push(e)
+		s.size++
+	}
+	return nil
+}
+
+// Claim takes events from the highest-priority ring first.
+func (s *memoryStore) Claim(ctx context.Context, limit int) (Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := min(limit, s.size)
+	events := make([]event.Event, 0, n)
+	for _, p := range event.Priorities {
+		r := &s.rings[p]
+		for len(events) < n && r.size > 0 {
+			var e event.Event
+			switch s.claim {
+			case config.ClaimLIFO:
+				e = r.popBack()
+			case config.ClaimRandom:
+				e = r.popAt(rand.Intn(r.size))
+			default:
+				e = r.pop()
+			}
+			s.inflight[e.ID] = struct{}{}
+			events = append(events, e)
+		}
+	}
+	s.size -= n
+	return &memoryBatch{store: s, events: events}, nil
+}
+
+// eventRing is a FIFO of events in a fixed-size buffer.
+type eventRing struct {
+	buf  []event.Event
+	head int // index of the oldest event
+	size int
+}
+
+func (r *eventRing) push(e event.Event) {
+	r.buf[(r.head+r.size)%len(r.buf)] = e
+	r.size++
+}
+
+func (r *eventRing) pop() event.Event {
+	e := r.buf[r.head]
+	r.buf[r.head] = event.Event{}
+	r.head = (r.head + 1) % len(r.buf)
+	r.size--
+	return e
+}
+
+// popBack removes the newest event.
+func (r *eventRing) popBack() event.Event {
+	r.size--
+	i := (r.head + r.size) % len(r.buf)
+	e := r.buf[i]
+	r.buf[i] = event.Event{}
+	return e
+}
+
+// popAt removes the i-th oldest event, moving the oldest one into its
+// place.
+func (r *eventRing) popAt(i int) event.Event {
+	i = (r.head + i) % len(r.buf)
+	r.buf[r.head], r.buf[i] = r.buf[i], r.buf[r.head]
+	return r.pop()
+}
+
+// pushFront puts e back at the head, to be popped next.
+func (r *eventRing) pushFront(e event.Event) {
+	r.head = (r.head - 1 + len(r.buf)) % len(r.buf)
+	r.buf[r.head] = e
+	r.size++
+}
+
+type memoryBatch struct {
+	store  *memoryStore
+	events []event.Event
+	done   bool
+}
+
+func (b *memoryBatch) Events() []event.Event { return b.events }
+
+func (b *memoryBatch) Commit(ctx context.Context) error {
+	b.store.mu.Lock()
+	defer b.store.mu.Unlock()
+
+	for _, e := range b.events {
+		delete(b.store.inflight, e.ID)
+	}
+	b.done = true
+	return nil
+}
+
+// Rollback puts the events back where their rings are claimed from, the
+// front or (with LIFO claims) the back, so they are the next ones claimed.
+// If they no longer fit, they are dropped and counted as lost, and the
+// error wraps ErrFull.
+func (b *memoryBatch) Rollback() error {
+	if b.done {
+		return nil
+	}
+	b.done = true
+
+	s := b.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size+len(b.events) > s.capacity {
+		for _, e := range b.events {
+			delete(s.inflight, e.ID)
+		}
+		s.lost += int64(len(b.events))
+		return fmt.Errorf("%w: %d claimed events lost on rollback", ErrFull, len(b.events))
+	}
+	for i := len(b.events) - 1; i >= 0; i-- {
+		r := s.ring(b.events[i])
+		if s.claim == config.ClaimLIFO {
+			r.push(b.events[i])
+		} else {
+			r.pushFront(b.events[i])
+		}
+		s.size++
+		delete(s.inflight, b.events[i].ID)
+	}
+	return nil
+}
+
+func (s *memoryStore) Close() error {
+	return nil
+}
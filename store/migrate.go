@@ -0,0 +1,198 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// migrationFiles are the schema migrations, a directory per database of
+// NNNN_name.sql files applied in order. A file is a text/template rendered
+// with the store's layout, for the choices made when the tables are
+// created, like -partition.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+var migrationName = regexp.MustCompile(`^(\d{4})_([a-z0-9_]+)\.sql$`)
+
+// migration is one step of a database's schema.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// loadMigrations returns the migrations in dir, in order, rendered with
+// layout.
+func loadMigrations(dir string, layout any) ([]migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, path.Join("migrations", dir))
+	if err != nil {
+		return nil, err
+	}
+	var migrations []migration
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("migration %s/%s: not named NNNN_name.sql", dir, e.Name())
+		}
+		tmpl, err := template.ParseFS(migrationFiles, path.Join("migrations", dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		var text strings.Builder
+		if err := tmpl.Execute(&text, layout); err != nil {
+			return nil, err
+		}
+		version, _ := strconv.Atoi(m[1])
+		migrations = append(migrations, migration{version: version, name: m[2], sql: text.String()})
+	}
+	slices.SortFunc(migrations, func(a, b migration) int { return a.version - b.version })
+	return migrations, nil
+}
+
+// migrator brings a database's schema up to date. The versions applied are
+// recorded in schema_migrations, each in the transaction that applied it,
+// so a migration that fails leaves nothing behind and is tried again next
+// time.
+type migrator struct {
+	db  *sql.DB
+	dir string
+	// exists asks whether the table named by its one parameter exists
+	exists string
+	// lock, if set, starts every migration's transaction, to keep
+	// simulators starting at once from migrating together
+	lock string
+}
+
+const migrationsSchema = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+
+// migrate applies the migrations the database hasn't had yet, and returns
+// their names.
+func (m migrator) migrate(ctx context.Context, layout any) ([]string, error) {
+	migrations, err := loadMigrations(m.dir, layout)
+	if err != nil {
+		return nil, err
+	}
+	version, err := m.version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if latest := migrations[len(migrations)-1].version; version > latest {
+		return nil, fmt.Errorf("the database schema is at version %d, newer than this build's %d", version, latest)
+	}
+
+	var applied []string
+	for _, mg := range migrations {
+		if mg.version <= version {
+			continue
+		}
+		ok, err := m.apply(ctx, mg)
+		if err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", mg.version, mg.name, err)
+		}
+		if ok {
+			applied = append(applied, fmt.Sprintf("%04d_%s", mg.version, mg.name))
+		}
+	}
+	return applied, nil
+}
+
+// version returns the latest migration applied, or 0 for an empty
+// database. Tables left by a build from before migrations can't be
+// migrated, only reset.
+func (m migrator) version(ctx context.Context) (int, error) {
+	var tracked, legacy bool
+	if err := m.db.QueryRowContext(ctx, m.exists, "schema_migrations").Scan(&tracked); err != nil {
+		return 0, err
+	}
+	if !tracked {
+		if err := m.db.QueryRowContext(ctx, m.exists, "events").Scan(&legacy); err != nil {
+			return 0, err
+		}
+		if legacy {
+			return 0, errors.New("the tables were created before schema migrations: run once with -reset")
+		}
+		tx, err := m.db.BeginTx(ctx, nil)
+		if err != nil {
+			return 0, err
+		}
+		defer tx.Rollback()
+		if m.lock != "" {
+			if _, err := tx.ExecContext(ctx, m.lock); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, migrationsSchema); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+	}
+	var version int
+	err := m.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// apply runs mg unless someone else got there first, and reports whether
+// it did.
+func (m migrator) apply(ctx context.Context, mg migration) (bool, error) {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if m.lock != "" {
+		if _, err := tx.ExecContext(ctx, m.lock); err != nil {
+			return false, err
+		}
+	}
+	var done bool
+	if err := tx.QueryRowContext(ctx, fmt.Sprintf(`SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = %d)`, mg.version)).Scan(&done); err != nil {
+		return false, err
+	}
+	if done {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, mg.sql); err != nil {
+		return false, err
+	}
+	// The name is a file name checked against migrationName
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`INSERT INTO schema_migrations (version, name) VALUES (%d, '%s')`, mg.version, mg.name)); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// current reports whether every migration has been applied, for a
+// simulator joining tables another one created.
+func (m migrator) current(ctx context.Context, layout any) (bool, error) {
+	migrations, err := loadMigrations(m.dir, layout)
+	if err != nil {
+		return false, err
+	}
+	var tracked bool
+	if err := m.db.QueryRowContext(ctx, m.exists, "schema_migrations").Scan(&tracked); err != nil || !tracked {
+		return false, err
+	}
+	var version int
+	if err := m.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return false, err
+	}
+	return version == migrations[len(migrations)-1].version, nil
+}
@@ -0,0 +1,39 @@
+-- The events table, the work queue: one plain table, or with -partition a
+-- table range-partitioned by created_at. The partitioned table's keys have
+-- to include created_at, and a default partition catches events whose time
+-- has no partition of its own - ones from before the oldest kept, or after
+-- the newest created. The index pending events are claimed through depends
+-- on -claim, and is built at startup rather than here.
+{{if .Partitioned}}
+CREATE TABLE events (
+	id SERIAL,
+	type VARCHAR(20),
+	data JSONB,
+	priority SMALLINT NOT NULL DEFAULT 0,
+	idem_key UUID,
+	processed BOOLEAN DEFAULT false,
+	scored BOOLEAN NOT NULL DEFAULT false,
+	exported BOOLEAN NOT NULL DEFAULT false,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	PRIMARY KEY (id, created_at),
+	UNIQUE (idem_key, created_at)
+) PARTITION BY RANGE (created_at);
+CREATE TABLE events_default PARTITION OF events DEFAULT;
+{{else}}
+CREATE TABLE events (
+	id SERIAL PRIMARY KEY,
+	type VARCHAR(20),
+	data JSONB,
+	priority SMALLINT NOT NULL DEFAULT 0,
+	idem_key UUID UNIQUE,
+	processed BOOLEAN DEFAULT false,
+	scored BOOLEAN NOT NULL DEFAULT false,
+	exported BOOLEAN NOT NULL DEFAULT false,
+	created_at TIMESTAMP DEFAULT NOW()
+);
+{{end}}
+CREATE INDEX idx_events_processed ON events(processed) WHERE NOT processed;
+CREATE INDEX idx_events_unscored ON events(id)
+	WHERE processed AND NOT scored AND type IN ('upvote', 'downvote');
+CREATE INDEX idx_events_unexported ON events(id) WHERE processed AND NOT exported;
+CREATE INDEX idx_events_subreddit ON events((data->>'subreddit'), id);
@@ -0,0 +1,95 @@
+-- The slice of Reddit the simulator exercises, which processors
+-- materialize events into. Posts and comments keep their generator-assigned
+-- "t3_..."/"t1_..." fullnames as primary keys so that later events can
+-- reference them before they're stored.
+CREATE TABLE users (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE TABLE subreddits (
+	id SERIAL PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ DEFAULT NOW()
+);
+CREATE TABLE posts (
+	id TEXT PRIMARY KEY,
+	subreddit_id INTEGER NOT NULL REFERENCES subreddits(id),
+	author_id INTEGER NOT NULL REFERENCES users(id),
+	title TEXT NOT NULL,
+	comment_count INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ NOT NULL,
+	removed_at TIMESTAMPTZ
+);
+CREATE INDEX idx_posts_subreddit ON posts(subreddit_id, created_at DESC);
+CREATE TABLE comments (
+	id TEXT PRIMARY KEY,
+	post_id TEXT NOT NULL REFERENCES posts(id),
+	-- NULL for a top-level comment; depth counts from 1 at the top
+	parent_id TEXT REFERENCES comments(id),
+	depth INTEGER NOT NULL,
+	replies INTEGER NOT NULL DEFAULT 0,
+	author_id INTEGER NOT NULL REFERENCES users(id),
+	body TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	removed_at TIMESTAMPTZ
+);
+CREATE INDEX idx_comments_post ON comments(post_id);
+CREATE INDEX idx_comments_parent ON comments(parent_id);
+CREATE TABLE votes (
+	post_id TEXT NOT NULL REFERENCES posts(id),
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+	created_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (post_id, user_id)
+);
+CREATE TABLE comment_votes (
+	comment_id TEXT NOT NULL REFERENCES comments(id),
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	value SMALLINT NOT NULL CHECK (value IN (-1, 1)),
+	created_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (comment_id, user_id)
+);
+-- thing_id is a post or a comment; resolution is 'removed' or
+-- 'approved' once a moderator has acted on the report
+CREATE TABLE reports (
+	id SERIAL PRIMARY KEY,
+	thing_id TEXT NOT NULL,
+	reporter_id INTEGER NOT NULL REFERENCES users(id),
+	reason TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	resolution TEXT,
+	resolved_at TIMESTAMPTZ
+);
+CREATE INDEX idx_reports_open ON reports(thing_id) WHERE resolution IS NULL;
+CREATE TABLE bans (
+	subreddit_id INTEGER NOT NULL REFERENCES subreddits(id),
+	user_id INTEGER NOT NULL REFERENCES users(id),
+	moderator_id INTEGER NOT NULL REFERENCES users(id),
+	reason TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (subreddit_id, user_id)
+);
+CREATE TABLE post_ranks (
+	post_id TEXT PRIMARY KEY REFERENCES posts(id),
+	ups INTEGER NOT NULL DEFAULT 0,
+	downs INTEGER NOT NULL DEFAULT 0,
+	hot DOUBLE PRECISION NOT NULL DEFAULT 0,
+	dirty BOOLEAN NOT NULL DEFAULT TRUE
+);
+CREATE INDEX idx_post_ranks_hot ON post_ranks(hot DESC);
+CREATE INDEX idx_post_ranks_dirty ON post_ranks(post_id) WHERE dirty;
+CREATE TABLE karma (
+	user_id INTEGER PRIMARY KEY REFERENCES users(id),
+	post_karma INTEGER NOT NULL DEFAULT 0,
+	comment_karma INTEGER NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- Raw tallies of every vote event, folded in incrementally; unlike
+-- post_ranks, a user who votes twice is counted twice
+CREATE TABLE post_scores (
+	post_id TEXT PRIMARY KEY REFERENCES posts(id),
+	ups INTEGER NOT NULL DEFAULT 0,
+	downs INTEGER NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,19 @@
+-- The -outbox tables: the activity processors derive from events, and the
+-- outbox the relay drains.
+CREATE TABLE activity (
+	event_id BIGINT PRIMARY KEY,
+	user_name TEXT NOT NULL,
+	action TEXT NOT NULL,
+	subreddit TEXT NOT NULL,
+	post_id TEXT,
+	comment_id TEXT,
+	at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE outbox (
+	id BIGSERIAL PRIMARY KEY,
+	key TEXT NOT NULL,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	published_at TIMESTAMPTZ
+);
+CREATE INDEX idx_outbox_pending ON outbox(id) WHERE published_at IS NULL;
@@ -0,0 +1,14 @@
+-- The registry of simulators sharing the database.
+CREATE TABLE instances (
+	name TEXT PRIMARY KEY,
+	host TEXT NOT NULL,
+	pid INTEGER NOT NULL,
+	started_at TIMESTAMPTZ NOT NULL,
+	heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+	generated BIGINT NOT NULL DEFAULT 0,
+	stored BIGINT NOT NULL DEFAULT 0,
+	processed BIGINT NOT NULL DEFAULT 0,
+	events_per_sec DOUBLE PRECISION NOT NULL DEFAULT 0,
+	processed_per_sec DOUBLE PRECISION NOT NULL DEFAULT 0,
+	leader BOOLEAN NOT NULL DEFAULT FALSE
+);
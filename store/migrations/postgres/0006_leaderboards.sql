@@ -0,0 +1,12 @@
+-- The leaderboards the leaderboard job recomputes: for each board, its
+-- top entries by rank. item is a post's fullname, a user's or a
+-- subreddit's name; title is the post's title on top_posts.
+CREATE TABLE leaderboards (
+	board TEXT NOT NULL,
+	rank INTEGER NOT NULL,
+	item TEXT NOT NULL,
+	title TEXT NOT NULL DEFAULT '',
+	score BIGINT NOT NULL,
+	computed_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (board, rank)
+);
@@ -0,0 +1,45 @@
+-- The analytics views the views job refreshes: events a minute by type,
+-- each subreddit's activity, the most active users, and the enriched
+-- events by the country and device they were sent from. Each has the
+-- unique index REFRESH MATERIALIZED VIEW CONCURRENTLY needs to refresh it
+-- without locking out its readers.
+CREATE MATERIALIZED VIEW events_per_minute AS
+	SELECT date_trunc('minute', created_at) AS minute, type, COUNT(*) AS events
+	FROM events
+	GROUP BY 1, 2;
+CREATE UNIQUE INDEX ON events_per_minute (minute, type);
+
+CREATE MATERIALIZED VIEW subreddit_activity AS
+	SELECT data->>'subreddit' AS subreddit,
+		COUNT(*) AS events,
+		COUNT(*) FILTER (WHERE type = 'post') AS posts,
+		COUNT(*) FILTER (WHERE type = 'comment') AS comments,
+		COUNT(*) FILTER (WHERE type IN ('upvote', 'downvote')) AS votes,
+		COUNT(DISTINCT data->>'user') AS users
+	FROM events
+	WHERE data->>'subreddit' IS NOT NULL
+	GROUP BY 1;
+CREATE UNIQUE INDEX ON subreddit_activity (subreddit);
+
+CREATE MATERIALIZED VIEW top_users AS
+	SELECT data->>'user' AS name,
+		COUNT(*) AS events,
+		COUNT(*) FILTER (WHERE type = 'post') AS posts,
+		COUNT(*) FILTER (WHERE type = 'comment') AS comments,
+		COUNT(*) FILTER (WHERE type IN ('upvote', 'downvote')) AS votes
+	FROM events
+	WHERE data->>'user' IS NOT NULL
+	GROUP BY 1
+	ORDER BY 2 DESC, 1
+	LIMIT 100;
+CREATE UNIQUE INDEX ON top_users (name);
+
+CREATE MATERIALIZED VIEW client_activity AS
+	SELECT data->'client'->>'country' AS country,
+		data->'client'->>'device' AS device,
+		COUNT(*) AS events,
+		COUNT(DISTINCT data->>'user') AS users
+	FROM events
+	WHERE data ? 'client'
+	GROUP BY 1, 2;
+CREATE UNIQUE INDEX ON client_activity (country, device);
@@ -0,0 +1,15 @@
+-- The events table, the work queue. The index unclaimed events are claimed
+-- through depends on -claim, and is built at startup rather than here.
+CREATE TABLE events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	type TEXT,
+	data TEXT,
+	priority INTEGER NOT NULL DEFAULT 0,
+	idem_key TEXT UNIQUE,
+	processed INTEGER NOT NULL DEFAULT 0,
+	claimed_at TIMESTAMP,
+	exported INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX idx_events_subreddit ON events(json_extract(data, '$.subreddit'), id);
+CREATE INDEX idx_events_unexported ON events(id) WHERE processed = 1 AND exported = 0;
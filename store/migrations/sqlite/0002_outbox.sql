@@ -0,0 +1,19 @@
+-- The -outbox tables: the activity processors derive from events, and the
+-- outbox the relay drains.
+CREATE TABLE activity (
+	event_id INTEGER PRIMARY KEY,
+	user_name TEXT NOT NULL,
+	action TEXT NOT NULL,
+	subreddit TEXT NOT NULL,
+	post_id TEXT,
+	comment_id TEXT,
+	at TIMESTAMP NOT NULL
+);
+CREATE TABLE outbox (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	key TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	created_at TIMESTAMP NOT NULL,
+	published_at TIMESTAMP
+);
+CREATE INDEX idx_outbox_pending ON outbox(id) WHERE published_at IS NULL;
@@ -0,0 +1,10 @@
+-- Users the anomaly detector (-detect) flagged, and why.
+CREATE TABLE flags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_name TEXT NOT NULL,
+	reason TEXT NOT NULL,
+	events INTEGER NOT NULL,
+	detail TEXT NOT NULL,
+	flagged_at TIMESTAMP NOT NULL
+);
+CREATE INDEX idx_flags_user ON flags(user_name);
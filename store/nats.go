@@ -0,0 +1,232 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// natsStore runs the pipeline over a NATS JetStream stream instead of a
+// database table: writers publish each event to <subject>.<type> and wait
+// for the server's ack, and processors share one durable pull consumer.
+//
+// A claim is a fetch of up to limit messages. Commit acks them, Rollback
+// naks them so the server redelivers them, and anything neither acked nor
+// nakked comes back after the ack wait - at-least-once processing without
+// the DB-as-queue pattern. The event ID is the message's stream sequence.
+//
+// Unlike the database stores, InsertBatch is not atomic: if some publishes
+// fail the rest are already in the stream. Event keys go out as message
+// IDs, so the server drops a republished event as long as it arrives
+// within the stream's duplicate window (two minutes by default).
+type natsStore struct {
+	nc         *nats.Conn
+	js         jetstream.JetStream
+	consumer   jetstream.Consumer
+	subject    string
+	duplicates atomic.Int64
+}
+
+// natsAckWait is how long a fetched message may go unacknowledged before
+// JetStream redelivers it to another processor.
+const natsAckWait = 30 * time.Second
+
+// newNATSStore connects to cfg.URL and recreates the stream and its
+// consumer, so every run starts from an empty stream like the other
+// backends start from an empty table.
+func newNATSStore(cfg config.NATS) (*natsStore, error) {
+	nc, err := nats.Connect(cfg.URL, nats.Name("reddit-sim"))
+	if err != nil {
+		return nil, err
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := js.DeleteStream(ctx, cfg.Stream); err != nil && !errors.Is(err, jetstream.ErrStreamNotFound) {
+		nc.Close()
+		return nil, err
+	}
+	stream, err := js.CreateStream(ctx, jetstream.StreamConfig{
+		Name:     cfg.Stream,
+		Subjects: []string{cfg.Subject + ".>"},
+		Storage:  jetstream.FileStorage,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("create stream %s: %w", cfg.Stream, err)
+	}
+	consumer, err := stream.CreateOrUpdateConsumer(ctx, jetstream.ConsumerConfig{
+		Durable:       cfg.Consumer,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       natsAckWait,
+		MaxAckPending: -1,
+	})
+	if err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("create consumer %s: %w", cfg.Consumer, err)
+	}
+	return &natsStore{nc: nc, js: js, consumer: consumer, subject: cfg.Subject}, nil
+}
+
+func (s *natsStore) Insert(ctx context.Context, e event.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	ack, err := s.js.Publish(ctx, s.subject+"."+e.Type.String(), data, publishOpts(e)...)
+	if err != nil {
+		return err
+	}
+	if ack.Duplicate {
+		s.duplicates.Add(1)
+	}
+	return nil
+}
+
+func (s *natsStore) Duplicates() int64 { return s.duplicates.Load() }
+
+// publishOpts tags the message with e's key, if it has one.
+func publishOpts(e event.Event) []jetstream.PublishOpt {
+	if e.Key == "" {
+		return nil
+	}
+	return []jetstream.PublishOpt{jetstream.WithMsgID(e.Key)}
+}
+
+// InsertBatch publishes every event asynchronously and then waits for all
+// the acks, so a batch costs roughly one round trip.
+func (s *natsStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	acks := make([]jetstream.PubAckFuture, 0, len(events))
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		ack, err := s.js.PublishAsync(s.subject+"."+e.Type.String(), data, publishOpts(e)...)
+		if err != nil {
+			return err
+		}
+		acks = append(acks, ack)
+	}
+
+	var failed int
+	var firstErr error
+	for _, ack := range acks {
+		select {
+		case pa := <-ack.Ok():
+			if pa.Duplicate {
+				s.duplicates.Add(1)
+			}
+		case err := <-ack.Err():
+			failed++
+			if firstErr == nil {
+				firstErr = err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if firstErr != nil {
+		return fmt.Errorf("%d of %d publishes failed: %w", failed, len(events), firstErr)
+	}
+	return nil
+}
+
+// Claim fetches whatever is available right now, up to limit messages,
+// without waiting for more to arrive.
+func (s *natsStore) Claim(ctx context.Context, limit int) (Batch, error) {
+	fetched, err := s.consumer.FetchNoWait(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &natsBatch{}
+	for msg := range fetched.Messages() {
+		var e event.Event
+		if err := json.Unmarshal(msg.Data(), &e); err != nil {
+			// Undecodable: redelivering won't help
+			msg.Term()
+			continue
+		}
+		if meta, err := msg.Metadata(); err == nil {
+			e.ID = int64(meta.Sequence.Stream)
+		}
+		b.msgs = append(b.msgs, msg)
+		b.events = append(b.events, e)
+	}
+	if err := fetched.Error(); err != nil {
+		b.Rollback()
+		return nil, err
+	}
+	return b, nil
+}
+
+type natsBatch struct {
+	msgs   []jetstream.Msg
+	events []event.Event
+	done   bool
+}
+
+func (b *natsBatch) Events() []event.Event { return b.events }
+
+// Commit acks every message. The acks are fire-and-forget; if one is lost
+// the message is redelivered after the ack wait, which at-least-once
+// processing has to tolerate anyway.
+func (b *natsBatch) Commit(ctx context.Context) error {
+	b.done = true
+	for _, msg := range b.msgs {
+		if err := msg.Ack(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Rollback naks every message so JetStream redelivers it straight away
+// instead of after the ack wait.
+func (b *natsBatch) Rollback() error {
+	if b.done {
+		return nil
+	}
+	b.done = true
+	var errs []error
+	for _, msg := range b.msgs {
+		errs = append(errs, msg.Nak())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *natsStore) Ping(ctx context.Context) error {
+	if !s.nc.IsConnected() {
+		return fmt.Errorf("nats: %s", s.nc.Status())
+	}
+	return nil
+}
+
+func (s *natsStore) Close() error {
+	return s.nc.Drain()
+}
+
+// QueueDepth is the number of messages the consumer has yet to deliver.
+func (s *natsStore) QueueDepth(ctx context.Context) (int, error) {
+	info, err := s.consumer.Info(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int(info.NumPending), nil
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"web-traffic-sim/event"
+)
+
+// activity is the record processors derive from every event in outbox
+// mode: one line of the acting user's activity feed.
+type activity struct {
+	EventID   int64     `json:"event_id"`
+	User      string    `json:"user"`
+	Action    string    `json:"action"`
+	Subreddit string    `json:"subreddit"`
+	PostID    string    `json:"post_id,omitempty"`
+	CommentID string    `json:"comment_id,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+func activityOf(e event.Event) activity {
+	return activity{
+		EventID:   e.ID,
+		User:      e.User,
+		Action:    e.Type.String(),
+		Subreddit: e.Subreddit,
+		PostID:    e.PostID,
+		CommentID: e.CommentID,
+		At:        e.Timestamp,
+	}
+}
+
+// key is what the outbox entry for a is partitioned by: its post, so a
+// consumer sees everything that happens to a post in order, or the user
+// for activity outside any post.
+func (a activity) key() string {
+	if a.PostID != "" {
+		return a.PostID
+	}
+	return a.User
+}
+
+// OutboxEntry is a message in the outbox table, waiting to be relayed.
+type OutboxEntry struct {
+	ID        int64
+	Key       string
+	Payload   json.RawMessage // the activity, as JSON
+	CreatedAt time.Time
+}
+
+// scanOutbox reads (id, key, payload, created_at) rows.
+func scanOutbox(rows *sql.Rows) ([]OutboxEntry, error) {
+	defer rows.Close()
+
+	var entries []OutboxEntry
+	for rows.Next() {
+		var (
+			e       OutboxEntry
+			payload []byte
+		)
+		if err := rows.Scan(&e.ID, &e.Key, &payload, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.Payload = payload
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,26 @@
+package store
+
+import (
+	"time"
+
+	"web-traffic-sim/config"
+)
+
+// PartitionInfo is one partition and the created_at range it holds, From
+// inclusive and To exclusive.
+type PartitionInfo struct {
+	Name string    `json:"name"`
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// partitionPeriods are, by Partition.By, the time range one partition
+// holds and the layout of the time its name ends in. Periods start on the
+// hour or at midnight, UTC.
+var partitionPeriods = map[string]struct {
+	length time.Duration
+	layout string
+}{
+	config.PartitionHour: {time.Hour, "2006010215"},
+	config.PartitionDay:  {24 * time.Hour, "20060102"},
+}
@@ -0,0 +1,146 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+func (s *postgresStore) partitioned() bool { return s.partition.By != config.PartitionNone }
+
+// partitionPrefix starts every time partition's name; the rest is the
+// start of its period.
+const partitionPrefix = "events_p"
+
+// Partitions lists the partitions by name, which sorts them by time. The
+// default partition, and any not named for this simulator's period, are
+// left out.
+func (s *postgresStore) Partitions(ctx context.Context) ([]PartitionInfo, error) {
+	period := partitionPeriods[s.partition.By]
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT c.relname FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'events'::regclass
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parts []PartitionInfo
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		from, err := time.Parse(period.layout, strings.TrimPrefix(name, partitionPrefix))
+		if !strings.HasPrefix(name, partitionPrefix) || err != nil {
+			continue
+		}
+		parts = append(parts, PartitionInfo{Name: name, From: from, To: from.Add(period.length)})
+	}
+	return parts, rows.Err()
+}
+
+// MaintainPartitions creates the missing partitions one at a time, so a
+// failure keeps the ones already created. Creating a partition scans the
+// default partition for rows that belong in it, which is cheap as long as
+// the partitions stay ahead of the clock and the default stays empty.
+// Dropping one takes a brief exclusive lock on the events table.
+func (s *postgresStore) MaintainPartitions(ctx context.Context, now time.Time) (created, dropped []string, err error) {
+	parts, err := s.Partitions(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	exists := map[string]bool{}
+	for _, p := range parts {
+		exists[p.Name] = true
+	}
+
+	period := partitionPeriods[s.partition.By]
+	current := now.UTC().Truncate(period.length)
+	for i := 0; i <= s.partition.Ahead; i++ {
+		from := current.Add(time.Duration(i) * period.length)
+		name := partitionPrefix + from.Format(period.layout)
+		if exists[name] {
+			continue
+		}
+		_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF events FOR VALUES FROM ('%s') TO ('%s')`,
+			name, from.Format(time.RFC3339), from.Add(period.length).Format(time.RFC3339)))
+		if err != nil {
+			return created, dropped, err
+		}
+		created = append(created, name)
+	}
+
+	if s.partition.Retain == 0 {
+		return created, dropped, nil
+	}
+	for _, p := range parts {
+		if now.Sub(p.To) <= s.partition.Retain {
+			break
+		}
+		if _, err := s.db.ExecContext(ctx, `DROP TABLE IF EXISTS `+p.Name); err != nil {
+			return created, dropped, err
+		}
+		dropped = append(dropped, p.Name)
+	}
+	return created, dropped, nil
+}
+
+// ExpirePartitions streams each partition's events to archive before it
+// drops the partition. An event that lands in a partition after it has
+// been archived - one whose own time is already past the retention - is
+// dropped with it unarchived.
+func (s *postgresStore) ExpirePartitions(ctx context.Context, age time.Duration, exported bool, archive ArchiveFunc) ([]string, error) {
+	parts, err := s.Partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var dropped []string
+	for _, p := range parts {
+		if time.Since(p.To) <= age {
+			break
+		}
+		var pending bool
+		err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+p.Name+` WHERE NOT processed OR (NOT exported AND $1))`, exported).Scan(&pending)
+		if err != nil {
+			return dropped, err
+		}
+		if pending {
+			continue
+		}
+		if archive != nil {
+			err := archive(p.Name, func(emit func(event.Event) error) error {
+				rows, err := s.db.QueryContext(ctx, `SELECT id, data FROM `+p.Name+` ORDER BY id`)
+				if err != nil {
+					return err
+				}
+				defer rows.Close()
+				for rows.Next() {
+					e, err := scanEvent(rows)
+					if err != nil {
+						return err
+					}
+					if err := emit(e); err != nil {
+						return err
+					}
+				}
+				return rows.Err()
+			})
+			if err != nil {
+				return dropped, err
+			}
+		}
+		if _, err := s.db.ExecContext(ctx, `DROP TABLE IF EXISTS `+p.Name); err != nil {
+			return dropped, err
+		}
+		dropped = append(dropped, p.Name)
+	}
+	return dropped, nil
+}
@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"math"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// pgxStore is the postgres store on the pgx driver (-driver pgx). The
+// writers insert through pgx's native interface, with its binary protocol
+// and a statement cache on every connection, and a batch goes to the
+// server as one pipelined round trip. Everything else - claims, the domain
+// model, the background jobs - runs the postgres store's database/sql code
+// on the same pool through pgx's stdlib adapter, so the two drivers run
+// the same workload and only the inserts differ.
+type pgxStore struct {
+	*postgresStore
+	pool *pgxpool.Pool
+}
+
+func newPgxStore(connStr string, p config.Processor, pool config.Pool, part config.Partition, prepare, join, reset bool) (*pgxStore, error) {
+	pcfg, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, err
+	}
+	// pgxpool has no unlimited or never-recycled setting, so 0 means as
+	// many and as long as it can count. MaxIdle has no equivalent: pgx
+	// closes connections once they have been idle for half an hour.
+	pcfg.MaxConns = math.MaxInt32
+	if pool.MaxOpen > 0 {
+		pcfg.MaxConns = int32(pool.MaxOpen)
+	}
+	pcfg.MaxConnLifetime = math.MaxInt64
+	if pool.MaxLifetime > 0 {
+		pcfg.MaxConnLifetime = pool.MaxLifetime
+	}
+	pgxPool, err := pgxpool.NewWithConfig(context.Background(), pcfg)
+	if err != nil {
+		return nil, err
+	}
+	ps, err := setupPostgres(stdlib.OpenDBFromPool(pgxPool), connStr, p, part, prepare, join, reset)
+	if err != nil {
+		pgxPool.Close()
+		return nil, err
+	}
+	return &pgxStore{postgresStore: ps, pool: pgxPool}, nil
+}
+
+func (s *pgxStore) Insert(ctx context.Context, e event.Event) error {
+	jsonData, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	tag, err := s.pool.Exec(ctx, s.insert.query, e.Type.String(), jsonData, e.Type.Priority(), e.Key)
+	return s.countTag(tag, err, 1)
+}
+
+// InsertBatch queues one INSERT per event and sends them all at once. pgx
+// pipelines the batch - the server runs each statement as it arrives and
+// the results come back together - so a batch costs one round trip, like
+// the pq store's unnest, without building arrays on either side.
+func (s *pgxStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	batch := &pgx.Batch{}
+	for _, e := range events {
+		jsonData, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		batch.Queue(s.insert.query, e.Type.String(), jsonData, e.Type.Priority(), e.Key)
+	}
+	br := s.pool.SendBatch(ctx, batch)
+	var inserted int64
+	for range events {
+		tag, err := br.Exec()
+		if err != nil {
+			br.Close()
+			return err
+		}
+		inserted += tag.RowsAffected()
+	}
+	if err := br.Close(); err != nil {
+		return err
+	}
+	s.duplicates.Add(int64(len(events)) - inserted)
+	return nil
+}
+
+// countTag counts the events of a native insert that the unique key
+// turned away.
+func (s *pgxStore) countTag(tag pgconn.CommandTag, err error, events int) error {
+	if err != nil {
+		return err
+	}
+	s.duplicates.Add(int64(events) - tag.RowsAffected())
+	return nil
+}
+
+// PoolStats reports pgx's own pool. The database/sql pool on top of it
+// keeps no idle connections of its own, so its figures would only show
+// the connections checked out through it.
+func (s *pgxStore) PoolStats() sql.DBStats {
+	st := s.pool.Stat()
+	stats := sql.DBStats{
+		MaxOpenConnections: int(st.MaxConns()),
+		OpenConnections:    int(st.TotalConns()),
+		InUse:              int(st.AcquiredConns()),
+		Idle:               int(st.IdleConns()),
+		WaitCount:          st.EmptyAcquireCount(),
+		WaitDuration:       st.EmptyAcquireWaitTime(),
+		MaxIdleClosed:      st.MaxIdleDestroyCount(),
+		MaxLifetimeClosed:  st.MaxLifetimeDestroyCount(),
+	}
+	if stats.MaxOpenConnections == math.MaxInt32 {
+		stats.MaxOpenConnections = 0
+	}
+	return stats
+}
+
+func (s *pgxStore) Ping(ctx context.Context) error {
+	return s.pool.Ping(ctx)
+}
+
+func (s *pgxStore) Close() error {
+	err := s.postgresStore.Close()
+	s.pool.Close()
+	return err
+}
@@ -0,0 +1,730 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/lib/pq"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// notifyChannel is the LISTEN/NOTIFY channel raised after inserts.
+const notifyChannel = "events_inserted"
+
+// postgresStore keeps events in a single PostgreSQL table, using the
+// database itself as the work queue.
+type postgresStore struct {
+	db      *sql.DB
+	connStr string
+	// claimOrder is the ORDER BY of Claim
+	claimOrder string
+	// The hot-path statements: one per event or batch written or claimed
+	insert, insertBatch, claim, markProcessed pgQuery
+	duplicates                                atomic.Int64
+	// leader is the session holding the leader lock, while this
+	// instance leads
+	leader *sql.Conn
+	// partition is how the events table is split by time, if it is
+	partition config.Partition
+}
+
+// newPostgresStore connects to connStr and migrates the events table and
+// the Reddit domain tables the processor materializes events into to this
+// build's schema, dropping them first with reset, unless it is to join
+// another simulator's tables. Claim takes events in the order p asks for,
+// the connection pool is sized by pool, and a new events table is
+// partitioned as part asks. With prepare the hot-path statements are
+// prepared once the tables exist.
+func newPostgresStore(connStr string, p config.Processor, pool config.Pool, part config.Partition, prepare, join, reset bool) (*postgresStore, error) {
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(pool.MaxOpen)
+	db.SetMaxIdleConns(pool.MaxIdle)
+	db.SetConnMaxLifetime(pool.MaxLifetime)
+	return setupPostgres(db, connStr, p, part, prepare, join, reset)
+}
+
+// setupPostgres is the part of newPostgresStore that doesn't depend on the
+// driver behind db. It closes db if it fails.
+func setupPostgres(db *sql.DB, connStr string, p config.Processor, part config.Partition, prepare, join, reset bool) (*postgresStore, error) {
+	s := &postgresStore{db: db, connStr: connStr, claimOrder: claimOrder(p), partition: part}
+	if err := s.migrate(p, join, reset); err != nil {
+		db.Close()
+		return nil, err
+	}
+	// The inserts depend on the table's layout, which whoever created it
+	// chose
+	var partitioned bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_partitioned_table WHERE partrelid = 'events'::regclass)`).Scan(&partitioned)
+	if err == nil && partitioned != s.partitioned() {
+		err = fmt.Errorf("the events table is partitioned=%t: use the -partition it was created with, or -reset", partitioned)
+	}
+	if err == nil && s.partitioned() && !join {
+		// The partitions events are about to be written to have to
+		// exist before the first insert, or it lands in the default one
+		_, _, err = s.MaintainPartitions(context.Background(), time.Now())
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.prepare(prepare); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// pgLayout is what the PostgreSQL migrations are rendered with.
+type pgLayout struct {
+	Partitioned bool
+}
+
+// pgReset drops every table the simulator creates.
+const pgReset = `
+	DROP TABLE IF EXISTS schema_migrations, leaderboards, flags, instances, events, outbox, activity, karma, post_scores, post_ranks, bans, reports, comment_votes, votes, comments, posts, subreddits, users CASCADE`
+
+// migrate brings the tables up to date, after dropping them with reset,
+// and rebuilds the index pending events are claimed through for p's
+// order. A simulator joining another only checks that it did the same.
+func (s *postgresStore) migrate(p config.Processor, join, reset bool) error {
+	ctx := context.Background()
+	m := migrator{
+		db:     s.db,
+		dir:    "postgres",
+		exists: `SELECT to_regclass($1) IS NOT NULL`,
+		lock:   `SELECT pg_advisory_xact_lock(hashtext('go-reddit-sim migrate'))`,
+	}
+	layout := pgLayout{Partitioned: s.partitioned()}
+	if join {
+		current, err := m.current(ctx, layout)
+		if err == nil && !current {
+			err = errors.New("nothing to join: start the first simulator, from this build, without -join")
+		}
+		return err
+	}
+
+	if reset {
+		if _, err := s.db.ExecContext(ctx, pgReset); err != nil {
+			return err
+		}
+	}
+	applied, err := m.migrate(ctx, layout)
+	for _, name := range applied {
+		slog.Info("applied migration", "migration", name)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		DROP INDEX IF EXISTS idx_events_pending;
+		CREATE INDEX idx_events_pending ON events(`+claimIndex(p)+`) WHERE NOT processed`)
+	return err
+}
+
+// pgQuery is a hot-path statement: its SQL and, with -prepare, the
+// statement prepared from it. database/sql prepares a statement on each
+// connection the first time it runs there and reuses it afterwards, so the
+// server parses and plans it once per connection rather than every time.
+type pgQuery struct {
+	query string
+	stmt  *sql.Stmt
+}
+
+// prepare sets up the hot-path statements, preparing them if asked to.
+// It closes the database if that fails, as the constructor would.
+func (s *postgresStore) prepare(prepare bool) error {
+	queries := []struct {
+		q     *pgQuery
+		query string
+	}{
+		{&s.insert, pgInsert},
+		{&s.insertBatch, pgInsertBatch},
+		{&s.claim, fmt.Sprintf(pgClaim, s.claimOrder)},
+		{&s.markProcessed, pgMarkProcessed},
+	}
+	if s.partitioned() {
+		queries[0].query, queries[1].query = pgInsertPartitioned, pgInsertBatchPartitioned
+	}
+	for _, q := range queries {
+		q.q.query = q.query
+		if !prepare {
+			continue
+		}
+		stmt, err := s.db.Prepare(q.query)
+		if err != nil {
+			s.db.Close()
+			return err
+		}
+		q.q.stmt = stmt
+	}
+	return nil
+}
+
+func (q pgQuery) exec(ctx context.Context, db *sql.DB, args ...any) (sql.Result, error) {
+	if q.stmt != nil {
+		return q.stmt.ExecContext(ctx, args...)
+	}
+	return db.ExecContext(ctx, q.query, args...)
+}
+
+// execTx and queryTx run q in tx. A prepared statement is looked up on the
+// transaction's connection, and prepared there if this is its first use.
+func (q pgQuery) execTx(ctx context.Context, tx *sql.Tx, args ...any) (sql.Result, error) {
+	if q.stmt != nil {
+		return tx.StmtContext(ctx, q.stmt).ExecContext(ctx, args...)
+	}
+	return tx.ExecContext(ctx, q.query, args...)
+}
+
+func (q pgQuery) queryTx(ctx context.Context, tx *sql.Tx, args ...any) (*sql.Rows, error) {
+	if q.stmt != nil {
+		return tx.StmtContext(ctx, q.stmt).QueryContext(ctx, args...)
+	}
+	return tx.QueryContext(ctx, q.query, args...)
+}
+
+const (
+	pgInsert = `
+		INSERT INTO events (type, data, priority, idem_key)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid)
+		ON CONFLICT (idem_key) DO NOTHING
+	`
+	pgInsertBatch = `
+		INSERT INTO events (type, data, priority, idem_key)
+		SELECT v.type, v.data, v.priority, NULLIF(v.key, '')::uuid
+		FROM unnest($1::text[], $2::jsonb[], $3::smallint[], $4::text[]) AS v(type, data, priority, key)
+		ON CONFLICT (idem_key) DO NOTHING
+	`
+	// A partitioned table can only enforce keys that include created_at,
+	// so there it is the event's own timestamp rather than the insert's:
+	// a redelivered event then has the same key and created_at as the
+	// copy already stored, and is turned away just the same
+	pgInsertPartitioned = `
+		INSERT INTO events (type, data, priority, idem_key, created_at)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, ($2::jsonb->>'timestamp')::timestamptz)
+		ON CONFLICT (idem_key, created_at) DO NOTHING
+	`
+	pgInsertBatchPartitioned = `
+		INSERT INTO events (type, data, priority, idem_key, created_at)
+		SELECT v.type, v.data, v.priority, NULLIF(v.key, '')::uuid, (v.data->>'timestamp')::timestamptz
+		FROM unnest($1::text[], $2::jsonb[], $3::smallint[], $4::text[]) AS v(type, data, priority, key)
+		ON CONFLICT (idem_key, created_at) DO NOTHING
+	`
+	// pgClaim takes the claim order
+	pgClaim = `
+		SELECT id, data FROM events
+		WHERE processed = false
+		ORDER BY %s
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`
+	pgMarkProcessed = `
+		UPDATE events
+		SET processed = true
+		WHERE id = ANY($1)
+	`
+)
+
+func (s *postgresStore) Insert(ctx context.Context, e event.Event) error {
+	// Convert event to JSON for PostgreSQL JSONB
+	jsonData, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.insert.exec(ctx, s.db, e.Type.String(), jsonData, e.Type.Priority(), e.Key)
+	return s.countDuplicates(res, err, 1)
+}
+
+// countDuplicates counts the events of an insert that the unique key
+// turned away.
+func (s *postgresStore) countDuplicates(res sql.Result, err error, events int) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	s.duplicates.Add(int64(events) - n)
+	return nil
+}
+
+func (s *postgresStore) Duplicates() int64 { return s.duplicates.Load() }
+
+// InsertBatch inserts the batch as one set-based INSERT from unnested
+// arrays. COPY would be cheaper, but it can't skip the events whose key is
+// already stored, and redelivered batches have to be let through minus
+// their duplicates rather than fail as a whole.
+func (s *postgresStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	var (
+		types, data, keys []string
+		priorities        []int64
+	)
+	for _, e := range events {
+		jsonData, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		types = append(types, e.Type.String())
+		data = append(data, string(jsonData))
+		priorities = append(priorities, int64(e.Type.Priority()))
+		keys = append(keys, e.Key)
+	}
+	res, err := s.insertBatch.exec(ctx, s.db, pq.Array(types), pq.Array(data), pq.Array(priorities), pq.Array(keys))
+	return s.countDuplicates(res, err, len(events))
+}
+
+// Claim opens a transaction and locks a batch with FOR UPDATE SKIP LOCKED.
+// The row locks are what keep competing processors apart, so they have to
+// be held until the batch is committed - hence the long-lived transaction.
+func (s *postgresStore) Claim(ctx context.Context, limit int) (Batch, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.claim.queryTx(ctx, tx, limit)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return &pgBatch{tx: tx, events: events, markProcessed: s.markProcessed}, nil
+}
+
+type pgBatch struct {
+	tx            *sql.Tx
+	events        []event.Event
+	markProcessed pgQuery
+}
+
+func (b *pgBatch) Events() []event.Event { return b.events }
+
+func (b *pgBatch) Commit(ctx context.Context) error {
+	if len(b.events) > 0 {
+		_, err := b.markProcessed.execTx(ctx, b.tx, pq.Array(eventIDs(b.events)))
+		if err != nil {
+			return err
+		}
+	}
+	return b.tx.Commit()
+}
+
+func (b *pgBatch) Rollback() error {
+	if err := b.tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		return err
+	}
+	return nil
+}
+
+// WriteOutbox inserts the batch's activity rows and outbox entries in the
+// claim's transaction.
+func (b *pgBatch) WriteOutbox(ctx context.Context) error {
+	n := len(b.events)
+	if n == 0 {
+		return nil
+	}
+	var (
+		ids                  = make([]int64, 0, n)
+		users, actions, subs = make([]string, 0, n), make([]string, 0, n), make([]string, 0, n)
+		posts, comments, ats = make([]string, 0, n), make([]string, 0, n), make([]string, 0, n)
+		keys, payloads       = make([]string, 0, n), make([]string, 0, n)
+	)
+	for _, e := range b.events {
+		a := activityOf(e)
+		payload, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		ids = append(ids, a.EventID)
+		users = append(users, a.User)
+		actions = append(actions, a.Action)
+		subs = append(subs, a.Subreddit)
+		posts = append(posts, a.PostID)
+		comments = append(comments, a.CommentID)
+		ats = append(ats, a.At.Format(time.RFC3339Nano))
+		keys = append(keys, a.key())
+		payloads = append(payloads, string(payload))
+	}
+	_, err := b.tx.ExecContext(ctx, `
+		INSERT INTO activity (event_id, user_name, action, subreddit, post_id, comment_id, at)
+		SELECT id, u, act, sub, NULLIF(post, ''), NULLIF(comment, ''), at
+		FROM unnest($1::bigint[], $2::text[], $3::text[], $4::text[], $5::text[], $6::text[], $7::timestamptz[])
+			AS v(id, u, act, sub, post, comment, at)
+	`, pq.Array(ids), pq.Array(users), pq.Array(actions), pq.Array(subs), pq.Array(posts), pq.Array(comments), pq.Array(ats))
+	if err != nil {
+		return err
+	}
+	_, err = b.tx.ExecContext(ctx, `
+		INSERT INTO outbox (key, payload)
+		SELECT * FROM unnest($1::text[], $2::jsonb[])
+	`, pq.Array(keys), pq.Array(payloads))
+	return err
+}
+
+// RelayOutbox locks the oldest pending entries with FOR UPDATE SKIP
+// LOCKED and holds the lock while they are published, so relays in other
+// processes never publish the same entries concurrently.
+func (s *postgresStore) RelayOutbox(ctx context.Context, limit int, publish func(context.Context, []OutboxEntry) error) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, key, payload, created_at FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := scanOutbox(rows)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+	if err := publish(ctx, entries); err != nil {
+		return 0, err
+	}
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE outbox SET published_at = NOW() WHERE id = ANY($1)`, pq.Array(ids)); err != nil {
+		return 0, err
+	}
+	return len(entries), tx.Commit()
+}
+
+// Notify installs a statement-level trigger that calls pg_notify after
+// every INSERT on events (so a batch of 500 rows raises one notification,
+// not 500) and LISTENs for it on a dedicated connection.
+func (s *postgresStore) Notify(ctx context.Context) (<-chan struct{}, error) {
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+		CREATE OR REPLACE FUNCTION notify_events_inserted() RETURNS trigger AS $$
+		BEGIN
+			PERFORM pg_notify('%s', '');
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+
+		DROP TRIGGER IF EXISTS events_inserted ON events;
+		CREATE TRIGGER events_inserted
+			AFTER INSERT ON events
+			FOR EACH STATEMENT EXECUTE FUNCTION notify_events_inserted();
+	`, notifyChannel))
+	if err != nil {
+		return nil, err
+	}
+
+	listener := pq.NewListener(s.connStr, 100*time.Millisecond, 10*time.Second, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("notification listener", "event", ev, "err", err)
+		}
+	})
+	if err := listener.Listen(notifyChannel); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	wake := make(chan struct{}, 1)
+	go func() {
+		defer listener.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-listener.Notify:
+				// A nil notification means the connection was re-established
+				// and we may have missed some; waking up is still right.
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return wake, nil
+}
+
+func (s *postgresStore) PoolStats() sql.DBStats { return s.db.Stats() }
+
+// ExpireEvents locks the expired events with SKIP LOCKED, archives them and
+// deletes them in one transaction. Vote events wait for the score
+// aggregator to fold them in before they can expire.
+func (s *postgresStore) ExpireEvents(ctx context.Context, age time.Duration, limit int, exported bool, archive ArchiveFunc) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, data FROM events
+		WHERE processed AND (scored OR type NOT IN ('upvote', 'downvote')) AND (exported OR NOT $3)
+			AND created_at < NOW() - make_interval(secs => $1)
+		ORDER BY id
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+	`, age.Seconds(), limit, exported)
+	if err != nil {
+		return 0, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	if archive != nil {
+		name := fmt.Sprintf("events-%d-%d", events[0].ID, events[len(events)-1].ID)
+		if err := archive(name, EmitAll(events)); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM events WHERE id = ANY($1)`, pq.Array(eventIDs(events))); err != nil {
+		return 0, err
+	}
+	return len(events), tx.Commit()
+}
+
+// ExportEvents locks the batch with SKIP LOCKED, so exports in several
+// instances share the work like the processors do, and flags it exported
+// in the same transaction once it's exported.
+func (s *postgresStore) ExportEvents(ctx context.Context, limit int, export func([]event.Event) error) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, data FROM events
+		WHERE processed AND NOT exported
+		ORDER BY id
+		LIMIT $1
+		FOR UPDATE SKIP LOCKED
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	if err := export(events); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE events SET exported = true WHERE id = ANY($1)`, pq.Array(eventIDs(events))); err != nil {
+		return 0, err
+	}
+	return len(events), tx.Commit()
+}
+
+func (s *postgresStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *postgresStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *postgresStore) ListEvents(ctx context.Context, f EventFilter) ([]StoredEvent, error) {
+	where, args := f.where(func(n int) string { return fmt.Sprintf("$%d", n) }, "data->>'subreddit'")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, data, processed FROM events `+where+`
+		ORDER BY id
+		LIMIT `+strconv.Itoa(f.Limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanStoredEvents(rows)
+}
+
+func (s *postgresStore) GetEvent(ctx context.Context, id int64) (StoredEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, data, processed FROM events WHERE id = $1`, id)
+	if err != nil {
+		return StoredEvent{}, err
+	}
+	events, err := scanStoredEvents(rows)
+	if err != nil {
+		return StoredEvent{}, err
+	}
+	if len(events) == 0 {
+		return StoredEvent{}, ErrEventNotFound
+	}
+	return events[0], nil
+}
+
+// Register takes over a stale row of the same name, as left behind by an
+// instance that crashed, but not a live one.
+func (s *postgresStore) Register(ctx context.Context, self InstanceStatus, stale time.Duration) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO instances (name, host, pid, started_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE
+		SET host = EXCLUDED.host, pid = EXCLUDED.pid, started_at = EXCLUDED.started_at, heartbeat_at = NOW(),
+			generated = 0, stored = 0, processed = 0, events_per_sec = 0, processed_per_sec = 0, leader = FALSE
+		WHERE instances.heartbeat_at < NOW() - make_interval(secs => $5)
+	`, self.Name, self.Host, self.PID, self.Started, stale.Seconds())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("instance %q is already running; pick another -instance name", self.Name)
+	}
+	return nil
+}
+
+func (s *postgresStore) Heartbeat(ctx context.Context, self InstanceStatus) error {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE instances
+		SET heartbeat_at = NOW(), generated = $2, stored = $3, processed = $4,
+			events_per_sec = $5, processed_per_sec = $6, leader = $7
+		WHERE name = $1
+	`, self.Name, self.Generated, self.Stored, self.Processed, self.EventsPerSec, self.ProcessedPerSec, self.Leader)
+	return err
+}
+
+func (s *postgresStore) Instances(ctx context.Context, stale time.Duration) ([]InstanceStatus, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT name, host, pid, started_at, heartbeat_at, generated, stored, processed, events_per_sec, processed_per_sec, leader
+		FROM instances
+		WHERE heartbeat_at > NOW() - make_interval(secs => $1)
+		ORDER BY started_at, name
+	`, stale.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var instances []InstanceStatus
+	for rows.Next() {
+		var i InstanceStatus
+		err := rows.Scan(&i.Name, &i.Host, &i.PID, &i.Started, &i.Heartbeat, &i.Generated, &i.Stored, &i.Processed, &i.EventsPerSec, &i.ProcessedPerSec, &i.Leader)
+		if err != nil {
+			return nil, err
+		}
+		instances = append(instances, i)
+	}
+	return instances, rows.Err()
+}
+
+func (s *postgresStore) Deregister(ctx context.Context, name string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM instances WHERE name = $1`, name)
+	return err
+}
+
+// leaderLock is the advisory lock the leader holds; hashtext keys it by
+// name rather than a magic number.
+const leaderLock = `hashtext('go-reddit-sim leader')`
+
+// TryLead takes the leader lock. An advisory lock belongs to the session
+// that took it, so the leader keeps a connection of its own out of the
+// pool; if that connection dies the server releases the lock and another
+// instance takes over. TryLead and Resign are only called from one
+// goroutine.
+func (s *postgresStore) TryLead(ctx context.Context) (bool, error) {
+	if s.leader != nil {
+		if _, err := s.leader.ExecContext(ctx, `SELECT 1`); err == nil {
+			return true, nil
+		}
+		discard(s.leader)
+		s.leader = nil
+	}
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+	var ok bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(`+leaderLock+`)`).Scan(&ok); err != nil {
+		discard(conn)
+		return false, err
+	}
+	if !ok {
+		return false, conn.Close()
+	}
+	s.leader = conn
+	return true, nil
+}
+
+// Resign releases the leader lock. If that fails the connection is
+// discarded instead, since closing the session releases it too.
+func (s *postgresStore) Resign(ctx context.Context) error {
+	if s.leader == nil {
+		return nil
+	}
+	conn := s.leader
+	s.leader = nil
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock(`+leaderLock+`)`); err != nil {
+		discard(conn)
+		return err
+	}
+	return conn.Close()
+}
+
+// discard closes conn's session rather than returning it to the pool,
+// where it could go on holding the leader lock.
+func discard(conn *sql.Conn) {
+	conn.Raw(func(any) error { return driver.ErrBadConn })
+}
+
+// Resume reads the newest posts and comments off the events table. Claims
+// need no releasing: an unfinished one died with its transaction.
+func (s *postgresStore) Resume(ctx context.Context, posts, comments int) (Resumed, error) {
+	var r Resumed
+	for _, q := range []struct {
+		typ   event.Type
+		limit int
+		into  *[]event.Thing
+	}{{event.Post, posts, &r.Posts}, {event.Comment, comments, &r.Comments}} {
+		rows, err := s.db.QueryContext(ctx, `SELECT data FROM events WHERE type = $1 ORDER BY id DESC LIMIT $2`, q.typ.String(), q.limit)
+		if err != nil {
+			return Resumed{}, err
+		}
+		if *q.into, err = scanThings(rows); err != nil {
+			return Resumed{}, err
+		}
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT priority, count(*) FROM events WHERE NOT processed GROUP BY priority`)
+	if err != nil {
+		return Resumed{}, err
+	}
+	return r, scanPending(rows, &r.Pending)
+}
+
+func (s *postgresStore) Flag(ctx context.Context, flags []UserFlag) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, f := range flags {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO flags (user_name, reason, events, detail, flagged_at) VALUES ($1, $2, $3, $4, $5)
+		`, f.User, f.Reason, f.Events, f.Detail, f.FlaggedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
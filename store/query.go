@@ -0,0 +1,129 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"web-traffic-sim/event"
+)
+
+// ErrEventNotFound is GetEvent's error for an ID it doesn't have.
+var ErrEventNotFound = errors.New("event not found")
+
+// EventFilter selects events for ListEvents. Zero fields don't filter.
+type EventFilter struct {
+	Type      *event.Type
+	Processed *bool
+	Subreddit string
+	After     int64 // only events with a greater ID, for cursor paging
+	Limit     int
+}
+
+// StoredEvent is an event as the store holds it, processing state
+// included.
+type StoredEvent struct {
+	event.Event
+	Processed bool `json:"processed"`
+}
+
+// MarshalJSON keeps Processed, which Event's own MarshalJSON would leave
+// out.
+func (e StoredEvent) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		SchemaVersion int `json:"schema_version"`
+		event.JSON
+		Processed bool `json:"processed"`
+	}{event.SchemaVersion, event.JSON(e.Event), e.Processed})
+}
+
+// where renders f as a SQL WHERE clause. placeholder returns the n-th
+// (1-based) bind parameter and subreddit is the expression extracting the
+// subreddit from the event's JSON, both of which differ per database.
+func (f EventFilter) where(placeholder func(n int) string, subreddit string) (string, []any) {
+	clause := "WHERE id > " + placeholder(1)
+	args := []any{f.After}
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		clause += " AND " + cond + " = " + placeholder(len(args))
+	}
+	if f.Type != nil {
+		add("type", f.Type.String())
+	}
+	if f.Processed != nil {
+		add("processed", *f.Processed)
+	}
+	if f.Subreddit != "" {
+		add(subreddit, f.Subreddit)
+	}
+	return clause, args
+}
+
+// scanStoredEvents reads (id, data, processed) rows.
+func scanStoredEvents(rows *sql.Rows) ([]StoredEvent, error) {
+	defer rows.Close()
+
+	var events []StoredEvent
+	for rows.Next() {
+		var (
+			e    StoredEvent
+			data []byte
+		)
+		if err := rows.Scan(&e.ID, &data, &e.Processed); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &e.Event); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// ErrUserNotFound is User's error for a name it doesn't have.
+var ErrUserNotFound = errors.New("user not found")
+
+// PostFilter selects posts for Posts. Zero fields don't filter.
+type PostFilter struct {
+	ID        string
+	Subreddit string
+	Author    string
+	Sort      string
+	Limit     int
+}
+
+// CommentFilter selects comments for Comments. Zero fields don't filter,
+// except that with Post and no Parent only top-level comments match,
+// unless Thread asks for the post's whole comment tree.
+type CommentFilter struct {
+	ID     string
+	Post   string
+	Parent string
+	Author string
+	Thread bool
+	Limit  int
+}
+
+// Comment is a comment as the GraphQL API shows it. Removed comments
+// keep their place in the tree with their body replaced.
+type Comment struct {
+	ID        string
+	Post      string
+	Parent    string // "" at the top level
+	Author    string
+	Body      string
+	Depth     int
+	Replies   int
+	Ups       int
+	Downs     int
+	CreatedAt time.Time
+}
+
+// User is a user as the GraphQL API shows it.
+type User struct {
+	Name         string
+	PostKarma    int
+	CommentKarma int
+	CreatedAt    time.Time
+}
@@ -0,0 +1,210 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// rabbitStore runs the pipeline over RabbitMQ: writers publish each event
+// to a topic exchange with routing key events.<type> and wait for the
+// publisher confirm, and processors consume the bound queue with manual
+// acks.
+//
+// The broker pushes up to Prefetch unacknowledged deliveries into a Go
+// channel; Claim takes whatever is waiting there. Commit acks the batch and
+// Rollback nacks it with requeue, so nothing is lost if processing fails,
+// and a processor that dies simply never acks.
+type rabbitStore struct {
+	conn  *amqp.Connection
+	queue string
+
+	// Publishing and confirms share one channel; amqp channels are not
+	// meant for concurrent publishers, so writers take turns on pubMu.
+	pubMu    sync.Mutex
+	pub      *amqp.Channel
+	exchange string
+
+	sub        *amqp.Channel
+	deliveries <-chan amqp.Delivery
+}
+
+// newRabbitStore connects to cfg.URL, declares the exchange and recreates
+// the queue, so every run starts with an empty queue.
+func newRabbitStore(cfg config.RabbitMQ) (*rabbitStore, error) {
+	conn, err := amqp.Dial(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	s := &rabbitStore{conn: conn, queue: cfg.Queue, exchange: cfg.Exchange}
+	if err := s.setup(cfg); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *rabbitStore) setup(cfg config.RabbitMQ) error {
+	var err error
+	if s.pub, err = s.conn.Channel(); err != nil {
+		return err
+	}
+	if err := s.pub.Confirm(false); err != nil {
+		return fmt.Errorf("enable publisher confirms: %w", err)
+	}
+	if err := s.pub.ExchangeDeclare(cfg.Exchange, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare exchange %s: %w", cfg.Exchange, err)
+	}
+	if _, err := s.pub.QueueDelete(cfg.Queue, false, false, false); err != nil {
+		return fmt.Errorf("delete queue %s: %w", cfg.Queue, err)
+	}
+	if _, err := s.pub.QueueDeclare(cfg.Queue, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("declare queue %s: %w", cfg.Queue, err)
+	}
+	if err := s.pub.QueueBind(cfg.Queue, "events.#", cfg.Exchange, false, nil); err != nil {
+		return fmt.Errorf("bind queue %s: %w", cfg.Queue, err)
+	}
+
+	if s.sub, err = s.conn.Channel(); err != nil {
+		return err
+	}
+	if err := s.sub.Qos(cfg.Prefetch, 0, false); err != nil {
+		return fmt.Errorf("set prefetch: %w", err)
+	}
+	s.deliveries, err = s.sub.Consume(cfg.Queue, "", false, false, false, false, nil)
+	return err
+}
+
+func (s *rabbitStore) Insert(ctx context.Context, e event.Event) error {
+	return s.InsertBatch(ctx, []event.Event{e})
+}
+
+// InsertBatch publishes every event and then waits for all the broker's
+// confirms. Like JetStream, a batch is not atomic: if a confirm comes back
+// negative the other events are already queued.
+func (s *rabbitStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	confirms := make([]*amqp.DeferredConfirmation, 0, len(events))
+
+	s.pubMu.Lock()
+	for _, e := range events {
+		data, err := json.Marshal(e)
+		if err != nil {
+			s.pubMu.Unlock()
+			return err
+		}
+		c, err := s.pub.PublishWithDeferredConfirmWithContext(ctx, s.exchange, "events."+e.Type.String(), false, false, amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Timestamp:    e.Timestamp,
+			Body:         data,
+		})
+		if err != nil {
+			s.pubMu.Unlock()
+			return err
+		}
+		confirms = append(confirms, c)
+	}
+	s.pubMu.Unlock()
+
+	nacked := 0
+	for _, c := range confirms {
+		ok, err := c.WaitContext(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			nacked++
+		}
+	}
+	if nacked > 0 {
+		return fmt.Errorf("broker rejected %d of %d events", nacked, len(events))
+	}
+	return nil
+}
+
+// Claim takes up to limit deliveries the broker has already pushed,
+// without waiting for more.
+func (s *rabbitStore) Claim(ctx context.Context, limit int) (Batch, error) {
+	b := &rabbitBatch{}
+	for len(b.deliveries) < limit {
+		select {
+		case d, ok := <-s.deliveries:
+			if !ok {
+				b.Rollback()
+				return nil, errors.New("rabbitmq consumer closed")
+			}
+			var e event.Event
+			if err := json.Unmarshal(d.Body, &e); err != nil {
+				// Undecodable: requeueing won't help
+				d.Nack(false, false)
+				continue
+			}
+			e.ID = int64(d.DeliveryTag)
+			b.deliveries = append(b.deliveries, d)
+			b.events = append(b.events, e)
+		default:
+			return b, nil
+		}
+	}
+	return b, nil
+}
+
+type rabbitBatch struct {
+	deliveries []amqp.Delivery
+	events     []event.Event
+	done       bool
+}
+
+func (b *rabbitBatch) Events() []event.Event { return b.events }
+
+func (b *rabbitBatch) Commit(ctx context.Context) error {
+	b.done = true
+	for _, d := range b.deliveries {
+		if err := d.Ack(false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *rabbitBatch) Rollback() error {
+	if b.done {
+		return nil
+	}
+	b.done = true
+	var errs []error
+	for _, d := range b.deliveries {
+		errs = append(errs, d.Nack(false, true))
+	}
+	return errors.Join(errs...)
+}
+
+// QueueDepth is the number of messages ready in the queue, not counting
+// the ones delivered and awaiting an ack.
+func (s *rabbitStore) QueueDepth(ctx context.Context) (int, error) {
+	s.pubMu.Lock()
+	defer s.pubMu.Unlock()
+	q, err := s.pub.QueueDeclarePassive(s.queue, true, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	return q.Messages, nil
+}
+
+func (s *rabbitStore) Ping(ctx context.Context) error {
+	if s.conn.IsClosed() {
+		return errors.New("rabbitmq: connection closed")
+	}
+	return nil
+}
+
+func (s *rabbitStore) Close() error {
+	return s.conn.Close()
+}
@@ -0,0 +1,217 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// redisStore runs the pipeline over a Redis stream: writers XADD, and
+// processors read through one consumer group with XREADGROUP and XACK
+// what they have processed.
+//
+// Redis has no negative ack, so a rolled-back batch stays pending in the
+// group and is queued locally to be handed out again by the next Claim.
+// Entries left pending by a processor that went away are reclaimed with
+// XAUTOCLAIM once they have been idle for redisClaimTimeout.
+type redisStore struct {
+	rdb      *redis.Client
+	stream   string
+	group    string
+	consumer string
+
+	mu    sync.Mutex
+	retry []redis.XMessage // rolled-back entries, still pending under consumer
+}
+
+// redisClaimTimeout is how long an entry may stay pending before another
+// Claim takes it over.
+const redisClaimTimeout = 30 * time.Second
+
+// newRedisStore connects to cfg.Addr and recreates the stream and its
+// consumer group, so every run starts empty.
+func newRedisStore(cfg config.Redis) (*redisStore, error) {
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.Addr})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := rdb.Del(ctx, cfg.Stream).Err(); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+	if err := rdb.XGroupCreateMkStream(ctx, cfg.Stream, cfg.Group, "$").Err(); err != nil {
+		rdb.Close()
+		return nil, fmt.Errorf("create group %s: %w", cfg.Group, err)
+	}
+	return &redisStore{
+		rdb:      rdb,
+		stream:   cfg.Stream,
+		group:    cfg.Group,
+		consumer: fmt.Sprintf("sim-%d", os.Getpid()),
+	}, nil
+}
+
+func (s *redisStore) xadd(e event.Event) (*redis.XAddArgs, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	return &redis.XAddArgs{Stream: s.stream, Values: []any{"type", e.Type.String(), "data", data}}, nil
+}
+
+func (s *redisStore) Insert(ctx context.Context, e event.Event) error {
+	args, err := s.xadd(e)
+	if err != nil {
+		return err
+	}
+	return s.rdb.XAdd(ctx, args).Err()
+}
+
+// InsertBatch sends every XADD in one MULTI/EXEC, so the batch is one round
+// trip and lands all at once.
+func (s *redisStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	_, err := s.rdb.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		for _, e := range events {
+			args, err := s.xadd(e)
+			if err != nil {
+				return err
+			}
+			p.XAdd(ctx, args)
+		}
+		return nil
+	})
+	return err
+}
+
+// Claim hands out, in order of preference: entries this store rolled
+// back, entries abandoned by another consumer, and new entries.
+func (s *redisStore) Claim(ctx context.Context, limit int) (Batch, error) {
+	s.mu.Lock()
+	n := min(limit, len(s.retry))
+	msgs := append([]redis.XMessage(nil), s.retry[:n]...)
+	s.retry = s.retry[n:]
+	s.mu.Unlock()
+
+	if len(msgs) < limit {
+		stale, _, err := s.rdb.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   s.stream,
+			Group:    s.group,
+			Consumer: s.consumer,
+			MinIdle:  redisClaimTimeout,
+			Start:    "0",
+			Count:    int64(limit - len(msgs)),
+		}).Result()
+		if err != nil {
+			s.requeue(msgs)
+			return nil, err
+		}
+		msgs = append(msgs, stale...)
+	}
+
+	if len(msgs) < limit {
+		streams, err := s.rdb.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    s.group,
+			Consumer: s.consumer,
+			Streams:  []string{s.stream, ">"},
+			Count:    int64(limit - len(msgs)),
+			Block:    -1, // don't block; the processor polls
+		}).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			s.requeue(msgs)
+			return nil, err
+		}
+		for _, st := range streams {
+			msgs = append(msgs, st.Messages...)
+		}
+	}
+
+	b := &redisBatch{store: s}
+	for _, msg := range msgs {
+		e, err := decodeStreamEntry(msg)
+		if err != nil {
+			// Undecodable: ack it out of the way, retrying won't help
+			s.rdb.XAck(ctx, s.stream, s.group, msg.ID)
+			continue
+		}
+		b.msgs = append(b.msgs, msg)
+		b.events = append(b.events, e)
+	}
+	return b, nil
+}
+
+func (s *redisStore) requeue(msgs []redis.XMessage) {
+	s.mu.Lock()
+	s.retry = append(msgs, s.retry...)
+	s.mu.Unlock()
+}
+
+// decodeStreamEntry rebuilds an event from its stream entry. The entry ID
+// "<ms>-<seq>" becomes ms<<16 | seq, which keeps IDs increasing.
+func decodeStreamEntry(msg redis.XMessage) (event.Event, error) {
+	var e event.Event
+	data, ok := msg.Values["data"].(string)
+	if !ok {
+		return e, fmt.Errorf("entry %s has no data", msg.ID)
+	}
+	if err := json.Unmarshal([]byte(data), &e); err != nil {
+		return e, err
+	}
+	ms, seq, _ := strings.Cut(msg.ID, "-")
+	msN, err1 := strconv.ParseInt(ms, 10, 64)
+	seqN, err2 := strconv.ParseInt(seq, 10, 64)
+	if err := errors.Join(err1, err2); err != nil {
+		return e, fmt.Errorf("entry ID %s: %w", msg.ID, err)
+	}
+	e.ID = msN<<16 | seqN
+	return e, nil
+}
+
+type redisBatch struct {
+	store  *redisStore
+	msgs   []redis.XMessage
+	events []event.Event
+	done   bool
+}
+
+func (b *redisBatch) Events() []event.Event { return b.events }
+
+func (b *redisBatch) Commit(ctx context.Context) error {
+	b.done = true
+	if len(b.msgs) == 0 {
+		return nil
+	}
+	ids := make([]string, len(b.msgs))
+	for i, msg := range b.msgs {
+		ids[i] = msg.ID
+	}
+	return b.store.rdb.XAck(ctx, b.store.stream, b.store.group, ids...).Err()
+}
+
+func (b *redisBatch) Rollback() error {
+	if b.done {
+		return nil
+	}
+	b.done = true
+	b.store.requeue(b.msgs)
+	return nil
+}
+
+func (s *redisStore) Ping(ctx context.Context) error {
+	return s.rdb.Ping(ctx).Err()
+}
+
+func (s *redisStore) Close() error {
+	return s.rdb.Close()
+}
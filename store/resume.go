@@ -0,0 +1,65 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"web-traffic-sim/event"
+)
+
+// Resumed is what a run carries on from.
+type Resumed struct {
+	Posts, Comments []event.Thing
+	Pending         [event.PriorityLevels]int
+}
+
+// Backlog is how many events are waiting in all.
+func (r Resumed) Backlog() int {
+	n := 0
+	for _, p := range r.Pending {
+		n += p
+	}
+	return n
+}
+
+// scanThings reads the (data) rows of post or comment events as the things
+// they created.
+func scanThings(rows *sql.Rows) ([]event.Thing, error) {
+	defer rows.Close()
+
+	var things []event.Thing
+	for rows.Next() {
+		var (
+			e    event.Event
+			data []byte
+		)
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &e); err != nil {
+			return nil, err
+		}
+		t := event.Thing{ID: e.PostID, PostID: e.PostID, Subreddit: e.Subreddit, Author: e.User}
+		if e.Type == event.Comment {
+			t.ID = e.CommentID
+		}
+		things = append(things, t)
+	}
+	return things, rows.Err()
+}
+
+// scanPending reads (priority, count) rows.
+func scanPending(rows *sql.Rows, pending *[event.PriorityLevels]int) error {
+	defer rows.Close()
+
+	for rows.Next() {
+		var p, n int
+		if err := rows.Scan(&p, &n); err != nil {
+			return err
+		}
+		if p >= 0 && p < event.PriorityLevels {
+			pending[p] += n
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,18 @@
+package store
+
+import "web-traffic-sim/event"
+
+// ArchiveFunc archives the events each emits under name.
+type ArchiveFunc func(name string, each func(emit func(event.Event) error) error) error
+
+// EmitAll emits events in order.
+func EmitAll(events []event.Event) func(emit func(event.Event) error) error {
+	return func(emit func(event.Event) error) error {
+		for _, e := range events {
+			if err := emit(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,443 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// sqliteStore is a zero-setup alternative to PostgreSQL, backed by a local
+// database file.
+//
+// SQLite has no FOR UPDATE SKIP LOCKED, so Claim marks rows instead: it
+// stamps claimed_at on a batch of unclaimed rows with UPDATE ... RETURNING.
+// A claimed row is not handed out again unless the batch is rolled back,
+// which gives processors the same batch semantics as the Postgres store.
+type sqliteStore struct {
+	db         *sql.DB
+	claimOrder string
+	duplicates atomic.Int64
+}
+
+// newSQLiteStore opens (or creates) the database file at path and migrates
+// it to this build's schema, dropping the tables first with reset. Claim
+// takes events in the order p asks for.
+func newSQLiteStore(path string, p config.Processor, reset bool) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer at a time; funnelling everything through
+	// one connection avoids SQLITE_BUSY errors between writer and processor.
+	db.SetMaxOpenConns(1)
+
+	s := &sqliteStore{db: db, claimOrder: claimOrder(p)}
+	if err := s.migrate(p, reset); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// sqliteReset drops every table the simulator creates.
+const sqliteReset = `
+	DROP TABLE IF EXISTS schema_migrations;
+	DROP TABLE IF EXISTS events;
+	DROP TABLE IF EXISTS activity;
+	DROP TABLE IF EXISTS outbox;
+	DROP TABLE IF EXISTS flags;`
+
+// migrate brings the tables up to date, after dropping them with reset,
+// and rebuilds the index unclaimed events are claimed through for p's
+// order.
+func (s *sqliteStore) migrate(p config.Processor, reset bool) error {
+	ctx := context.Background()
+	if reset {
+		if _, err := s.db.ExecContext(ctx, sqliteReset); err != nil {
+			return err
+		}
+	}
+	m := migrator{
+		db:     s.db,
+		dir:    "sqlite",
+		exists: `SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = ?)`,
+	}
+	applied, err := m.migrate(ctx, nil)
+	for _, name := range applied {
+		slog.Info("applied migration", "migration", name)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		DROP INDEX IF EXISTS idx_events_unclaimed;
+		CREATE INDEX idx_events_unclaimed ON events(`+claimIndex(p)+`) WHERE claimed_at IS NULL`)
+	return err
+}
+
+func (s *sqliteStore) Insert(ctx context.Context, e event.Event) error {
+	jsonData, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO events (type, data, priority, idem_key)
+		VALUES (?, ?, ?, NULLIF(?, ''))
+		ON CONFLICT (idem_key) DO NOTHING
+	`, e.Type.String(), string(jsonData), int(e.Type.Priority()), e.Key)
+	return s.countDuplicates(res, err, 1)
+}
+
+// countDuplicates counts the events of an insert that the unique key
+// turned away.
+func (s *sqliteStore) countDuplicates(res sql.Result, err error, events int) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	s.duplicates.Add(int64(events) - n)
+	return nil
+}
+
+func (s *sqliteStore) Duplicates() int64 { return s.duplicates.Load() }
+
+// InsertBatch writes the batch as one multi-row INSERT, skipping the
+// events whose key is already stored.
+func (s *sqliteStore) InsertBatch(ctx context.Context, events []event.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	args := make([]any, 0, 4*len(events))
+	for _, e := range events {
+		jsonData, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		args = append(args, e.Type.String(), string(jsonData), int(e.Type.Priority()), e.Key)
+	}
+	values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, NULLIF(?, '')),", len(events)), ",")
+
+	res, err := s.db.ExecContext(ctx, `INSERT INTO events (type, data, priority, idem_key) VALUES `+values+`
+		ON CONFLICT (idem_key) DO NOTHING`, args...)
+	return s.countDuplicates(res, err, len(events))
+}
+
+// Claim stamps claimed_at on a batch of unclaimed rows. Unlike Postgres
+// the claim is committed straight away: holding a transaction open would
+// block the writers on SQLite's single connection.
+func (s *sqliteStore) Claim(ctx context.Context, limit int) (Batch, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE events
+		SET claimed_at = CURRENT_TIMESTAMP
+		WHERE id IN (
+			SELECT id FROM events
+			WHERE claimed_at IS NULL
+			ORDER BY `+s.claimOrder+`
+			LIMIT ?
+		)
+		RETURNING id, data
+	`, limit)
+	if err != nil {
+		return nil, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &sqliteBatch{db: s.db, events: events}, nil
+}
+
+type sqliteBatch struct {
+	db     *sql.DB
+	events []event.Event
+	done   bool
+	outbox bool
+}
+
+func (b *sqliteBatch) Events() []event.Event { return b.events }
+
+func (b *sqliteBatch) Commit(ctx context.Context) error {
+	if b.outbox && len(b.events) > 0 {
+		return b.commitOutbox(ctx)
+	}
+	if len(b.events) > 0 {
+		if err := b.exec(ctx, b.db, `UPDATE events SET processed = 1 WHERE id IN (%s)`); err != nil {
+			return err
+		}
+	}
+	b.done = true
+	return nil
+}
+
+// WriteOutbox defers the outbox to Commit: the claim is already committed,
+// so the activity, the outbox entries and the processed flag get a
+// transaction of their own there.
+func (b *sqliteBatch) WriteOutbox(ctx context.Context) error {
+	b.outbox = true
+	return nil
+}
+
+func (b *sqliteBatch) commitOutbox(ctx context.Context) error {
+	tx, err := b.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	for _, e := range b.events {
+		a := activityOf(e)
+		payload, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO activity (event_id, user_name, action, subreddit, post_id, comment_id, at)
+			VALUES (?, ?, ?, ?, NULLIF(?, ''), NULLIF(?, ''), ?)
+		`, a.EventID, a.User, a.Action, a.Subreddit, a.PostID, a.CommentID, a.At)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO outbox (key, payload, created_at) VALUES (?, ?, ?)`, a.key(), string(payload), now)
+		if err != nil {
+			return err
+		}
+	}
+	if err := b.exec(ctx, tx, `UPDATE events SET processed = 1 WHERE id IN (%s)`); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	b.done = true
+	return nil
+}
+
+func (b *sqliteBatch) Rollback() error {
+	if b.done || len(b.events) == 0 {
+		return nil
+	}
+	b.done = true
+	return b.exec(context.Background(), b.db, `UPDATE events SET claimed_at = NULL WHERE id IN (%s)`)
+}
+
+// execer is what sqliteBatch.exec runs its query on: the database or a
+// transaction.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// exec runs query on db with its %s replaced by one placeholder per event,
+// since SQLite has no array parameters.
+func (b *sqliteBatch) exec(ctx context.Context, db execer, query string) error {
+	args := make([]any, len(b.events))
+	for i, e := range b.events {
+		args[i] = e.ID
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+	_, err := db.ExecContext(ctx, fmt.Sprintf(query, placeholders), args...)
+	return err
+}
+
+// RelayOutbox needs no locking: a SQLite database has one process, and so
+// one relay. Nothing is held open while entries are published, which
+// would stall the writers on the single connection.
+func (s *sqliteStore) RelayOutbox(ctx context.Context, limit int, publish func(context.Context, []OutboxEntry) error) (int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, key, payload, created_at FROM outbox
+		WHERE published_at IS NULL
+		ORDER BY id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := scanOutbox(rows)
+	if err != nil || len(entries) == 0 {
+		return 0, err
+	}
+	if err := publish(ctx, entries); err != nil {
+		return 0, err
+	}
+	first, last := entries[0].ID, entries[len(entries)-1].ID
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE outbox SET published_at = ?
+		WHERE id BETWEEN ? AND ? AND published_at IS NULL
+	`, time.Now(), first, last)
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), nil
+}
+
+func (s *sqliteStore) PoolStats() sql.DBStats { return s.db.Stats() }
+
+// ExpireEvents reads, archives and deletes the expired events in one
+// transaction. The store's single connection keeps the writers out until
+// it commits, so the delete removes exactly the events read.
+func (s *sqliteStore) ExpireEvents(ctx context.Context, age time.Duration, limit int, exported bool, archive ArchiveFunc) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// created_at is CURRENT_TIMESTAMP's UTC text, which sorts as time
+	cutoff := time.Now().UTC().Add(-age).Format(time.DateTime)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, data FROM events
+		WHERE processed = 1 AND (exported = 1 OR NOT ?) AND created_at < ?
+		ORDER BY id
+		LIMIT ?
+	`, exported, cutoff, limit)
+	if err != nil {
+		return 0, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	last := events[len(events)-1].ID
+	if archive != nil {
+		if err := archive(fmt.Sprintf("events-%d-%d", events[0].ID, last), EmitAll(events)); err != nil {
+			return 0, err
+		}
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM events
+		WHERE processed = 1 AND (exported = 1 OR NOT ?) AND created_at < ? AND id <= ?
+	`, exported, cutoff, last)
+	if err != nil {
+		return 0, err
+	}
+	return len(events), tx.Commit()
+}
+
+// ExportEvents reads, exports and flags a batch in one transaction, like
+// ExpireEvents.
+func (s *sqliteStore) ExportEvents(ctx context.Context, limit int, export func([]event.Event) error) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id, data FROM events
+		WHERE processed = 1 AND exported = 0
+		ORDER BY id
+		LIMIT ?
+	`, limit)
+	if err != nil {
+		return 0, err
+	}
+	events, err := scanEvents(rows)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+	if err := export(events); err != nil {
+		return 0, err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE events SET exported = 1
+		WHERE processed = 1 AND exported = 0 AND id <= ?
+	`, events[len(events)-1].ID)
+	if err != nil {
+		return 0, err
+	}
+	return len(events), tx.Commit()
+}
+
+func (s *sqliteStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *sqliteStore) ListEvents(ctx context.Context, f EventFilter) ([]StoredEvent, error) {
+	where, args := f.where(func(int) string { return "?" }, "json_extract(data, '$.subreddit')")
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, data, processed FROM events `+where+`
+		ORDER BY id
+		LIMIT `+strconv.Itoa(f.Limit), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanStoredEvents(rows)
+}
+
+func (s *sqliteStore) GetEvent(ctx context.Context, id int64) (StoredEvent, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, data, processed FROM events WHERE id = ?`, id)
+	if err != nil {
+		return StoredEvent{}, err
+	}
+	events, err := scanStoredEvents(rows)
+	if err != nil {
+		return StoredEvent{}, err
+	}
+	if len(events) == 0 {
+		return StoredEvent{}, ErrEventNotFound
+	}
+	return events[0], nil
+}
+
+// Resume reads the newest posts and comments off the events table, and
+// releases the claims of the run before, which can't have finished them:
+// the database file has one simulator at a time.
+func (s *sqliteStore) Resume(ctx context.Context, posts, comments int) (Resumed, error) {
+	var r Resumed
+	if _, err := s.db.ExecContext(ctx, `UPDATE events SET claimed_at = NULL WHERE processed = 0 AND claimed_at IS NOT NULL`); err != nil {
+		return Resumed{}, err
+	}
+	for _, q := range []struct {
+		typ   event.Type
+		limit int
+		into  *[]event.Thing
+	}{{event.Post, posts, &r.Posts}, {event.Comment, comments, &r.Comments}} {
+		rows, err := s.db.QueryContext(ctx, `SELECT data FROM events WHERE type = ? ORDER BY id DESC LIMIT ?`, q.typ.String(), q.limit)
+		if err != nil {
+			return Resumed{}, err
+		}
+		if *q.into, err = scanThings(rows); err != nil {
+			return Resumed{}, err
+		}
+	}
+	rows, err := s.db.QueryContext(ctx, `SELECT priority, count(*) FROM events WHERE processed = 0 GROUP BY priority`)
+	if err != nil {
+		return Resumed{}, err
+	}
+	return r, scanPending(rows, &r.Pending)
+}
+
+func (s *sqliteStore) Flag(ctx context.Context, flags []UserFlag) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, f := range flags {
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO flags (user_name, reason, events, detail, flagged_at) VALUES (?, ?, ?, ?, ?)
+		`, f.User, f.Reason, f.Events, f.Detail, f.FlaggedAt); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,143 @@
+// Package store is where the simulator keeps its events: the Store
+// interface the pipeline writes to and drains, and its backends -
+// PostgreSQL, SQLite, an in-memory ring buffer, and NATS, Redis and
+// RabbitMQ as brokers. Backends may do more than Store asks, such as
+// materialize a domain model or rank posts; the simulator looks for those
+// methods on the Store it is given.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"web-traffic-sim/config"
+	"web-traffic-sim/event"
+)
+
+// Store is the persistence layer the pipeline writes events to and the
+// processor drains them from. Implementations must be safe for concurrent
+// use by the writer and processor goroutines.
+type Store interface {
+	// Insert persists a single event.
+	Insert(ctx context.Context, e event.Event) error
+	// InsertBatch persists several events in one round trip. Either all of
+	// them are stored or none are. Stores that deduplicate skip events
+	// whose Key they have already stored, rather than failing.
+	InsertBatch(ctx context.Context, events []event.Event) error
+	// Claim takes up to limit unprocessed events, oldest first (highest
+	// Priority first, where the store supports it and was asked to), for
+	// the caller's exclusive use. Events held by one claim are never handed to
+	// another until that claim is rolled back, so several processors can
+	// compete for work safely.
+	Claim(ctx context.Context, limit int) (Batch, error)
+	Close() error
+}
+
+// Batch is a set of claimed events. Exactly one of Commit or Rollback must
+// be called; Rollback after Commit is a no-op, so it can be deferred.
+type Batch interface {
+	Events() []event.Event
+	// Commit marks every event in the batch processed and releases it.
+	Commit(ctx context.Context) error
+	// Rollback releases the batch untouched; its events will be claimed
+	// again later.
+	Rollback() error
+}
+
+// DomainCounts is how many rows a Materialize call inserted per table.
+// It also carries the deepest and busiest comment threads the call saw.
+type DomainCounts struct {
+	Users, Subreddits, Posts, Comments, Votes int
+	Reports, Removed, Bans                    int
+
+	Deepest, Busiest         int // reply depth; comments on the post
+	DeepestPost, BusiestPost string
+}
+
+// scanEvents reads (id, data) rows where data is the event's JSON encoding.
+func scanEvents(rows *sql.Rows) ([]event.Event, error) {
+	defer rows.Close()
+
+	var events []event.Event
+	for rows.Next() {
+		e, err := scanEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// scanEvent reads the current (id, data) row.
+func scanEvent(rows *sql.Rows) (event.Event, error) {
+	var (
+		e    event.Event
+		data []byte
+	)
+	if err := rows.Scan(&e.ID, &data); err != nil {
+		return event.Event{}, err
+	}
+	err := json.Unmarshal(data, &e)
+	return e, err
+}
+
+func eventIDs(events []event.Event) []int64 {
+	ids := make([]int64, len(events))
+	for i, e := range events {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+// Open returns the Store selected by cfg.Backend.
+func Open(cfg *config.Config) (Store, error) {
+	switch cfg.Backend {
+	case config.BackendPostgres:
+		if cfg.Driver == config.DriverPGX {
+			return newPgxStore(cfg.DSN, cfg.Processor, cfg.Pool, cfg.Partition, cfg.Prepare, cfg.Instance.Join, cfg.Reset)
+		}
+		return newPostgresStore(cfg.DSN, cfg.Processor, cfg.Pool, cfg.Partition, cfg.Prepare, cfg.Instance.Join, cfg.Reset)
+	case config.BackendSQLite:
+		return newSQLiteStore(cfg.SQLitePath, cfg.Processor, cfg.Reset)
+	case config.BackendMemory:
+		return newMemoryStore(cfg.MemoryCapacity, cfg.Processor), nil
+	case config.BackendNATS:
+		return newNATSStore(cfg.NATS)
+	case config.BackendRedis:
+		return newRedisStore(cfg.Redis)
+	case config.BackendRabbitMQ:
+		return newRabbitStore(cfg.RabbitMQ)
+	default:
+		return nil, fmt.Errorf("unknown backend %q", cfg.Backend)
+	}
+}
+
+// claimOrder is the ORDER BY the database stores claim pending events in
+// under p: by priority if asked, then by claim strategy.
+func claimOrder(p config.Processor) string {
+	order := "created_at, id"
+	switch p.Claim {
+	case config.ClaimLIFO:
+		order = "created_at DESC, id DESC"
+	case config.ClaimRandom:
+		order = "random()"
+	}
+	if p.Priority {
+		order = "priority DESC, " + order
+	}
+	return order
+}
+
+// claimIndex is the column list of the index on pending events that serves
+// claimOrder. No index can hand out rows at random, so a random claim
+// still has to read and sort every pending row; the index only narrows it
+// to them.
+func claimIndex(p config.Processor) string {
+	if p.Claim == config.ClaimRandom {
+		p.Claim = config.ClaimFIFO
+	}
+	return claimOrder(p)
+}
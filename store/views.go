@@ -0,0 +1,64 @@
+package store
+
+import "time"
+
+// The analytics views, as named in the database.
+const (
+	ViewEventsPerMinute   = "events_per_minute"
+	ViewSubredditActivity = "subreddit_activity"
+	ViewTopUsers          = "top_users"
+	ViewClientActivity    = "client_activity"
+)
+
+// Views are the analytics views, in the order they're refreshed.
+var Views = []string{ViewEventsPerMinute, ViewSubredditActivity, ViewTopUsers, ViewClientActivity}
+
+// Analytics is what the analytics views held when they were last
+// refreshed, the top rows of each.
+type Analytics struct {
+	// EventsPerMinute is the most recent minutes' events by type, latest
+	// first; the latest minute is usually still filling up.
+	EventsPerMinute []MinuteCount `json:"events_per_minute"`
+	// Subreddits are the busiest subreddits, TopUsers the most active
+	// users and Clients the countries and devices most enriched events
+	// were sent from.
+	Subreddits []SubredditActivity `json:"subreddits"`
+	TopUsers   []UserActivity      `json:"top_users"`
+	Clients    []ClientActivity    `json:"clients"`
+}
+
+// MinuteCount is the number of events of a type in a minute.
+type MinuteCount struct {
+	Minute time.Time `json:"minute"`
+	Type   string    `json:"type"`
+	Events int64     `json:"events"`
+}
+
+// SubredditActivity is a subreddit's events of every kind, and how many
+// users sent them.
+type SubredditActivity struct {
+	Subreddit string `json:"subreddit"`
+	Events    int64  `json:"events"`
+	Posts     int64  `json:"posts"`
+	Comments  int64  `json:"comments"`
+	Votes     int64  `json:"votes"`
+	Users     int64  `json:"users"`
+}
+
+// UserActivity is a user's events of every kind.
+type UserActivity struct {
+	User     string `json:"user"`
+	Events   int64  `json:"events"`
+	Posts    int64  `json:"posts"`
+	Comments int64  `json:"comments"`
+	Votes    int64  `json:"votes"`
+}
+
+// ClientActivity is the events sent from a country on a device, and how
+// many users sent them.
+type ClientActivity struct {
+	Country string `json:"country"`
+	Device  string `json:"device"`
+	Events  int64  `json:"events"`
+	Users   int64  `json:"users"`
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+)
+
+// RefreshView recomputes view, CONCURRENTLY: the new rows are worked out
+// beside the old and merged in, so readers aren't locked out meanwhile.
+func (s *postgresStore) RefreshView(ctx context.Context, view string) error {
+	if !slices.Contains(Views, view) {
+		return fmt.Errorf("no such view %q", view)
+	}
+	_, err := s.db.ExecContext(ctx, `REFRESH MATERIALIZED VIEW CONCURRENTLY `+view)
+	return err
+}
+
+// Analytics reads the top n rows of each view, and the last n minutes of
+// events_per_minute.
+func (s *postgresStore) Analytics(ctx context.Context, n int) (Analytics, error) {
+	a := Analytics{
+		EventsPerMinute: []MinuteCount{},
+		Subreddits:      []SubredditActivity{},
+		TopUsers:        []UserActivity{},
+		Clients:         []ClientActivity{},
+	}
+	for _, q := range []struct {
+		sql  string
+		scan func(scan func(dest ...any) error) error
+	}{
+		{`SELECT minute, type, events FROM events_per_minute
+		WHERE minute > (SELECT MAX(minute) FROM events_per_minute) - make_interval(mins => $1)
+		ORDER BY minute DESC, type`, func(scan func(dest ...any) error) error {
+			var m MinuteCount
+			err := scan(&m.Minute, &m.Type, &m.Events)
+			a.EventsPerMinute = append(a.EventsPerMinute, m)
+			return err
+		}},
+		{`SELECT subreddit, events, posts, comments, votes, users FROM subreddit_activity
+		ORDER BY events DESC, subreddit
+		LIMIT $1`, func(scan func(dest ...any) error) error {
+			var sa SubredditActivity
+			err := scan(&sa.Subreddit, &sa.Events, &sa.Posts, &sa.Comments, &sa.Votes, &sa.Users)
+			a.Subreddits = append(a.Subreddits, sa)
+			return err
+		}},
+		{`SELECT name, events, posts, comments, votes FROM top_users
+		ORDER BY events DESC, name
+		LIMIT $1`, func(scan func(dest ...any) error) error {
+			var u UserActivity
+			err := scan(&u.User, &u.Events, &u.Posts, &u.Comments, &u.Votes)
+			a.TopUsers = append(a.TopUsers, u)
+			return err
+		}},
+		{`SELECT country, device, events, users FROM client_activity
+		ORDER BY events DESC, country, device
+		LIMIT $1`, func(scan func(dest ...any) error) error {
+			var c ClientActivity
+			err := scan(&c.Country, &c.Device, &c.Events, &c.Users)
+			a.Clients = append(a.Clients, c)
+			return err
+		}},
+	} {
+		rows, err := s.db.QueryContext(ctx, q.sql, n)
+		if err != nil {
+			return a, err
+		}
+		for rows.Next() {
+			if err := q.scan(rows.Scan); err != nil {
+				rows.Close()
+				return a, err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return a, err
+		}
+	}
+	return a, nil
+}